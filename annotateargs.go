@@ -0,0 +1,76 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// AnnotateCallArgs names the arguments of the calls in node with inline
+// comments, the readability convention standing in for named arguments:
+//
+//	f(/* timeout= */ 5, /* retries= */ 3)
+//
+// paramNames returns the names of the parameters of a call, or false to
+// leave it alone. Arguments whose parameter is unnamed or named _ get no
+// comment. Calls spreading a variadic argument, calls whose number of
+// arguments isn't that of the names, and calls without positions are
+// skipped. Like gofmt, the printer moves the comment of an argument
+// following another one on the same line before the comma separating
+// them, dial( /* timeout= */ 5 /* retries= */, 3), only arguments starting
+// a line keep it after the comma.
+//
+// If node is a file, the comments are added to its comments, and calls
+// already holding comments between their parentheses, like annotated ones,
+// are skipped, so that annotating again changes nothing. Otherwise the
+// caller adds the comment groups returned, one per argument, to the
+// comments of the file holding node for them to be printed.
+func AnnotateCallArgs(node ast.Node, paramNames func(call *ast.CallExpr) ([]string, bool)) []*ast.CommentGroup {
+	file, _ := node.(*ast.File)
+	var added []*ast.CommentGroup
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || call.Ellipsis.IsValid() || !call.Lparen.IsValid() || len(call.Args) == 0 {
+			return true
+		}
+		if file != nil && commentedBetween(file, call.Lparen, call.Rparen) {
+			return true
+		}
+		names, ok := paramNames(call)
+		if !ok || len(names) != len(call.Args) {
+			return true
+		}
+		for i, arg := range call.Args {
+			if names[i] == "" || names[i] == "_" || !arg.Pos().IsValid() {
+				continue
+			}
+			// the printer emits a comment before the first token after its
+			// position, so it goes right before the argument
+			added = append(added, &ast.CommentGroup{List: []*ast.Comment{{
+				Slash: arg.Pos() - 1,
+				Text:  "/* " + names[i] + "= */",
+			}}})
+		}
+		return true
+	})
+
+	if file != nil && len(added) > 0 {
+		file.Comments = append(file.Comments, added...)
+		sort.Slice(file.Comments, func(i, j int) bool {
+			return file.Comments[i].Pos() < file.Comments[j].Pos()
+		})
+	}
+	return added
+}
+
+// commentedBetween reports whether a comment of f starts between the
+// positions from and to, including at from, where the comment of a first
+// argument right after the parenthesis is put.
+func commentedBetween(f *ast.File, from, to token.Pos) bool {
+	for _, cg := range f.Comments {
+		if cg.Pos() >= from && cg.Pos() < to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestAnnotateCallArgs(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f() {
+	dial(5, 3)
+	dial(/* timeout= */ 5, 3)
+	dial(args...)
+	other(5, 3)
+	dial(dial(1,
+		2), 3)
+}
+`)
+	names := func(call *ast.CallExpr) ([]string, bool) {
+		if isIdent(call.Fun, "dial") {
+			return []string{"timeout", "retries"}, true
+		}
+		return nil, false
+	}
+
+	want := `package p
+
+func f() {
+	dial( /* timeout= */ 5 /* retries= */, 3)
+	dial( /* timeout= */ 5, 3)
+	dial(args...)
+	other(5, 3)
+	dial( /* timeout= */ dial( /* timeout= */ 1,
+		/* retries= */ 2), /* retries= */ 3)
+}
+`
+	if got := AnnotateCallArgs(file, names); len(got) != 6 {
+		t.Errorf("got %d comments, want 6", len(got))
+	}
+	checkSource(t, fset, file, want)
+
+	// annotated calls are skipped
+	if got := AnnotateCallArgs(file, names); len(got) != 0 {
+		t.Errorf("got %d comments on the second run, want none", len(got))
+	}
+	checkSource(t, fset, file, want)
+}
@@ -0,0 +1,155 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// Annotation is an anchor comment like
+//
+//	//astrewrite:replace rule=foo
+//
+// marking the node following it for the walk function.
+type Annotation struct {
+	// Name is the word following the prefix, like replace.
+	Name string
+
+	// Args holds the key=value words following the name. Words without
+	// a value map to "".
+	Args map[string]string
+
+	// Comment is the comment the annotation was parsed from.
+	Comment *ast.Comment
+}
+
+// WithAnnotations parses the anchor comments starting with prefix, or
+// "astrewrite:" if prefix is empty, from the comments of the walked file
+// before the walk, and makes them available through Cursor.Annotations.
+// The walk has to start at an *ast.File.
+//
+// An anchor belongs to the outermost node starting after it, which is the
+// declaration it documents or the statement on the line below it. As the
+// walker has no file set, an anchor at the end of a line belongs to the node
+// starting after it as well. Removing an anchored node removes its anchors.
+//
+// The anchors begin-skip and end-skip mark a region of the file whose nodes
+// are never passed to the walk function and kept as they are. A region
+// without end-skip extends to the end of the file.
+func WithAnnotations(prefix string) Option {
+	if prefix == "" {
+		prefix = "astrewrite:"
+	}
+	return func(w *Walker) {
+		w.annotationPrefix = prefix
+	}
+}
+
+// annotations holds the anchors of a file.
+type annotations struct {
+	// anchored holds the annotations of the anchored nodes
+	anchored map[ast.Node][]Annotation
+
+	// groups holds the comment group of each anchor
+	groups map[*ast.Comment]*ast.CommentGroup
+
+	// skips holds the skip regions as pairs of positions
+	skips [][2]token.Pos
+}
+
+// parseAnnotations parses the anchors starting with prefix in file.
+func parseAnnotations(file *ast.File, prefix string) *annotations {
+	a := &annotations{
+		anchored: make(map[ast.Node][]Annotation),
+		groups:   make(map[*ast.Comment]*ast.CommentGroup),
+	}
+	begin := token.NoPos
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			text := strings.TrimPrefix(c.Text, "//"+prefix)
+			if text == c.Text {
+				continue
+			}
+			words := strings.Fields(text)
+			if len(words) == 0 {
+				continue
+			}
+			switch words[0] {
+			case "begin-skip":
+				if !begin.IsValid() {
+					begin = c.Pos()
+				}
+				continue
+			case "end-skip":
+				if begin.IsValid() {
+					a.skips = append(a.skips, [2]token.Pos{begin, c.End()})
+					begin = token.NoPos
+				}
+				continue
+			}
+
+			ann := Annotation{Name: words[0], Args: make(map[string]string), Comment: c}
+			for _, word := range words[1:] {
+				k, v, _ := strings.Cut(word, "=")
+				ann.Args[k] = v
+			}
+			if n := nodeAfter(file, c.End()); n != nil {
+				a.anchored[n] = append(a.anchored[n], ann)
+				a.groups[c] = cg
+			}
+		}
+	}
+	if begin.IsValid() {
+		a.skips = append(a.skips, [2]token.Pos{begin, file.FileEnd})
+	}
+	return a
+}
+
+// nodeAfter returns the outermost node of file starting at or after pos,
+// other than a comment.
+func nodeAfter(file *ast.File, pos token.Pos) ast.Node {
+	var found ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n.(type) {
+		case nil, *ast.CommentGroup, *ast.Comment:
+			return false
+		}
+		if found != nil || n.End() <= pos {
+			return false
+		}
+		if n.Pos() >= pos {
+			found = n
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// skipped reports whether node lies inside a skip region.
+func (a *annotations) skipped(node ast.Node) bool {
+	pos, end := node.Pos(), node.End()
+	if !pos.IsValid() {
+		return false
+	}
+	for _, s := range a.skips {
+		if s[0] <= pos && end <= s[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// drop removes the anchors of the removed node from their comment groups.
+func (a *annotations) drop(node ast.Node) {
+	for _, ann := range a.anchored[node] {
+		cg := a.groups[ann.Comment]
+		list := make([]*ast.Comment, 0, len(cg.List))
+		for _, c := range cg.List {
+			if c != ann.Comment {
+				list = append(list, c)
+			}
+		}
+		cg.List = list
+	}
+}
@@ -0,0 +1,85 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	src := `package p
+
+//astrewrite:begin-skip
+func f() {
+	x := 1
+	println(x)
+}
+
+//astrewrite:end-skip
+
+func g() {
+	x := 1
+	println(x)
+}
+
+func h() {
+	//astrewrite:replace rule=trace verbose
+	println("trace")
+	println("kept")
+}
+`
+	fset, file := parse(t, src)
+
+	var w *Walker
+	var anns []Annotation
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if n.Name == "x" {
+				n.Name = "y"
+			}
+		case *ast.BasicLit:
+			if a := w.Cursor().Annotations(); len(a) > 0 {
+				anns = a
+			}
+		case *ast.ExprStmt:
+			if a := w.Cursor().Annotations(); len(a) > 0 && a[0].Name == "replace" {
+				return nil, true
+			}
+		}
+		return n, true
+	}, WithAnnotations(""))
+
+	w.Walk(file)
+	// removed statements leave blank lines behind
+	checkSource(t, fset, file, `package p
+
+//astrewrite:begin-skip
+func f() {
+	x := 1
+	println(x)
+}
+
+//astrewrite:end-skip
+
+func g() {
+	y := 1
+	println(y)
+}
+
+func h() {
+
+	println("kept")
+}
+`)
+
+	// the literal "trace" got the annotation of its statement
+	if len(anns) != 1 {
+		t.Fatalf("got %d annotations, want 1", len(anns))
+	}
+	if a := anns[0]; a.Name != "replace" || len(a.Args) != 2 || a.Args["rule"] != "trace" || a.Args["verbose"] != "" {
+		t.Errorf("got annotation %q %v", a.Name, a.Args)
+	}
+	if w.Cursor() != nil {
+		t.Error("got a cursor after the walk")
+	}
+}
@@ -0,0 +1,281 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"sort"
+)
+
+// ApplyCompat traverses the tree rooted at root like astutil.Apply of
+// golang.org/x/tools/go/ast/astutil, to ease moving code written for it,
+// and returns the possibly modified tree. pre and post are called with the
+// same Cursor methods, for the same nodes in the same order: pre before the
+// children of a node, skipping them and post if it returns false, and post
+// after them, ending the traversal if it returns false. Like with Apply,
+// they are called for unset optional children too, with a nil Node, except
+// for the type parameters of a FuncType or TypeSpec. Nodes passed to
+// Replace, InsertBefore or InsertAfter aren't traversed.
+//
+// Two things intentionally differ from Apply, where its behavior leaves
+// malformed or misleading output:
+//
+//   - Delete clears the comments of the deleted node, as the walker does
+//     for removed nodes, so they aren't printed as stray comments where
+//     the node used to be.
+//   - A FieldList emptied by deletes is cleared from its parent if it holds
+//     the type parameters of a FuncType or TypeSpec, or the results of a
+//     FuncType, instead of being printed as empty brackets. This happens
+//     after post was called for it.
+//
+// Unlike Walk, removing a child that its parent can't do without doesn't
+// remove the parent; the edits are applied as requested.
+func ApplyCompat(root ast.Node, pre, post func(*Cursor) bool) (result ast.Node) {
+	parent := &struct{ ast.Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != abortApply {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+	a := &application{pre: pre, post: post}
+	a.apply(parent, "Node", nil, root)
+	return
+}
+
+// abortApply is panicked with to end ApplyCompat once post returns false.
+var abortApply = new(int)
+
+type application struct {
+	pre, post func(*Cursor) bool
+
+	// cascade makes deletes follow RemovalBehavior, during WalkCursor
+	cascade bool
+
+	// stack holds the ancestors of the node being applied
+	stack []ast.Node
+}
+
+type applyIter struct {
+	index, step int
+}
+
+func (a *application) apply(parent ast.Node, name string, iter *applyIter, n ast.Node) (propagate bool) {
+	if isNil(n) {
+		n = nil
+	}
+	c := &Cursor{a: a, parent: parent, name: name, iter: iter, node: n}
+	if a.pre != nil && !a.pre(c) || c.edited {
+		return c.propagate
+	}
+
+	fields := -1
+	if fl, ok := n.(*ast.FieldList); ok {
+		fields = len(fl.List)
+	}
+	if n != nil {
+		a.stack = append(a.stack, n)
+		propagate = a.applyChildren(n)
+		a.stack = a.stack[:len(a.stack)-1]
+	}
+	if propagate {
+		// a child n can't do without was deleted
+		c.Delete()
+		return c.propagate
+	}
+
+	if a.post != nil && !a.post(c) {
+		panic(abortApply)
+	}
+	if fields > 0 && len(n.(*ast.FieldList).List) == 0 && !a.cascade {
+		clearEmptied(parent, name)
+	}
+	return false
+}
+
+// applyChildren applies the children of n. It returns true if n has to be
+// deleted because a child it can't do without was deleted, which only
+// happens during WalkCursor.
+func (a *application) applyChildren(n ast.Node) bool {
+	if pkg, ok := n.(*ast.Package); ok {
+		names := make([]string, 0, len(pkg.Files))
+		for name := range pkg.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			a.apply(pkg, name, nil, pkg.Files[name])
+		}
+		return false
+	}
+
+	v := reflect.ValueOf(n).Elem()
+	edges, ok := schema[v.Type().Name()]
+	if !ok {
+		panic(fmt.Sprintf("astrewrite: ApplyCompat: unexpected node type %T", n))
+	}
+	for _, e := range edges {
+		if e.Kind == EdgeSlice {
+			if a.applyList(n, e.Name) {
+				return true
+			}
+			continue
+		}
+		child, _ := v.FieldByName(e.Name).Interface().(ast.Node)
+		if e.Name == "TypeParams" && isNil(child) {
+			continue
+		}
+		if a.apply(n, e.Name, nil, child) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *application) applyList(parent ast.Node, name string) bool {
+	iter := &applyIter{}
+	for {
+		v := reflect.ValueOf(parent).Elem().FieldByName(name)
+		if iter.index >= v.Len() {
+			break
+		}
+		x, _ := v.Index(iter.index).Interface().(ast.Node)
+		iter.step = 1
+		if a.apply(parent, name, iter, x) {
+			return true
+		}
+		iter.index += iter.step
+	}
+	return false
+}
+
+// clearEmptied clears the field name of parent holding an emptied FieldList
+// if the FieldList is optional there.
+func clearEmptied(parent ast.Node, name string) {
+	switch parent.(type) {
+	case *ast.FuncType:
+		if name != "TypeParams" && name != "Results" {
+			return
+		}
+	case *ast.TypeSpec:
+		if name != "TypeParams" {
+			return
+		}
+	default:
+		return
+	}
+	f := reflect.ValueOf(parent).Elem().FieldByName(name)
+	f.Set(reflect.Zero(f.Type()))
+}
+
+// Name returns the name of the field of Parent holding Node, like "Cond",
+// or the file name if Node is a file of an ast.Package. It's only known
+// during ApplyCompat and WalkCursor, and "" otherwise.
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Index returns the index of Node in the slice of Parent holding it, or a
+// negative value if it's not held by a slice or the cursor isn't one of
+// ApplyCompat or WalkCursor. InsertBefore increments the index of the current node.
+func (c *Cursor) Index() int {
+	if c.iter == nil {
+		return -1
+	}
+	return c.iter.index
+}
+
+// field returns the field of Parent holding Node.
+func (c *Cursor) field() reflect.Value {
+	if c.w != nil {
+		panic("astrewrite: Cursor edits are only supported during ApplyCompat and WalkCursor")
+	}
+	return reflect.ValueOf(c.parent).Elem().FieldByName(c.name)
+}
+
+// Replace replaces Node by n during ApplyCompat. n isn't traversed, and
+// Node keeps returning the replaced node.
+func (c *Cursor) Replace(n ast.Node) {
+	c.edited = c.a != nil && c.a.cascade
+	if _, ok := c.node.(*ast.File); ok {
+		if pkg, ok := c.parent.(*ast.Package); ok {
+			file, ok := n.(*ast.File)
+			if !ok {
+				panic("astrewrite: attempt to replace *ast.File with non-*ast.File")
+			}
+			pkg.Files[c.name] = file
+			return
+		}
+	}
+	v := c.field()
+	if i := c.Index(); i >= 0 {
+		v = v.Index(i)
+	}
+	v.Set(reflect.ValueOf(n))
+}
+
+// Delete deletes Node from the slice of Parent holding it during
+// ApplyCompat, or the file from the Files of its ast.Package, and clears
+// its comments. It panics if Node isn't held by a slice. During WalkCursor,
+// Node may be held by any field, and the deletion follows RemovalBehavior
+// like removals of Walk.
+func (c *Cursor) Delete() {
+	if !isNil(c.node) {
+		nukeComments(c.node)
+	}
+	c.edited = c.a != nil && c.a.cascade
+	if _, ok := c.node.(*ast.File); ok {
+		if pkg, ok := c.parent.(*ast.Package); ok {
+			delete(pkg.Files, c.name)
+			return
+		}
+	}
+	i := c.Index()
+	if i < 0 && c.edited {
+		c.deleteField()
+		return
+	}
+	if i < 0 {
+		panic("astrewrite: Delete node not contained in slice")
+	}
+	v := c.field()
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+	if c.edited && l == 1 && RemovalBehavior(reflect.TypeOf(c.parent).Elem().Name(), c.name) == DropOrPropagate {
+		c.propagate = true
+	}
+}
+
+// InsertAfter inserts n after Node in the slice of Parent holding it during
+// ApplyCompat. n isn't traversed. It panics if Node isn't held by a slice.
+func (c *Cursor) InsertAfter(n ast.Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("astrewrite: InsertAfter node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(reflect.ValueOf(n))
+	c.iter.step++
+}
+
+// InsertBefore inserts n before Node in the slice of Parent holding it
+// during ApplyCompat. n isn't traversed. It panics if Node isn't held by a
+// slice.
+func (c *Cursor) InsertBefore(n ast.Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("astrewrite: InsertBefore node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(reflect.ValueOf(n))
+	c.iter.index++
+}
@@ -0,0 +1,428 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// applyCursor is the method set of astutil.Cursor, which the cases below
+// are written against.
+type applyCursor interface {
+	Node() ast.Node
+	Parent() ast.Node
+	Name() string
+	Index() int
+	Replace(n ast.Node)
+	Delete()
+	InsertAfter(n ast.Node)
+	InsertBefore(n ast.Node)
+}
+
+var _ applyCursor = (*Cursor)(nil)
+
+type applyCase struct {
+	name      string
+	src       string
+	pre, post func(c applyCursor, trace *[]string) bool
+
+	// want is the output of astutil.Apply of golang.org/x/tools, and
+	// compat that of ApplyCompat where it intentionally differs
+	want, compat string
+}
+
+// applyCases are representative transformations, whose expected outputs
+// were recorded with astutil.Apply, as x/tools isn't a dependency.
+var applyCases = []applyCase{
+	{
+		name: "trace",
+		src: `package p
+
+// F adds.
+func F[T any](a, b int) (int, error) {
+	if a > b {
+		return a + b, nil
+	}
+	return 0, nil
+}
+`,
+		want: `package p
+
+// F adds.
+func F[T any](a, b int) (int, error) {
+	if a > b {
+		return a + b, nil
+	}
+	return 0, nil
+}
+---
+pre *ast.File Node -1
+pre <nil> Doc -1
+post <nil> Doc -1
+pre *ast.Ident Name -1
+post *ast.Ident Name -1
+pre *ast.FuncDecl Decls 0
+pre *ast.CommentGroup Doc -1
+pre *ast.Comment List 0
+post *ast.Comment List 0
+post *ast.CommentGroup Doc -1
+pre <nil> Recv -1
+post <nil> Recv -1
+pre *ast.Ident Name -1
+post *ast.Ident Name -1
+pre *ast.FuncType Type -1
+pre *ast.FieldList TypeParams -1
+pre *ast.Field List 0
+pre <nil> Doc -1
+post <nil> Doc -1
+pre *ast.Ident Names 0
+post *ast.Ident Names 0
+pre *ast.Ident Type -1
+post *ast.Ident Type -1
+pre <nil> Tag -1
+post <nil> Tag -1
+pre <nil> Comment -1
+post <nil> Comment -1
+post *ast.Field List 0
+post *ast.FieldList TypeParams -1
+pre *ast.FieldList Params -1
+pre *ast.Field List 0
+pre <nil> Doc -1
+post <nil> Doc -1
+pre *ast.Ident Names 0
+post *ast.Ident Names 0
+pre *ast.Ident Names 1
+post *ast.Ident Names 1
+pre *ast.Ident Type -1
+post *ast.Ident Type -1
+pre <nil> Tag -1
+post <nil> Tag -1
+pre <nil> Comment -1
+post <nil> Comment -1
+post *ast.Field List 0
+post *ast.FieldList Params -1
+pre *ast.FieldList Results -1
+pre *ast.Field List 0
+pre <nil> Doc -1
+post <nil> Doc -1
+pre *ast.Ident Type -1
+post *ast.Ident Type -1
+pre <nil> Tag -1
+post <nil> Tag -1
+pre <nil> Comment -1
+post <nil> Comment -1
+post *ast.Field List 0
+pre *ast.Field List 1
+pre <nil> Doc -1
+post <nil> Doc -1
+pre *ast.Ident Type -1
+post *ast.Ident Type -1
+pre <nil> Tag -1
+post <nil> Tag -1
+pre <nil> Comment -1
+post <nil> Comment -1
+post *ast.Field List 1
+post *ast.FieldList Results -1
+post *ast.FuncType Type -1
+pre *ast.BlockStmt Body -1
+pre *ast.IfStmt List 0
+pre <nil> Init -1
+post <nil> Init -1
+pre *ast.BinaryExpr Cond -1
+pre *ast.Ident X -1
+post *ast.Ident X -1
+pre *ast.Ident Y -1
+post *ast.Ident Y -1
+post *ast.BinaryExpr Cond -1
+pre *ast.BlockStmt Body -1
+pre *ast.ReturnStmt List 0
+pre *ast.BinaryExpr Results 0
+pre *ast.Ident X -1
+post *ast.Ident X -1
+pre *ast.Ident Y -1
+post *ast.Ident Y -1
+post *ast.BinaryExpr Results 0
+pre *ast.Ident Results 1
+post *ast.Ident Results 1
+post *ast.ReturnStmt List 0
+post *ast.BlockStmt Body -1
+pre <nil> Else -1
+post <nil> Else -1
+post *ast.IfStmt List 0
+pre *ast.ReturnStmt List 1
+pre *ast.BasicLit Results 0
+post *ast.BasicLit Results 0
+pre *ast.Ident Results 1
+post *ast.Ident Results 1
+post *ast.ReturnStmt List 1
+post *ast.BlockStmt Body -1
+post *ast.FuncDecl Decls 0
+post *ast.File Node -1
+`,
+		pre: func(c applyCursor, trace *[]string) bool {
+			*trace = append(*trace, fmt.Sprintf("pre %T %s %d", c.Node(), c.Name(), c.Index()))
+			return true
+		},
+		post: func(c applyCursor, trace *[]string) bool {
+			*trace = append(*trace, fmt.Sprintf("post %T %s %d", c.Node(), c.Name(), c.Index()))
+			return true
+		},
+	},
+	{
+		name: "rename",
+		src: `package p
+
+func f(a int) int {
+	b := a * 2
+	return a + b
+}
+`,
+		want: `package p
+
+func f(x int) int {
+	b := x * 2
+	return x + b
+}
+`,
+		pre: func(c applyCursor, _ *[]string) bool {
+			if id, ok := c.Node().(*ast.Ident); ok && id.Name == "a" {
+				c.Replace(&ast.Ident{NamePos: id.NamePos, Name: "x"})
+			}
+			return true
+		},
+	},
+	{
+		name: "fold",
+		src: `package p
+
+var x = 1 + 2*3 + (4 - 1)
+`,
+		want: `package p
+
+var x = 10
+`,
+		post: func(c applyCursor, _ *[]string) bool {
+			if bin, ok := c.Node().(*ast.BinaryExpr); ok {
+				x, okX := ast.Unparen(bin.X).(*ast.BasicLit)
+				y, okY := ast.Unparen(bin.Y).(*ast.BasicLit)
+				if okX && okY {
+					a, _ := strconv.Atoi(x.Value)
+					b, _ := strconv.Atoi(y.Value)
+					v := a + b
+					switch bin.Op {
+					case token.SUB:
+						v = a - b
+					case token.MUL:
+						v = a * b
+					}
+					c.Replace(&ast.BasicLit{ValuePos: bin.Pos(), Kind: token.INT, Value: strconv.Itoa(v)})
+				}
+			}
+			return true
+		},
+	},
+	{
+		name: "insert",
+		src: `package p
+
+func f() int {
+	g()
+	return 1
+}
+`,
+		want: `package p
+
+func f() int {
+	g()
+	before()
+	return 1
+	after()
+}
+`,
+		pre: func(c applyCursor, _ *[]string) bool {
+			if _, ok := c.Node().(*ast.ReturnStmt); ok && c.Index() >= 0 {
+				c.InsertBefore(&ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("before")}})
+				c.InsertAfter(&ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("after")}})
+			}
+			return true
+		},
+	},
+	{
+		name: "skip and abort",
+		src: `package p
+
+func f() {
+	a()
+	func() { b() }()
+	c()
+	d()
+}
+`,
+		want: `package p
+
+func f() {
+	a()
+	func() { b() }()
+	c()
+	d()
+}
+---
+p
+f
+a
+c
+`,
+		pre: func(c applyCursor, trace *[]string) bool {
+			if _, ok := c.Node().(*ast.FuncLit); ok {
+				return false
+			}
+			if id, ok := c.Node().(*ast.Ident); ok {
+				*trace = append(*trace, id.Name)
+			}
+			return true
+		},
+		post: func(c applyCursor, _ *[]string) bool {
+			id, ok := c.Node().(*ast.Ident)
+			return !ok || id.Name != "c"
+		},
+	},
+	{
+		name: "delete statements",
+		src: `package p
+
+func f() {
+	// log the start
+	debug("start")
+	work() // the actual work
+	debug("end") // log the end
+}
+`,
+		want: `package p
+
+func f() {
+	// log the start
+
+	work() // the actual work
+	// log the end
+}
+`,
+		pre: func(c applyCursor, _ *[]string) bool {
+			if es, ok := c.Node().(*ast.ExprStmt); ok {
+				if call, ok := es.X.(*ast.CallExpr); ok && isIdent(call.Fun, "debug") {
+					c.Delete()
+				}
+			}
+			return true
+		},
+	},
+	{
+		name: "delete fields with comments",
+		src: `package p
+
+type T struct {
+	// debug enables tracing.
+	debug bool
+	n     int
+	trace []string // collected lines
+}
+`,
+		want: `package p
+
+type T struct {
+	// debug enables tracing.
+
+	n int
+	// collected lines
+}
+`,
+		pre: func(c applyCursor, _ *[]string) bool {
+			if f, ok := c.Node().(*ast.Field); ok && f.Names[0].Name != "n" {
+				c.Delete()
+			}
+			return true
+		},
+		// ApplyCompat clears the comments of deleted nodes
+		compat: `package p
+
+type T struct {
+	n int
+}
+`,
+	},
+	{
+		name: "delete type parameters",
+		src: `package p
+
+func f[T any](x int) (err error) { return nil }
+
+type S[T any] struct{ n int }
+`,
+		want: `package p
+
+func f[](x int) { return nil }
+
+type S[] struct{ n int }
+`,
+		pre: func(c applyCursor, _ *[]string) bool {
+			if f, ok := c.Node().(*ast.Field); ok {
+				if _, ok := c.Parent().(*ast.FieldList); ok && (len(f.Names) == 1 && f.Names[0].Name == "T" || isIdent(f.Type, "error")) {
+					c.Delete()
+				}
+			}
+			return true
+		},
+		// ApplyCompat clears emptied type parameter and result lists
+		compat: `package p
+
+func f(x int) { return nil }
+
+type S struct{ n int }
+`,
+	},
+}
+
+func TestApplyCompat(t *testing.T) {
+	for _, tc := range applyCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := runApplyCase(t, tc, func(root ast.Node, pre, post func(applyCursor) bool) ast.Node {
+				var preFn, postFn func(*Cursor) bool
+				if pre != nil {
+					preFn = func(c *Cursor) bool { return pre(c) }
+				}
+				if post != nil {
+					postFn = func(c *Cursor) bool { return post(c) }
+				}
+				return ApplyCompat(root, preFn, postFn)
+			})
+			want := tc.want
+			if tc.compat != "" {
+				want = tc.compat
+			}
+			if got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// runApplyCase runs tc with apply and returns the printed result, followed
+// by the trace if there is one.
+func runApplyCase(t *testing.T, tc applyCase, apply func(root ast.Node, pre, post func(applyCursor) bool) ast.Node) string {
+	fset, file := parse(t, tc.src)
+	var trace []string
+	var pre, post func(applyCursor) bool
+	if tc.pre != nil {
+		pre = func(c applyCursor) bool { return tc.pre(c, &trace) }
+	}
+	if tc.post != nil {
+		post = func(c applyCursor) bool { return tc.post(c, &trace) }
+	}
+	out := render(t, fset, apply(file, pre, post))
+	if len(trace) > 0 {
+		out += "---\n" + strings.Join(trace, "\n") + "\n"
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// ConvertAssertions rewrites the hand-written checks in the body of fn, a
+// function of file, into calls of the assertion library with import path
+// lib, which is expected to follow testify's assert package. A check is an
+// if statement without init and else whose condition is a comparison and
+// whose body is a single call of Error, Errorf, Fatal or Fatalf on a
+// parameter of fn of type *testing.T or testing.TB:
+//
+//	if got != want {
+//		t.Errorf("got %v, want %v", got, want)
+//	}
+//
+// becomes assert.Equal(t, want, got). The right operand of the comparison is
+// taken as the expected value, unless the left one is a literal. == turns
+// into NotEqual, and comparisons with nil into Nil and NotNil. Comparisons
+// with a literal use EqualValues and NotEqualValues, since the type of the
+// literal depends on the other operand. Messages are
+// dropped, as the library reports both values. Since the library only marks
+// the test as failed, the Fatal variants become
+//
+//	if !assert.Equal(t, want, got) {
+//		t.FailNow()
+//	}
+//
+// The import of lib is added to file if needed, and the number of converted
+// checks is returned.
+func ConvertAssertions(file *ast.File, fn *ast.FuncDecl, lib string) int {
+	if fn.Body == nil {
+		return 0
+	}
+
+	pkg := defaultImportName(lib)
+	for _, imp := range file.Imports {
+		if importPath(imp) == lib && imp.Name != nil {
+			pkg = imp.Name.Name
+		}
+	}
+
+	// the parameters of type *testing.T or testing.TB
+	testing, _ := importedAs(file, "testing")
+	params := make(map[string]*ast.Field)
+	for _, field := range fn.Type.Params.List {
+		typ := field.Type
+		if star, ok := typ.(*ast.StarExpr); ok && isQualified(star.X, testing, "T") || isQualified(typ, testing, "TB") {
+			for _, name := range field.Names {
+				params[name.Name] = field
+			}
+		}
+	}
+	isT := func(id *ast.Ident) bool {
+		field, ok := params[id.Name]
+		return ok && (id.Obj == nil || id.Obj.Decl == field)
+	}
+
+	n := 0
+	Walk(fn.Body, func(node ast.Node) (ast.Node, bool) {
+		ifs, ok := node.(*ast.IfStmt)
+		if !ok {
+			return node, true
+		}
+		stmt := convertAssertion(ifs, pkg, isT)
+		if stmt == nil {
+			return node, true
+		}
+		n++
+		return stmt, false
+	})
+
+	if n > 0 {
+		AddImport(file, lib)
+	}
+	return n
+}
+
+// convertAssertion returns the statement replacing the check ifs with a call
+// of pkg, or nil if ifs isn't a check on a variable for which isT is true.
+func convertAssertion(ifs *ast.IfStmt, pkg string, isT func(*ast.Ident) bool) ast.Stmt {
+	if ifs.Init != nil || ifs.Else != nil || len(ifs.Body.List) != 1 {
+		return nil
+	}
+	cmp, ok := ifs.Cond.(*ast.BinaryExpr)
+	if !ok || (cmp.Op != token.EQL && cmp.Op != token.NEQ) {
+		return nil
+	}
+	es, ok := ifs.Body.List[0].(*ast.ExprStmt)
+	if !ok {
+		return nil
+	}
+	call, ok := es.X.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	t, ok := sel.X.(*ast.Ident)
+	if !ok || !isT(t) {
+		return nil
+	}
+	var fatal bool
+	switch sel.Sel.Name {
+	case "Error", "Errorf":
+	case "Fatal", "Fatalf":
+		fatal = true
+	default:
+		return nil
+	}
+
+	got, want := cmp.X, cmp.Y
+	if isLiteral(got) || isNilIdent(got) {
+		got, want = want, got
+	}
+
+	var name string
+	args := []ast.Expr{ast.NewIdent(t.Name)}
+	switch {
+	case isNilIdent(want) && cmp.Op == token.NEQ:
+		name, args = "Nil", append(args, got)
+	case isNilIdent(want):
+		name, args = "NotNil", append(args, got)
+	case cmp.Op == token.NEQ:
+		name, args = "Equal", append(args, want, got)
+	default:
+		name, args = "NotEqual", append(args, want, got)
+	}
+	if isLiteral(want) {
+		// an untyped literal takes the type of got in the comparison,
+		// while Equal would compare it as an int, float64 or string
+		name += "Values"
+	}
+	assertion := &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent(name)},
+		Args: args,
+	}
+	at := func(pos token.Pos) func(token.Pos) token.Pos {
+		return func(token.Pos) token.Pos { return pos }
+	}
+	mapPositions(assertion, at(ifs.If))
+	assertion.Ellipsis = token.NoPos
+
+	if !fatal {
+		return &ast.ExprStmt{X: assertion}
+	}
+	failNow := &ast.CallExpr{Fun: &ast.SelectorExpr{X: ast.NewIdent(t.Name), Sel: ast.NewIdent("FailNow")}}
+	mapPositions(failNow, at(es.Pos()))
+	failNow.Ellipsis = token.NoPos
+	return &ast.IfStmt{
+		If:   ifs.If,
+		Cond: &ast.UnaryExpr{OpPos: ifs.If, Op: token.NOT, X: assertion},
+		Body: &ast.BlockStmt{
+			Lbrace: ifs.Body.Lbrace,
+			List:   []ast.Stmt{&ast.ExprStmt{X: failNow}},
+			Rbrace: ifs.Body.Rbrace,
+		},
+	}
+}
+
+// isNilIdent reports whether e is the identifier nil.
+func isNilIdent(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "nil"
+}
@@ -0,0 +1,111 @@
+package astrewrite
+
+import "testing"
+
+func TestConvertAssertions(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "testing"
+
+func TestF(t *testing.T) {
+	got := F()
+	if got != 3 {
+		t.Errorf("got %d, want 3", got)
+	}
+	if err := G(); err != nil {
+		t.Fatal(err)
+	}
+	err := G()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == want {
+		t.Error("unchanged")
+	}
+	if got != want {
+		t.Log("different")
+	}
+	if got < want {
+		t.Errorf("too small")
+	}
+	if got != want {
+		t.Errorf("got %d, want %d", got, want)
+		return
+	}
+	if got != want {
+		log.Fatalf("bad")
+	}
+}
+`)
+
+	n := ConvertAssertions(file, findFunc(file, "TestF"), "github.com/stretchr/testify/assert")
+	if n != 3 {
+		t.Errorf("converted %d checks, want 3", n)
+	}
+	// the lines of the replaced checks are left blank
+	checkSource(t, fset, file, `package p
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestF(t *testing.T) {
+	got := F()
+	assert.EqualValues(t, 3, got)
+
+	if err := G(); err != nil {
+		t.Fatal(err)
+	}
+	err := G()
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.NotEqual(t, want, got)
+
+	if got != want {
+		t.Log("different")
+	}
+	if got < want {
+		t.Errorf("too small")
+	}
+	if got != want {
+		t.Errorf("got %d, want %d", got, want)
+		return
+	}
+	if got != want {
+		log.Fatalf("bad")
+	}
+}
+`)
+}
+
+func TestConvertAssertionsTB(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "testing"
+
+func check(tb testing.TB, got int64) {
+	if got != -1 {
+		tb.Errorf("got %d", got)
+	}
+	tb.Log("checked")
+}
+`)
+	if n := ConvertAssertions(file, findFunc(file, "check"), "github.com/stretchr/testify/assert"); n != 1 {
+		t.Errorf("converted %d checks, want 1", n)
+	}
+	checkSource(t, fset, file, `package p
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func check(tb testing.TB, got int64) {
+	assert.EqualValues(tb, -1, got)
+
+	tb.Log("checked")
+}
+`)
+}
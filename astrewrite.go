@@ -1,14 +1,14 @@
 package astrewrite
 
 import (
-	"fmt"
 	"go/ast"
 	"reflect"
+	"sort"
 )
 
 // WalkFunc describes a function to be called for each node during a Walk. The
-// returned node can be used to rewrite the AST. Returning nil will remove the node.
-// Walking stops if the returned bool is false.
+// returned node can be used to rewrite the AST. Returning nil or Remove will
+// remove the node. Walking stops if the returned bool is false.
 type WalkFunc func(ast.Node) (ast.Node, bool)
 
 func isNil(v interface{}) bool {
@@ -22,374 +22,200 @@ func isNil(v interface{}) bool {
 // followed by a call of fn(nil). The returned node of fn can be used to
 // rewrite the passed node to fn. Panics if the returned type is not the same
 // type as the original one.
-func Walk(node ast.Node, fn WalkFunc) (ret ast.Node) {
-	if isNil(node) {
-		return node
-	}
-	rewritten, ok := fn(node)
-	if !ok {
-		return rewritten
-	}
-
-	// walk children
-	// (the order of the cases matches the order
-	// of the corresponding node types in ast.go)
-	switch n := node.(type) {
-	// Comments and fields
-	case *ast.Comment:
-		// nothing to do
-
-	case *ast.CommentGroup:
-		out := n.List[:0]
-		for _, c := range n.List {
-			if c, _ = Walk(c, fn).(*ast.Comment); c != nil {
-				out = append(out, c)
-			}
-		}
-		n.List = out
-
-	case *ast.Field:
-		n.Names = walkIdentList(n.Names, fn)
-		if t, ok := Walk(n.Type, fn).(ast.Expr); ok {
-			n.Type = t
-		} else {
-			return
-		}
-
-		if n.Tag != nil {
-			n.Tag, _ = Walk(n.Tag, fn).(*ast.BasicLit)
-		}
-
-		if n.Doc != nil {
-			n.Doc, _ = Walk(n.Doc, fn).(*ast.CommentGroup)
-		}
-		if n.Comment != nil {
-			n.Comment, _ = Walk(n.Comment, fn).(*ast.CommentGroup)
-		}
-
-	case *ast.FieldList:
-		if len(n.List) == 0 {
-			break
-		}
-		out := n.List[:0]
-		for _, f := range n.List {
-			if v, ok := Walk(f, fn).(*ast.Field); ok {
-				out = append(out, v)
-			} else {
-				nukeComments(f)
-			}
-		}
-		if n.List = out; len(n.List) == 0 {
-			return
-		}
-
-	// Expressions
-	case *ast.BadExpr, *ast.Ident, *ast.BasicLit:
-		// nothing to do
-
-	case *ast.Ellipsis:
-		if v, ok := Walk(n.Elt, fn).(ast.Expr); ok {
-			n.Elt = v
-		} else {
-			return
-		}
-
-	case *ast.FuncLit:
-		if t, ok := Walk(n.Type, fn).(*ast.FuncType); ok {
-			n.Type = t
-		} else {
-			return
-		}
-
-		n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
-
-	case *ast.CompositeLit:
-		if n.Type != nil {
-			n.Type, _ = Walk(n.Type, fn).(ast.Expr)
-		}
-		n.Elts = walkExprList(n.Elts, fn)
-
-	case *ast.ParenExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-
-	case *ast.SelectorExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-		n.Sel = Walk(n.Sel, fn).(*ast.Ident)
-
-	case *ast.IndexExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-		n.Index = Walk(n.Index, fn).(ast.Expr)
-
-	case *ast.SliceExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-		if n.Low != nil {
-			n.Low = Walk(n.Low, fn).(ast.Expr)
-		}
-		if n.High != nil {
-			n.High = Walk(n.High, fn).(ast.Expr)
-		}
-		if n.Max != nil {
-			n.Max = Walk(n.Max, fn).(ast.Expr)
-		}
-
-	case *ast.TypeAssertExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-		if n.Type != nil {
-			n.Type = Walk(n.Type, fn).(ast.Expr)
-		}
-
-	case *ast.CallExpr:
-		if n.Fun, _ = Walk(n.Fun, fn).(ast.Expr); n.Fun == nil {
-			return
-		}
-		n.Args = walkExprList(n.Args, fn)
-
-	case *ast.StarExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-
-	case *ast.UnaryExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-
-	case *ast.BinaryExpr:
-		n.X = Walk(n.X, fn).(ast.Expr)
-		n.Y = Walk(n.Y, fn).(ast.Expr)
-
-	case *ast.KeyValueExpr:
-		n.Key = Walk(n.Key, fn).(ast.Expr)
-		n.Value = Walk(n.Value, fn).(ast.Expr)
-
-	// Types
-	case *ast.ArrayType:
-		if v, ok := Walk(n.Len, fn).(ast.Expr); ok {
-			n.Len = v
-		}
-		if v, ok := Walk(n.Elt, fn).(ast.Expr); ok {
-			n.Elt = v
-		} else {
-			return
-		}
-
-	case *ast.StructType:
-		if n.Fields, _ = Walk(n.Fields, fn).(*ast.FieldList); n.Fields == nil {
-			return
-		}
-
-	case *ast.FuncType:
-		// allow changing the params and/or results or completely removing them
-		if n.Params != nil {
-			n.Params, _ = Walk(n.Params, fn).(*ast.FieldList)
-		}
-		if n.Results != nil {
-			n.Results, _ = Walk(n.Results, fn).(*ast.FieldList)
-		}
-
-	case *ast.InterfaceType:
-		n.Methods, _ = Walk(n.Methods, fn).(*ast.FieldList)
-
-	case *ast.MapType:
-		if n.Key, _ = Walk(n.Key, fn).(ast.Expr); n.Key == nil {
-			return
-		}
-		if n.Value, _ = Walk(n.Value, fn).(ast.Expr); n.Value == nil {
-			return
-		}
-
-	case *ast.ChanType:
-		if n.Value, _ = Walk(n.Value, fn).(ast.Expr); n.Value == nil {
-			return
-		}
+//
+// node doesn't need to be part of a file: any node, like a lone
+// *ast.Field, can be the root of a walk. Removing the root, or a child it
+// can't do without, makes Walk return nil.
+func Walk(node ast.Node, fn WalkFunc) ast.Node {
+	w := &walker{Walker: &Walker{fn: fn}}
+	return w.walk(node)
+}
 
-	// Statements
-	case *ast.BadStmt:
-		// nothing to do
+// WalkErrFunc is like WalkFunc, but can fail.
+type WalkErrFunc func(ast.Node) (ast.Node, bool, error)
 
-	case *ast.DeclStmt:
-		if n.Decl, _ = Walk(n.Decl, fn).(ast.Decl); n.Decl == nil {
-			return
+// WalkErr is like Walk, but stops calling fn once it returns an error and
+// returns that error. The node fn failed on is kept as it was, but earlier
+// changes stay in place, so the tree may be partially rewritten.
+func WalkErr(node ast.Node, fn WalkErrFunc) (ast.Node, error) {
+	var err error
+	rewritten := Walk(node, func(n ast.Node) (ast.Node, bool) {
+		if err != nil {
+			return n, false
 		}
-
-	case *ast.EmptyStmt:
-		// nothing to do
-
-	case *ast.LabeledStmt:
-		n.Label = Walk(n.Label, fn).(*ast.Ident)
-		n.Stmt = Walk(n.Stmt, fn).(ast.Stmt)
-
-	case *ast.ExprStmt:
-		if n.X, _ = Walk(n.X, fn).(ast.Expr); n.X == nil {
-			return
+		r, ok, e := fn(n)
+		if e != nil {
+			err = e
+			return n, false
 		}
+		return r, ok
+	})
+	return rewritten, err
+}
 
-	case *ast.SendStmt:
-		n.Chan = Walk(n.Chan, fn).(ast.Expr)
-		n.Value = Walk(n.Value, fn).(ast.Expr)
-
-	case *ast.IncDecStmt:
-		n.X = Walk(n.X, fn).(ast.Expr)
+// WalkBody walks the body of fn like Walk and never offers the receiver,
+// name or type of fn to body, so that rules meant for bodies can't change the
+// signature. Removing the body turns fn into a declaration without body.
+func WalkBody(fn *ast.FuncDecl, body WalkFunc) {
+	if fn.Body == nil {
+		return
+	}
+	fn.Body, _ = Walk(fn.Body, body).(*ast.BlockStmt)
+}
 
-	case *ast.AssignStmt:
-		n.Lhs = walkExprList(n.Lhs, fn)
-		n.Rhs = walkExprList(n.Rhs, fn)
+// WalkStmtList walks each statement of list like Walk and returns the
+// rewritten list, without the statements that were removed. It reuses the
+// backing array of list, so list shouldn't be used afterwards.
+func WalkStmtList(list []ast.Stmt, fn WalkFunc) []ast.Stmt {
+	w := &walker{Walker: &Walker{fn: fn}}
+	return walkNodes(w, list)
+}
 
-	case *ast.GoStmt:
-		n.Call = Walk(n.Call, fn).(*ast.CallExpr)
+// WalkExprList is like WalkStmtList for a list of expressions, like the
+// arguments of a call.
+func WalkExprList(list []ast.Expr, fn WalkFunc) []ast.Expr {
+	w := &walker{Walker: &Walker{fn: fn}}
+	return walkNodes(w, list)
+}
 
-	case *ast.DeferStmt:
-		n.Call = Walk(n.Call, fn).(*ast.CallExpr)
+// WalkDeclList is like WalkStmtList for a list of declarations, like the
+// declarations of a file.
+func WalkDeclList(list []ast.Decl, fn WalkFunc) []ast.Decl {
+	w := &walker{Walker: &Walker{fn: fn}}
+	return walkNodes(w, list)
+}
 
-	case *ast.ReturnStmt:
-		n.Results = walkExprList(n.Results, fn)
+// WalkFieldList is like WalkStmtList for a list of fields, like the List of
+// an ast.FieldList. Unlike when walking the FieldList itself, an emptied
+// list is returned as such rather than removing anything else.
+func WalkFieldList(list []*ast.Field, fn WalkFunc) []*ast.Field {
+	w := &walker{Walker: &Walker{fn: fn}}
+	return walkNodes(w, list)
+}
 
-	case *ast.BranchStmt:
-		if n.Label != nil {
-			n.Label = Walk(n.Label, fn).(*ast.Ident)
-		}
+// walker holds the state of a single walk.
+type walker struct {
+	*Walker
 
-	case *ast.BlockStmt:
-		n.List = walkStmtList(n.List, fn)
+	report *Report
 
-	case *ast.IfStmt:
-		if n.Init != nil {
-			n.Init = Walk(n.Init, fn).(ast.Stmt)
-		}
-		n.Cond = Walk(n.Cond, fn).(ast.Expr)
-		n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
-		if n.Else != nil {
-			n.Else = Walk(n.Else, fn).(ast.Stmt)
-		}
+	// stack holds the ancestors of the node being walked
+	stack []ast.Node
 
-	case *ast.CaseClause:
-		n.List = walkExprList(n.List, fn)
-		n.Body = walkStmtList(n.Body, fn)
+	// retained holds the removed nodes recorded in the report
+	retained map[ast.Node]bool
 
-	case *ast.SwitchStmt:
-		if n.Init != nil {
-			n.Init = Walk(n.Init, fn).(ast.Stmt)
-		}
-		if n.Tag != nil {
-			n.Tag = Walk(n.Tag, fn).(ast.Expr)
-		}
-		n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
+	// unions holds the binary expressions of union type elements, whose
+	// terms can be removed individually
+	unions map[*ast.BinaryExpr]bool
 
-	case *ast.TypeSwitchStmt:
-		if n.Init != nil {
-			n.Init = Walk(n.Init, fn).(ast.Stmt)
-		}
-		n.Assign = Walk(n.Assign, fn).(ast.Stmt)
-		n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
+	// shown holds the nodes passed to the walk function and skipped the
+	// subtrees it skipped or returned, under WithCoverageCheck
+	shown, skipped map[ast.Node]bool
 
-	case *ast.CommClause:
-		if n.Comm != nil {
-			n.Comm, _ = Walk(n.Comm, fn).(ast.Stmt)
-		}
-		n.Body = walkStmtList(n.Body, fn)
+	// node is the node the walk function is called with
+	node ast.Node
 
-	case *ast.SelectStmt:
-		n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
+	// ann holds the anchors of the walked file, under WithAnnotations
+	ann *annotations
+}
 
-	case *ast.ForStmt:
-		if n.Init != nil {
-			n.Init = Walk(n.Init, fn).(ast.Stmt)
-		}
-		if n.Cond != nil {
-			n.Cond = Walk(n.Cond, fn).(ast.Expr)
-		}
-		if n.Post != nil {
-			n.Post = Walk(n.Post, fn).(ast.Stmt)
+func (w *walker) walk(node ast.Node) ast.Node {
+	if isNil(node) {
+		return node
+	}
+	if w.ann != nil && w.ann.skipped(node) {
+		return node
+	}
+	w.node = node
+	rewritten, ok := w.fn(node)
+	if w.shown != nil {
+		w.shown[node] = true
+		if !ok || rewritten != node {
+			w.skipped[rewritten] = true
 		}
-		n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
+	}
+	switch {
+	case rewritten == Remove:
+		rewritten = nil
+	case isNil(rewritten) && w.nilUnchanged:
+		rewritten = node
+	}
+	if isNil(rewritten) && w.retainRemoved {
+		w.retain(node)
+	}
+	if isNil(rewritten) && w.ann != nil {
+		w.ann.drop(node)
+	}
+	if !ok {
+		return rewritten
+	}
 
-	case *ast.RangeStmt:
-		if n.Key != nil {
-			n.Key = Walk(n.Key, fn).(ast.Expr)
+	w.stack = append(w.stack, node)
+	keep := w.walkChildren(node)
+	w.stack = w.stack[:len(w.stack)-1]
+	if !keep {
+		if w.ann != nil {
+			w.ann.drop(node)
 		}
-		if n.Value != nil {
-			n.Value = Walk(n.Value, fn).(ast.Expr)
-		}
-		n.X = Walk(n.X, fn).(ast.Expr)
-		n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
+		return nil
+	}
 
-	// Declarations
-	case *ast.ImportSpec:
-		if n.Doc != nil {
-			n.Doc = Walk(n.Doc, fn).(*ast.CommentGroup)
-		}
-		if n.Name != nil {
-			n.Name = Walk(n.Name, fn).(*ast.Ident)
-		}
-		n.Path = Walk(n.Path, fn).(*ast.BasicLit)
-		if n.Comment != nil {
-			n.Comment = Walk(n.Comment, fn).(*ast.CommentGroup)
-		}
+	w.node = nil
+	w.fn(nil)
+	return rewritten
+}
 
-	case *ast.ValueSpec:
-		if n.Doc != nil {
-			n.Doc = Walk(n.Doc, fn).(*ast.CommentGroup)
-		}
-		n.Names = walkIdentList(n.Names, fn)
-		if n.Type != nil {
-			n.Type = Walk(n.Type, fn).(ast.Expr)
-		}
-		n.Values = walkExprList(n.Values, fn)
-		if n.Comment != nil {
-			n.Comment = Walk(n.Comment, fn).(*ast.CommentGroup)
+// walkChildren walks the children of node. It returns false if node has to
+// be removed because a child it can't do without was removed.
+func (w *walker) walkChildren(node ast.Node) bool {
+	// the children are walked by walkEdges, generated from the schema, and
+	// what happens when a child is removed is given by RemovalBehavior; the
+	// cases here are those the schema can't describe
+	switch n := node.(type) {
+	case *ast.Field:
+		w.markUnion(n.Type)
+		if !w.walkEdges(n) {
+			return false
 		}
+		n.Type = shrinkUnion(n.Type)
+		return n.Type != nil
 
-	case *ast.TypeSpec:
-		Walk(n.Name, fn)
-		Walk(n.Type, fn)
-		if n.Comment != nil {
-			n.Comment = Walk(n.Comment, fn).(*ast.CommentGroup)
+	case *ast.BinaryExpr:
+		if w.unions[n] {
+			// the terms of unions are dropped by shrinkUnion
+			n.X, _ = w.walk(n.X).(ast.Expr)
+			n.Y, _ = w.walk(n.Y).(ast.Expr)
+			return true
 		}
 
-	case *ast.BadDecl:
-		// nothing to do
-
-	case *ast.GenDecl:
-		if n.Specs = walkSpecList(n.Specs, fn); len(n.Specs) == 0 {
-			return
-		}
-		if n.Doc != nil {
-			n.Doc = Walk(n.Doc, fn).(*ast.CommentGroup)
-		}
-	case *ast.FuncDecl:
-		n.Doc, _ = Walk(n.Doc, fn).(*ast.CommentGroup)
-		if v, ok := Walk(n.Recv, fn).(*ast.FieldList); ok {
-			n.Recv = v
-		} else {
-			return
-		}
-		n.Name = Walk(n.Name, fn).(*ast.Ident)
-		n.Type = Walk(n.Type, fn).(*ast.FuncType)
-		if n.Body != nil {
-			n.Body = Walk(n.Body, fn).(*ast.BlockStmt)
+	case *ast.SliceExpr:
+		if !w.walkEdges(n) {
+			return false
 		}
-
-	// Files and packages
-	case *ast.File:
-		if n.Doc != nil {
-			n.Doc = Walk(n.Doc, fn).(*ast.CommentGroup)
+		// a 3-index slice needs both high and max
+		if n.Slice3 && (n.High == nil || n.Max == nil) {
+			n.Max, n.Slice3 = nil, false
 		}
-
-		n.Name = Walk(n.Name, fn).(*ast.Ident)
-		n.Decls = walkDeclList(n.Decls, fn)
-
-		// don't walk n.Comments - they have been
-		// visited already through the individual
-		// nodes
+		return true
 
 	case *ast.Package:
-		for i, f := range n.Files {
-			n.Files[i] = Walk(f, fn).(*ast.File)
+		// in the order of their names, for reproducible walks
+		names := make([]string, 0, len(n.Files))
+		for name := range n.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if f, _ := w.walk(n.Files[name]).(*ast.File); f != nil {
+				n.Files[name] = f
+			} else {
+				delete(n.Files, name)
+			}
 		}
-
-	default:
-		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+		return true
 	}
-
-	fn(nil)
-	ret = rewritten
-	return
+	return w.walkEdges(node)
 }
 
 func nukeComments(root ast.Node) {
@@ -408,64 +234,3 @@ func nukeComments(root ast.Node) {
 		}
 	})
 }
-
-func walkIdentList(list []*ast.Ident, fn WalkFunc) (out []*ast.Ident) {
-	out = list[:0]
-	for _, x := range list {
-		if v, ok := Walk(x, fn).(*ast.Ident); ok {
-			out = append(out, v)
-		} else {
-			nukeComments(x)
-		}
-	}
-	return
-}
-
-func walkExprList(list []ast.Expr, fn WalkFunc) (out []ast.Expr) {
-	out = list[:0]
-	for _, x := range list {
-		if v, ok := Walk(x, fn).(ast.Expr); ok {
-			out = append(out, v)
-		} else {
-			nukeComments(x)
-		}
-	}
-	return
-}
-
-func walkStmtList(list []ast.Stmt, fn WalkFunc) (out []ast.Stmt) {
-	out = list[:0]
-	for _, x := range list {
-		if v, ok := Walk(x, fn).(ast.Stmt); ok {
-			out = append(out, v)
-		} else {
-			nukeComments(x)
-		}
-	}
-	return
-}
-
-func walkDeclList(list []ast.Decl, fn WalkFunc) (out []ast.Decl) {
-	out = list[:0]
-	for _, x := range list {
-		if v, ok := Walk(x, fn).(ast.Decl); ok {
-			out = append(out, v)
-		} else {
-			nukeComments(x)
-		}
-	}
-	return
-}
-
-func walkSpecList(list []ast.Spec, fn WalkFunc) (out []ast.Spec) {
-	out = list[:0]
-	for _, x := range list {
-		if v, ok := Walk(x, fn).(ast.Spec); ok {
-			out = append(out, v)
-		} else {
-			nukeComments(x)
-		}
-	}
-
-	return
-}
@@ -0,0 +1,273 @@
+package astrewrite
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func parse(t *testing.T, src string) (*token.FileSet, *ast.File) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "src.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, file
+}
+
+func render(t *testing.T, fset *token.FileSet, node ast.Node) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func findFunc(file *ast.File, name string) *ast.FuncDecl {
+	for _, d := range file.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Name.Name == name {
+			return fd
+		}
+	}
+	return nil
+}
+
+func checkSource(t *testing.T, fset *token.FileSet, node ast.Node, want string) {
+	t.Helper()
+	if got := render(t, fset, node); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWalkBody(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func (s *S) f(a int) (b int) {
+	return a + s.n
+}
+`)
+	fd := findFunc(file, "f")
+	recv, name, typ := fd.Recv, fd.Name, fd.Type
+	header := render(t, fset, &ast.FuncDecl{Recv: recv, Name: name, Type: typ})
+
+	WalkBody(fd, func(n ast.Node) (ast.Node, bool) {
+		// a careless rule renaming every identifier
+		if id, ok := n.(*ast.Ident); ok {
+			id.Name += "2"
+		}
+		return n, true
+	})
+
+	if fd.Recv != recv || fd.Name != name || fd.Type != typ {
+		t.Error("signature nodes replaced")
+	}
+	if got := render(t, fset, &ast.FuncDecl{Recv: fd.Recv, Name: fd.Name, Type: fd.Type}); got != header {
+		t.Errorf("got signature %q, want %q", got, header)
+	}
+	checkSource(t, fset, file, `package p
+
+func (s *S) f(a int) (b int) {
+	return a2 + s2.n2
+}
+`)
+}
+
+func TestWalkErr(t *testing.T) {
+	fset, file := parse(t, `package p
+
+var a, b, c = 1, 2, 3
+`)
+
+	_, err := WalkErr(file, func(n ast.Node) (ast.Node, bool, error) {
+		if id, ok := n.(*ast.Ident); ok {
+			if id.Name == "b" {
+				return nil, false, errors.New("found b")
+			}
+			id.Name += "2"
+		}
+		return n, true, nil
+	})
+	if err == nil || err.Error() != "found b" {
+		t.Errorf("got error %v, want found b", err)
+	}
+	checkSource(t, fset, file, `package p2
+
+var a2, b, c = 1, 2, 3
+`)
+}
+
+func TestWalkLists(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "fmt"
+
+// debug is removed.
+var debug = false
+
+type T struct {
+	// n is kept.
+	n int
+	// trace is removed.
+	trace []string
+}
+
+func f(a, b, c int) {
+	fmt.Println(a, b, c)
+	println(debug)
+	a++
+}
+`)
+	removeDebug := func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.GenDecl:
+			if n.Tok == token.VAR {
+				return nil, false
+			}
+		case *ast.ExprStmt:
+			if call, ok := n.X.(*ast.CallExpr); ok && isIdent(call.Fun, "println") {
+				return nil, false
+			}
+		case *ast.Field:
+			if len(n.Names) > 0 && n.Names[0].Name == "trace" {
+				return nil, false
+			}
+		case *ast.Ident:
+			if n.Name == "b" {
+				return nil, false
+			}
+		}
+		return n, true
+	}
+
+	fields := file.Decls[2].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields
+	fields.List = WalkFieldList(fields.List, removeDebug)
+	if len(fields.List) != 1 {
+		t.Errorf("got %d fields, want 1", len(fields.List))
+	}
+
+	body := findFunc(file, "f").Body
+	body.List = WalkStmtList(body.List, removeDebug)
+	if len(body.List) != 2 {
+		t.Errorf("got %d statements, want 2", len(body.List))
+	}
+	call := body.List[0].(*ast.ExprStmt).X.(*ast.CallExpr)
+	call.Args = WalkExprList(call.Args, removeDebug)
+	if len(call.Args) != 2 {
+		t.Errorf("got %d arguments, want 2", len(call.Args))
+	}
+
+	file.Decls = WalkDeclList(file.Decls, func(n ast.Node) (ast.Node, bool) {
+		if _, ok := n.(*ast.FuncDecl); ok {
+			return n, false
+		}
+		return removeDebug(n)
+	})
+	if len(file.Decls) != 3 {
+		t.Errorf("got %d declarations, want 3", len(file.Decls))
+	}
+	checkSource(t, fset, file, `package p
+
+import "fmt"
+
+type T struct {
+	// n is kept.
+	n int
+}
+
+func f(a, b, c int) {
+	fmt.Println(a, c)
+
+	a++
+}
+`)
+}
+
+func TestWalkFieldRoot(t *testing.T) {
+	_, file := parse(t, `package p
+
+type T struct {
+	n, m int
+}
+`)
+	field := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields.List[0]
+
+	// removing a name keeps the field
+	got := Walk(field, func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "m" {
+			return nil, false
+		}
+		return n, true
+	})
+	if got != field || len(field.Names) != 1 {
+		t.Fatalf("got %v with %d names, want the field with 1 name", got, len(field.Names))
+	}
+
+	// removing the type removes the field
+	got = Walk(field, func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "int" {
+			return nil, false
+		}
+		return n, true
+	})
+	if got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+}
+
+func TestWalkTypeParams(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type Number interface {
+	~int | ~float64
+}
+
+func Map[T, U Number](xs []T, f func(T) U) []U {
+	return nil
+}
+
+type List[T Number] struct {
+	next *List[T]
+}
+
+func Plain[T any]() {}
+`)
+
+	rename := map[string]string{"T": "E", "Number": "Numeric"}
+	file = Walk(file, func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if to, ok := rename[n.Name]; ok {
+				n.Name = to
+			}
+		case *ast.Field:
+			// removing the only type parameter clears the list
+			if isIdent(n.Type, "any") {
+				return Remove, false
+			}
+		}
+		return n, true
+	}).(*ast.File)
+
+	checkSource(t, fset, file, `package p
+
+type Numeric interface {
+	~int | ~float64
+}
+
+func Map[E, U Numeric](xs []E, f func(E) U) []U {
+	return nil
+}
+
+type List[E Numeric] struct {
+	next *List[E]
+}
+
+func Plain() {}
+`)
+}
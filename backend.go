@@ -0,0 +1,179 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+)
+
+// Node is a handle on a node of a tree seen through a Backend, like an
+// ast.Node for AST. Handles on the same node compare equal.
+type Node interface{}
+
+// Backend gives access to the trees of a representation of Go source, so
+// that rules written against it run over go/ast as well as over others,
+// like the decorated trees of github.com/dave/dst, which keep comments
+// attached to their nodes. AST is the backend of go/ast; others live in
+// modules of their own, which this package doesn't depend on, and can check
+// themselves with the suite of the backendtest package.
+//
+// Nodes are described like in Schema, which holds for any representation
+// mirroring the node types of go/ast: a node has a kind, the name of its
+// type like "IfStmt", children held by edges named after its fields, like
+// "Cond", and attributes, the fields holding plain values, like the Name of
+// an Ident or the Op of a BinaryExpr. Positions and the objects resolved by
+// the parser aren't attributes. Using an edge the kind of a node doesn't
+// have, or a child of the wrong kind for an edge, panics.
+type Backend interface {
+	// Walk walks the tree rooted at root like Walk: fn is called with
+	// every node before its children and returns the node taking its
+	// place, or nil to remove it, and whether to walk the children of the
+	// returned node. Unlike with Walk, fn isn't called with nil once the
+	// children are done. Removals follow RemovalBehavior. Walk returns the
+	// rewritten root, or nil if it was removed.
+	Walk(root Node, fn func(Node) (Node, bool)) Node
+
+	// Kind returns the kind of n, like "IfStmt".
+	Kind(n Node) string
+
+	// Attrs returns the attributes of n by name, formatted with
+	// fmt.Sprint, which gives the operator of a token.Token, like "+",
+	// and strings as they are, like the Value of a BasicLit with its
+	// quotes.
+	Attrs(n Node) map[string]string
+
+	// Child returns the child of n held by a single or optional edge, or
+	// nil if there's none.
+	Child(n Node, edge string) Node
+
+	// Children returns the children of n held by a slice edge.
+	Children(n Node, edge string) []Node
+
+	// SetChild replaces the child of n held by a single or optional edge
+	// with child; nil clears the edge.
+	SetChild(n Node, edge string, child Node)
+
+	// Splice replaces the children i to j of n held by a slice edge with
+	// nodes, which deletes them if there are no nodes and inserts nodes
+	// before the child i if i equals j.
+	Splice(n Node, edge string, i, j int, nodes ...Node)
+
+	// Clone returns a deep copy of the tree rooted at n.
+	Clone(n Node) Node
+
+	// ParseExpr parses an expression into a tree that can be inserted
+	// into any other.
+	ParseExpr(src string) (Node, error)
+}
+
+// AST is the Backend of go/ast, whose nodes are ast.Nodes walked by Walk.
+// Expressions parsed by ParseExpr have no positions, which leaves out the
+// ellipsis of calls like f(args...).
+var AST Backend = astBackend{}
+
+type astBackend struct{}
+
+func (astBackend) Walk(root Node, fn func(Node) (Node, bool)) Node {
+	rewritten := Walk(root.(ast.Node), func(n ast.Node) (ast.Node, bool) {
+		if n == nil {
+			return nil, true
+		}
+		r, ok := fn(n)
+		if r == nil {
+			return nil, ok
+		}
+		return r.(ast.Node), ok
+	})
+	if isNil(rewritten) {
+		return nil
+	}
+	return rewritten
+}
+
+func (astBackend) Kind(n Node) string {
+	return reflect.TypeOf(n).Elem().Name()
+}
+
+func (b astBackend) Attrs(n Node) map[string]string {
+	v := reflect.ValueOf(n).Elem()
+	edges := make(map[string]bool)
+	for _, e := range schema[b.Kind(n)] {
+		edges[e.Name] = true
+	}
+	attrs := make(map[string]string)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if edges[f.Name] || f.Type == posType {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int:
+			attrs[f.Name] = fmt.Sprint(v.Field(i).Interface())
+		}
+	}
+	return attrs
+}
+
+func (b astBackend) Child(n Node, edge string) Node {
+	child := b.edge(n, edge, false)
+	if child.IsNil() {
+		return nil
+	}
+	return child.Interface()
+}
+
+func (b astBackend) Children(n Node, edge string) []Node {
+	children := b.edge(n, edge, true)
+	nodes := make([]Node, children.Len())
+	for i := range nodes {
+		nodes[i] = children.Index(i).Interface()
+	}
+	return nodes
+}
+
+func (b astBackend) SetChild(n Node, edge string, child Node) {
+	f := b.edge(n, edge, false)
+	if child == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return
+	}
+	f.Set(reflect.ValueOf(child))
+}
+
+func (b astBackend) Splice(n Node, edge string, i, j int, nodes ...Node) {
+	f := b.edge(n, edge, true)
+	spliced := reflect.MakeSlice(f.Type(), 0, f.Len()-(j-i)+len(nodes))
+	spliced = reflect.AppendSlice(spliced, f.Slice(0, i))
+	for _, node := range nodes {
+		spliced = reflect.Append(spliced, reflect.ValueOf(node))
+	}
+	spliced = reflect.AppendSlice(spliced, f.Slice(j, f.Len()))
+	f.Set(spliced)
+}
+
+func (astBackend) Clone(n Node) Node {
+	return Clone(n.(ast.Node))
+}
+
+func (astBackend) ParseExpr(src string) (Node, error) {
+	e, err := parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// edge returns the field of n holding the edge, which must be a slice edge
+// if slice is set and a single or optional one otherwise.
+func (b astBackend) edge(n Node, edge string, slice bool) reflect.Value {
+	kind := b.Kind(n)
+	for _, e := range schema[kind] {
+		if e.Name == edge {
+			if (e.Kind == EdgeSlice) != slice {
+				panic(fmt.Sprintf("astrewrite: %s.%s is a %s edge", kind, edge, e.Kind))
+			}
+			return reflect.ValueOf(n).Elem().FieldByName(edge)
+		}
+	}
+	panic(fmt.Sprintf("astrewrite: %s has no edge %s", kind, edge))
+}
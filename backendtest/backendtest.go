@@ -0,0 +1,176 @@
+// Package backendtest checks that an astrewrite.Backend behaves like the
+// rules written against it expect.
+//
+// The suite is meant to be run by every backend, including those living in
+// other modules:
+//
+//	func TestConformance(t *testing.T) {
+//		backendtest.Run(t, mybackend.New(), mybackend.Format)
+//	}
+//
+// It works on expressions parsed by the backend and compares the results
+// by their formatted source.
+package backendtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/astrewrite"
+)
+
+// Run runs the conformance suite on b in subtests of t. format returns the
+// source of a tree of b, as formatted by go/format.
+func Run(t *testing.T, b astrewrite.Backend, format func(astrewrite.Node) (string, error)) {
+	t.Helper()
+	s := &suite{b: b, format: format}
+	t.Run("kinds and attributes", s.attrs)
+	t.Run("children", s.children)
+	t.Run("set child", s.setChild)
+	t.Run("splice", s.splice)
+	t.Run("walk", s.walk)
+	t.Run("walk removal", s.walkRemoval)
+	t.Run("clone", s.clone)
+	t.Run("rewrite pattern", s.rewritePattern)
+}
+
+type suite struct {
+	b      astrewrite.Backend
+	format func(astrewrite.Node) (string, error)
+}
+
+// parse parses the expression src.
+func (s *suite) parse(t *testing.T, src string) astrewrite.Node {
+	t.Helper()
+	n, err := s.b.ParseExpr(src)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", src, err)
+	}
+	return n
+}
+
+// check checks that n formats as want.
+func (s *suite) check(t *testing.T, n astrewrite.Node, want string) {
+	t.Helper()
+	got, err := s.format(n)
+	if err != nil {
+		t.Fatalf("formatting: %v", err)
+	}
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func (s *suite) attrs(t *testing.T) {
+	n := s.parse(t, `a + "b"`)
+	if k := s.b.Kind(n); k != "BinaryExpr" {
+		t.Fatalf("got kind %s, want BinaryExpr", k)
+	}
+	if op := s.b.Attrs(n)["Op"]; op != "+" {
+		t.Errorf("got Op %q, want +", op)
+	}
+	x, y := s.b.Child(n, "X"), s.b.Child(n, "Y")
+	if k, name := s.b.Kind(x), s.b.Attrs(x)["Name"]; k != "Ident" || name != "a" {
+		t.Errorf("got X %s %q, want Ident a", k, name)
+	}
+	attrs := s.b.Attrs(y)
+	if k := s.b.Kind(y); k != "BasicLit" || attrs["Kind"] != "STRING" || attrs["Value"] != `"b"` {
+		t.Errorf("got Y %s %v, want BasicLit STRING \"b\"", k, attrs)
+	}
+}
+
+func (s *suite) children(t *testing.T) {
+	n := s.parse(t, "s[i:j]")
+	if lo := s.b.Child(n, "Low"); lo == nil || s.b.Attrs(lo)["Name"] != "i" {
+		t.Errorf("got Low %v, want i", lo)
+	}
+	if max := s.b.Child(n, "Max"); max != nil {
+		t.Errorf("got Max %v, want nil", max)
+	}
+
+	call := s.parse(t, "f(a, b, c)")
+	var names []string
+	for _, arg := range s.b.Children(call, "Args") {
+		names = append(names, s.b.Attrs(arg)["Name"])
+	}
+	if got := strings.Join(names, " "); got != "a b c" {
+		t.Errorf("got Args %s, want a b c", got)
+	}
+	if args := s.b.Children(s.parse(t, "f()"), "Args"); len(args) != 0 {
+		t.Errorf("got %d Args, want none", len(args))
+	}
+}
+
+func (s *suite) setChild(t *testing.T) {
+	n := s.parse(t, "s[i:j]")
+	s.b.SetChild(n, "Low", nil)
+	s.b.SetChild(n, "High", s.parse(t, "len(s)-1"))
+	s.check(t, n, "s[:len(s)-1]")
+}
+
+func (s *suite) splice(t *testing.T) {
+	call := s.parse(t, "f(a, b, c)")
+	s.b.Splice(call, "Args", 1, 2)
+	s.check(t, call, "f(a, c)")
+	s.b.Splice(call, "Args", 0, 0, s.parse(t, "x"), s.parse(t, "y"))
+	s.check(t, call, "f(x, y, a, c)")
+	s.b.Splice(call, "Args", 2, 4, s.parse(t, "z"))
+	s.check(t, call, "f(x, y, z)")
+}
+
+func (s *suite) walk(t *testing.T) {
+	n := s.parse(t, "f(a, -b)")
+	var kinds []string
+	n = s.b.Walk(n, func(n astrewrite.Node) (astrewrite.Node, bool) {
+		kinds = append(kinds, s.b.Kind(n))
+		if s.b.Kind(n) == "UnaryExpr" {
+			return s.b.Child(n, "X"), false
+		}
+		return n, true
+	})
+	if got := strings.Join(kinds, " "); got != "CallExpr Ident Ident UnaryExpr" {
+		t.Errorf("walked %s, want CallExpr Ident Ident UnaryExpr", got)
+	}
+	s.check(t, n, "f(a, b)")
+}
+
+func (s *suite) walkRemoval(t *testing.T) {
+	n := s.parse(t, "f(a, b, g(b))")
+	n = s.b.Walk(n, func(n astrewrite.Node) (astrewrite.Node, bool) {
+		if s.b.Kind(n) == "Ident" && s.b.Attrs(n)["Name"] == "b" {
+			return nil, false
+		}
+		return n, true
+	})
+	s.check(t, n, "f(a, g())")
+
+	// removing a child that is always set removes its parent
+	n = s.parse(t, "[]int{x + y, z}")
+	n = s.b.Walk(n, func(n astrewrite.Node) (astrewrite.Node, bool) {
+		if s.b.Kind(n) == "Ident" && s.b.Attrs(n)["Name"] == "y" {
+			return nil, false
+		}
+		return n, true
+	})
+	s.check(t, n, "[]int{z}")
+}
+
+func (s *suite) clone(t *testing.T) {
+	n := s.parse(t, "f(a)")
+	c := s.b.Clone(n)
+	s.b.Splice(c, "Args", 0, 1)
+	s.check(t, n, "f(a)")
+	s.check(t, c, "f()")
+}
+
+func (s *suite) rewritePattern(t *testing.T) {
+	n := s.parse(t, "copy(s[i:len(s)], t[0:len(t)])")
+	n, count, err := astrewrite.RewritePattern(s.b, n, "a[b:len(a)]", "a[b:]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("rewrote %d expressions, want 2", count)
+	}
+	s.check(t, n, "copy(s[i:], t[0:])")
+}
@@ -0,0 +1,19 @@
+package backendtest
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"testing"
+
+	"github.com/fatih/astrewrite"
+)
+
+func TestAST(t *testing.T) {
+	Run(t, astrewrite.AST, func(n astrewrite.Node) (string, error) {
+		var buf bytes.Buffer
+		err := format.Node(&buf, token.NewFileSet(), n.(ast.Node))
+		return buf.String(), err
+	})
+}
@@ -0,0 +1,109 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// BatchOption configures BatchChannelSends.
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	changeElemType bool
+}
+
+// ChangeElemType opts in to the change of the element type of the channel
+// BatchChannelSends makes.
+func ChangeElemType() BatchOption {
+	return func(c *batchConfig) {
+		c.changeElemType = true
+	}
+}
+
+// BatchReport describes what BatchChannelSends did.
+type BatchReport struct {
+	// Batched holds the sends of whole slices replacing the loops, in
+	// source order.
+	Batched []*ast.SendStmt
+
+	// Note describes the change of the element type of the channel, to
+	// be passed on to whoever updates its declaration and receivers, or
+	// is empty if no loop was rewritten.
+	Note string
+}
+
+// BatchChannelSends replaces the loops in the body of fn sending the
+// elements of a slice one by one on the channel named chanVar,
+//
+//	for _, x := range xs {
+//		ch <- x
+//	}
+//
+// by a single send of the slice, ch <- xs, so that receivers get a batch at
+// a time. This changes the element type of the channel from T to []T, which
+// the declaration of the channel, its other senders and all its receivers
+// must follow, so it requires ChangeElemType: without it BatchChannelSends
+// fails if there's a loop to rewrite, and changes nothing.
+//
+// Other loops are left alone, as are loops whose body does anything else.
+// Telling a slice from a string, an array or a map takes types, so ranging
+// over a slice is up to the caller to ensure. Receivers of a batch also get
+// the empty ones, and share the backing array with the sender, which must
+// not modify it afterwards.
+func BatchChannelSends(fn *ast.FuncDecl, chanVar string, opts ...BatchOption) (BatchReport, error) {
+	var cfg batchConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var report BatchReport
+	if fn.Body == nil {
+		return report, nil
+	}
+
+	var loops []*ast.RangeStmt
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if loop, ok := n.(*ast.RangeStmt); ok && isSendLoop(loop, chanVar) {
+			loops = append(loops, loop)
+		}
+		return true
+	})
+	if len(loops) == 0 {
+		return report, nil
+	}
+	if !cfg.changeElemType {
+		return report, fmt.Errorf("astrewrite: batching the sends on %s changes its element type, which takes ChangeElemType", chanVar)
+	}
+
+	batched := make(map[*ast.RangeStmt]bool)
+	for _, loop := range loops {
+		batched[loop] = true
+	}
+	Walk(fn.Body, func(n ast.Node) (ast.Node, bool) {
+		loop, ok := n.(*ast.RangeStmt)
+		if !ok || !batched[loop] {
+			return n, true
+		}
+		send := loop.Body.List[0].(*ast.SendStmt)
+		batch := &ast.SendStmt{Chan: send.Chan, Arrow: loop.For, Value: loop.X}
+		send.Chan.(*ast.Ident).NamePos = loop.For
+		report.Batched = append(report.Batched, batch)
+		return batch, false
+	})
+	report.Note = fmt.Sprintf("%s now carries slices of its former element type: update its declaration, other senders and receivers", chanVar)
+	return report, nil
+}
+
+// isSendLoop reports whether loop sends each element it ranges over, and
+// nothing else, on the channel named chanVar.
+func isSendLoop(loop *ast.RangeStmt, chanVar string) bool {
+	if loop.Tok != token.DEFINE || loop.Key != nil && !isIdent(loop.Key, "_") || len(loop.Body.List) != 1 {
+		return false
+	}
+	x, ok := loop.Value.(*ast.Ident)
+	if !ok || x.Name == "_" {
+		return false
+	}
+	send, ok := loop.Body.List[0].(*ast.SendStmt)
+	return ok && isIdent(send.Chan, chanVar) && isIdent(send.Value, x.Name) && !mentions(loop.X, chanVar)
+}
@@ -0,0 +1,69 @@
+package astrewrite
+
+import "testing"
+
+func TestBatchChannelSends(t *testing.T) {
+	src := `package p
+
+func produce(ch chan int, xs []int, m map[string]int) {
+	for _, x := range xs {
+		ch <- x
+	}
+	for x := range m {
+		ch <- m[x]
+	}
+	for _, x := range xs {
+		ch <- x * 2
+	}
+	for _, x := range xs {
+		log(x)
+		ch <- x
+	}
+	for _, x := range xs {
+		other <- x
+	}
+	if len(xs) > 1 {
+		for _, x := range xs[1:] {
+			ch <- x
+		}
+	}
+}
+`
+	_, file := parse(t, src)
+	if _, err := BatchChannelSends(findFunc(file, "produce"), "ch"); err == nil {
+		t.Error("changed the element type of ch without opting in")
+	}
+
+	fset, file := parse(t, src)
+	report, err := BatchChannelSends(findFunc(file, "produce"), "ch", ChangeElemType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Batched) != 2 || report.Note == "" {
+		t.Errorf("got report %+v, want 2 batched sends and a note", report)
+	}
+	checkSource(t, fset, file, `package p
+
+func produce(ch chan int, xs []int, m map[string]int) {
+	ch <- xs
+
+	for x := range m {
+		ch <- m[x]
+	}
+	for _, x := range xs {
+		ch <- x * 2
+	}
+	for _, x := range xs {
+		log(x)
+		ch <- x
+	}
+	for _, x := range xs {
+		other <- x
+	}
+	if len(xs) > 1 {
+		ch <- xs[1:]
+
+	}
+}
+`)
+}
@@ -0,0 +1,79 @@
+// Package build constructs common AST nodes with the right tokens and
+// wrapper nodes, which are easy to get wrong by hand: a wrong token prints
+// fine, but doesn't parse back. All positions of the built nodes are unset,
+// so that they take the positions of the nodes they replace once placed.
+package build
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Assign returns the assignment lhs = rhs.
+func Assign(lhs, rhs []ast.Expr) *ast.AssignStmt {
+	return &ast.AssignStmt{Lhs: lhs, Tok: token.ASSIGN, Rhs: rhs}
+}
+
+// Define returns the short variable declaration of names, names := rhs.
+func Define(names []string, rhs ...ast.Expr) *ast.AssignStmt {
+	lhs := make([]ast.Expr, len(names))
+	for i, name := range names {
+		lhs[i] = ast.NewIdent(name)
+	}
+	return &ast.AssignStmt{Lhs: lhs, Tok: token.DEFINE, Rhs: rhs}
+}
+
+// Var returns the declaration statement var name typ = values. typ may be
+// nil if there are values.
+func Var(name string, typ ast.Expr, values ...ast.Expr) *ast.DeclStmt {
+	return &ast.DeclStmt{Decl: &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names:  []*ast.Ident{ast.NewIdent(name)},
+			Type:   typ,
+			Values: values,
+		}},
+	}}
+}
+
+// Call returns the call fun(args...). fun may be a qualified name like
+// "fmt.Println" or a selector like "s.buf.Write".
+func Call(fun string, args ...ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{Fun: Sel(strings.Split(fun, ".")...), Args: args}
+}
+
+// Sel returns the selector expression parts[0].parts[1]..., or the
+// identifier parts[0] if there's only one part.
+func Sel(parts ...string) ast.Expr {
+	var x ast.Expr = ast.NewIdent(parts[0])
+	for _, part := range parts[1:] {
+		x = &ast.SelectorExpr{X: x, Sel: ast.NewIdent(part)}
+	}
+	return x
+}
+
+// String returns an interpreted string literal with the value s.
+func String(s string) *ast.BasicLit {
+	return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s)}
+}
+
+// Int returns an integer literal with the value n. A negative n makes a
+// unary expression, as literals have no sign.
+func Int(n int64) ast.Expr {
+	if n < 0 {
+		return &ast.UnaryExpr{Op: token.SUB, X: &ast.BasicLit{Kind: token.INT, Value: strconv.FormatUint(uint64(-n), 10)}}
+	}
+	return &ast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(n, 10)}
+}
+
+// Return returns the statement return results.
+func Return(results ...ast.Expr) *ast.ReturnStmt {
+	return &ast.ReturnStmt{Results: results}
+}
+
+// If returns the statement if cond { body }.
+func If(cond ast.Expr, body ...ast.Stmt) *ast.IfStmt {
+	return &ast.IfStmt{Cond: cond, Body: &ast.BlockStmt{List: body}}
+}
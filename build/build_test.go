@@ -0,0 +1,79 @@
+package build
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	// func clamp(c config, n int) int
+	fn := &ast.FuncDecl{
+		Name: ast.NewIdent("clamp"),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{
+				{Names: []*ast.Ident{ast.NewIdent("c")}, Type: ast.NewIdent("config")},
+				{Names: []*ast.Ident{ast.NewIdent("n")}, Type: ast.NewIdent("int")},
+			}},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("int")}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			Define([]string{"limit", "name"}, Sel("c", "limits", "max"), String("clamp \"n\"")),
+			Var("min", ast.NewIdent("int"), Int(-1)),
+			If(&ast.BinaryExpr{X: ast.NewIdent("n"), Op: token.GTR, Y: ast.NewIdent("limit")},
+				&ast.ExprStmt{X: Call("println", ast.NewIdent("name"), Int(math.MinInt64))},
+				Assign([]ast.Expr{ast.NewIdent("n")}, []ast.Expr{ast.NewIdent("limit")}),
+			),
+			If(&ast.BinaryExpr{X: ast.NewIdent("n"), Op: token.LSS, Y: ast.NewIdent("min")},
+				Return(Call("c.lowest")),
+			),
+			Return(ast.NewIdent("n")),
+		}},
+	}
+
+	fset := token.NewFileSet()
+	var buf bytes.Buffer
+	buf.WriteString("package p\n\n")
+	if err := format.Node(&buf, fset, fn); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString(`
+
+type config struct{ limits struct{ max int } }
+
+func (config) lowest() int { return 0 }
+`)
+	src := buf.String()
+
+	want := `package p
+
+func clamp(c config, n int) int {
+	limit, name := c.limits.max, "clamp \"n\""
+	var min int = -1
+	if n > limit {
+		println(name, -9223372036854775808)
+		n = limit
+	}
+	if n < min {
+		return c.lowest()
+	}
+	return n
+}
+`
+	if src[:len(want)] != want {
+		t.Errorf("got:\n%s\nwant:\n%s", src, want)
+	}
+
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{f}, nil); err != nil {
+		t.Errorf("%v\n%s", err, src)
+	}
+}
@@ -0,0 +1,26 @@
+package astrewrite
+
+import "go/ast"
+
+// InsertIntoChain appends a call of method with args to the call chain
+// ending in chain, like a chain of builder methods returning their receiver,
+// and returns the new end of the chain, chain.method(args...), which the
+// caller puts in place of chain. The chain may pass through indexes and type
+// assertions, like b.Items()[0].(*Item).SetName(n), as the call binds tighter
+// than any of them. The new call is placed at the end of chain so that it
+// prints on the same line.
+func InsertIntoChain(chain *ast.CallExpr, method string, args []ast.Expr) *ast.CallExpr {
+	pos := chain.End()
+	for _, arg := range args {
+		stampPositions(arg, pos)
+	}
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   chain,
+			Sel: &ast.Ident{NamePos: pos, Name: method},
+		},
+		Lparen: pos,
+		Args:   args,
+		Rparen: pos,
+	}
+}
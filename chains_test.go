@@ -0,0 +1,44 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestInsertIntoChain(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(b *Builder, n string) {
+	req := b.Method("GET").URL("/items")
+	b.Items()[0].(*Item).SetName(n)
+	_ = req
+}
+`)
+
+	// append Header to the chain of the assignment and Done to the chain
+	// going through an index and a type assertion
+	Walk(findFunc(file, "f").Body, func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if chain, ok := n.Rhs[0].(*ast.CallExpr); ok {
+				arg, _ := parseExpr(`"Accept"`)
+				arg2, _ := parseExpr(`"text/plain"`)
+				n.Rhs[0] = InsertIntoChain(chain, "Header", []ast.Expr{arg, arg2})
+			}
+			return n, false
+		case *ast.ExprStmt:
+			n.X = InsertIntoChain(n.X.(*ast.CallExpr), "Done", nil)
+			return n, false
+		}
+		return n, true
+	})
+
+	checkSource(t, fset, file, `package p
+
+func f(b *Builder, n string) {
+	req := b.Method("GET").URL("/items").Header("Accept", "text/plain")
+	b.Items()[0].(*Item).SetName(n).Done()
+	_ = req
+}
+`)
+}
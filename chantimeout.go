@@ -0,0 +1,156 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+)
+
+// AddChannelTimeout rewrites the blocking channel operations in the body of
+// fn into select statements with an additional case <-time.After(timeoutExpr)
+// that panics. Rewritten are sends, receives used as expression statements and
+// receives that are the single right hand side of an assignment.
+//
+// A receive declaring new variables (v := <-ch) keeps its binding by moving the
+// rest of its block into the receive case. Since the timeout case panics this
+// doesn't change what runs after a successful receive; the receive is left
+// alone if the moved statements contain a break the select would capture or a
+// label, or end with a fallthrough, which can't leave a select case.
+//
+// fn is a function of file, to which the "time" import is added if needed.
+// It returns the number of rewritten operations.
+func AddChannelTimeout(file *ast.File, fn *ast.FuncDecl, timeoutExpr string) (int, error) {
+	if _, err := parser.ParseExpr(timeoutExpr); err != nil {
+		return 0, err
+	}
+	if fn.Body == nil {
+		return 0, nil
+	}
+
+	timePkg, _ := importedAs(file, "time")
+	ct := &chanTimeout{timeout: timeoutExpr, time: timePkg}
+	Walk(fn.Body, func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			n.List = ct.rewrite(n.List)
+		case *ast.CaseClause:
+			n.Body = ct.rewrite(n.Body)
+		case *ast.CommClause:
+			n.Body = ct.rewrite(n.Body)
+		}
+		return n, true
+	})
+	if ct.count > 0 {
+		AddImport(file, "time")
+	}
+	return ct.count, nil
+}
+
+type chanTimeout struct {
+	timeout string
+	time    string // the name the file imports time by
+	count   int
+}
+
+// rewrite replaces the blocking operations in list. Statements moved into a
+// receive case are not handled here, Walk visits them through the new
+// CommClause.
+func (ct *chanTimeout) rewrite(list []ast.Stmt) []ast.Stmt {
+	for i, s := range list {
+		define, ok := isBlockingOp(s)
+		if !ok {
+			continue
+		}
+
+		var rest []ast.Stmt
+		if define {
+			if !movable(list[i+1:]) {
+				continue
+			}
+			rest = append(rest, list[i+1:]...)
+		}
+
+		list[i] = ct.selectStmt(s, rest)
+		ct.count++
+		if define {
+			return list[:i+1]
+		}
+	}
+	return list
+}
+
+func (ct *chanTimeout) selectStmt(comm ast.Stmt, body []ast.Stmt) *ast.SelectStmt {
+	timeout, _ := parseExpr(ct.timeout)
+	after := &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent(ct.time), Sel: ast.NewIdent("After")},
+		Args: []ast.Expr{timeout},
+	}
+	panicStmt := &ast.ExprStmt{X: &ast.CallExpr{
+		Fun: ast.NewIdent("panic"),
+		Args: []ast.Expr{&ast.BasicLit{
+			Kind:  token.STRING,
+			Value: strconv.Quote("channel operation timed out"),
+		}},
+	}}
+
+	// stamp the positions of the replaced statements so comments and
+	// following statements stay where they were
+	end := comm.End()
+	if len(body) > 0 {
+		end = body[len(body)-1].End()
+	}
+	return &ast.SelectStmt{
+		Select: comm.Pos(),
+		Body: &ast.BlockStmt{
+			Lbrace: comm.Pos(),
+			List: []ast.Stmt{
+				&ast.CommClause{Case: comm.Pos(), Comm: comm, Colon: comm.End(), Body: body},
+				&ast.CommClause{
+					Comm: &ast.ExprStmt{X: &ast.UnaryExpr{Op: token.ARROW, X: after}},
+					Body: []ast.Stmt{panicStmt},
+				},
+			},
+			Rbrace: end,
+		},
+	}
+}
+
+// isBlockingOp reports whether s is a channel operation that can be used as
+// the communication of a select case, and whether it declares variables.
+func isBlockingOp(s ast.Stmt) (define, ok bool) {
+	switch s := s.(type) {
+	case *ast.SendStmt:
+		return false, true
+	case *ast.ExprStmt:
+		return false, isReceive(s.X)
+	case *ast.AssignStmt:
+		if len(s.Rhs) != 1 || (s.Tok != token.ASSIGN && s.Tok != token.DEFINE) {
+			return false, false
+		}
+		return s.Tok == token.DEFINE, isReceive(s.Rhs[0])
+	}
+	return false, false
+}
+
+func isReceive(e ast.Expr) bool {
+	u, ok := ast.Unparen(e).(*ast.UnaryExpr)
+	return ok && u.Op == token.ARROW
+}
+
+// movable reports whether list can be moved into a select case without
+// changing the target of a break, hiding a label from a goto or moving a
+// fallthrough out of its case clause.
+func movable(list []ast.Stmt) bool {
+	for _, s := range list {
+		switch s := s.(type) {
+		case *ast.LabeledStmt:
+			return false
+		case *ast.BranchStmt:
+			if s.Tok == token.FALLTHROUGH {
+				return false
+			}
+		}
+	}
+	return !hasBreak(list)
+}
@@ -0,0 +1,124 @@
+package astrewrite
+
+import "testing"
+
+func TestAddChannelTimeoutReceive(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(ch chan int) int {
+	v := <-ch
+	v++
+	return v
+}
+
+func g(ch chan int) {
+	for {
+		v := <-ch
+		if v == 0 {
+			break
+		}
+	}
+}
+
+func h(ch chan int, n int) {
+	switch n {
+	case 0:
+		v := <-ch
+		println(v)
+		fallthrough
+	default:
+	}
+}
+`)
+
+	for _, name := range []string{"f", "g", "h"} {
+		if _, err := AddChannelTimeout(file, findFunc(file, name), "5 * time.Second"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkSource(t, fset, file, `package p
+
+import "time"
+
+func f(ch chan int) int {
+	select {
+	case v := <-ch:
+		v++
+		return v
+	case <-time.After(5 * time.Second):
+		panic("channel operation timed out")
+	}
+}
+
+func g(ch chan int) {
+	for {
+		v := <-ch
+		if v == 0 {
+			break
+		}
+	}
+}
+
+func h(ch chan int, n int) {
+	switch n {
+	case 0:
+		v := <-ch
+		println(v)
+		fallthrough
+	default:
+	}
+}
+`)
+}
+
+func TestAddChannelTimeoutSend(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "fmt"
+
+func f(ch chan<- int, done chan struct{}) {
+	ch <- 1
+	<-done
+	select {
+	case ch <- 2:
+	default:
+	}
+	fmt.Println("sent")
+}
+`)
+
+	n, err := AddChannelTimeout(file, findFunc(file, "f"), "timeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("rewrote %d operations, want 2", n)
+	}
+
+	checkSource(t, fset, file, `package p
+
+import (
+	"fmt"
+	"time"
+)
+
+func f(ch chan<- int, done chan struct{}) {
+	select {
+	case ch <- 1:
+	case <-time.After(timeout):
+		panic("channel operation timed out")
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		panic("channel operation timed out")
+	}
+	select {
+	case ch <- 2:
+	default:
+	}
+	fmt.Println("sent")
+}
+`)
+}
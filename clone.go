@@ -0,0 +1,87 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"reflect"
+)
+
+// Clone returns a deep copy of the tree rooted at node, positions included.
+// Nodes referenced more than once, like comment groups referenced both by a
+// node and by File.Comments, are copied once so the copy shares them the same
+// way. Objects and scopes from identifier resolution are not copied; the copy
+// refers to the original ones.
+func Clone(node ast.Node) ast.Node {
+	if isNil(node) {
+		return node
+	}
+	c := &cloner{seen: make(map[interface{}]reflect.Value)}
+	return c.clone(reflect.ValueOf(node)).Interface().(ast.Node)
+}
+
+// cloneOrigins is like Clone, but also returns the node of the tree rooted
+// at node every node of the copy was copied from.
+func cloneOrigins(node ast.Node) (ast.Node, map[ast.Node]ast.Node) {
+	c := &cloner{seen: make(map[interface{}]reflect.Value)}
+	cp := c.clone(reflect.ValueOf(node)).Interface().(ast.Node)
+	origins := make(map[ast.Node]ast.Node, len(c.seen))
+	for orig, v := range c.seen {
+		if n, ok := orig.(ast.Node); ok {
+			origins[v.Interface().(ast.Node)] = n
+		}
+	}
+	return cp, origins
+}
+
+type cloner struct {
+	seen map[interface{}]reflect.Value
+}
+
+func (c *cloner) clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType {
+			return v
+		}
+		if cp, ok := c.seen[v.Interface()]; ok {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		c.seen[v.Interface()] = cp
+		cp.Elem().Set(c.clone(v.Elem()))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(c.clone(v.Elem()))
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(c.clone(v.Index(i)))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), c.clone(iter.Value()))
+		}
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			cp.Field(i).Set(c.clone(v.Field(i)))
+		}
+		return cp
+	default:
+		return v
+	}
+}
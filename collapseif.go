@@ -0,0 +1,127 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// CollapseNestedIf merges nested if statements below node into a single if
+// joining their conditions with &&:
+//
+//	if a {
+//		if b {
+//			...
+//		}
+//	}
+//
+// becomes if a && b { ... }. Only ifs without else branches and init
+// statements are merged, and only if the inner if is the sole statement of
+// the outer body. If node is a file, what follows a merged if moves up to
+// the line of the first removed closing brace, unless comments lie in
+// between, so that no blank line is left in place of the braces.
+func CollapseNestedIf(node ast.Node) {
+	// the first removed closing brace after each merged if
+	removed := make(map[token.Pos]token.Pos)
+	Walk(node, func(n ast.Node) (ast.Node, bool) {
+		outer, ok := n.(*ast.IfStmt)
+		if !ok {
+			return n, true
+		}
+		brace := token.NoPos
+		for {
+			inner := collapsibleIf(outer)
+			if inner == nil {
+				break
+			}
+
+			// the inner condition would otherwise be printed on the
+			// line it came from
+			clearPositions(inner.Cond)
+			outer.Cond = &ast.BinaryExpr{
+				X:  parenthesize(outer.Cond, token.LAND),
+				Op: token.LAND,
+				Y:  parenthesize(inner.Cond, token.LAND),
+			}
+			brace = outer.Body.Rbrace
+			outer.Body = inner.Body
+		}
+		if brace.IsValid() {
+			removed[outer.End()] = brace
+		}
+		return outer, true
+	})
+	if f, ok := node.(*ast.File); ok && len(removed) > 0 {
+		closeBraceGaps(f, removed)
+	}
+}
+
+// closeBraceGaps moves the statements of f that follow a removed closing
+// brace, and the closing braces of blocks ending with one, up to the line
+// of the brace. removed maps the ends of the nodes followed by a removed
+// brace to the position of the brace; moving a block's brace up in turn
+// removes its old line.
+func closeBraceGaps(f *ast.File, removed map[token.Pos]token.Pos) {
+	closeList := func(list []ast.Stmt) {
+		for i := 0; i+1 < len(list); i++ {
+			to, ok := removed[list[i].End()]
+			if !ok || commentsIn(f, list[i].End(), list[i+1].Pos()) {
+				continue
+			}
+			from := list[i+1].Pos()
+			mapPositions(list[i+1], func(p token.Pos) token.Pos {
+				if p == from {
+					return to
+				}
+				return p
+			})
+		}
+	}
+
+	// inner lists first, as their braces may move up
+	var nodes []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	for i := len(nodes) - 1; i >= 0; i-- {
+		switch n := nodes[i].(type) {
+		case *ast.BlockStmt:
+			closeList(n.List)
+			if len(n.List) == 0 {
+				continue
+			}
+			last := n.List[len(n.List)-1].End()
+			if to, ok := removed[last]; ok && !commentsIn(f, last, n.Rbrace) {
+				removed[to+1] = n.Rbrace
+				n.Rbrace = to
+			}
+		case *ast.CaseClause:
+			closeList(n.Body)
+		case *ast.CommClause:
+			closeList(n.Body)
+		}
+	}
+}
+
+func collapsibleIf(outer *ast.IfStmt) *ast.IfStmt {
+	if outer.Init != nil || outer.Else != nil || len(outer.Body.List) != 1 {
+		return nil
+	}
+	inner, ok := outer.Body.List[0].(*ast.IfStmt)
+	if !ok || inner.Init != nil || inner.Else != nil {
+		return nil
+	}
+	return inner
+}
+
+// parenthesize wraps binary expressions binding less tightly than op in
+// parentheses, so e can be used as an operand of op.
+func parenthesize(e ast.Expr, op token.Token) ast.Expr {
+	if b, ok := e.(*ast.BinaryExpr); ok && b.Op.Precedence() < op.Precedence() {
+		return &ast.ParenExpr{X: e}
+	}
+	return e
+}
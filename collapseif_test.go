@@ -0,0 +1,100 @@
+package astrewrite
+
+import "testing"
+
+func TestCollapseNestedIf(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(a, b, c, d bool) {
+	if a {
+		if b || c {
+			if d {
+				println("all")
+			}
+		}
+	}
+	for a {
+		if b {
+			if c {
+				break
+			}
+		}
+	}
+	switch {
+	case a:
+		if b {
+			if c {
+				println("a")
+			}
+		}
+	default:
+	}
+	println("done")
+}
+`)
+
+	CollapseNestedIf(file)
+
+	checkSource(t, fset, file, `package p
+
+func f(a, b, c, d bool) {
+	if a && (b || c) && d {
+		println("all")
+	}
+	for a {
+		if b && c {
+			break
+		}
+	}
+	switch {
+	case a:
+		if b && c {
+			println("a")
+		}
+	default:
+	}
+	println("done")
+}
+`)
+}
+
+func TestCollapseNestedIfSkipped(t *testing.T) {
+	src := `package p
+
+func f(a, b bool, g func() error) {
+	if a {
+		if b {
+			println("b")
+		} else {
+			println("not b")
+		}
+	}
+	if a {
+		if err := g(); err != nil {
+			println(err)
+		}
+	}
+	if err := g(); err != nil {
+		if b {
+			println(err)
+		}
+	}
+	if a {
+		if b {
+			println("b")
+		}
+		println("a")
+	}
+	if a {
+		if b {
+			println("b")
+		}
+	} else {
+		println("not a")
+	}
+}
+`
+	fset, file := parse(t, src)
+	CollapseNestedIf(file)
+	checkSource(t, fset, file, src)
+}
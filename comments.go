@@ -0,0 +1,248 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// dropEmptyCommentGroups removes the comment groups without comments from
+// f.Comments and from the nodes of f they're attached to.
+func dropEmptyCommentGroups(f *ast.File) {
+	empty := func(cg *ast.CommentGroup) *ast.CommentGroup {
+		if cg != nil && len(cg.List) == 0 {
+			return nil
+		}
+		return cg
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.File:
+			n.Doc = empty(n.Doc)
+		case *ast.Field:
+			n.Doc, n.Comment = empty(n.Doc), empty(n.Comment)
+		case *ast.ImportSpec:
+			n.Doc, n.Comment = empty(n.Doc), empty(n.Comment)
+		case *ast.ValueSpec:
+			n.Doc, n.Comment = empty(n.Doc), empty(n.Comment)
+		case *ast.TypeSpec:
+			n.Doc, n.Comment = empty(n.Doc), empty(n.Comment)
+		case *ast.GenDecl:
+			n.Doc = empty(n.Doc)
+		case *ast.FuncDecl:
+			n.Doc = empty(n.Doc)
+		}
+		return true
+	})
+
+	out := f.Comments[:0]
+	for _, cg := range f.Comments {
+		if len(cg.List) > 0 {
+			out = append(out, cg)
+		}
+	}
+	f.Comments = out
+}
+
+// setComments replaces the comments of cg with kept, a subsequence of them.
+// If all of them are line comments, the kept ones take the positions of the
+// last comments of the group, so that the group still ends right above the
+// node it documents rather than leaving a gap.
+func setComments(cg *ast.CommentGroup, kept []*ast.Comment) {
+	if len(kept) == len(cg.List) {
+		return
+	}
+	for _, c := range cg.List {
+		if !strings.HasPrefix(c.Text, "//") {
+			cg.List = kept
+			return
+		}
+	}
+
+	offset := len(cg.List) - len(kept)
+	for i, c := range kept {
+		c.Slash = cg.List[offset+i].Slash
+	}
+	cg.List = kept
+}
+
+// RewriteNolint rewrites the //nolint directives of f, attached to a node
+// or not, calling transform with the linters each one lists. Directives are
+// written in the current //nolint:a,b format, keeping any text following
+// the linter list, like an explanation. A directive whose linters are all
+// removed by transform is deleted; a bare directive stays bare.
+func RewriteNolint(f *ast.File, transform func(linters []string) []string) {
+	for _, cg := range f.Comments {
+		var kept []*ast.Comment
+		for _, c := range cg.List {
+			if rewriteNolint(c, transform) {
+				kept = append(kept, c)
+			}
+		}
+		setComments(cg, kept)
+	}
+	dropEmptyCommentGroups(f)
+}
+
+// rewriteNolint rewrites c if it's a nolint directive and reports whether c
+// should be kept.
+func rewriteNolint(c *ast.Comment, transform func([]string) []string) bool {
+	if !strings.HasPrefix(c.Text, "//") {
+		return true
+	}
+	text := strings.TrimLeft(c.Text[2:], " \t")
+	if !strings.HasPrefix(text, "nolint") {
+		return true
+	}
+	text = text[len("nolint"):]
+
+	var linters []string
+	rest := text
+	if strings.HasPrefix(text, ":") {
+		list := text[1:]
+		rest = ""
+		if i := strings.Index(list, "//"); i >= 0 {
+			list, rest = list[:i], list[i:]
+		}
+		for _, l := range strings.Split(list, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				linters = append(linters, l)
+			}
+		}
+	} else if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		// some other word starting with nolint
+		return true
+	}
+
+	had := len(linters) > 0
+	linters = transform(linters)
+	if had && len(linters) == 0 {
+		return false
+	}
+
+	text = "//nolint"
+	if len(linters) > 0 {
+		text += ":" + strings.Join(linters, ",")
+	}
+	if rest = strings.TrimSpace(rest); rest != "" {
+		text += " " + rest
+	}
+	c.Text = text
+	return true
+}
+
+// FilterComments removes the comments of f that keep rejects, one comment
+// at a time, which is finer grained than removing whole groups. keep is
+// called with every comment, in the order of f.Comments, and the node the
+// group holding it is attached to as a doc or line comment, or nil for a
+// comment that isn't attached to any, like the comments inside function
+// bodies. Groups left without comments are removed from f and from their
+// nodes. The remaining comments of a group of line comments move down to
+// the end of the group, so that it still ends right above the node it
+// documents rather than leaving a gap. The lines of the removed comments
+// can't be taken out of the file without its token.File though, so a group
+// right below a line of code, like the opening brace of a block, is left
+// with a blank line above it.
+func FilterComments(f *ast.File, keep func(c *ast.Comment, owner ast.Node) bool) {
+	owners := commentOwners(f)
+	for _, cg := range f.Comments {
+		var kept []*ast.Comment
+		for _, c := range cg.List {
+			if keep(c, owners[cg]) {
+				kept = append(kept, c)
+			}
+		}
+		setComments(cg, kept)
+	}
+	dropEmptyCommentGroups(f)
+}
+
+// commentOwners maps the comment groups attached to the nodes of f to
+// those nodes.
+func commentOwners(f *ast.File) map[*ast.CommentGroup]ast.Node {
+	owners := make(map[*ast.CommentGroup]ast.Node)
+	own := func(n ast.Node, groups ...*ast.CommentGroup) {
+		for _, cg := range groups {
+			if cg != nil {
+				owners[cg] = n
+			}
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.File:
+			own(n, n.Doc)
+		case *ast.Field:
+			own(n, n.Doc, n.Comment)
+		case *ast.ImportSpec:
+			own(n, n.Doc, n.Comment)
+		case *ast.ValueSpec:
+			own(n, n.Doc, n.Comment)
+		case *ast.TypeSpec:
+			own(n, n.Doc, n.Comment)
+		case *ast.GenDecl:
+			own(n, n.Doc)
+		case *ast.FuncDecl:
+			own(n, n.Doc)
+		}
+		return true
+	})
+	return owners
+}
+
+// DropCommentedOutCode is a keep function for FilterComments rejecting the
+// comments that are commented-out code: line comments whose text parses as
+// Go, and block comments most of whose non-blank lines do. To tell code
+// from prose, a line only counts if it also holds a bracket, a brace, an
+// assignment or a semicolon, or starts with a keyword, or is a lone closing
+// brace, which doesn't parse on its own. Directives like //go:generate or
+// //nolint are always kept.
+func DropCommentedOutCode(c *ast.Comment, owner ast.Node) bool {
+	if strings.HasPrefix(c.Text, "//") {
+		text := c.Text[2:]
+		if text == "" || text[0] != ' ' && text[0] != '\t' {
+			// a directive, or an empty comment
+			return true
+		}
+		return !isCodeLine(text)
+	}
+
+	code, lines := 0, 0
+	for _, line := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines++
+		if isCodeLine(line) {
+			code++
+		}
+	}
+	return lines == 0 || 2*code <= lines
+}
+
+// isCodeLine reports whether line looks like a line of Go code, see
+// DropCommentedOutCode.
+func isCodeLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if strings.Trim(line, "}) ") == "" || strings.HasSuffix(line, "{") && strings.HasPrefix(line, "}") {
+		return line != ""
+	}
+	codeLike := strings.ContainsAny(line, "()[]{}=;")
+	if word, _, _ := strings.Cut(line, " "); token.Lookup(word).IsKeyword() {
+		codeLike = true
+	}
+	if !codeLike {
+		return false
+	}
+	if strings.HasSuffix(line, "{") {
+		// the header of a block, closed for parsing
+		line += "}"
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", "package p; func _() {\n"+line+"\n}", 0); err == nil {
+		return true
+	}
+	_, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+line, 0)
+	return err == nil
+}
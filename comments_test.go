@@ -0,0 +1,189 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"strings"
+	"testing"
+)
+
+// stringerGenerate is built from two strings, as go generate would run
+// it if a line of this file started with it.
+const stringerGenerate = "//go:" + "generate stringer -type T"
+
+func TestRewriteNolint(t *testing.T) {
+	fset, file := parse(t, `package p
+
+// nolint
+var a = 1
+
+var b = 2 // nolint: errcheck, megacheck // legacy code
+
+// Doc for c.
+//
+//nolint:megacheck
+var c = 3
+
+func f() {
+	// nolint:unused,deadcode
+	_ = 4
+}
+`)
+
+	rename := map[string]string{"megacheck": "staticcheck"}
+	RewriteNolint(file, func(linters []string) []string {
+		var out []string
+		for _, l := range linters {
+			if l == "deadcode" {
+				continue
+			}
+			if r, ok := rename[l]; ok {
+				l = r
+			}
+			out = append(out, l)
+		}
+		return out
+	})
+
+	checkSource(t, fset, file, `package p
+
+//nolint
+var a = 1
+
+var b = 2 //nolint:errcheck,staticcheck // legacy code
+
+// Doc for c.
+//
+//nolint:staticcheck
+var c = 3
+
+func f() {
+	//nolint:unused
+	_ = 4
+}
+`)
+}
+
+func TestRewriteNolintRemove(t *testing.T) {
+	fset, file := parse(t, `package p
+
+// nolinter is not a directive
+var a = 1 // nolint:deadcode
+
+// Doc for b.
+// nolint: deadcode
+var b = 2
+`)
+
+	RewriteNolint(file, func([]string) []string { return nil })
+
+	checkSource(t, fset, file, `package p
+
+// nolinter is not a directive
+var a = 1
+
+// Doc for b.
+var b = 2
+`)
+}
+
+func TestFilterComments(t *testing.T) {
+	fset, file := parse(t, `package p
+
+// Doc for T.
+// TODO: drop
+// More doc.
+type T struct {
+	// TODO: drop
+	X int // TODO: drop
+}
+
+func f() {
+	_ = 0
+
+	// keep
+	// TODO: drop
+	_ = 1
+}
+`)
+
+	owners := make(map[string]bool)
+	FilterComments(file, func(c *ast.Comment, owner ast.Node) bool {
+		switch owner.(type) {
+		case *ast.GenDecl:
+			owners["GenDecl"] = true
+		case *ast.Field:
+			owners["Field"] = true
+		case nil:
+			owners["nil"] = true
+		}
+		return !strings.Contains(c.Text, "TODO")
+	})
+
+	checkSource(t, fset, file, `package p
+
+// Doc for T.
+// More doc.
+type T struct {
+	X int
+}
+
+func f() {
+	_ = 0
+
+	// keep
+	_ = 1
+}
+`)
+	if len(owners) != 3 {
+		t.Errorf("got owners %v, want GenDecl, Field and nil", owners)
+	}
+	if len(file.Comments) != 2 {
+		t.Errorf("got %d comment groups, want 2", len(file.Comments))
+	}
+}
+
+func TestDropCommentedOutCode(t *testing.T) {
+	fset, file := parse(t, `package p
+
+`+stringerGenerate+`
+
+// Doc for f.
+// x := g()
+// if x != nil {
+//	return x
+// }
+// Output:
+func f() {
+	_ = 0
+
+	// Compute the value.
+	// v := compute(1)
+	_ = 1
+
+	/*
+		a := 1
+		b := a + 1
+		here is why
+	*/
+	_ = 2 /* see the docs (again) */
+}
+`)
+
+	FilterComments(file, DropCommentedOutCode)
+
+	checkSource(t, fset, file, `package p
+
+`+stringerGenerate+`
+
+// Doc for f.
+// Output:
+func f() {
+	_ = 0
+
+	// Compute the value.
+	_ = 1
+
+	_ = 2 /* see the docs (again) */
+}
+`)
+}
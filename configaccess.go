@@ -0,0 +1,86 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// TypedConfigAccess replaces type assertions on elements of the map
+// configVar in the body of fn with calls of typed getters. typeToMethod maps
+// asserted types, written like in source ("string", "[]int"), to the name of
+// the getter for them, so that with {"string": "GetString"}
+//
+//	cfg["key"].(string)
+//
+// becomes cfg.GetString("key"). In the comma-ok form, like
+// v, ok := cfg["key"].(string), the getter's name gets the suffix OK:
+// v, ok := cfg.GetStringOK("key"). Assertions to types missing from
+// typeToMethod are left alone. It returns the number of replaced
+// assertions.
+func TypedConfigAccess(fn *ast.FuncDecl, configVar string, typeToMethod map[string]string) int {
+	if fn.Body == nil {
+		return 0
+	}
+
+	// getter returns the call replacing x, or nil if x isn't a matching
+	// assertion.
+	getter := func(x ast.Expr, suffix string) *ast.CallExpr {
+		ta, ok := x.(*ast.TypeAssertExpr)
+		if !ok || ta.Type == nil {
+			return nil
+		}
+		ix, ok := ta.X.(*ast.IndexExpr)
+		if !ok {
+			return nil
+		}
+		id, ok := ix.X.(*ast.Ident)
+		if !ok || id.Name != configVar {
+			return nil
+		}
+		method, ok := typeToMethod[types.ExprString(ta.Type)]
+		if !ok {
+			return nil
+		}
+		return &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   id,
+				Sel: &ast.Ident{NamePos: ix.Lbrack, Name: method + suffix},
+			},
+			Lparen: ix.Lbrack,
+			Args:   []ast.Expr{ix.Index},
+			Rparen: ix.Rbrack,
+		}
+	}
+
+	n := 0
+	commaOK := func(lhs, rhs []ast.Expr) {
+		if len(lhs) == 2 && len(rhs) == 1 {
+			if call := getter(rhs[0], "OK"); call != nil {
+				rhs[0] = call
+				n++
+			}
+		}
+	}
+	Walk(fn.Body, func(node ast.Node) (ast.Node, bool) {
+		switch x := node.(type) {
+		case *ast.AssignStmt:
+			if x.Tok == token.DEFINE || x.Tok == token.ASSIGN {
+				commaOK(x.Lhs, x.Rhs)
+			}
+		case *ast.ValueSpec:
+			names := make([]ast.Expr, len(x.Names))
+			for i, name := range x.Names {
+				names[i] = name
+			}
+			commaOK(names, x.Values)
+		case *ast.TypeAssertExpr:
+			if call := getter(x, ""); call != nil {
+				n++
+				return call, true
+			}
+		}
+		return node, true
+	})
+	return n
+}
@@ -0,0 +1,40 @@
+package astrewrite
+
+import "testing"
+
+func TestTypedConfigAccess(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(cfg map[string]interface{}, other map[string]interface{}) {
+	name := cfg["name"].(string)
+	port, ok := cfg["port"].(int)
+	var debug, set = cfg["debug"].(bool)
+	tags := cfg["tags"].([]string)
+	timeout := cfg["timeout"].(time.Duration)
+	x := other["name"].(string)
+	use(name, port, ok, debug, set, tags, timeout, x, len(cfg["name"].(string)))
+}
+`)
+
+	n := TypedConfigAccess(findFunc(file, "f"), "cfg", map[string]string{
+		"string":   "GetString",
+		"int":      "GetInt",
+		"bool":     "GetBool",
+		"[]string": "GetStrings",
+	})
+	if n != 5 {
+		t.Errorf("replaced %d assertions, want 5", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func f(cfg map[string]interface{}, other map[string]interface{}) {
+	name := cfg.GetString("name")
+	port, ok := cfg.GetIntOK("port")
+	var debug, set = cfg.GetBoolOK("debug")
+	tags := cfg.GetStrings("tags")
+	timeout := cfg["timeout"].(time.Duration)
+	x := other["name"].(string)
+	use(name, port, ok, debug, set, tags, timeout, x, len(cfg.GetString("name")))
+}
+`)
+}
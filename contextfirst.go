@@ -0,0 +1,156 @@
+package astrewrite
+
+import "go/ast"
+
+// ContextFirst moves the context.Context parameter of the functions and
+// methods declared in file to the front of their parameter lists when it
+// isn't there yet, and moves the corresponding arguments of the calls in
+// file along.
+//
+// Calls are matched by callee name: plain calls of a function by its name,
+// and selector calls that don't go through an imported package by the name
+// of the method. Since the receiver type isn't known, a method is only
+// changed if all methods and interface methods of that name declared in
+// file have their context at the same position. Arguments are moved without
+// regard to their side effects, which changes the order in which they are
+// evaluated if the context argument is a call.
+func ContextFirst(file *ast.File) {
+	ctxPkg := ""
+	imports := make(map[string]bool)
+	for _, imp := range file.Imports {
+		name := importName(imp)
+		imports[name] = true
+		if importPath(imp) == "context" {
+			ctxPkg = name
+		}
+	}
+	if ctxPkg == "" || ctxPkg == "_" || ctxPkg == "." {
+		return
+	}
+
+	// ctxIndex returns the index of the first context parameter of ft if
+	// it isn't the first parameter, or -1.
+	ctxIndex := func(ft *ast.FuncType) int {
+		i := 0
+		for _, field := range ft.Params.List {
+			if isQualified(field.Type, ctxPkg, "Context") {
+				if i == 0 || len(field.Names) == 0 {
+					return -1
+				}
+				return i
+			}
+			if len(field.Names) == 0 {
+				i++
+			}
+			i += len(field.Names)
+		}
+		return -1
+	}
+
+	funcs := make(map[string]int)
+	var moved []*ast.FuncType
+	methods := make(map[string][]int)
+	methodTypes := make(map[string][]*ast.FuncType)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			i := ctxIndex(n.Type)
+			switch {
+			case n.Recv != nil:
+				methods[n.Name.Name] = append(methods[n.Name.Name], i)
+				methodTypes[n.Name.Name] = append(methodTypes[n.Name.Name], n.Type)
+			case i > 0:
+				funcs[n.Name.Name] = i
+				moved = append(moved, n.Type)
+			}
+		case *ast.InterfaceType:
+			for _, m := range n.Methods.List {
+				ft, ok := m.Type.(*ast.FuncType)
+				if !ok || len(m.Names) == 0 {
+					continue
+				}
+				name := m.Names[0].Name
+				methods[name] = append(methods[name], ctxIndex(ft))
+				methodTypes[name] = append(methodTypes[name], ft)
+			}
+		}
+		return true
+	})
+
+	movedMethods := make(map[string]int)
+	for name, indices := range methods {
+		same := true
+		for _, i := range indices {
+			same = same && i == indices[0]
+		}
+		if same && indices[0] > 0 {
+			movedMethods[name] = indices[0]
+			moved = append(moved, methodTypes[name]...)
+		}
+	}
+	if len(moved) == 0 {
+		return
+	}
+	for _, ft := range moved {
+		moveContextParam(ft, ctxIndex(ft))
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		i := -1
+		switch fun := ast.Unparen(call.Fun).(type) {
+		case *ast.Ident:
+			if k, ok := funcs[fun.Name]; ok && (fun.Obj == nil || fun.Obj.Kind == ast.Fun) {
+				i = k
+			}
+		case *ast.SelectorExpr:
+			if x, ok := fun.X.(*ast.Ident); ok && x.Obj == nil && imports[x.Name] {
+				break
+			}
+			if k, ok := movedMethods[fun.Sel.Name]; ok {
+				i = k
+			}
+		}
+		if i < 0 || i >= len(call.Args) || (call.Ellipsis.IsValid() && i == len(call.Args)-1) {
+			return true
+		}
+		ctx := call.Args[i]
+		copy(call.Args[1:i+1], call.Args[:i])
+		call.Args[0] = ctx
+		return true
+	})
+}
+
+// moveContextParam moves the i-th parameter of ft, which has a field of its
+// own or shares it with the following parameters, to the front.
+func moveContextParam(ft *ast.FuncType, i int) {
+	list := ft.Params.List
+	for j, field := range list {
+		if i >= len(field.Names) {
+			i -= len(field.Names)
+			continue
+		}
+		ctx := field
+		if len(field.Names) > 1 {
+			ctx = &ast.Field{Names: field.Names[:1], Type: Clone(field.Type).(ast.Expr)}
+			field.Names = field.Names[1:]
+		} else {
+			list = append(list[:j:j], list[j+1:]...)
+		}
+		ft.Params.List = append([]*ast.Field{ctx}, list...)
+		return
+	}
+}
+
+// isQualified reports whether e is the qualified identifier pkg.name.
+func isQualified(e ast.Expr, pkg, name string) bool {
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == pkg && sel.Sel.Name == name
+}
@@ -0,0 +1,116 @@
+package astrewrite
+
+import "testing"
+
+func TestContextFirst(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	"context"
+	"fmt"
+)
+
+type Store interface {
+	Get(key string, ctx context.Context) (string, error)
+}
+
+type db struct{}
+
+func (d *db) Get(key string, ctx context.Context) (string, error) { return "", nil }
+
+func Load(name string, ctx context.Context, opts ...string) error {
+	fmt.Println(name, opts)
+	return nil
+}
+
+func Fetch(ctx context.Context, url string) error { return nil }
+
+func Copy(dst, src string, ctx, parent context.Context) {}
+
+func run(s Store, ctx context.Context, names []string) {
+	Load("a", ctx)
+	Load("b", ctx, "x", "y")
+	Load("c", ctx, names...)
+	s.Get("k", ctx)
+	Fetch(ctx, "u")
+	Copy("d", "s", ctx, ctx)
+	fmt.Println("x", ctx)
+}
+`)
+
+	ContextFirst(file)
+	checkSource(t, fset, file, `package p
+
+import (
+	"context"
+	"fmt"
+)
+
+type Store interface {
+	Get(ctx context.Context, key string) (string, error)
+}
+
+type db struct{}
+
+func (d *db) Get(ctx context.Context, key string) (string, error) { return "", nil }
+
+func Load(ctx context.Context, name string, opts ...string) error {
+	fmt.Println(name, opts)
+	return nil
+}
+
+func Fetch(ctx context.Context, url string) error { return nil }
+
+func Copy(ctx context.Context, dst, src string, parent context.Context) {}
+
+func run(ctx context.Context, s Store, names []string) {
+	Load(ctx, "a")
+	Load(ctx, "b", "x", "y")
+	Load(ctx, "c", names...)
+	s.Get(ctx, "k")
+	Fetch(ctx, "u")
+	Copy(ctx, "d", "s", ctx)
+	fmt.Println("x", ctx)
+}
+`)
+}
+
+func TestContextFirstAmbiguousMethod(t *testing.T) {
+	src := `package p
+
+import "context"
+
+type A struct{}
+
+func (A) Do(n int, ctx context.Context) {}
+
+type B struct{}
+
+func (B) Do(ctx context.Context, n int) {}
+
+func f(a A, b B, ctx context.Context) {
+	a.Do(1, ctx)
+	b.Do(ctx, 1)
+}
+`
+	fset, file := parse(t, src)
+	ContextFirst(file)
+	// f is a function, only the methods are left alone
+	checkSource(t, fset, file, `package p
+
+import "context"
+
+type A struct{}
+
+func (A) Do(n int, ctx context.Context) {}
+
+type B struct{}
+
+func (B) Do(ctx context.Context, n int) {}
+
+func f(ctx context.Context, a A, b B) {
+	a.Do(1, ctx)
+	b.Do(ctx, 1)
+}
+`)
+}
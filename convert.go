@@ -0,0 +1,271 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// ConvReport describes the conversion function GenerateConverter made.
+type ConvReport struct {
+	// Mapped holds the paths of the fields of the target type that are
+	// assigned, like Inner.X or Items[].ID, in the order of the type.
+	Mapped []string
+
+	// Unmapped holds the fields of the target type that are left to be
+	// converted by hand, in the order of the type.
+	Unmapped []UnmappedField
+
+	// Imports holds the sorted import paths of the packages the function
+	// refers to, which the caller adds with AddImport.
+	Imports []string
+}
+
+// UnmappedField describes a field GenerateConverter couldn't map.
+type UnmappedField struct {
+	// Path is the path of the field in the target type.
+	Path string
+
+	// Reason tells why it's not mapped.
+	Reason string
+}
+
+// ConvOption configures GenerateConverter.
+type ConvOption func(*convConfig)
+
+type convConfig struct {
+	name   string
+	panics bool
+}
+
+// ConvName sets the name of the conversion function, by default that of
+// the source type, To and that of the target type, like UserToUserDTO.
+func ConvName(name string) ConvOption {
+	return func(c *convConfig) {
+		c.name = name
+	}
+}
+
+// ConvPanics makes the conversion function end with a panic naming the
+// fields it leaves unmapped, if any, rather than return, so that they
+// can't go unnoticed. By default they're listed as TODO comments in the doc
+// comment of the function only.
+func ConvPanics() ConvOption {
+	return func(c *convConfig) {
+		c.panics = true
+	}
+}
+
+// GenerateConverter returns a function converting a value of the struct
+// type from into one of the struct type to, field by field:
+//
+//	func UserToUserDTO(in User) UserDTO
+//
+// A field of to gets the field of the same name of from if it's assignable
+// to it. If both are structs, slices of structs or maps of structs with the
+// same key type, their fields are mapped the same way, the elements of
+// slices and maps in a loop, keeping nil slices and maps nil. Other fields,
+// like those without a counterpart, those converting a pointer to a value
+// or back, or unexported ones of another package, are reported as
+// unmapped, and listed in TODO comments in the doc comment of the
+// function, see ConvPanics.
+//
+// The function is generated in the package info was filled for, which
+// decides which types are qualified and which fields are accessible, or in
+// that of to if info is nil or holds no definitions. It has no positions,
+// so it can be returned from the generator of GenerateFromMarkers, which
+// replaces it when run again.
+func GenerateConverter(info *types.Info, from, to *types.Named, opts ...ConvOption) (*ast.FuncDecl, ConvReport) {
+	cfg := convConfig{name: from.Obj().Name() + "To" + to.Obj().Name()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	g := &converter{pkg: to.Obj().Pkg(), body: new(strings.Builder), imports: make(map[string]bool)}
+	if info != nil {
+		for _, obj := range info.Defs {
+			if obj != nil && obj.Pkg() != nil {
+				g.pkg = obj.Pkg()
+				break
+			}
+		}
+	}
+
+	fmt.Fprintf(g.body, "var out %s\n", g.typeString(to))
+	g.fields(from, to, "in.", "out.", "", 0)
+	if cfg.panics && len(g.report.Unmapped) > 0 {
+		var paths []string
+		for _, u := range g.report.Unmapped {
+			paths = append(paths, u.Path)
+		}
+		fmt.Fprintf(g.body, "panic(%q)\n", "TODO: convert "+strings.Join(paths, ", "))
+	} else {
+		g.body.WriteString("return out\n")
+	}
+
+	src := fmt.Sprintf("func %s(in %s) %s {\n%s}", cfg.name, g.typeString(from), g.typeString(to), g.body.String())
+	s, err := ParseSnippetKind(src, DeclSnippet)
+	if err != nil {
+		// the source is built from type names and field names only
+		panic(fmt.Sprintf("astrewrite: GenerateConverter: %v", err))
+	}
+	fd := s.File.Decls[0].(*ast.FuncDecl)
+	clearPositions(fd)
+
+	doc := []*ast.Comment{{Text: fmt.Sprintf("// %s converts a %s into a %s.", cfg.name, from.Obj().Name(), to.Obj().Name())}}
+	if len(g.report.Unmapped) > 0 {
+		doc = append(doc, &ast.Comment{Text: "//"})
+	}
+	for _, u := range g.report.Unmapped {
+		doc = append(doc, &ast.Comment{Text: fmt.Sprintf("// TODO: convert %s: %s.", u.Path, u.Reason)})
+	}
+	fd.Doc = &ast.CommentGroup{List: doc}
+
+	for path := range g.imports {
+		g.report.Imports = append(g.report.Imports, path)
+	}
+	sort.Strings(g.report.Imports)
+	return fd, g.report
+}
+
+type converter struct {
+	pkg     *types.Package
+	body    *strings.Builder
+	report  ConvReport
+	imports map[string]bool
+}
+
+// typeString returns the source of t as written in the package of the
+// function, recording the imports it needs.
+func (g *converter) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		g.imports[p.Path()] = true
+		return p.Name()
+	})
+}
+
+// fields writes the assignments of the fields of the struct type to, held
+// by the expression dst, from those of from, held by src. path is the path
+// of dst in the target type and depth the number of enclosing loops.
+func (g *converter) fields(from, to types.Type, src, dst, path string, depth int) {
+	fs, ts := from.Underlying().(*types.Struct), to.Underlying().(*types.Struct)
+	byName := make(map[string]*types.Var)
+	for i := 0; i < fs.NumFields(); i++ {
+		byName[fs.Field(i).Name()] = fs.Field(i)
+	}
+	for i := 0; i < ts.NumFields(); i++ {
+		tf := ts.Field(i)
+		fieldPath := path + tf.Name()
+		ff := byName[tf.Name()]
+		switch {
+		case tf.Name() == "_":
+			continue
+		case !g.accessible(tf):
+			g.unmapped(fieldPath, "unexported in "+g.typeString(to))
+		case ff == nil:
+			g.unmapped(fieldPath, "no field "+tf.Name()+" in "+g.typeString(from))
+		case !g.accessible(ff):
+			g.unmapped(fieldPath, "unexported in "+g.typeString(from))
+		default:
+			g.field(ff.Type(), tf.Type(), src+ff.Name(), dst+tf.Name(), fieldPath, depth)
+		}
+	}
+}
+
+// field writes the conversion of src, of type from, into dst, of type to.
+func (g *converter) field(from, to types.Type, src, dst, path string, depth int) {
+	if types.AssignableTo(from, to) {
+		fmt.Fprintf(g.body, "%s = %s\n", dst, src)
+		g.report.Mapped = append(g.report.Mapped, path)
+		return
+	}
+	if isStruct(from) && isStruct(to) {
+		g.fields(from, to, src+".", dst+".", path+".", depth)
+		return
+	}
+
+	suffix := ""
+	if depth > 0 {
+		suffix = fmt.Sprint(depth + 1)
+	}
+	switch f := from.Underlying().(type) {
+	case *types.Slice:
+		t, ok := to.Underlying().(*types.Slice)
+		if !ok || !isStruct(f.Elem()) || !isStruct(t.Elem()) {
+			break
+		}
+		i, v := "i"+suffix, "v"+suffix
+		loop, v := g.loopBody(v, func() {
+			g.fields(f.Elem(), t.Elem(), v+".", dst+"["+i+"].", path+"[].", depth+1)
+		})
+		fmt.Fprintf(g.body, "if %s != nil {\n%s = make(%s, len(%s))\n", src, dst, g.typeString(to), src)
+		if loop != "" {
+			fmt.Fprintf(g.body, "for %s := range %s {\n%s}\n", rangeVars(i, v), src, loop)
+		}
+		g.body.WriteString("}\n")
+		return
+	case *types.Map:
+		t, ok := to.Underlying().(*types.Map)
+		if !ok || !types.Identical(f.Key(), t.Key()) || !isStruct(f.Elem()) || !isStruct(t.Elem()) {
+			break
+		}
+		k, v, w := "k"+suffix, "v"+suffix, "w"+suffix
+		loop, v := g.loopBody(v, func() {
+			g.fields(f.Elem(), t.Elem(), v+".", w+".", path+"[].", depth+1)
+		})
+		fmt.Fprintf(g.body, "if %s != nil {\n%s = make(%s, len(%s))\nfor %s := range %s {\nvar %s %s\n%s%s[%s] = %s\n}\n}\n",
+			src, dst, g.typeString(to), src, rangeVars(k, v), src, w, g.typeString(t.Elem()), loop, dst, k, w)
+		return
+	}
+
+	reason := fmt.Sprintf("%s isn't assignable to %s", g.typeString(from), g.typeString(to))
+	if p, ok := from.(*types.Pointer); ok && types.AssignableTo(p.Elem(), to) {
+		reason = "pointer to value"
+	} else if p, ok := to.(*types.Pointer); ok && types.AssignableTo(from, p.Elem()) {
+		reason = "value to pointer"
+	}
+	g.unmapped(path, reason)
+}
+
+// loopBody returns what write writes for the body of a loop over the
+// elements v, and v, or _ if the body doesn't use it.
+func (g *converter) loopBody(v string, write func()) (string, string) {
+	outer, mapped := g.body, len(g.report.Mapped)
+	g.body = new(strings.Builder)
+	write()
+	body := g.body.String()
+	g.body = outer
+	if len(g.report.Mapped) == mapped {
+		v = "_"
+	}
+	return body, v
+}
+
+// rangeVars returns the variables of a range clause over the keys and
+// values key and value, leaving out value if it's _.
+func rangeVars(key, value string) string {
+	if value == "_" {
+		return key
+	}
+	return key + ", " + value
+}
+
+func (g *converter) unmapped(path, reason string) {
+	g.report.Unmapped = append(g.report.Unmapped, UnmappedField{Path: path, Reason: reason})
+}
+
+// accessible reports whether the field f can be used in the package of the
+// function.
+func (g *converter) accessible(f *types.Var) bool {
+	return f.Exported() || f.Pkg() == g.pkg
+}
+
+func isStruct(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
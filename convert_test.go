@@ -0,0 +1,123 @@
+package astrewrite
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestGenerateConverter(t *testing.T) {
+	src := `package p
+
+type Inner struct {
+	X int
+	Y string
+}
+
+type InnerDTO struct {
+	X int
+	Y string
+}
+
+type Item struct{ ID int }
+
+type ItemDTO struct{ ID int }
+
+type User struct {
+	Name  string
+	Inner Inner
+	Items []Item
+	ByKey map[string]Item
+	Age   *int
+	Email string
+}
+
+type UserDTO struct {
+	Name  string
+	Inner InnerDTO
+	Items []ItemDTO
+	ByKey map[string]ItemDTO
+	Age   int
+	Mail  string
+}
+`
+	fset, file := parse(t, src)
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	pkg, err := new(types.Config).Check("p", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := func(name string) *types.Named {
+		return pkg.Scope().Lookup(name).Type().(*types.Named)
+	}
+
+	// generated from a marker, so that running again replaces the function
+	var report ConvReport
+	gen := func(ts *ast.TypeSpec, st *ast.StructType) ([]ast.Decl, error) {
+		var fd *ast.FuncDecl
+		fd, report = GenerateConverter(info, named(ts.Name.Name), named(ts.Name.Name+"DTO"))
+		return []ast.Decl{fd}, nil
+	}
+	marked := strings.Replace(src, "type User struct", "//gen:convert\ntype User struct", 1)
+	want := strings.Replace(marked, "\ntype UserDTO", `
+// UserToUserDTO converts a User into a UserDTO.
+//
+// TODO: convert Age: pointer to value.
+// TODO: convert Mail: no field Mail in User.
+//
+//astrewrite:generated marker=gen:convert from=User
+func UserToUserDTO(in User) UserDTO {
+	var out UserDTO
+	out.Name = in.Name
+	out.Inner.X = in.Inner.X
+	out.Inner.Y = in.Inner.Y
+	if in.Items != nil {
+		out.Items = make([]ItemDTO, len(in.Items))
+		for i, v := range in.Items {
+			out.Items[i].ID = v.ID
+		}
+	}
+	if in.ByKey != nil {
+		out.ByKey = make(map[string]ItemDTO, len(in.ByKey))
+		for k, v := range in.ByKey {
+			var w ItemDTO
+			w.ID = v.ID
+			out.ByKey[k] = w
+		}
+	}
+	return out
+}
+
+type UserDTO`, 1)
+	fset, file = parse(t, marked)
+	for i := 0; i < 2; i++ {
+		if r := GenerateFromMarkers(fset, file, "gen:convert", gen); r.Err != nil || r.Generated != 1 {
+			t.Fatalf("run %d: got report %+v", i, r)
+		}
+		checkSource(t, fset, file, want)
+	}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, nil); err != nil {
+		t.Error(err)
+	}
+
+	if len(report.Mapped) != 5 || len(report.Imports) != 0 {
+		t.Errorf("got mapped fields %q and imports %q, want 5 fields and no imports", report.Mapped, report.Imports)
+	}
+	if len(report.Unmapped) != 2 || report.Unmapped[0].Path != "Age" || report.Unmapped[1].Path != "Mail" {
+		t.Errorf("got unmapped fields %v, want Age and Mail", report.Unmapped)
+	}
+
+	// the panicking variant ends with a panic rather than a return
+	fd, _ := GenerateConverter(info, named("User"), named("UserDTO"), ConvPanics(), ConvName("toDTO"))
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), fd); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`panic("TODO: convert Age, Mail")`)) || bytes.Contains(buf.Bytes(), []byte("return out")) {
+		t.Errorf("got\n%s\nwant a final panic", buf.String())
+	}
+}
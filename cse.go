@@ -0,0 +1,153 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// ExtractCommonSubexpr looks for expressions occurring at least twice in
+// the same statement below node and evaluates them once into a temporary
+// declared right before the statement. It returns the number of extracted
+// expressions.
+//
+// It's deliberately conservative: only assignments, expression, return and
+// send statements are considered, as their expressions are evaluated once
+// per execution, and candidates must be operations free of side effects.
+// Calls only qualify if they're builtins like len or listed in pureFuncs,
+// named like they're called ("strings.ToUpper"). Occurrences inside function
+// literals and on the right of && and ||, which might not be evaluated, are
+// left alone.
+func ExtractCommonSubexpr(node ast.Node, pureFuncs ...string) int {
+	c := &cse{names: NewNameGen(node), pure: make(map[string]bool)}
+	for _, f := range pureFuncs {
+		c.pure[f] = true
+	}
+
+	Walk(node, func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			n.List = c.stmts(n.List)
+		case *ast.CaseClause:
+			n.Body = c.stmts(n.Body)
+		case *ast.CommClause:
+			n.Body = c.stmts(n.Body)
+		}
+		return n, true
+	})
+	return c.count
+}
+
+type cse struct {
+	names *NameGen
+	pure  map[string]bool
+	count int
+}
+
+func (c *cse) stmts(list []ast.Stmt) []ast.Stmt {
+	var out []ast.Stmt
+	for _, s := range list {
+		switch s.(type) {
+		case *ast.AssignStmt, *ast.ExprStmt, *ast.ReturnStmt, *ast.SendStmt:
+			for {
+				occurrences := c.common(s)
+				if occurrences == nil {
+					break
+				}
+				name := c.names.Name("tmp")
+				out = append(out, c.extract(s, name, occurrences))
+				c.count++
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// common returns the occurrences of the first expression in s that occurs
+// at least twice and can be extracted.
+func (c *cse) common(s ast.Stmt) []ast.Expr {
+	var candidates []ast.Expr
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.BinaryExpr:
+			candidates = append(candidates, n)
+			if n.Op == token.LAND || n.Op == token.LOR {
+				ast.Inspect(n.X, visit)
+				return false
+			}
+		case *ast.UnaryExpr:
+			if n.Op != token.AND && n.Op != token.ARROW {
+				candidates = append(candidates, n)
+			}
+		case *ast.CallExpr:
+			candidates = append(candidates, n)
+		}
+		return true
+	}
+	ast.Inspect(s, visit)
+
+	free := make(map[string]bool)
+	for _, name := range FreeVars(s) {
+		free[name] = true
+	}
+	valid := func(e ast.Expr) bool {
+		if hasSideEffects(e, c.pure) {
+			return false
+		}
+		vars := FreeVars(e)
+		for _, v := range vars {
+			if !free[v] {
+				// declared inside the statement
+				return false
+			}
+		}
+		return len(vars) > 0
+	}
+
+	for i, e := range candidates {
+		if !valid(e) {
+			continue
+		}
+		occurrences := []ast.Expr{e}
+		for _, o := range candidates[i+1:] {
+			if o.Pos() >= e.End() && Equal(e, o) {
+				occurrences = append(occurrences, o)
+			}
+		}
+		if len(occurrences) > 1 {
+			return occurrences
+		}
+	}
+	return nil
+}
+
+// extract replaces the occurrences in s with name and returns the statement
+// declaring it.
+func (c *cse) extract(s ast.Stmt, name string, occurrences []ast.Expr) ast.Stmt {
+	value := Clone(occurrences[0]).(ast.Expr)
+	stampPositions(value, s.Pos())
+	def := &ast.AssignStmt{
+		Lhs:    []ast.Expr{&ast.Ident{NamePos: s.Pos(), Name: name}},
+		TokPos: s.Pos(),
+		Tok:    token.DEFINE,
+		Rhs:    []ast.Expr{value},
+	}
+
+	replace := make(map[ast.Node]bool)
+	for _, o := range occurrences {
+		replace[o] = true
+	}
+	Walk(s, func(n ast.Node) (ast.Node, bool) {
+		if p, ok := n.(*ast.ParenExpr); ok && replace[p.X] {
+			return &ast.Ident{NamePos: p.Pos(), Name: name}, false
+		}
+		if replace[n] {
+			return &ast.Ident{NamePos: n.Pos(), Name: name}, false
+		}
+		return n, true
+	})
+	return def
+}
@@ -0,0 +1,53 @@
+package astrewrite
+
+import "testing"
+
+func TestExtractCommonSubexpr(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(a, b, c int, s string) (int, int) {
+	x := (a*b + c) / (a*b + c + len(s))
+	if a > 0 {
+		return strings.ToLower(s) + strings.ToLower(s), a - b*c
+	}
+	return x * (b - c), x * (b - c)
+}
+`)
+
+	if n := ExtractCommonSubexpr(file, "strings.ToLower"); n != 3 {
+		t.Errorf("extracted %d expressions, want 3", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func f(a, b, c int, s string) (int, int) {
+	tmp := a*b + c
+	x := tmp / (tmp + len(s))
+	if a > 0 {
+		tmp2 := strings.ToLower(s)
+		return tmp2 + tmp2, a - b*c
+	}
+	tmp1 := x * (b - c)
+	return tmp1, tmp1
+}
+`)
+}
+
+func TestExtractCommonSubexprSkipped(t *testing.T) {
+	src := `package p
+
+func f(a, b int) int {
+	x := next(a) + next(a)
+	y := <-ch + <-ch
+	ok := b != 0 && a/b > 1 && a/b < 10
+	g := a*b + func() int { return a * b }()
+	h := 1<<3 + 1<<3
+	return x + y
+}
+`
+	fset, file := parse(t, src)
+
+	if n := ExtractCommonSubexpr(file); n != 0 {
+		t.Errorf("extracted %d expressions, want 0", n)
+	}
+	checkSource(t, fset, file, src)
+}
@@ -0,0 +1,120 @@
+package astrewrite
+
+import "go/ast"
+
+// Cursor describes the node the walk function was called with during a walk
+// of a Walker, the node pre or post was called with during ApplyCompat, or
+// the node fn was called with during WalkCursor.
+type Cursor struct {
+	w *walker
+
+	// the state of ApplyCompat, where w is nil
+	a      *application
+	parent ast.Node
+	name   string
+	iter   *applyIter
+	node   ast.Node
+
+	// edited is set once Node was deleted or replaced during WalkCursor,
+	// and propagate once its parent has to be deleted along with it
+	edited, propagate bool
+}
+
+// Cursor returns the cursor of the walk in progress, or nil if there's
+// none. It's meant to be called from the walk function, and is only valid
+// until it returns.
+func (w *Walker) Cursor() *Cursor {
+	if w.active == nil {
+		return nil
+	}
+	return &Cursor{w: w.active}
+}
+
+// Node returns the node the walk function was called with.
+func (c *Cursor) Node() ast.Node {
+	if c.w == nil {
+		return c.node
+	}
+	return c.w.node
+}
+
+// Parent returns the parent of Node, or nil at the root of the walk. During
+// ApplyCompat, the parent of the root is a placeholder holding it in its
+// field Node, like with astutil.Apply.
+func (c *Cursor) Parent() ast.Node {
+	if c.w == nil {
+		return c.parent
+	}
+	if len(c.w.stack) == 0 {
+		return nil
+	}
+	return c.w.stack[len(c.w.stack)-1]
+}
+
+// ancestors returns the ancestors of Node, starting at the root.
+func (c *Cursor) ancestors() []ast.Node {
+	if c.w == nil {
+		return c.a.stack
+	}
+	return c.w.stack
+}
+
+// Annotations returns the annotations of Node or, if it has none, of its
+// nearest anchored ancestor. It returns nil unless the walk was configured
+// with WithAnnotations.
+func (c *Cursor) Annotations() []Annotation {
+	if c.w == nil {
+		return nil
+	}
+	a := c.w.ann
+	if a == nil {
+		return nil
+	}
+	if anns := a.anchored[c.w.node]; len(anns) > 0 {
+		return anns
+	}
+	for i := len(c.w.stack) - 1; i >= 0; i-- {
+		if anns := a.anchored[c.w.stack[i]]; len(anns) > 0 {
+			return anns
+		}
+	}
+	return nil
+}
+
+// InDefer reports whether Node is part of a defer statement, including the
+// bodies of the function literals it defers, which run when the function
+// returns rather than where they appear.
+func (c *Cursor) InDefer() bool {
+	return c.within(func(n ast.Node) bool {
+		_, ok := n.(*ast.DeferStmt)
+		return ok
+	})
+}
+
+// InGoStmt reports whether Node is part of a go statement, including the
+// bodies of the function literals it starts, which run in another
+// goroutine.
+func (c *Cursor) InGoStmt() bool {
+	return c.within(func(n ast.Node) bool {
+		_, ok := n.(*ast.GoStmt)
+		return ok
+	})
+}
+
+// InClosure reports whether Node is part of a function literal.
+func (c *Cursor) InClosure() bool {
+	return c.within(func(n ast.Node) bool {
+		_, ok := n.(*ast.FuncLit)
+		return ok
+	})
+}
+
+// within reports whether an ancestor of Node satisfies match.
+func (c *Cursor) within(match func(ast.Node) bool) bool {
+	for _, n := range c.ancestors() {
+		if match(n) {
+			return true
+		}
+	}
+	return false
+}
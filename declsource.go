@@ -0,0 +1,162 @@
+package astrewrite
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// ReplaceDeclSource replaces the source of the top-level declaration of
+// declName in src, the source f was parsed from into fset, with the printed
+// newDecl, and leaves every other byte alone, comments, spacing and
+// formatting quirks included. declName names a function, a type, a
+// constant or a variable, or a method as Type.Method. A name declared by a
+// spec of a grouped declaration, like a type of a type ( ... ) block, only
+// has its spec replaced, by the single spec of newDecl.
+//
+// newDecl is printed with fset, so it must have been parsed into fset, like
+// generated code parsed along with f, or have no positions at all. Only
+// its comments attached to nodes, like doc comments and comments of struct
+// fields, are printed. The doc comment of the replaced declaration is
+// replaced if newDecl has one, and kept otherwise. Lines after the first
+// are indented like the line the declaration starts on.
+//
+// It fails if declName isn't declared in f, or declared more than once,
+// like init functions are.
+func ReplaceDeclSource(src []byte, fset *token.FileSet, f *ast.File, declName string, newDecl ast.Decl) ([]byte, error) {
+	tf := fset.File(f.Pos())
+	if tf == nil {
+		return nil, fmt.Errorf("astrewrite: file not in FileSet")
+	}
+
+	var found []ast.Node
+	for _, d := range f.Decls {
+		if n := declaring(d, declName); n != nil {
+			found = append(found, n)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("astrewrite: %s isn't declared", declName)
+	case 1:
+	default:
+		return nil, fmt.Errorf("astrewrite: %s is declared %d times", declName, len(found))
+	}
+
+	old, repl := found[0], ast.Node(newDecl)
+	if _, ok := old.(ast.Spec); ok {
+		gd, ok := newDecl.(*ast.GenDecl)
+		if !ok || len(gd.Specs) != 1 {
+			return nil, fmt.Errorf("astrewrite: %s is declared in a group, replacing it needs a single spec", declName)
+		}
+		repl = gd.Specs[0]
+		if gd.Doc != nil {
+			// the doc comment of an ungrouped declaration belongs to it
+			repl = withDoc(repl, gd.Doc)
+		}
+	}
+
+	pos := old.Pos()
+	if oldDoc, newDoc := docComment(old), docComment(repl); newDoc != nil && oldDoc != nil {
+		pos = oldDoc.Pos()
+	}
+	start, end := tf.Offset(pos), tf.Offset(old.End())
+	indent := lineIndent(src, start)
+	// printIndented prints the comments of a file, which are those of
+	// newDecl here
+	text, err := printIndented(fset, &ast.File{Comments: attachedComments(repl)}, repl, indent)
+	if err != nil {
+		return nil, err
+	}
+	if indent != "" && !strings.Contains(indent, "\t") {
+		// a spec of a group indented with spaces, which the nested
+		// levels of the printed spec should use as well
+		text = spaceIndent(text, indent)
+	}
+
+	out := make([]byte, 0, len(src)-(end-start)+len(text))
+	out = append(out, src[:start]...)
+	out = append(out, text...)
+	return append(out, src[end:]...), nil
+}
+
+// withDoc returns a copy of spec with the doc comment doc.
+func withDoc(spec ast.Node, doc *ast.CommentGroup) ast.Node {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		cp := *spec
+		cp.Doc = doc
+		return &cp
+	case *ast.ValueSpec:
+		cp := *spec
+		cp.Doc = doc
+		return &cp
+	}
+	return spec
+}
+
+// spaceIndent replaces the tabs following unit at the start of the lines
+// of text after the first, as indented by printIndented, by unit.
+func spaceIndent(text []byte, unit string) []byte {
+	lines := bytes.Split(text, []byte("\n"))
+	for i := 1; i < len(lines); i++ {
+		line, ok := bytes.CutPrefix(lines[i], []byte(unit))
+		if !ok {
+			continue
+		}
+		tabs := len(line) - len(bytes.TrimLeft(line, "\t"))
+		lines[i] = append([]byte(strings.Repeat(unit, 1+tabs)), line[tabs:]...)
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// declaring returns d if it's the declaration of name, the spec of d
+// declaring it if d is a grouped declaration, or nil.
+func declaring(d ast.Decl, name string) ast.Node {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		fname := d.Name.Name
+		if recv, _, _, ok := ReceiverType(d); ok {
+			fname = recv + "." + fname
+		}
+		if fname == name {
+			return d
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			var names []*ast.Ident
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				names = []*ast.Ident{spec.Name}
+			case *ast.ValueSpec:
+				names = spec.Names
+			}
+			for _, id := range names {
+				if id.Name != name {
+					continue
+				}
+				if d.Lparen.IsValid() {
+					return spec
+				}
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// attachedComments returns the comment groups attached to the nodes of the
+// tree rooted at node, in source order.
+func attachedComments(node ast.Node) []*ast.CommentGroup {
+	var groups []*ast.CommentGroup
+	ast.Inspect(node, func(n ast.Node) bool {
+		if cg, ok := n.(*ast.CommentGroup); ok {
+			groups = append(groups, cg)
+			return false
+		}
+		return true
+	})
+	return groups
+}
@@ -0,0 +1,83 @@
+package astrewrite
+
+import (
+	"go/parser"
+	"strings"
+	"testing"
+)
+
+// oddSource is deliberately not gofmt'ed.
+const oddSource = `package api
+
+import "time"
+
+// Version   is hand  maintained.
+const Version="1.2"   // keep
+
+type (
+    // Request is replaced.
+    Request struct {
+        ID string
+    }
+
+    Response struct{Body []byte;   Took time.Duration}
+)
+
+func   handle( r Request )Response{
+	return Response{}   // odd
+}
+`
+
+func TestReplaceDeclSource(t *testing.T) {
+	fset, file := parse(t, oddSource)
+	gen, err := parser.ParseFile(fset, "gen.go", `package api
+
+// Request is a request to the API.
+type Request struct {
+	ID      string
+	Timeout time.Duration // zero means none
+}
+`, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ReplaceDeclSource([]byte(oddSource), fset, file, "Request", gen.Decls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package api
+
+import "time"
+
+// Version   is hand  maintained.
+const Version="1.2"   // keep
+
+type (
+    // Request is a request to the API.
+    Request struct {
+        ID      string
+        Timeout time.Duration // zero means none
+    }
+
+    Response struct{Body []byte;   Took time.Duration}
+)
+
+func   handle( r Request )Response{
+	return Response{}   // odd
+}
+`
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	src := "package p\n\nfunc init() {}\n\nfunc init() {}\n"
+	fset, file = parse(t, src)
+	for _, name := range []string{"Missing", "init"} {
+		if _, err := ReplaceDeclSource([]byte(src), fset, file, name, gen.Decls[0]); err == nil {
+			t.Errorf("%s: got no error", name)
+		} else if strings.Contains(err.Error(), "FileSet") {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
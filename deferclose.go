@@ -0,0 +1,91 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// CheckDeferredClose rewrites the deferred calls in the body of fn matched
+// by closerMatch, like defer f.Close(), into deferred closures handing the
+// error of the call to the error result of fn unless that already holds an
+// error:
+//
+//	defer func() {
+//		if cerr := f.Close(); cerr != nil && err == nil {
+//			err = cerr
+//		}
+//	}()
+//
+// fn must have an error as its last result. If its results are unnamed, they
+// are named, the error with a name not used in fn and the others _. Deferred
+// calls in function literals are left alone. It returns the number of
+// rewritten calls.
+func CheckDeferredClose(fn *ast.FuncDecl, closerMatch func(*ast.CallExpr) bool) int {
+	results := fn.Type.Results
+	if fn.Body == nil || results == nil || len(results.List) == 0 {
+		return 0
+	}
+	last := results.List[len(results.List)-1]
+	if id, ok := last.Type.(*ast.Ident); !ok || id.Name != "error" {
+		return 0
+	}
+
+	var defers []*ast.DeferStmt
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			if closerMatch(n.Call) {
+				defers = append(defers, n)
+			}
+		}
+		return true
+	})
+	if len(defers) == 0 {
+		return 0
+	}
+
+	gen := NewNameGen(fn)
+	if len(last.Names) == 0 {
+		for _, f := range results.List {
+			f.Names = []*ast.Ident{{NamePos: f.Type.Pos(), Name: "_"}}
+		}
+		last.Names[0].Name = gen.Name("err")
+		if !results.Opening.IsValid() {
+			results.Opening, results.Closing = last.Pos(), last.End()
+		}
+	}
+	errName := last.Names[len(last.Names)-1]
+	if errName.Name == "_" {
+		errName.Name = gen.Name("err")
+	}
+	cerr := gen.Name("cerr")
+
+	for _, d := range defers {
+		check := &ast.IfStmt{
+			Init: &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(cerr)},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{d.Call},
+			},
+			Cond: &ast.BinaryExpr{
+				X:  &ast.BinaryExpr{X: ast.NewIdent(cerr), Op: token.NEQ, Y: ast.NewIdent("nil")},
+				Op: token.LAND,
+				Y:  &ast.BinaryExpr{X: ast.NewIdent(errName.Name), Op: token.EQL, Y: ast.NewIdent("nil")},
+			},
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(errName.Name)},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent(cerr)},
+			}}},
+		}
+		d.Call = &ast.CallExpr{
+			Fun: &ast.FuncLit{
+				Type: &ast.FuncType{Func: d.Defer, Params: &ast.FieldList{}},
+				Body: &ast.BlockStmt{List: []ast.Stmt{check}},
+			},
+		}
+	}
+	return len(defers)
+}
@@ -0,0 +1,90 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func isClose(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Close" && len(call.Args) == 0
+}
+
+func TestCheckDeferredClose(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func read(name string) (data []byte, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	defer mu.Unlock()
+	go func() {
+		defer f.Close()
+	}()
+	return io.ReadAll(f)
+}
+
+func write(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(nil)
+	return err
+}
+
+func count(name string) int {
+	f, _ := os.Open(name)
+	defer f.Close()
+	return 0
+}
+`)
+
+	for name, want := range map[string]int{"read": 1, "write": 1, "count": 0} {
+		if n := CheckDeferredClose(findFunc(file, name), isClose); n != want {
+			t.Errorf("%s: rewrote %d calls, want %d", name, n, want)
+		}
+	}
+	checkSource(t, fset, file, `package p
+
+func read(name string) (data []byte, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	defer mu.Unlock()
+	go func() {
+		defer f.Close()
+	}()
+	return io.ReadAll(f)
+}
+
+func write(name string) (err1 error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err1 == nil {
+			err1 = cerr
+		}
+	}()
+	_, err = f.Write(nil)
+	return err
+}
+
+func count(name string) int {
+	f, _ := os.Open(name)
+	defer f.Close()
+	return 0
+}
+`)
+}
@@ -0,0 +1,107 @@
+package astrewrite
+
+import "go/ast"
+
+// ExtractDuplicateDefers extracts the deferred function literals of file
+// that appear, with equal bodies, in more than one function, like
+//
+//	defer func() {
+//		if r := recover(); r != nil {
+//			log.Print(r)
+//		}
+//	}()
+//
+// into a function declared at the end of the file, named cleanup or
+// cleanup followed by a number, and defers calls of that
+// function instead. Only literals without parameters and results called
+// without arguments are extracted, and only if they capture nothing: every
+// identifier they refer to but don't declare must be declared outside the
+// function, like package level names, imports and builtins. Literals holding
+// comments are left alone. It returns the number of defers rewritten.
+func ExtractDuplicateDefers(file *ast.File) int {
+	type deferred struct {
+		fd  *ast.FuncDecl
+		d   *ast.DeferStmt
+		lit *ast.FuncLit
+	}
+	var groups [][]deferred
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			d, ok := n.(*ast.DeferStmt)
+			if !ok {
+				return true
+			}
+			lit, ok := ast.Unparen(d.Call.Fun).(*ast.FuncLit)
+			if !ok || len(d.Call.Args) > 0 || lit.Type.Params.NumFields() > 0 || lit.Type.Results.NumFields() > 0 ||
+				capturesLocals(fd, lit) || hasComments(file, lit) {
+				return true
+			}
+			for i, g := range groups {
+				if Equal(g[0].lit.Body, lit.Body) {
+					groups[i] = append(g, deferred{fd, d, lit})
+					return true
+				}
+			}
+			groups = append(groups, []deferred{{fd, d, lit}})
+			return true
+		})
+	}
+
+	// the functions go to the end of the file, where nothing follows that
+	// they could be printed into
+	end := file.End()
+	if n := len(file.Comments); n > 0 && file.Comments[n-1].End() > end {
+		end = file.Comments[n-1].End()
+	}
+	n := 0
+	for _, g := range groups {
+		funcs := make(map[*ast.FuncDecl]bool)
+		for _, def := range g {
+			funcs[def.fd] = true
+		}
+		if len(funcs) < 2 {
+			continue
+		}
+
+		name := unusedName(file, "cleanup")
+		body := Clone(g[0].lit.Body).(*ast.BlockStmt)
+		clearPositions(body)
+		file.Decls = append(file.Decls, &ast.FuncDecl{
+			Name: &ast.Ident{NamePos: end, Name: name},
+			Type: &ast.FuncType{Func: end, Params: &ast.FieldList{}},
+			Body: body,
+		})
+
+		for _, def := range g {
+			pos := def.lit.Pos()
+			def.d.Call = &ast.CallExpr{Fun: &ast.Ident{NamePos: pos, Name: name}, Lparen: pos, Rparen: pos}
+			n++
+		}
+	}
+	return n
+}
+
+// capturesLocals reports whether lit, a function literal in fd, refers to
+// a name declared in fd outside of lit.
+func capturesLocals(fd *ast.FuncDecl, lit *ast.FuncLit) bool {
+	for _, name := range FreeVars(lit) {
+		if declaredIn(fd, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasComments reports whether a comment of file lies within node.
+func hasComments(file *ast.File, node ast.Node) bool {
+	for _, cg := range file.Comments {
+		if node.Pos() <= cg.Pos() && cg.End() <= node.End() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package astrewrite
+
+import "testing"
+
+func TestExtractDuplicateDefers(t *testing.T) {
+	fset, file := parse(t, `package p
+
+var mu sync.Mutex
+
+// f does things.
+func f() {
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		log.Print("unlocked")
+	}()
+}
+
+func g(n int) {
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		log.Print("unlocked")
+	}()
+}
+
+func h(n int) {
+	defer func() { log.Print(n) }()
+}
+
+func k(n int) {
+	defer func() { log.Print(n) }()
+}
+`)
+
+	if n := ExtractDuplicateDefers(file); n != 2 {
+		t.Errorf("rewrote %d defers, want 2", n)
+	}
+
+	checkSource(t, fset, file, `package p
+
+var mu sync.Mutex
+
+// f does things.
+func f() {
+	mu.Lock()
+	defer cleanup()
+
+}
+
+func g(n int) {
+	mu.Lock()
+	defer cleanup()
+
+}
+
+func h(n int) {
+	defer func() { log.Print(n) }()
+}
+
+func k(n int) {
+	defer func() { log.Print(n) }()
+}
+func cleanup() { mu.Unlock(); log.Print("unlocked") }
+`)
+}
@@ -0,0 +1,167 @@
+package astrewrite
+
+import "go/ast"
+
+// unlocks maps the locking methods of sync.Mutex and sync.RWMutex to their
+// unlocking counterparts.
+var unlocks = map[string]string{"Lock": "Unlock", "RLock": "RUnlock"}
+
+// DeferUnlock rewrites the lock cycles in the body of fn that may leak a
+// lock, like
+//
+//	mu.Lock()
+//	if bad {
+//		return errBad
+//	}
+//	mu.Unlock()
+//	return nil
+//
+// into ones unlocking with a deferred call right after locking:
+//
+//	mu.Lock()
+//	defer mu.Unlock()
+//	if bad {
+//		return errBad
+//	}
+//	return nil
+//
+// Lock and RLock are handled. A cycle is only rewritten if the Lock and
+// Unlock calls are statements of the function body itself, not of a nested
+// block, there is a return statement between them, and they are the only
+// locking calls on their receiver in fn, function literals included, which
+// rules out functions locking more than once. As the deferred call unlocks
+// later than the explicit one did, Unlock must be the last statement of the
+// body or be followed only by a return statement whose results have no side
+// effects. It returns the number of rewritten cycles.
+func DeferUnlock(fn *ast.FuncDecl) int {
+	if fn.Body == nil {
+		return 0
+	}
+	list := fn.Body.List
+
+	var calls []*ast.SelectorExpr
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok && isLockMethod(sel.Sel.Name) {
+				calls = append(calls, sel)
+			}
+		}
+		return true
+	})
+	uses := func(x ast.Expr) int {
+		n := 0
+		for _, sel := range calls {
+			if Equal(sel.X, x) {
+				n++
+			}
+		}
+		return n
+	}
+
+	deferred := make(map[int]*ast.DeferStmt)
+	removed := make(map[int]bool)
+	for i, s := range list {
+		lock := lockCall(s)
+		if lock == nil || HasSideEffects(lock.X) {
+			continue
+		}
+		unlock := unlocks[lock.Sel.Name]
+		if unlock == "" || uses(lock.X) != 2 {
+			continue
+		}
+		j := i + 1
+		for j < len(list) {
+			if sel := lockCall(list[j]); sel != nil && sel.Sel.Name == unlock && Equal(sel.X, lock.X) {
+				break
+			}
+			j++
+		}
+		if j == len(list) || !containsReturn(list[i+1:j]) || !unlocksLast(list[j+1:]) {
+			continue
+		}
+
+		end := s.End()
+		call := list[j].(*ast.ExprStmt).X.(*ast.CallExpr)
+		stampPositions(call, end)
+		deferred[i] = &ast.DeferStmt{Defer: end, Call: call}
+		removed[j] = true
+	}
+	if len(deferred) == 0 {
+		return 0
+	}
+
+	var rewritten []ast.Stmt
+	for i, s := range list {
+		if !removed[i] {
+			rewritten = append(rewritten, s)
+		}
+		if d := deferred[i]; d != nil {
+			rewritten = append(rewritten, d)
+		}
+	}
+	fn.Body.List = rewritten
+	return len(deferred)
+}
+
+func isLockMethod(name string) bool {
+	switch name {
+	case "Lock", "Unlock", "RLock", "RUnlock", "TryLock", "TryRLock":
+		return true
+	}
+	return false
+}
+
+// lockCall returns the selector of s if it's a call of a locking method
+// without arguments, like mu.Lock().
+func lockCall(s ast.Stmt) *ast.SelectorExpr {
+	es, ok := s.(*ast.ExprStmt)
+	if !ok {
+		return nil
+	}
+	call, ok := es.X.(*ast.CallExpr)
+	if !ok || len(call.Args) != 0 {
+		return nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || !isLockMethod(sel.Sel.Name) {
+		return nil
+	}
+	return sel
+}
+
+// containsReturn reports whether list contains a return statement outside
+// of function literals.
+func containsReturn(list []ast.Stmt) bool {
+	found := false
+	for _, s := range list {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// unlocksLast reports whether list, the statements following an Unlock, can
+// run before the unlocking instead: it's empty or a single return without
+// side effects.
+func unlocksLast(list []ast.Stmt) bool {
+	if len(list) == 0 {
+		return true
+	}
+	ret, ok := list[0].(*ast.ReturnStmt)
+	if !ok || len(list) != 1 {
+		return false
+	}
+	for _, r := range ret.Results {
+		if HasSideEffects(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package astrewrite
+
+import "testing"
+
+func TestDeferUnlock(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func (c *cache) get(key string) (string, error) {
+	c.mu.RLock()
+	v, ok := c.m[key]
+	if !ok {
+		return "", errMissing
+	}
+	c.mu.RUnlock()
+	return v, nil
+}
+
+func (c *cache) swap(key, v string) error {
+	c.mu.Lock()
+	if c.m == nil {
+		return errClosed
+	}
+	c.m[key] = v
+	c.mu.Unlock()
+	c.mu.Lock()
+	if c.m == nil {
+		return errClosed
+	}
+	delete(c.m, key)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *cache) set(key, v string) error {
+	c.mu.Lock()
+	if c.m == nil {
+		return errClosed
+	}
+	c.m[key] = v
+	c.mu.Unlock()
+	return c.flush()
+}
+
+func (c *cache) clear() {
+	c.mu.Lock()
+	c.m = nil
+	c.mu.Unlock()
+}
+`)
+
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"get", 1, `func (c *cache) get(key string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.m[key]
+	if !ok {
+		return "", errMissing
+	}
+
+	return v, nil
+}`},
+		{"swap", 0, ""},
+		{"set", 0, ""},
+		{"clear", 0, ""},
+	}
+	for _, tt := range tests {
+		fn := findFunc(file, tt.name)
+		before := render(t, fset, fn)
+		if n := DeferUnlock(fn); n != tt.n {
+			t.Errorf("%s: rewrote %d cycles, want %d", tt.name, n, tt.n)
+		}
+		if tt.want == "" {
+			checkSource(t, fset, fn, before)
+			continue
+		}
+		checkSource(t, fset, fn, tt.want)
+	}
+}
@@ -0,0 +1,427 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Deprecation describes a use of a deprecated object.
+type Deprecation struct {
+	// Ident is the identifier referring to the object, which has its
+	// position.
+	Ident *ast.Ident
+
+	// Object is the deprecated object.
+	Object types.Object
+
+	// Name is the qualified name of the object, like example.com/p.F for
+	// a package-level object and example.com/p.T.M for a field or method
+	// of the type T.
+	Name string
+
+	// Hint is the text of the deprecation notice, without its
+	// "Deprecated:" prefix.
+	Hint string
+
+	// Replacement is the name Hint suggests using instead, as written in
+	// it, like os.ReadFile in "Use os.ReadFile instead.", or "".
+	Replacement string
+}
+
+// DeprecatedNames returns the deprecation notices in the doc comments of the
+// declarations in files, the syntax of the package importable as path, by
+// the qualified names of the deprecated objects, as used by Deprecation.
+// Following the convention, a notice is a paragraph starting with
+// "Deprecated: ". A notice on a declaration grouping several specs isn't
+// taken to apply to them; only their own doc comments count.
+//
+// The files of imported packages can be taken from their source, in the
+// module cache or GOROOT; export data doesn't carry doc comments.
+func DeprecatedNames(path string, files []*ast.File) map[string]string {
+	names := make(map[string]string)
+	add := func(doc *ast.CommentGroup, name string) {
+		if hint, ok := deprecationNotice(doc); ok {
+			names[path+"."+name] = hint
+		}
+	}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				name := d.Name.Name
+				if d.Recv != nil {
+					recv, _, _, ok := ReceiverType(d)
+					if !ok {
+						continue
+					}
+					name = recv + "." + name
+				}
+				add(d.Doc, name)
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					doc := d.Doc
+					if len(d.Specs) > 1 {
+						doc = nil
+					}
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Doc != nil {
+							doc = s.Doc
+						}
+						add(doc, s.Name.Name)
+						var fields *ast.FieldList
+						switch t := s.Type.(type) {
+						case *ast.StructType:
+							fields = t.Fields
+						case *ast.InterfaceType:
+							fields = t.Methods
+						}
+						for _, field := range fieldList(fields) {
+							for _, name := range field.Names {
+								add(field.Doc, s.Name.Name+"."+name.Name)
+							}
+						}
+					case *ast.ValueSpec:
+						if s.Doc != nil {
+							doc = s.Doc
+						}
+						for _, name := range s.Names {
+							add(doc, name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// fieldList returns the fields of fields, which may be nil.
+func fieldList(fields *ast.FieldList) []*ast.Field {
+	if fields == nil {
+		return nil
+	}
+	return fields.List
+}
+
+// deprecationNotice returns the deprecation notice in doc, if any.
+func deprecationNotice(doc *ast.CommentGroup) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, para := range strings.Split(doc.Text(), "\n\n") {
+		if hint, ok := strings.CutPrefix(para, "Deprecated: "); ok {
+			return strings.Join(strings.Fields(hint), " "), true
+		}
+	}
+	return "", false
+}
+
+// suggestedReplacement returns the name following "use" in hint, if it
+// looks like an identifier, possibly qualified. Doc links and trailing
+// punctuation are stripped.
+func suggestedReplacement(hint string) string {
+	words := strings.Fields(hint)
+	for i := 0; i+1 < len(words); i++ {
+		if !strings.EqualFold(words[i], "use") {
+			continue
+		}
+		name := strings.Trim(strings.TrimRight(words[i+1], ".,;:"), "[]`")
+		name = strings.TrimSuffix(name, "()")
+		valid := name != ""
+		for _, part := range strings.Split(name, ".") {
+			valid = valid && token.IsIdentifier(part)
+		}
+		if valid {
+			return name
+		}
+	}
+	return ""
+}
+
+// FindDeprecatedUses returns the uses in files of the objects deprecated
+// by the notices in deprecated, which maps qualified names to notices as
+// returned by DeprecatedNames, in the order they appear in files. info must
+// hold the Uses of files. Declarations aren't uses, but references within
+// the package declaring a deprecated object are.
+func FindDeprecatedUses(files []*ast.File, info *types.Info, deprecated map[string]string) []Deprecation {
+	var uses []Deprecation
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok || info.Uses[id] == nil {
+				return true
+			}
+			obj := info.Uses[id]
+			name := qualifiedName(obj)
+			if hint, ok := deprecated[name]; ok && name != "" {
+				uses = append(uses, Deprecation{
+					Ident:       id,
+					Object:      obj,
+					Name:        name,
+					Hint:        hint,
+					Replacement: suggestedReplacement(hint),
+				})
+			}
+			return true
+		})
+	}
+	return uses
+}
+
+// qualifiedName returns the qualified name of obj as used by Deprecation,
+// or "" if it has none, like local variables and fields of unnamed
+// structs.
+func qualifiedName(obj types.Object) string {
+	if obj.Pkg() == nil {
+		return ""
+	}
+	path := obj.Pkg().Path()
+	switch obj := obj.(type) {
+	case *types.Func:
+		recv := obj.Origin().Type().(*types.Signature).Recv()
+		if recv == nil {
+			break
+		}
+		named := namedType(recv.Type())
+		if named == nil {
+			return ""
+		}
+		return path + "." + named.Obj().Name() + "." + obj.Name()
+	case *types.Var:
+		if !obj.IsField() {
+			break
+		}
+		field := obj.Origin()
+		scope := obj.Pkg().Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			st, ok := tn.Type().Underlying().(*types.Struct)
+			if !ok {
+				continue
+			}
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i) == field {
+					return path + "." + name + "." + obj.Name()
+				}
+			}
+		}
+		return ""
+	}
+	if obj.Parent() != obj.Pkg().Scope() {
+		return ""
+	}
+	return path + "." + obj.Name()
+}
+
+// namedType returns the named type t is or points to, or nil.
+func namedType(t types.Type) *types.Named {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, _ := t.(*types.Named)
+	if named == nil {
+		return nil
+	}
+	return named.Origin()
+}
+
+// DeprecationReport describes what RewriteDeprecated did.
+type DeprecationReport struct {
+	// Rewritten is the number of rewritten uses.
+	Rewritten int
+
+	// Skipped holds the uses of mapped objects which are left alone, as
+	// their replacement can't be written in their place.
+	Skipped []*ast.Ident
+}
+
+// RewriteDeprecated replaces the uses in files of the objects named by the
+// keys of mapping, with qualified names as used by Deprecation, by the
+// objects named by their values. info must hold the Uses of files and
+// isn't updated.
+//
+// A package-level object is replaced by the package-level object with the
+// qualified name it maps to, like example.com/old.F by example.com/new.G,
+// adding the import of its package as needed and removing the imports
+// nothing refers to anymore. A field or method is replaced by the field or
+// method of the same type it maps to, given by its bare name, like
+// example.com/p.T.Old by New. Uses that can't be rewritten are reported,
+// like those in files dot importing the package of the deprecated object
+// and those whose new qualifier is already taken in their file.
+//
+// The replacements are taken as given: the new objects aren't checked to
+// exist or have the same types, so the mapping is best built from uses
+// reviewed by the caller.
+func RewriteDeprecated(files []*ast.File, info *types.Info, mapping map[string]string) DeprecationReport {
+	var report DeprecationReport
+	for _, f := range files {
+		r := &deprecationRewriter{file: f, info: info, mapping: mapping, report: &report}
+		r.rewrite()
+	}
+	return report
+}
+
+type deprecationRewriter struct {
+	file    *ast.File
+	info    *types.Info
+	mapping map[string]string
+	report  *DeprecationReport
+
+	// the import paths the file needs imports of, and those that lost
+	// qualifiers
+	needed  map[string]bool
+	dropped map[string]bool
+}
+
+func (r *deprecationRewriter) rewrite() {
+	r.needed, r.dropped = make(map[string]bool), make(map[string]bool)
+	Walk(r.file, func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			x, ok := n.X.(*ast.Ident)
+			if !ok {
+				break
+			}
+			pn, ok := r.info.Uses[x].(*types.PkgName)
+			if !ok {
+				break
+			}
+			if repl := r.replace(n.Sel, false); repl != nil {
+				r.dropped[pn.Imported().Path()] = true
+				return repl, false
+			}
+			return n, false
+		case *ast.Ident:
+			if repl := r.replace(n, true); repl != nil {
+				return repl, false
+			}
+		}
+		return n, true
+	})
+
+	for _, spec := range append([]*ast.ImportSpec(nil), r.file.Imports...) {
+		if path := importPath(spec); r.dropped[path] && !r.needed[path] && !r.refersTo(path) {
+			removeImport(r.file, spec)
+		}
+	}
+	var paths []string
+	for path := range r.needed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if _, ok := importedAs(r.file, path); !ok {
+			AddImport(r.file, path)
+		}
+	}
+}
+
+// replace returns the replacement of the use id, or nil if it isn't mapped
+// or can't be replaced. bare tells whether id isn't qualified.
+func (r *deprecationRewriter) replace(id *ast.Ident, bare bool) ast.Expr {
+	obj := r.info.Uses[id]
+	if obj == nil {
+		return nil
+	}
+	from := qualifiedName(obj)
+	to, ok := r.mapping[from]
+	if from == "" || !ok {
+		return nil
+	}
+
+	if obj.Parent() != obj.Pkg().Scope() {
+		// a field or method, renamed in place
+		if !token.IsIdentifier(to) {
+			r.report.Skipped = append(r.report.Skipped, id)
+			return nil
+		}
+		r.report.Rewritten++
+		return &ast.Ident{NamePos: id.NamePos, Name: to}
+	}
+
+	i := strings.LastIndex(to, ".")
+	if i < 0 || !token.IsIdentifier(to[i+1:]) {
+		r.report.Skipped = append(r.report.Skipped, id)
+		return nil
+	}
+	path, name := to[:i], to[i+1:]
+	if bare && path == obj.Pkg().Path() {
+		r.report.Rewritten++
+		return &ast.Ident{NamePos: id.NamePos, Name: name}
+	}
+	if bare && r.dotImports(obj.Pkg().Path()) {
+		r.report.Skipped = append(r.report.Skipped, id)
+		return nil
+	}
+	if path == r.pkgPath() {
+		r.report.Rewritten++
+		return &ast.Ident{NamePos: id.NamePos, Name: name}
+	}
+	qualifier, imported := importedAs(r.file, path)
+	if qualifier == "." || qualifier == "_" || !imported && !r.needed[path] && mentions(r.file, qualifier) {
+		r.report.Skipped = append(r.report.Skipped, id)
+		return nil
+	}
+	r.needed[path] = true
+	r.report.Rewritten++
+	return qualified(qualifier, name, id.NamePos)
+}
+
+// dotImports reports whether the file dot imports path.
+func (r *deprecationRewriter) dotImports(path string) bool {
+	for _, imp := range r.file.Imports {
+		if importPath(imp) == path && importName(imp) == "." {
+			return true
+		}
+	}
+	return false
+}
+
+// pkgPath returns the path of the package of the file, or "" if info
+// doesn't tell.
+func (r *deprecationRewriter) pkgPath() string {
+	for _, decl := range r.file.Decls {
+		var names []*ast.Ident
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			names = append(names, d.Name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name)
+				case *ast.ValueSpec:
+					names = append(names, s.Names...)
+				}
+			}
+		}
+		for _, name := range names {
+			if obj := r.info.Defs[name]; obj != nil && obj.Pkg() != nil {
+				return obj.Pkg().Path()
+			}
+		}
+	}
+	return ""
+}
+
+// refersTo reports whether a qualifier left in the file refers to the
+// package imported as path.
+func (r *deprecationRewriter) refersTo(path string) bool {
+	found := false
+	ast.Inspect(r.file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if pn, ok := r.info.Uses[id].(*types.PkgName); ok && pn.Imported().Path() == path {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,151 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+func TestDeprecated(t *testing.T) {
+	fset := token.NewFileSet()
+	parseFiles := func(srcs ...string) []*ast.File {
+		var files []*ast.File
+		for _, src := range srcs {
+			f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, f)
+		}
+		return files
+	}
+
+	// the module depends on example.com/legacy
+	legacy := parseFiles(`package legacy
+
+// Get returns the value.
+//
+// Deprecated: Use fresh.Get instead.
+func Get() int { return 1 }
+
+func Put(int) {}
+`)
+	legacyPkg, err := new(types.Config).Check("example.com/legacy", fset, legacy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := parseFiles(`package app
+
+import "example.com/legacy"
+
+type Config struct {
+	// Deprecated: Use Deadline instead.
+	Timeout  int
+	Deadline int
+}
+
+// oldHelper doubles n.
+//
+// Deprecated: use [newHelper].
+func oldHelper(n int) int { return 2 * n }
+
+func newHelper(n int) int { return n + n }
+
+func run(c Config) int {
+	c.Timeout = 3
+	legacy.Put(0)
+	return oldHelper(legacy.Get()) + c.Timeout
+}
+
+var _ = Config{Timeout: 1}
+`, `package app
+
+import . "example.com/legacy"
+
+func other() int { return Get() }
+`)
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+		if path != "example.com/legacy" {
+			return nil, fmt.Errorf("unknown import %q", path)
+		}
+		return legacyPkg, nil
+	})}
+	if _, err := conf.Check("example.com/app", fset, app, info); err != nil {
+		t.Fatal(err)
+	}
+
+	deprecated := DeprecatedNames("example.com/app", app)
+	for name, hint := range DeprecatedNames("example.com/legacy", legacy) {
+		deprecated[name] = hint
+	}
+	if len(deprecated) != 3 {
+		t.Errorf("got %d deprecated names, want 3: %v", len(deprecated), deprecated)
+	}
+
+	uses := FindDeprecatedUses(app, info, deprecated)
+	var got []string
+	for _, use := range uses {
+		got = append(got, fmt.Sprintf("%d:%s:%s", fset.Position(use.Ident.Pos()).Line, use.Name, use.Replacement))
+	}
+	want := []string{
+		"19:example.com/app.Config.Timeout:Deadline",
+		"21:example.com/app.oldHelper:newHelper",
+		"21:example.com/legacy.Get:fresh.Get",
+		"21:example.com/app.Config.Timeout:Deadline",
+		"24:example.com/app.Config.Timeout:Deadline",
+		"5:example.com/legacy.Get:fresh.Get",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got uses\n%v\nwant\n%v", got, want)
+	}
+
+	report := RewriteDeprecated(app, info, map[string]string{
+		"example.com/legacy.Get":         "example.com/fresh.Get",
+		"example.com/app.oldHelper":      "example.com/app.newHelper",
+		"example.com/app.Config.Timeout": "Deadline",
+	})
+	if report.Rewritten != 5 || len(report.Skipped) != 1 {
+		t.Errorf("rewrote %d uses and skipped %d, want 5 and 1", report.Rewritten, len(report.Skipped))
+	}
+	checkSource(t, fset, findFunc(app[0], "run"), `func run(c Config) int {
+	c.Deadline = 3
+	legacy.Put(0)
+	return newHelper(fresh.Get()) + c.Deadline
+}`)
+	checkSource(t, fset, app[0].Decls[0], `import (
+	"example.com/fresh"
+	"example.com/legacy"
+)`)
+	checkSource(t, fset, findFunc(app[1], "other"), `func other() int { return Get() }`)
+
+	// without the call of Put, the import of legacy goes away
+	app = parseFiles(`package app
+
+import "example.com/legacy"
+
+func get() int { return legacy.Get() }
+`)
+	info.Uses = make(map[*ast.Ident]types.Object)
+	if _, err := conf.Check("example.com/app", fset, app, info); err != nil {
+		t.Fatal(err)
+	}
+	RewriteDeprecated(app, info, map[string]string{"example.com/legacy.Get": "example.com/fresh.Get"})
+	checkSource(t, fset, app[0], `package app
+
+import "example.com/fresh"
+
+func get() int { return fresh.Get() }
+`)
+}
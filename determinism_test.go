@@ -0,0 +1,137 @@
+package astrewrite
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// runs is how often the operations below are repeated; map iteration order
+// is randomized, so any dependence on it shows up as differing outputs.
+const runs = 50
+
+func TestDeterministicSpliceEdits(t *testing.T) {
+	src := []byte("package p\n\nvar x, y = 1, 2\n")
+	fset, file := parse(t, string(src))
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	one, two := spec.Values[0], spec.Values[1]
+	edits := []Edit{
+		{Pos: one.Pos(), End: one.End(), Node: ast.NewIdent("b")},
+		{Pos: one.Pos(), End: one.End(), Node: ast.NewIdent("a")},
+		{Pos: two.Pos(), End: two.End(), Node: ast.NewIdent("c")},
+		{Pos: two.Pos(), End: two.End()},
+		{Pos: spec.Names[1].Pos(), End: spec.Names[1].End(), Node: ast.NewIdent("z")},
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	var first string
+	for i := 0; i < runs; i++ {
+		rnd.Shuffle(len(edits), func(i, j int) { edits[i], edits[j] = edits[j], edits[i] })
+		out, err := SpliceEdits(src, fset, file, edits, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = string(out)
+		} else if string(out) != first {
+			t.Fatalf("run %d:\n%s\nfirst run:\n%s", i, out, first)
+		}
+	}
+	if want := "package p\n\nvar x, z = a, \n"; first != want {
+		t.Errorf("got:\n%s\nwant:\n%s", first, want)
+	}
+}
+
+func TestDeterministicRenameAll(t *testing.T) {
+	src := `package p
+
+func g() {
+	x := 1
+	_ = a + x
+}
+
+func h() {
+	y := 2
+	_ = a + y
+}
+
+var a = 0
+`
+	var first string
+	for i := 0; i < runs; i++ {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := &types.Info{
+			Defs:      make(map[*ast.Ident]types.Object),
+			Uses:      make(map[*ast.Ident]types.Object),
+			Implicits: make(map[ast.Node]types.Object),
+		}
+		if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, info); err != nil {
+			t.Fatal(err)
+		}
+
+		// a can't become b, as both x and y do, and each of them would
+		// be reported if its use of a were checked first
+		report := RenameAll([]*ast.File{file}, info, func(obj types.Object) (string, bool) {
+			return "b", strings.Contains("axy", obj.Name())
+		})
+		var got strings.Builder
+		for _, r := range report.Refused {
+			fmt.Fprintf(&got, "%s: %s\n", r.Object.Name(), r.Reason)
+		}
+		if i == 0 {
+			first = got.String()
+		} else if got.String() != first {
+			t.Fatalf("run %d:\n%s\nfirst run:\n%s", i, got.String(), first)
+		}
+	}
+	if want := "a: conflicts with var x int\n"; first != want {
+		t.Errorf("got:\n%s\nwant:\n%s", first, want)
+	}
+}
+
+func TestDeterministicDriver(t *testing.T) {
+	files := map[string]string{
+		"a.go":     "package p\n\nfunc f() { g() }\n",
+		"b.go":     "package p\n\nfunc g() { f() }\n",
+		"sub/c.go": "package p\n\nvar v = f\n",
+	}
+	rename := func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "f" {
+			id.Name = "run"
+		}
+		return n, true
+	}
+
+	var first []byte
+	for i := 0; i < runs; i++ {
+		dir := writeFiles(t, files)
+		paths := make([]string, 0, len(files))
+		for name := range files {
+			paths = append(paths, dir+"/"+name)
+		}
+		var buf bytes.Buffer
+		report, err := NewDriver(rename, RecordSession("rename@v1", &buf)).Run(paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sort.SliceIsSorted(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path }) {
+			t.Errorf("run %d: files not sorted by path", i)
+		}
+		if i == 0 {
+			first = buf.Bytes()
+		} else if !bytes.Equal(buf.Bytes(), first) {
+			t.Fatalf("run %d:\n%s\nfirst run:\n%s", i, buf.Bytes(), first)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/token"
+)
+
+// DocAfterRewrite returns the documentation of the package made of files,
+// as go/doc computes it, so that documentation consistent with rewritten
+// files can be produced without writing them first. The files must be
+// named in fset, with a .go extension; test files, named *_test.go,
+// contribute examples.
+//
+// go/doc modifies the files it's given, removing function bodies and
+// unexported declarations, so it's run on copies of files, made with Clone,
+// and files are left as they are. The ImportPath of the result is empty
+// and left to the caller.
+func DocAfterRewrite(fset *token.FileSet, files []*ast.File) (*doc.Package, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("astrewrite: DocAfterRewrite: no files")
+	}
+	copies := make([]*ast.File, len(files))
+	for i, f := range files {
+		copies[i] = Clone(f).(*ast.File)
+	}
+	pkg, err := doc.NewFromFiles(fset, copies, "")
+	if err != nil {
+		return nil, fmt.Errorf("astrewrite: DocAfterRewrite: %v", err)
+	}
+	return pkg, nil
+}
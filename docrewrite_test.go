@@ -0,0 +1,69 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestDocAfterRewrite(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", `package p
+
+// Old does something.
+func Old() int {
+	return helper()
+}
+
+// Gone is removed by the rewrite.
+func Gone() {}
+
+func helper() int { return 1 }
+`, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []*ast.File{f}
+
+	// rename Old to New and remove Gone
+	for i, f := range files {
+		files[i] = Walk(f, func(n ast.Node) (ast.Node, bool) {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Name.Name == "Gone" {
+					return Remove, false
+				}
+			case *ast.Ident:
+				if n.Name == "Old" {
+					n.Name = "New"
+				}
+			}
+			return n, true
+		}).(*ast.File)
+	}
+	want := `package p
+
+// Old does something.
+func New() int {
+	return helper()
+}
+
+func helper() int { return 1 }
+`
+	checkSource(t, fset, files[0], want)
+
+	pkg, err := DocAfterRewrite(fset, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.Funcs) != 1 || pkg.Funcs[0].Name != "New" || pkg.Funcs[0].Doc != "Old does something.\n" {
+		t.Errorf("got funcs %+v, want New only", pkg.Funcs)
+	}
+	if pkg.Funcs[0].Decl.Body != nil {
+		t.Error("got the body of New in the documentation, want it stripped")
+	}
+
+	// the rewritten files keep their bodies and unexported declarations
+	checkSource(t, fset, files[0], want)
+}
@@ -0,0 +1,469 @@
+package astrewrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"hash/maphash"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Driver walks the Go files found below a set of paths and writes back the
+// files the walk changed.
+type Driver struct {
+	fn WalkFunc
+
+	lazyBodies bool
+	session    *session
+	hooks      FileHooks
+
+	print       func(fset *token.FileSet, f *ast.File) ([]byte, error)
+	postProcess func(path string, out []byte) ([]byte, error)
+
+	ctx           context.Context
+	workers       int
+	collectErrors bool
+
+	mu     sync.Mutex
+	bodies map[*ast.BlockStmt]*lazyBody
+}
+
+// DriverOption configures a Driver.
+type DriverOption func(*Driver)
+
+// NewDriver returns a Driver walking every file with fn.
+func NewDriver(fn WalkFunc, opts ...DriverOption) *Driver {
+	d := &Driver{fn: fn, ctx: context.Background(), workers: 1}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// FileHooks are called around the walk of every file by a Driver, see
+// Hooks. Either may be nil.
+type FileHooks struct {
+	// Before is called after the file is parsed and before it's walked.
+	Before func(*ast.File) error
+
+	// After is called after the file is walked and before it's written,
+	// so it may still change the file. The report holds the edits of
+	// the walk.
+	After func(*ast.File, *FileReport) error
+}
+
+// Hooks makes the Driver call hooks around the walk of every file. An
+// error returned by a hook aborts only its file, which is left unchanged
+// and gets the error in its report, while Run goes on with the others.
+func Hooks(hooks FileHooks) DriverOption {
+	return func(d *Driver) {
+		d.hooks = hooks
+	}
+}
+
+// WithPrinter makes the Driver print the files it changed with print
+// rather than like gofmt does, for instance with a printer.Config using
+// different settings.
+func WithPrinter(print func(fset *token.FileSet, f *ast.File) ([]byte, error)) DriverOption {
+	return func(d *Driver) {
+		d.print = print
+	}
+}
+
+// WithPostProcess makes the Driver pass the printed form of every file it
+// changed, along with its path, to process, and write what it returns,
+// which lets it insert a license header or normalize line endings. It's
+// called again every time the file changes, so it must not add what's
+// already there. An error aborts the run, like a printer error does.
+func WithPostProcess(process func(path string, out []byte) ([]byte, error)) DriverOption {
+	return func(d *Driver) {
+		d.postProcess = process
+	}
+}
+
+// WithContext makes Run stop when ctx is done: no file is started
+// afterwards, the files being processed are finished, and Run returns the
+// error of ctx.
+func WithContext(ctx context.Context) DriverOption {
+	return func(d *Driver) {
+		d.ctx = ctx
+	}
+}
+
+// WithConcurrency makes the Driver process up to n files at the same time,
+// each of them parsed, walked, printed and written by the same goroutine,
+// rather than one after the other. The walk function, hooks, printer and
+// post-processor must then be safe for concurrent use. n less than 1 is
+// taken as 1.
+func WithConcurrency(n int) DriverOption {
+	return func(d *Driver) {
+		d.workers = max(n, 1)
+	}
+}
+
+// CollectErrors makes Run go on with the other files after an error, and
+// return the errors of all files, joined, rather than stop at the first
+// one.
+func CollectErrors() DriverOption {
+	return func(d *Driver) {
+		d.collectErrors = true
+	}
+}
+
+// DriverReport describes a run of a Driver.
+type DriverReport struct {
+	// Files holds a report for every file walked, sorted by path.
+	Files []*FileReport
+
+	// Manifest records the run if enabled with RecordSession.
+	Manifest *Manifest
+}
+
+// FileReport describes what a Driver did to a single file.
+type FileReport struct {
+	// Path is the path of the file.
+	Path string
+
+	// Changed is set if the file was rewritten.
+	Changed bool
+
+	// SkippedBodies is the number of function bodies that were replaced
+	// by a placeholder, see LazyBodies.
+	SkippedBodies int
+
+	// LoadedBodies is the number of skipped bodies that were loaded
+	// during the walk.
+	LoadedBodies int
+
+	// Edits holds the nodes the walk replaced or removed, see WalkEdits.
+	Edits []Edit
+
+	// PostProcessed is set if the post-processing step changed the
+	// printed file, see WithPostProcess.
+	PostProcessed bool
+
+	// Err is the error a hook aborted the file with, see Hooks.
+	Err error
+}
+
+// Run walks the Go files given in paths and the Go files in the directory
+// trees given in paths, skipping directories named testdata or starting
+// with a dot or an underscore. Files are started in lexical order of their
+// paths, see WithConcurrency, and Run stops at the first error, except for
+// errors of hooks, which only abort their file, see CollectErrors. Files
+// are written to a temporary file first, which replaces them once
+// complete, so that stopping never leaves a file half-written.
+func (d *Driver) Run(paths ...string) (*DriverReport, error) {
+	files, err := goFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriverReport{}
+	if d.session != nil {
+		d.session.start(paths)
+	}
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	reports := make([]*FileReport, len(files))
+	errs := make([]error, len(files))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < d.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					continue
+				}
+				reports[i], errs[i] = d.file(files[i])
+				if errs[i] != nil && !d.collectErrors {
+					cancel()
+				}
+			}
+		}()
+	}
+schedule:
+	for i := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break schedule
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	var failed []error
+	for i, fr := range reports {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		}
+		if fr != nil {
+			report.Files = append(report.Files, fr)
+		}
+	}
+	switch {
+	case len(failed) > 0 && !d.collectErrors:
+		return report, failed[0]
+	case d.ctx.Err() != nil:
+		return report, errors.Join(append(failed, d.ctx.Err())...)
+	case len(failed) > 0:
+		return report, errors.Join(failed...)
+	}
+	if d.session != nil {
+		report.Manifest = d.session.manifest
+		if err := d.session.finish(); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// file walks and rewrites the file at path.
+func (d *Driver) file(path string) (*FileReport, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fr := &FileReport{Path: path}
+	fset := token.NewFileSet()
+	var file *ast.File
+	if d.lazyBodies {
+		file, err = d.parseSkeleton(fset, path, src, fr)
+	} else {
+		file, err = parser.ParseFile(fset, path, src, parser.ParseComments)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(file.Package)
+	defer d.forget(tf)
+
+	before := d.fingerprint(tf, file)
+	if d.hooks.Before != nil {
+		if err := d.hooks.Before(file); err != nil {
+			return d.abort(fr, src, err), nil
+		}
+	}
+	node, edits := WalkEdits(file, d.fn)
+	if file, _ = node.(*ast.File); file == nil {
+		return nil, fmt.Errorf("astrewrite: %s: file removed by walk", path)
+	}
+	fr.LoadedBodies = d.loaded(tf)
+	fr.Edits = edits
+	if d.hooks.After != nil {
+		if err := d.hooks.After(file, fr); err != nil {
+			return d.abort(fr, src, err), nil
+		}
+	}
+	// the edits of the walk tell most changes, those made in place are
+	// told by the fingerprint
+	if len(fr.Edits) == 0 && d.fingerprint(tf, file) == before && !d.bodiesChanged(tf) {
+		d.record(path, src, src)
+		return fr, nil
+	}
+
+	if err := d.loadAll(file); err != nil {
+		return nil, err
+	}
+	out, err := d.output(path, fset, file, fr)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(path, out, fi.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	d.record(path, src, out)
+	fr.Changed = true
+	return fr, nil
+}
+
+// output prints file, found at path, and post-processes the result.
+func (d *Driver) output(path string, fset *token.FileSet, file *ast.File, fr *FileReport) ([]byte, error) {
+	var out []byte
+	if d.print != nil {
+		var err error
+		if out, err = d.print(fset, file); err != nil {
+			return nil, fmt.Errorf("astrewrite: %s: %v", path, err)
+		}
+	} else {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, file); err != nil {
+			return nil, fmt.Errorf("astrewrite: %s: %v", path, err)
+		}
+		out = buf.Bytes()
+	}
+	if d.postProcess == nil {
+		return out, nil
+	}
+	processed, err := d.postProcess(path, out)
+	if err != nil {
+		return nil, fmt.Errorf("astrewrite: %s: %v", path, err)
+	}
+	fr.PostProcessed = !bytes.Equal(processed, out)
+	return processed, nil
+}
+
+// abort gives up on the file of fr, with the source src, because of err.
+func (d *Driver) abort(fr *FileReport, src []byte, err error) *FileReport {
+	fr.Err = err
+	d.record(fr.Path, src, src)
+	return fr
+}
+
+// record records the file at path in the session, if there's one.
+func (d *Driver) record(path string, in, out []byte) {
+	if d.session == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.session.record(path, in, out)
+}
+
+// writeFile writes data to a temporary file next to path, which then
+// replaces the file at path, so that the file is either left as it was or
+// completely written.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// fingerprint returns the digest of file, with skipped bodies that were
+// loaded replaced by their placeholders again.
+func (d *Driver) fingerprint(tf *token.File, file *ast.File) uint64 {
+	restore := d.unload(tf)
+	defer restore()
+	return digest(file)
+}
+
+// digestSeed seeds the digests of trees, which are only compared within a
+// process.
+var digestSeed = maphash.MakeSeed()
+
+// digest returns a hash of the tree rooted at node, covering the types,
+// values and positions of its nodes and the comments of files, without
+// printing it. Object and scope links are not followed.
+func digest(node ast.Node) uint64 {
+	var h maphash.Hash
+	h.SetSeed(digestSeed)
+	digestValue(&h, reflect.ValueOf(node))
+	return h.Sum64()
+}
+
+func digestValue(h *maphash.Hash, v reflect.Value) {
+	var buf [8]byte
+	writeInt := func(n int64) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		h.Write(buf[:])
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType {
+			h.WriteByte(0)
+			return
+		}
+		h.WriteByte(1)
+		digestValue(h, v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			h.WriteByte(0)
+			return
+		}
+		h.WriteString(v.Elem().Type().String())
+		digestValue(h, v.Elem())
+	case reflect.Slice:
+		writeInt(int64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			digestValue(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			digestValue(h, v.Field(i))
+		}
+	case reflect.String:
+		writeInt(int64(v.Len()))
+		h.WriteString(v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			h.WriteByte(1)
+		} else {
+			h.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(v.Int())
+	}
+}
+
+// goFiles returns the sorted paths of the Go files given by paths.
+func goFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := fi.Name()
+			if fi.IsDir() {
+				if p != path && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(name, ".go") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
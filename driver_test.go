@@ -0,0 +1,443 @@
+package astrewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// writeFiles creates the given files in a temporary directory and returns
+// its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readFile returns the contents of the named file in dir.
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestDriver(t *testing.T) {
+	unchanged := `package p
+
+func g() {}
+`
+	dir := writeFiles(t, map[string]string{
+		"a.go": `package p
+
+func f() {
+	g()
+}
+`,
+		"b.go":          unchanged,
+		"testdata/c.go": `package p; func f() {}`,
+	})
+
+	d := NewDriver(func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "f" {
+			id.Name = "h"
+		}
+		return n, true
+	})
+	report, err := d.Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Files) != 2 || !report.Files[0].Changed || report.Files[1].Changed {
+		t.Errorf("unexpected report %+v", report.Files)
+	}
+	if got, want := readFile(t, dir, "a.go"), `package p
+
+func h() {
+	g()
+}
+`; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := readFile(t, dir, "b.go"); got != unchanged {
+		t.Errorf("unchanged file was rewritten:\n%s", got)
+	}
+}
+
+func TestDriverLazyBodies(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.go": `package p
+
+type T struct{}
+
+// Old does things.
+func Old(x interface{ M() }) struct{ N int } {
+	// keep this comment
+	if x != nil {
+		x.M()
+	}
+	return struct{ N int }{}
+}
+
+func (T) Method() {
+	Old(nil) // call
+}
+
+func load() {
+	s := "{"
+	_ = s
+}
+`,
+		"b.go": `package p
+
+func untouched() {
+	// nothing to see
+}
+`,
+	})
+
+	var d *Driver
+	d = NewDriver(func(n ast.Node) (ast.Node, bool) {
+		fd, ok := n.(*ast.FuncDecl)
+		if !ok {
+			return n, true
+		}
+		if !d.Skipped(fd.Body) {
+			t.Errorf("body of %s not skipped", fd.Name.Name)
+		}
+		switch fd.Name.Name {
+		case "Old":
+			fd.Name.Name = "New"
+		case "load":
+			body, err := d.LoadBody(fd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body.List[0].(*ast.AssignStmt).Rhs[0].(*ast.BasicLit).Value = `"}"`
+		}
+		return n, false
+	}, LazyBodies())
+
+	report, err := d.Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := report.Files[0], report.Files[1]
+	if !a.Changed || a.SkippedBodies != 3 || a.LoadedBodies != 1 {
+		t.Errorf("unexpected report %+v", a)
+	}
+	if b.Changed || b.SkippedBodies != 1 || b.LoadedBodies != 0 {
+		t.Errorf("unexpected report %+v", b)
+	}
+
+	if got, want := readFile(t, dir, "a.go"), `package p
+
+type T struct{}
+
+// Old does things.
+func New(x interface{ M() }) struct{ N int } {
+	// keep this comment
+	if x != nil {
+		x.M()
+	}
+	return struct{ N int }{}
+}
+
+func (T) Method() {
+	Old(nil) // call
+}
+
+func load() {
+	s := "}"
+	_ = s
+}
+`; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDriverLazyBodiesLoadedUnchanged(t *testing.T) {
+	src := `package p
+
+func f() {
+	// comment
+	g()
+}
+`
+	dir := writeFiles(t, map[string]string{"a.go": src})
+
+	var d *Driver
+	d = NewDriver(func(n ast.Node) (ast.Node, bool) {
+		if fd, ok := n.(*ast.FuncDecl); ok {
+			if _, err := d.LoadBody(fd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return n, true
+	}, LazyBodies())
+
+	report, err := d.Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr := report.Files[0]; fr.Changed || fr.LoadedBodies != 1 {
+		t.Errorf("unexpected report %+v", fr)
+	}
+	if got := readFile(t, dir, "a.go"); got != src {
+		t.Errorf("file was rewritten:\n%s", got)
+	}
+}
+
+func TestDriverHooks(t *testing.T) {
+	small := "package p\n\nvar _ = []int{x, x, x}\n"
+	large := "package p\n\nvar _ = []int{" + strings.Repeat("x, ", 60) + "}\n"
+	broken := "package p\n\nvar _ = x\n"
+	dir := writeFiles(t, map[string]string{"a.go": small, "b.go": large, "c.go": broken})
+
+	// edits more than 50 nodes of a file are left for manual review
+	calls := 0
+	hooks := FileHooks{
+		Before: func(f *ast.File) error {
+			calls++
+			spec := f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+			if _, ok := spec.Values[0].(*ast.Ident); ok {
+				return errors.New("no setup")
+			}
+			return nil
+		},
+		After: func(f *ast.File, fr *FileReport) error {
+			if len(fr.Edits) > 50 {
+				return fmt.Errorf("%d edits, needs manual review", len(fr.Edits))
+			}
+			return nil
+		},
+	}
+	d := NewDriver(func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "x" {
+			return &ast.Ident{NamePos: id.NamePos, Name: "y"}, true
+		}
+		return n, true
+	}, Hooks(hooks))
+	report, err := d.Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Errorf("Before called %d times, want 3", calls)
+	}
+	a, b, c := report.Files[0], report.Files[1], report.Files[2]
+	if !a.Changed || a.Err != nil || len(a.Edits) != 3 {
+		t.Errorf("got report %+v for a.go", a)
+	}
+	if b.Changed || b.Err == nil || b.Err.Error() != "60 edits, needs manual review" {
+		t.Errorf("got report %+v for b.go", b)
+	}
+	if c.Changed || c.Err == nil || len(c.Edits) != 0 {
+		t.Errorf("got report %+v for c.go", c)
+	}
+	if got := readFile(t, dir, "a.go"); got != strings.ReplaceAll(small, "x", "y") {
+		t.Errorf("a.go not rewritten:\n%s", got)
+	}
+	if got := readFile(t, dir, "b.go"); got != large {
+		t.Errorf("b.go rewritten:\n%s", got)
+	}
+	if got := readFile(t, dir, "c.go"); got != broken {
+		t.Errorf("c.go rewritten:\n%s", got)
+	}
+}
+
+func TestDriverPrinter(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.go": `package p
+
+func f() {
+	g()
+}
+`})
+
+	const header = "// Copyright The Authors.\n\n"
+	rename := func(from, to string) WalkFunc {
+		return func(n ast.Node) (ast.Node, bool) {
+			if id, ok := n.(*ast.Ident); ok && id.Name == from {
+				id.Name = to
+			}
+			return n, true
+		}
+	}
+	opts := []DriverOption{
+		WithPrinter(func(fset *token.FileSet, f *ast.File) ([]byte, error) {
+			var buf bytes.Buffer
+			cfg := printer.Config{Tabwidth: 4, Mode: printer.UseSpaces}
+			err := cfg.Fprint(&buf, fset, f)
+			return buf.Bytes(), err
+		}),
+		WithPostProcess(func(path string, out []byte) ([]byte, error) {
+			if bytes.HasPrefix(out, []byte(header)) {
+				return out, nil
+			}
+			return append([]byte(header), out...), nil
+		}),
+	}
+
+	report, err := NewDriver(rename("g", "h"), opts...).Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr := report.Files[0]; !fr.Changed || !fr.PostProcessed {
+		t.Errorf("got report %+v, want the file changed and post-processed", fr)
+	}
+	want := header + "package p\n\nfunc f() {\n    h()\n}\n"
+	if got := readFile(t, dir, "a.go"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// the header is kept as a comment of the file, and not added again
+	report, err = NewDriver(rename("h", "k"), opts...).Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr := report.Files[0]; !fr.Changed || fr.PostProcessed {
+		t.Errorf("got report %+v, want the file changed and not post-processed", fr)
+	}
+	want = header + "package p\n\nfunc f() {\n    k()\n}\n"
+	if got := readFile(t, dir, "a.go"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	report, err = NewDriver(rename("h", "k"), opts...).Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr := report.Files[0]; fr.Changed {
+		t.Errorf("got report %+v, want the file unchanged", fr)
+	}
+	if got := readFile(t, dir, "a.go"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDriverCancel(t *testing.T) {
+	const src = "package p\n\nfunc f() {\n\tg()\n}\n"
+	const want = "package p\n\nfunc f() {\n\th()\n}\n"
+	files := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("d%d/f%03d.go", i%10, i)] = src
+	}
+	dir := writeFiles(t, files)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var walked atomic.Int32
+	d := NewDriver(func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.File:
+			if walked.Add(1) == 20 {
+				cancel()
+			}
+		case *ast.Ident:
+			if n.Name == "g" {
+				n.Name = "h"
+			}
+		}
+		return n, true
+	}, WithContext(ctx), WithConcurrency(4))
+	report, err := d.Run(dir)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if n := len(report.Files); n < 20 || n >= 200 {
+		t.Errorf("got %d files processed, want the run stopped after 20", n)
+	}
+
+	changed := 0
+	for name := range files {
+		switch got := readFile(t, dir, name); got {
+		case src:
+		case want:
+			changed++
+		default:
+			t.Errorf("%s is half-written:\n%s", name, got)
+		}
+	}
+	if changed != len(report.Files) {
+		t.Errorf("got %d files changed, want the %d reported", changed, len(report.Files))
+	}
+	tmps, err := filepath.Glob(filepath.Join(dir, "*", "*.tmp"))
+	if err != nil || len(tmps) > 0 {
+		t.Errorf("got temporary files %q left, error %v", tmps, err)
+	}
+}
+
+func TestDriverCollectErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.go": "package p\n\nfunc f( {}\n",
+		"b.go": "package p\n\nfunc g() {}\n",
+		"c.go": "package p\n\nfunc h() }\n",
+	})
+	walk := func(n ast.Node) (ast.Node, bool) { return n, true }
+
+	report, err := NewDriver(walk, WithConcurrency(2)).Run(dir)
+	if err == nil || strings.Contains(err.Error(), "c.go") {
+		t.Errorf("got error %v, want that of a.go only", err)
+	}
+
+	report, err = NewDriver(walk, WithConcurrency(2), CollectErrors()).Run(dir)
+	if err == nil || !strings.Contains(err.Error(), "a.go") || !strings.Contains(err.Error(), "c.go") {
+		t.Errorf("got error %v, want those of a.go and c.go", err)
+	}
+	if len(report.Files) != 1 || filepath.Base(report.Files[0].Path) != "b.go" {
+		t.Errorf("got report %+v, want b.go only", report.Files)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	_, file := parse(t, `package p
+
+// f does nothing.
+func f(x int) {
+	g(x)
+}
+`)
+	d := digest(file)
+	if digest(Clone(file)) != d {
+		t.Error("a copy of the file has another digest")
+	}
+
+	// changes made in place count, down to positions and comments
+	fd := findFunc(file, "f")
+	changes := []func(){
+		func() { fd.Name.Name = "h" },
+		func() { fd.Body.Rbrace++ },
+		func() { file.Comments[0].List[0].Text = "// f does something." },
+		func() { fd.Body.List = nil },
+	}
+	for i, change := range changes {
+		change()
+		if digest(file) == d {
+			t.Errorf("change %d: got the same digest", i)
+		}
+		d = digest(file)
+	}
+}
@@ -0,0 +1,210 @@
+package astrewrite
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Edit describes the replacement of the source range [Pos, End) with the
+// printed form of Node. A nil Node deletes the range.
+type Edit struct {
+	Pos, End token.Pos
+	Node     ast.Node
+}
+
+// WalkEdits is like Walk, but also returns an edit for every node fn
+// replaced or removed, covering the source range the node had before fn was
+// called. Changes fn makes to a node in place are not recorded; callers can
+// add an edit reprinting such a node themselves.
+func WalkEdits(node ast.Node, fn WalkFunc) (ast.Node, []Edit) {
+	var edits []Edit
+	rewritten := Walk(node, func(n ast.Node) (ast.Node, bool) {
+		if n == nil {
+			return fn(n)
+		}
+		pos, end := n.Pos(), n.End()
+		r, ok := fn(n)
+		if r != n {
+			e := Edit{Pos: pos, End: end, Node: r}
+			if r == Remove {
+				e.Node = nil
+			}
+			edits = append(edits, e)
+		}
+		return r, ok
+	})
+	return rewritten, edits
+}
+
+// SpliceEdits applies edits to src, the source file was parsed from, by
+// replacing only the edited byte ranges with the printed nodes and leaving
+// every other byte untouched, even if src isn't gofmt'ed. Edits nested in
+// another edit are covered by it and dropped, adjacent ones are merged;
+// edits overlapping partially are an error. Edits of the same range are
+// ordered by their printed nodes, so the result doesn't depend on the order
+// edits are given in. Printed nodes are indented like the line they start
+// on, and deletions spanning whole lines remove those lines. If gofmt is
+// set, the result is formatted as a whole afterwards.
+func SpliceEdits(src []byte, fset *token.FileSet, file *ast.File, edits []Edit, gofmt bool) ([]byte, error) {
+	tf := fset.File(file.Pos())
+	if tf == nil {
+		return nil, fmt.Errorf("astrewrite: file not in FileSet")
+	}
+
+	edits = append([]Edit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].Pos != edits[j].Pos {
+			return edits[i].Pos < edits[j].Pos
+		}
+		if edits[i].End != edits[j].End {
+			return edits[i].End > edits[j].End
+		}
+		return editKey(fset, edits[i]) < editKey(fset, edits[j])
+	})
+
+	type span struct {
+		start, end int
+		text       []byte
+	}
+	var spans []span
+	for _, e := range edits {
+		if !e.Pos.IsValid() || !e.End.IsValid() {
+			return nil, fmt.Errorf("astrewrite: edit without source range")
+		}
+		pos := e.Pos
+		if doc := docComment(e.Node); doc != nil && doc.Pos().IsValid() && doc.Pos() < pos {
+			// printed along with the node
+			pos = doc.Pos()
+		}
+		start, end := tf.Offset(pos), tf.Offset(e.End)
+
+		if n := len(spans); n > 0 && start < spans[n-1].end {
+			if end <= spans[n-1].end {
+				// nested in the previous edit
+				continue
+			}
+			return nil, fmt.Errorf("astrewrite: overlapping edits at %s", fset.Position(e.Pos))
+		}
+
+		indent := lineIndent(src, start)
+		var text []byte
+		if e.Node != nil {
+			var err error
+			if text, err = printIndented(fset, file, e.Node, indent); err != nil {
+				return nil, err
+			}
+		} else {
+			start, end = deletionRange(src, start, end)
+		}
+
+		if n := len(spans); n > 0 && start == spans[n-1].end {
+			spans[n-1].end = end
+			spans[n-1].text = append(spans[n-1].text, text...)
+			continue
+		}
+		spans = append(spans, span{start, end, text})
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		buf.Write(src[last:s.start])
+		buf.Write(s.text)
+		last = s.end
+	}
+	buf.Write(src[last:])
+
+	if gofmt {
+		return format.Source(buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// editKey orders edits of the same range, which would otherwise be applied
+// in the order they were given: deletions first, then by printed node.
+func editKey(fset *token.FileSet, e Edit) string {
+	if e.Node == nil {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteByte(' ')
+	printer.Fprint(&buf, fset, e.Node)
+	return buf.String()
+}
+
+// lineIndent returns the leading whitespace of the line containing offset.
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
+
+// deletionRange extends the deleted range [start, end) to the whole line
+// if nothing but whitespace would be left on it.
+func deletionRange(src []byte, start, end int) (int, int) {
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	if strings.TrimSpace(string(src[lineStart:start])) != "" {
+		return start, end
+	}
+	lineEnd := bytes.IndexByte(src[end:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src) - end
+	}
+	if strings.TrimSpace(string(src[end:end+lineEnd])) != "" {
+		return start, end
+	}
+	if end+lineEnd < len(src) {
+		lineEnd++
+	}
+	return lineStart, end + lineEnd
+}
+
+// printIndented prints node with the comments of file inside its range,
+// indenting all lines but the first with indent.
+func printIndented(fset *token.FileSet, file *ast.File, node ast.Node, indent string) ([]byte, error) {
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	tabs := strings.Count(indent, "\t")
+	if tabs == len(indent) {
+		cfg.Indent = tabs
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, &printer.CommentedNode{Node: node, Comments: file.Comments}); err != nil {
+		return nil, err
+	}
+	out := bytes.TrimLeft(buf.Bytes(), "\t")
+	if cfg.Indent == 0 && indent != "" {
+		// indentation with spaces, which the printer can't do; lines of
+		// multi-line raw strings get indented as well
+		out = bytes.ReplaceAll(out, []byte("\n"), []byte("\n"+indent))
+	}
+	return out, nil
+}
+
+// docComment returns the doc comment of node, if it has one.
+func docComment(node ast.Node) *ast.CommentGroup {
+	switch n := node.(type) {
+	case *ast.Field:
+		return n.Doc
+	case *ast.ImportSpec:
+		return n.Doc
+	case *ast.ValueSpec:
+		return n.Doc
+	case *ast.TypeSpec:
+		return n.Doc
+	case *ast.GenDecl:
+		return n.Doc
+	case *ast.FuncDecl:
+		return n.Doc
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const weirdSrc = `package   p
+import "fmt"
+func   a( )  { fmt.Println( "a" ) }
+
+// b prints x.
+func b() {
+	x := 1   // one
+	if x>0 {
+	      fmt.Println(  x )
+	}
+}
+var   c = 1
+`
+
+func TestSpliceEditsFunc(t *testing.T) {
+	fset, file := parse(t, weirdSrc)
+	fd := findFunc(file, "b")
+	start, end := fset.Position(fd.Doc.Pos()).Offset, fset.Position(fd.End()).Offset
+
+	// rename x in place and reprint the whole function
+	pos, oldEnd := fd.Pos(), fd.End()
+	ast.Inspect(fd, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "x" {
+			id.Name = "count"
+		}
+		return true
+	})
+
+	out, err := SpliceEdits([]byte(weirdSrc), fset, file, []Edit{{Pos: pos, End: oldEnd, Node: fd}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := string(out)
+	if got[:start] != weirdSrc[:start] {
+		t.Errorf("bytes before the function changed:\n%s", got[:start])
+	}
+	if !strings.HasSuffix(got, weirdSrc[end:]) {
+		t.Errorf("bytes after the function changed:\n%s", got)
+	}
+	want := `// b prints x.
+func b() {
+	count := 1 // one
+	if count > 0 {
+		fmt.Println(count)
+	}
+}`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant function:\n%s", got, want)
+	}
+}
+
+func TestSpliceEditsWalk(t *testing.T) {
+	fset, file := parse(t, weirdSrc)
+
+	_, edits := WalkEdits(findFunc(file, "b"), func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			// multi-line replacement, indented like the statement
+			return &ast.IfStmt{
+				Cond: ast.NewIdent("debug"),
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					&ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("trace")}},
+				}},
+			}, true
+		case *ast.BasicLit:
+			if n.Kind == token.INT {
+				// nested in the edit of the assignment for 1
+				return &ast.BasicLit{Kind: token.INT, Value: "2"}, true
+			}
+		case *ast.ExprStmt:
+			// removed along with its line
+			return nil, false
+		}
+		return n, true
+	})
+	if len(edits) != 4 {
+		t.Fatalf("got %d edits, want 4", len(edits))
+	}
+
+	out, err := SpliceEdits([]byte(weirdSrc), fset, file, edits, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package   p
+import "fmt"
+func   a( )  { fmt.Println( "a" ) }
+
+// b prints x.
+func b() {
+	if debug {
+		trace()
+	}   // one
+	if x>2 {
+	}
+}
+var   c = 1
+`
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, err = SpliceEdits([]byte(weirdSrc), fset, file, edits, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), "package p\n\nimport \"fmt\"\n\nfunc a() { fmt.Println(\"a\") }") {
+		t.Errorf("not formatted:\n%s", out)
+	}
+}
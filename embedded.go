@@ -0,0 +1,92 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// EmbeddedReport describes a run of RewriteEmbeddedGo.
+type EmbeddedReport struct {
+	// Rewritten is the number of literals whose source was changed.
+	Rewritten int
+
+	// Diagnostics holds the literals that were left alone because their
+	// source couldn't be parsed, printed or quoted back, in source order.
+	Diagnostics []EmbeddedDiagnostic
+}
+
+// EmbeddedDiagnostic describes a literal RewriteEmbeddedGo left alone.
+type EmbeddedDiagnostic struct {
+	Lit *ast.BasicLit
+	Err error
+}
+
+// RewriteEmbeddedGo rewrites the Go source held by the string literals of
+// f that locate reports as Go, like source strings passed to generators, so
+// that they keep up with the renames applied to the code around them. The
+// value of every such literal is parsed with ParseSnippet, as a file, an
+// expression, declarations or statements, walked with fn and printed back
+// into the literal with its original quoting, raw or interpreted, and the
+// white space leading and trailing its value. Literals whose source fn
+// doesn't change keep their formatting.
+//
+// Snippets that don't parse or print, and rewritten sources a raw string
+// can't hold because of a backquote, aren't errors: they're recorded in the
+// report and their literals are left alone.
+func RewriteEmbeddedGo(f *ast.File, locate func(lit *ast.BasicLit) bool, fn WalkFunc) EmbeddedReport {
+	var report EmbeddedReport
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING || !locate(lit) {
+			return true
+		}
+		value, err := rewriteEmbedded(lit, fn)
+		switch {
+		case err != nil:
+			report.Diagnostics = append(report.Diagnostics, EmbeddedDiagnostic{Lit: lit, Err: err})
+		case value != lit.Value:
+			lit.Value = value
+			report.Rewritten++
+		}
+		return true
+	})
+	return report
+}
+
+// rewriteEmbedded returns the literal lit with its source rewritten by fn.
+func rewriteEmbedded(lit *ast.BasicLit, fn WalkFunc) (string, error) {
+	src, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", err
+	}
+	s, err := ParseSnippet(src)
+	if err != nil {
+		return "", err
+	}
+	before, err := s.Source()
+	if err != nil {
+		return "", err
+	}
+	s.Node = Walk(s.Node, fn)
+	after, err := s.Source()
+	if err != nil {
+		return "", err
+	}
+	if after == before {
+		return lit.Value, nil
+	}
+
+	trimmed := strings.TrimSpace(src)
+	i := strings.Index(src, trimmed)
+	out := src[:i] + strings.TrimSpace(after) + src[i+len(trimmed):]
+	if !strings.HasPrefix(lit.Value, "`") {
+		return strconv.Quote(out), nil
+	}
+	if strings.Contains(out, "`") || strings.Contains(out, "\r") {
+		return "", fmt.Errorf("astrewrite: rewritten source can't be a raw string")
+	}
+	return "`" + out + "`", nil
+}
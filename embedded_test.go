@@ -0,0 +1,52 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestRewriteEmbeddedGo(t *testing.T) {
+	fset, file := parse(t, "package p\n\n"+
+		"var tmpl = gen(`\n"+
+		"func apply(c *Config) error {\n"+
+		"\treturn OldValidate(c)\n"+
+		"}\n"+
+		"`)\n\n"+
+		"var expr = gen(\"OldValidate(cfg)  && ok\")\n\n"+
+		"var broken = gen(\"OldValidate(\")\n\n"+
+		"var other = \"OldValidate(cfg)\"\n\n"+
+		"var same = gen(\"f( x )\")\n")
+
+	locate := func(lit *ast.BasicLit) bool {
+		for _, d := range file.Decls {
+			vs := d.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+			if call, ok := vs.Values[0].(*ast.CallExpr); ok && call.Args[0] == lit {
+				return true
+			}
+		}
+		return false
+	}
+	report := RewriteEmbeddedGo(file, locate, func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "OldValidate" {
+			id.Name = "Validate"
+		}
+		return n, true
+	})
+
+	if report.Rewritten != 2 {
+		t.Errorf("rewrote %d literals, want 2", report.Rewritten)
+	}
+	if len(report.Diagnostics) != 1 || report.Diagnostics[0].Lit.Value != `"OldValidate("` {
+		t.Errorf("got diagnostics %v, want the broken literal", report.Diagnostics)
+	}
+	checkSource(t, fset, file, "package p\n\n"+
+		"var tmpl = gen(`\n"+
+		"func apply(c *Config) error {\n"+
+		"\treturn Validate(c)\n"+
+		"}\n"+
+		"`)\n\n"+
+		"var expr = gen(\"Validate(cfg) && ok\")\n\n"+
+		"var broken = gen(\"OldValidate(\")\n\n"+
+		"var other = \"OldValidate(cfg)\"\n\n"+
+		"var same = gen(\"f( x )\")\n")
+}
@@ -0,0 +1,127 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// UseErrorsIs returns a WalkFunc replacing comparisons of errors to sentinel
+// errors by calls of errors.Is, which also match errors wrapping them:
+//
+//	err == io.EOF   becomes errors.Is(err, io.EOF)
+//	err != io.EOF   becomes !errors.Is(err, io.EOF)
+//
+// The comparisons may be written the other way around. Without type
+// information errors are told by their names: one side must be a variable
+// named err or ending with Err, like readErr, or a call of an Err method,
+// like ctx.Err(), and sentinel must report the other one, which is checked
+// with IsSentinelError if sentinel is nil.
+//
+// Walking a file, it rewrites the whole file at once, adding the import of
+// errors if needed and using an existing alias of it, and doesn't descend
+// into it; a file with something else named like the import is left alone.
+// Walking a node below a file, adding the import is up to the caller.
+func UseErrorsIs(sentinel func(e ast.Expr) bool) WalkFunc {
+	if sentinel == nil {
+		sentinel = IsSentinelError
+	}
+	return func(n ast.Node) (ast.Node, bool) {
+		file, ok := n.(*ast.File)
+		if !ok {
+			if call := errorsIs("errors", n, sentinel); call != nil {
+				return call, false
+			}
+			return n, true
+		}
+
+		pkg, imported := importedAs(file, "errors")
+		if !imported && mentions(file, pkg) {
+			return file, false
+		}
+		rewritten := false
+		Walk(file, func(n ast.Node) (ast.Node, bool) {
+			if call := errorsIs(pkg, n, sentinel); call != nil {
+				rewritten = true
+				return call, false
+			}
+			return n, true
+		})
+		if rewritten && !imported {
+			AddImport(file, "errors")
+		}
+		return file, false
+	}
+}
+
+// IsSentinelError reports whether e is named like a sentinel error: Err
+// followed by an upper case letter, like ErrNotExist or os.ErrNotExist, err
+// followed by one for unexported ones, like errClosed, or io.EOF,
+// context.Canceled or context.DeadlineExceeded.
+func IsSentinelError(e ast.Expr) bool {
+	var name string
+	switch e := e.(type) {
+	case *ast.Ident:
+		name = e.Name
+	case *ast.SelectorExpr:
+		if _, ok := e.X.(*ast.Ident); !ok {
+			return false
+		}
+		if isQualified(e, "io", "EOF") || isQualified(e, "context", "Canceled") || isQualified(e, "context", "DeadlineExceeded") {
+			return true
+		}
+		name = e.Sel.Name
+	default:
+		return false
+	}
+	for _, prefix := range []string{"Err", "err"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			r, _ := utf8.DecodeRuneInString(rest)
+			return unicode.IsUpper(r)
+		}
+	}
+	return false
+}
+
+// errorsIs returns the call of errors.Is, qualified by pkg, replacing n if
+// it compares an error to a sentinel, negated if it's !=, or nil.
+func errorsIs(pkg string, n ast.Node, sentinel func(ast.Expr) bool) ast.Expr {
+	be, ok := n.(*ast.BinaryExpr)
+	if !ok || be.Op != token.EQL && be.Op != token.NEQ {
+		return nil
+	}
+	err, target := be.X, be.Y
+	if !isErrorValue(err) || !sentinel(target) {
+		err, target = be.Y, be.X
+		if !isErrorValue(err) || !sentinel(target) {
+			return nil
+		}
+	}
+
+	pos := be.Pos()
+	var call ast.Expr = &ast.CallExpr{
+		Fun:    qualified(pkg, "Is", pos),
+		Lparen: pos,
+		Args:   []ast.Expr{err, target},
+		Rparen: be.End(),
+	}
+	if be.Op == token.NEQ {
+		call = &ast.UnaryExpr{OpPos: pos, Op: token.NOT, X: call}
+	}
+	return call
+}
+
+// isErrorValue reports whether e is named like an error: a variable named
+// err or ending with Err, or a call of an Err method without arguments.
+func isErrorValue(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name == "err" || strings.HasSuffix(e.Name, "Err") && e.Name != "Err"
+	case *ast.CallExpr:
+		sel, ok := e.Fun.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == "Err" && len(e.Args) == 0
+	}
+	return false
+}
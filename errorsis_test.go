@@ -0,0 +1,83 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestUseErrorsIs(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	"context"
+	"io"
+)
+
+var errClosed = io.ErrClosedPipe
+
+func f(ctx context.Context, r io.Reader) error {
+	_, err := r.Read(nil)
+	if err == io.EOF {
+		return nil
+	}
+	if io.ErrUnexpectedEOF != err && ctx.Err() != context.Canceled {
+		return err
+	}
+	if readErr := g(); readErr == errClosed || err == nil {
+		return readErr
+	}
+	return nil
+}
+`)
+	file = Walk(file, UseErrorsIs(nil)).(*ast.File)
+	checkSource(t, fset, file, `package p
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var errClosed = io.ErrClosedPipe
+
+func f(ctx context.Context, r io.Reader) error {
+	_, err := r.Read(nil)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+	if readErr := g(); errors.Is(readErr, errClosed) || err == nil {
+		return readErr
+	}
+	return nil
+}
+`)
+}
+
+func TestUseErrorsIsPredicate(t *testing.T) {
+	// a caller-supplied predicate, with errors imported under an alias
+	fset, file := parse(t, `package p
+
+import stderrors "errors"
+
+var notFound = stderrors.New("not found")
+
+func f(err error) bool {
+	return err == notFound || err == io.EOF
+}
+`)
+	sentinel := func(e ast.Expr) bool { return isIdent(e, "notFound") }
+	file = Walk(file, UseErrorsIs(sentinel)).(*ast.File)
+	checkSource(t, fset, file, `package p
+
+import stderrors "errors"
+
+var notFound = stderrors.New("not found")
+
+func f(err error) bool {
+	return stderrors.Is(err, notFound) || err == io.EOF
+}
+`)
+}
@@ -0,0 +1,108 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"strings"
+	"unicode/utf8"
+)
+
+// UseErrorWrapping rewrites the calls of fmt.Errorf below node that format
+// an error with %v or %s into ones wrapping it with %w, like
+// fmt.Errorf("open: %v", err) into fmt.Errorf("open: %w", err), so that the
+// error can be inspected with errors.Is and errors.As. isError reports
+// whether an argument is an error. A call is only rewritten if its format
+// is a string literal without %w and explicit argument indexes, exactly one
+// of its arguments is an error and that argument is formatted by a single
+// plain %v or %s, without flags, width or precision. It returns the number
+// of rewritten calls.
+func UseErrorWrapping(node ast.Node, isError func(ast.Expr) bool) int {
+	n := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 || call.Ellipsis.IsValid() || !isQualified(call.Fun, "fmt", "Errorf") {
+			return true
+		}
+		if call.Fun.(*ast.SelectorExpr).X.(*ast.Ident).Obj != nil {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			return true
+		}
+		format, err := StringValue(lit)
+		if err != nil {
+			return true
+		}
+		verbs, ok := formatVerbs(format)
+		if !ok || len(verbs) != len(call.Args)-1 {
+			return true
+		}
+
+		wrap := -1
+		for i, arg := range call.Args[1:] {
+			if !isError(arg) {
+				continue
+			}
+			if wrap >= 0 {
+				return true
+			}
+			wrap = i
+		}
+		if wrap < 0 {
+			return true
+		}
+		v := verbs[wrap]
+		if v == nil || !v.plain || (format[v.offset] != 'v' && format[v.offset] != 's') {
+			return true
+		}
+		SetStringValue(lit, format[:v.offset]+"w"+format[v.offset+1:], false)
+		n++
+		return true
+	})
+	return n
+}
+
+// formatVerb is the verb formatting an argument of a printf format.
+type formatVerb struct {
+	// offset is the offset of the verb letter in the format.
+	offset int
+
+	// plain is set if the verb has no flags, width or precision.
+	plain bool
+}
+
+// formatVerbs returns the verb formatting each argument of the printf
+// format, with a nil verb for arguments taken by a * width or precision.
+// ok is false if format has %w or explicit argument indexes.
+func formatVerbs(format string) (verbs []*formatVerb, ok bool) {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		start := i
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) && (format[i] == '.' || format[i] == '*' || '0' <= format[i] && format[i] <= '9') {
+			if format[i] == '*' {
+				verbs = append(verbs, nil)
+			}
+			i++
+		}
+		if i == len(format) {
+			// a lone % at the end
+			break
+		}
+		if format[i] == '[' || format[i] == 'w' {
+			return nil, false
+		}
+		verbs = append(verbs, &formatVerb{offset: i, plain: i == start})
+		_, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+	}
+	return verbs, true
+}
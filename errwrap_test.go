@@ -0,0 +1,47 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestUseErrorWrapping(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "fmt"
+
+func f(name string, n int, err, err2 error) {
+	_ = fmt.Errorf("open %s: %v", name, err)
+	_ = fmt.Errorf(`+"`"+`%d%% of %q: %s`+"`"+`, n, name, err)
+	_ = fmt.Errorf("%v and %v", err, err2)
+	_ = fmt.Errorf("%w, then %v", err, err2)
+	_ = fmt.Errorf("%+v", err)
+	_ = fmt.Errorf("%*d: %v", n, n, err)
+	_ = fmt.Errorf("%[1]v", err)
+	_ = fmt.Errorf("%v", name)
+	_ = fmt.Errorf("%v %v", err)
+	_ = fmt.Sprintf("%v", err)
+}
+`)
+
+	isError := func(e ast.Expr) bool {
+		id, ok := e.(*ast.Ident)
+		return ok && (id.Name == "err" || id.Name == "err2")
+	}
+	if n := UseErrorWrapping(file, isError); n != 3 {
+		t.Errorf("rewrote %d calls, want 3", n)
+	}
+
+	checkSource(t, fset, findFunc(file, "f"), `func f(name string, n int, err, err2 error) {
+	_ = fmt.Errorf("open %s: %w", name, err)
+	_ = fmt.Errorf(`+"`"+`%d%% of %q: %w`+"`"+`, n, name, err)
+	_ = fmt.Errorf("%v and %v", err, err2)
+	_ = fmt.Errorf("%w, then %v", err, err2)
+	_ = fmt.Errorf("%+v", err)
+	_ = fmt.Errorf("%*d: %w", n, n, err)
+	_ = fmt.Errorf("%[1]v", err)
+	_ = fmt.Errorf("%v", name)
+	_ = fmt.Errorf("%v %v", err)
+	_ = fmt.Sprintf("%v", err)
+}`)
+}
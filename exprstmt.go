@@ -0,0 +1,55 @@
+package astrewrite
+
+import "go/ast"
+
+// AsStmt returns e as a statement, wrapped in an *ast.ExprStmt. It returns
+// nil for a nil e.
+func AsStmt(e ast.Expr) ast.Stmt {
+	if isNil(e) {
+		return nil
+	}
+	return &ast.ExprStmt{X: e}
+}
+
+// ExprOf returns the expression of s if it's an *ast.ExprStmt.
+func ExprOf(s ast.Stmt) (ast.Expr, bool) {
+	es, ok := s.(*ast.ExprStmt)
+	if !ok {
+		return nil, false
+	}
+	return es.X, true
+}
+
+// EnclosingExprStmt returns the expression statement whose expression is the
+// node of cur, possibly in parentheses, or the node itself if it's an
+// expression statement. The statement is removed along with the expression
+// when the walk function removes the expression.
+func EnclosingExprStmt(cur *Cursor) (*ast.ExprStmt, bool) {
+	if es, ok := cur.Node().(*ast.ExprStmt); ok {
+		return es, true
+	}
+	if _, ok := cur.Node().(ast.Expr); !ok {
+		return nil, false
+	}
+	stack := cur.ancestors()
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.ParenExpr:
+			continue
+		case *ast.ExprStmt:
+			return n, true
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// WrapExprStmts makes an expression returned by the walk function in place
+// of a statement of a list, like the statements of a block, a case clause or
+// a select clause, take its place wrapped in an expression statement.
+// Without it the statement is removed.
+func WrapExprStmts() Option {
+	return func(w *Walker) {
+		w.wrapExprs = true
+	}
+}
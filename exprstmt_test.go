@@ -0,0 +1,113 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestAsStmt(t *testing.T) {
+	call := &ast.CallExpr{Fun: ast.NewIdent("f")}
+	s := AsStmt(call)
+	if e, ok := ExprOf(s); !ok || e != call {
+		t.Errorf("got %v, %v back, want the call", e, ok)
+	}
+	if s := AsStmt(nil); s != nil {
+		t.Errorf("got %#v for nil, want nil", s)
+	}
+	var lit *ast.BasicLit
+	if s := AsStmt(lit); s != nil {
+		t.Errorf("got %#v for a nil literal, want nil", s)
+	}
+	if _, ok := ExprOf(&ast.ReturnStmt{}); ok {
+		t.Error("got an expression of a return statement")
+	}
+}
+
+func TestEnclosingExprStmt(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() {
+	(g(1))
+	x := g(2)
+	_ = x
+}
+`)
+	fn := findFunc(file, "f")
+	want := fn.Body.List[0].(*ast.ExprStmt)
+
+	var w *Walker
+	found := make(map[string]*ast.ExprStmt)
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		if call, ok := n.(*ast.CallExpr); ok {
+			es, ok := EnclosingExprStmt(w.Cursor())
+			if ok != (es != nil) {
+				t.Errorf("got %v, %v", es, ok)
+			}
+			found[call.Args[0].(*ast.BasicLit).Value] = es
+		}
+		if es, ok := n.(*ast.ExprStmt); ok {
+			if got, _ := EnclosingExprStmt(w.Cursor()); got != es {
+				t.Error("statement isn't its own enclosing statement")
+			}
+		}
+		return n, true
+	})
+	w.Walk(fn)
+
+	if found["1"] != want {
+		t.Errorf("got %v for g(1), want the statement", found["1"])
+	}
+	if found["2"] != nil {
+		t.Errorf("got %v for g(2), want none", found["2"])
+	}
+}
+
+func TestWrapExprStmts(t *testing.T) {
+	src := `package p
+
+func f() {
+	g(1)
+	g(2)
+}
+`
+	// returning the call of a statement in its place
+	unwrap := func(n ast.Node) (ast.Node, bool) {
+		if es, ok := n.(*ast.ExprStmt); ok && es.X.(*ast.CallExpr).Args[0].(*ast.BasicLit).Value == "1" {
+			return es.X, false
+		}
+		return n, true
+	}
+
+	// drops the statement by default
+	fset, file := parse(t, src)
+	New(unwrap).Walk(file)
+	// removed statements leave blank lines behind
+	checkSource(t, fset, file, `package p
+
+func f() {
+
+	g(2)
+}
+`)
+
+	// and keeps it with the option
+	fset, file = parse(t, src)
+	New(unwrap, WrapExprStmts()).Walk(file)
+	checkSource(t, fset, file, src)
+
+	// synthesized expressions are wrapped as well
+	fset, file = parse(t, src)
+	New(func(n ast.Node) (ast.Node, bool) {
+		if _, ok := n.(*ast.ExprStmt); ok {
+			return &ast.CallExpr{Fun: ast.NewIdent("h"), Lparen: n.Pos(), Rparen: n.Pos()}, false
+		}
+		return n, true
+	}, WrapExprStmts()).Walk(file)
+	checkSource(t, fset, file, `package p
+
+func f() {
+	h()
+	h()
+}
+`)
+}
@@ -0,0 +1,53 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// ExtractInterface returns a type spec declaring the interface ifaceName
+// with the exported methods of the type typeName declared in file, in the
+// order they are declared, or nil if there are none. Parameter and result
+// names and types are kept as they are. If typeName is generic, the
+// interface gets its type parameters, which the receivers of the methods
+// are expected to name the same way. The returned spec has no positions;
+// the caller inserts it, e.g. in a GenDecl of its own.
+func ExtractInterface(file *ast.File, typeName, ifaceName string) *ast.TypeSpec {
+	var methods []*ast.Field
+	var typeParams *ast.FieldList
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				if ts := spec.(*ast.TypeSpec); ts.Name.Name == typeName && ts.TypeParams != nil {
+					typeParams = Clone(ts.TypeParams).(*ast.FieldList)
+				}
+			}
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			if name, _, _, ok := ReceiverType(decl); !ok || name != typeName {
+				continue
+			}
+			methods = append(methods, &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent(decl.Name.Name)},
+				Type:  Clone(decl.Type).(*ast.FuncType),
+			})
+		}
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+
+	spec := &ast.TypeSpec{
+		Name:       ast.NewIdent(ifaceName),
+		TypeParams: typeParams,
+		Type:       &ast.InterfaceType{Methods: &ast.FieldList{List: methods}},
+	}
+	clearPositions(spec)
+	return spec
+}
@@ -0,0 +1,50 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+)
+
+func TestExtractInterface(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type Store struct{ m map[string][]byte }
+
+func (s *Store) Get(key string) (value []byte, ok bool) {
+	value, ok = s.m[key]
+	return
+}
+
+func (s *Store) lock() {}
+
+func (s Store) Put(key string, value []byte) error {
+	s.m[key] = value
+	return nil
+}
+
+func (o *Other) Get(key string) []byte { return nil }
+
+type Stack[T any] struct{ items []T }
+
+func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }
+`)
+
+	spec := ExtractInterface(file, "Store", "KV")
+	if spec == nil {
+		t.Fatal("got no interface")
+	}
+	checkSource(t, fset, &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{spec}}, `type KV interface {
+	Get(key string) (value []byte, ok bool)
+	Put(key string, value []byte) error
+}`)
+
+	spec = ExtractInterface(file, "Stack", "Pusher")
+	checkSource(t, fset, &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{spec}}, `type Pusher[T any] interface {
+	Push(v T)
+}`)
+
+	if spec := ExtractInterface(file, "Other2", "X"); spec != nil {
+		t.Errorf("got an interface for a type without methods")
+	}
+}
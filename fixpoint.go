@@ -0,0 +1,55 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// FixpointError is returned by WalkFixpoint when the tree was still changing
+// after the maximum number of iterations. Positions holds the positions of
+// the nodes replaced or removed during the last iteration, which usually
+// point at a pair of rules undoing each other.
+type FixpointError struct {
+	Iterations int
+	Positions  []token.Pos
+}
+
+func (e *FixpointError) Error() string {
+	return fmt.Sprintf("astrewrite: no fixpoint after %d iterations, %d nodes still changing",
+		e.Iterations, len(e.Positions))
+}
+
+// WalkFixpoint walks root with fn repeatedly until a walk neither replaces
+// nor removes a node, and returns the final node along with the number of
+// walks done. A node counts as changed when fn returns a different node than
+// the one it was given; changes fn makes in place are not detected. If the
+// tree still changes after maxIters walks, a *FixpointError is returned;
+// maxIters must be positive. Walks changing nothing, like the last one,
+// don't allocate.
+func WalkFixpoint(root ast.Node, fn WalkFunc, maxIters int) (ast.Node, int, error) {
+	if maxIters <= 0 {
+		return root, 0, fmt.Errorf("astrewrite: WalkFixpoint needs a positive number of iterations, got %d", maxIters)
+	}
+
+	// the walker and the positions of the changed nodes are reused by every
+	// walk, which records changes like WalkEdits
+	var positions []token.Pos
+	w := &walker{Walker: &Walker{fn: func(n ast.Node) (ast.Node, bool) {
+		r, ok := fn(n)
+		if n != nil && r != n {
+			positions = append(positions, n.Pos())
+		}
+		return r, ok
+	}}}
+	for i := 1; i <= maxIters; i++ {
+		positions = positions[:0]
+		for b := range w.unions {
+			delete(w.unions, b)
+		}
+		if root = w.walk(root); len(positions) == 0 || isNil(root) {
+			return root, i, nil
+		}
+	}
+	return root, maxIters, &FixpointError{Iterations: maxIters, Positions: positions}
+}
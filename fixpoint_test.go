@@ -0,0 +1,102 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func renameIdents(names map[string]string) WalkFunc {
+	return func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok {
+			if name, ok := names[id.Name]; ok {
+				return &ast.Ident{NamePos: id.NamePos, Name: name}, true
+			}
+		}
+		return n, true
+	}
+}
+
+func TestWalkFixpoint(t *testing.T) {
+	fset, file := parse(t, `package p
+
+var v = x + y
+`)
+
+	// replaced nodes aren't walked again in the same pass, so x needs
+	// two passes to become z and a third one to see nothing changes
+	root, iters, err := WalkFixpoint(file, renameIdents(map[string]string{"x": "y", "y": "z"}), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iters != 3 {
+		t.Errorf("got %d iterations, want 3", iters)
+	}
+	checkSource(t, fset, root, `package p
+
+var v = z + z
+`)
+}
+
+func TestWalkFixpointOscillating(t *testing.T) {
+	fset, file := parse(t, `package p
+
+var v = a + 1
+`)
+
+	_, iters, err := WalkFixpoint(file, renameIdents(map[string]string{"a": "b", "b": "a"}), 5)
+	ferr, ok := err.(*FixpointError)
+	if !ok {
+		t.Fatalf("got error %v, want *FixpointError", err)
+	}
+	if iters != 5 || ferr.Iterations != 5 {
+		t.Errorf("got %d iterations, want 5", iters)
+	}
+	if len(ferr.Positions) != 1 {
+		t.Fatalf("got %d changing positions, want 1", len(ferr.Positions))
+	}
+	if pos := fset.Position(ferr.Positions[0]); pos.Line != 3 || pos.Column != 9 {
+		t.Errorf("got changing node at %v, want src.go:3:9", pos)
+	}
+}
+
+func TestWalkFixpointAllocs(t *testing.T) {
+	_, file := parse(t, `package p
+
+var v = x
+`)
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	x, y := spec.Values[0], ast.NewIdent("y")
+	fn := func(n ast.Node) (ast.Node, bool) {
+		if n == x {
+			return y, true
+		}
+		return n, true
+	}
+
+	// the second walk, which finds nothing to change, only costs the
+	// growth of the positions recorded by the first one
+	once := testing.AllocsPerRun(10, func() {
+		spec.Values[0] = y
+		WalkFixpoint(file, fn, 5)
+	})
+	twice := testing.AllocsPerRun(10, func() {
+		spec.Values[0] = x
+		WalkFixpoint(file, fn, 5)
+	})
+	if twice > once+1 {
+		t.Errorf("got %v allocations for two walks, %v for one", twice, once)
+	}
+}
+
+func TestWalkFixpointMaxIters(t *testing.T) {
+	_, file := parse(t, "package p\n")
+	for _, n := range []int{0, -1} {
+		root, iters, err := WalkFixpoint(file, renameIdents(nil), n)
+		if _, ok := err.(*FixpointError); ok || err == nil {
+			t.Errorf("maxIters %d: got error %v, want an argument error", n, err)
+		}
+		if root != file || iters != 0 {
+			t.Errorf("maxIters %d: got %d iterations", n, iters)
+		}
+	}
+}
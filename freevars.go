@@ -0,0 +1,98 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// FreeVars returns the sorted names of the identifiers referenced in node
+// that aren't declared anywhere inside it. The analysis is syntactic and
+// ignores scopes: field and method names of selectors and labels are left
+// out, but every other identifier counts, including package names, types,
+// builtins and the keys of composite literals, which can't be told apart
+// from map keys.
+func FreeVars(node ast.Node) []string {
+	declared := make(map[string]bool)
+	free := make(map[string]bool)
+
+	declare := func(ids ...*ast.Ident) {
+		for _, id := range ids {
+			declared[id.Name] = true
+		}
+	}
+	declareFields := func(fl *ast.FieldList) {
+		if fl == nil {
+			return
+		}
+		for _, f := range fl.List {
+			declare(f.Names...)
+		}
+	}
+
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				for _, l := range n.Lhs {
+					if id, ok := l.(*ast.Ident); ok {
+						declare(id)
+					}
+				}
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				for _, x := range []ast.Expr{n.Key, n.Value} {
+					if id, ok := x.(*ast.Ident); ok {
+						declare(id)
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			declare(n.Names...)
+		case *ast.TypeSpec:
+			declare(n.Name)
+		case *ast.FuncDecl:
+			declare(n.Name)
+			declareFields(n.Recv)
+		case *ast.FuncType:
+			declareFields(n.Params)
+			declareFields(n.Results)
+		case *ast.TypeSwitchStmt:
+			if a, ok := n.Assign.(*ast.AssignStmt); ok {
+				for _, l := range a.Lhs {
+					declare(l.(*ast.Ident))
+				}
+			}
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.LabeledStmt:
+			ast.Inspect(n.Stmt, visit)
+			return false
+		case *ast.BranchStmt:
+			return false
+		case *ast.Field:
+			// the names of fields and methods don't reference anything,
+			// parameter names are declared by the FuncType
+			if n.Type != nil {
+				ast.Inspect(n.Type, visit)
+			}
+			return false
+		case *ast.Ident:
+			free[n.Name] = true
+		}
+		return true
+	}
+	ast.Inspect(node, visit)
+
+	var names []string
+	for name := range free {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,24 @@
+package astrewrite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFreeVars(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() {
+	for i, v := range xs {
+		y := v.Field + i
+		fmt.Println(y, z)
+	}
+}
+`)
+
+	got := FreeVars(findFunc(file, "f").Body)
+	want := []string{"fmt", "xs", "z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package astrewrite
+
+import "go/ast"
+
+// WalkFuncLits walks the bodies of the function literals below node, each
+// with the WalkFunc fn returns for it, and skips the literals fn returns nil
+// for. call is the call the literal is the function or an argument of, like
+// http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {...}),
+// or nil.
+//
+// The body of a literal is walked before the literals nested in it, which
+// are looked up in the rewritten body. Removing the body of a literal leaves
+// it empty.
+func WalkFuncLits(node ast.Node, fn func(lit *ast.FuncLit, call *ast.CallExpr) WalkFunc) {
+	calls := make(map[*ast.FuncLit]*ast.CallExpr)
+	var lits []*ast.FuncLit
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			for _, e := range append([]ast.Expr{n.Fun}, n.Args...) {
+				if lit, ok := ast.Unparen(e).(*ast.FuncLit); ok {
+					calls[lit] = n
+				}
+			}
+		case *ast.FuncLit:
+			if n != node {
+				lits = append(lits, n)
+				return false
+			}
+		}
+		return true
+	})
+
+	for _, lit := range lits {
+		if walkFn := fn(lit, calls[lit]); walkFn != nil {
+			body, _ := Walk(lit.Body, walkFn).(*ast.BlockStmt)
+			if body == nil {
+				body = &ast.BlockStmt{Lbrace: lit.Body.Lbrace, Rbrace: lit.Body.Rbrace}
+			}
+			lit.Body = body
+		}
+		WalkFuncLits(lit.Body, fn)
+	}
+}
@@ -0,0 +1,68 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWalkFuncLits(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f() {
+	println("f")
+	handle(func() {
+		println("outer")
+		defer func() {
+			println("inner")
+		}()
+	})
+	skip := func() {
+		println("skipped")
+	}
+	skip()
+}
+`)
+
+	// the strings in each literal name the function it's passed to, the
+	// literal assigned to a variable is left alone
+	var seen []string
+	WalkFuncLits(file, func(lit *ast.FuncLit, call *ast.CallExpr) WalkFunc {
+		if call == nil {
+			seen = append(seen, "nil")
+			return nil
+		}
+		name := "literal"
+		if id, ok := call.Fun.(*ast.Ident); ok {
+			name = id.Name
+		}
+		seen = append(seen, name)
+		return func(n ast.Node) (ast.Node, bool) {
+			if lit, ok := n.(*ast.BasicLit); ok {
+				lit.Value = strconv.Quote(name)
+			}
+			return n, true
+		}
+	})
+
+	if got := strings.Join(seen, " "); got != "handle literal nil" {
+		t.Errorf("got literals %q, want handle literal nil", got)
+	}
+	checkSource(t, fset, file, `package p
+
+func f() {
+	println("f")
+	handle(func() {
+		println("handle")
+		defer func() {
+			println("literal")
+		}()
+	})
+	skip := func() {
+		println("skipped")
+	}
+	skip()
+}
+`)
+}
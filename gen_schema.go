@@ -0,0 +1,225 @@
+//go:build ignore
+
+// gen_schema generates schema_gen.go from the type definitions in go/ast:
+// the schema of the nodes and the walk of their children.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+)
+
+// interfaces are the node interfaces of go/ast.
+var interfaces = map[string]bool{"Node": true, "Expr": true, "Stmt": true, "Decl": true, "Spec": true}
+
+// skipped are the fields holding nodes that aren't children, as in ast.Walk.
+var skipped = map[string]bool{
+	"File.Imports":    true, // also reachable through File.Decls
+	"File.Unresolved": true, // also reachable through File.Decls
+	"File.Comments":   true, // reachable through the nodes they belong to
+}
+
+func main() {
+	fset := token.NewFileSet()
+	path := filepath.Join(runtime.GOROOT(), "src", "go", "ast", "ast.go")
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Node types are the struct types with a Pos method.
+	structs := make(map[string]*ast.StructType)
+	nodes := make(map[string]bool)
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						structs[ts.Name.Name] = st
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Recv != nil && d.Name.Name == "Pos" {
+				if star, ok := d.Recv.List[0].Type.(*ast.StarExpr); ok {
+					nodes[star.X.(*ast.Ident).Name] = true
+				}
+			}
+		}
+	}
+	delete(nodes, "Package") // holds a map of files, see the walker
+
+	optional, err := optionalEdges("schema.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var names []string
+	for name := range structs {
+		if nodes[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// the edges of each node, in the order of their fields
+	edges := make(map[string][]edgeField)
+	for _, name := range names {
+		edges[name] = []edgeField{}
+		for _, field := range structs[name].Fields.List {
+			typ, kind := edge(field.Type, nodes)
+			if kind == "" {
+				continue
+			}
+			for _, id := range field.Names {
+				key := name + "." + id.Name
+				if skipped[key] {
+					continue
+				}
+				k := kind
+				if optional[key] {
+					if kind != "EdgeSingle" {
+						log.Fatalf("%s is optional but holds a %s", key, kind)
+					}
+					k = "EdgeOptional"
+					delete(optional, key)
+				}
+				edges[name] = append(edges[name], edgeField{id.Name, k, typ})
+			}
+		}
+	}
+
+	for key := range optional {
+		log.Fatalf("%s is optional but isn't an edge", key)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gen_schema.go from go/ast; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package astrewrite\n\n")
+	fmt.Fprintf(&buf, "import (\n\t\"fmt\"\n\t\"go/ast\"\n\t\"reflect\"\n)\n\n")
+	fmt.Fprintf(&buf, "var schema = map[string][]EdgeInfo{\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\t%q: {\n", name)
+		for _, e := range edges[name] {
+			fmt.Fprintf(&buf, "\t\t{Name: %q, Kind: %s, Type: %q},\n", e.name, e.kind, e.typ)
+		}
+		fmt.Fprintf(&buf, "\t},\n")
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "var nodeTypes = map[string]reflect.Type{\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\t%q: reflect.TypeOf(ast.%s{}),\n", name, name)
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	// the walk follows the schema, so that the two never disagree
+	fmt.Fprintf(&buf, "// walkEdges walks the children of node in the order of their fields, as\n")
+	fmt.Fprintf(&buf, "// described by the schema. It returns false if node has to be removed\n")
+	fmt.Fprintf(&buf, "// because a child it can't do without was removed, see RemovalBehavior.\n")
+	fmt.Fprintf(&buf, "func (w *walker) walkEdges(node ast.Node) bool {\n")
+	fmt.Fprintf(&buf, "\tvar ok bool\n")
+	fmt.Fprintf(&buf, "\tswitch n := node.(type) {\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\tcase *ast.%s:\n", name)
+		for _, e := range edges[name] {
+			walk := "walkEdge"
+			if e.kind == "EdgeSlice" {
+				walk = "walkList"
+			}
+			fmt.Fprintf(&buf, "\t\tif n.%[1]s, ok = %[2]s(w, n, %[1]q, n.%[1]s); !ok {\n\t\t\treturn false\n\t\t}\n", e.name, walk)
+		}
+	}
+	fmt.Fprintf(&buf, "\tdefault:\n")
+	fmt.Fprintf(&buf, "\t\tpanic(fmt.Sprintf(\"ast.Walk: unexpected node type %%T\", n))\n")
+	fmt.Fprintf(&buf, "\t}\n")
+	fmt.Fprintf(&buf, "\treturn true\n")
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("schema_gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// edgeField is a field of a node holding children.
+type edgeField struct {
+	name, kind, typ string
+}
+
+// edge returns the printed type and the kind of a field of type typ, or an
+// empty kind if the field doesn't hold nodes.
+func edge(typ ast.Expr, nodes map[string]bool) (string, string) {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		if interfaces[t.Name] {
+			return t.Name, "EdgeSingle"
+		}
+	case *ast.StarExpr:
+		if id, ok := t.X.(*ast.Ident); ok && nodes[id.Name] {
+			return "*" + id.Name, "EdgeSingle"
+		}
+	case *ast.ArrayType:
+		if t.Len != nil {
+			break
+		}
+		if elem, kind := edge(t.Elt, nodes); kind == "EdgeSingle" {
+			return "[]" + elem, "EdgeSlice"
+		}
+	}
+	return "", ""
+}
+
+// optionalEdges returns the keys of the optionalEdges map in the file path,
+// which lists the edges that may be nil.
+func optionalEdges(path string) (map[string]bool, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if len(vs.Names) != 1 || vs.Names[0].Name != "optionalEdges" || len(vs.Values) != 1 {
+				continue
+			}
+			lit, ok := vs.Values[0].(*ast.CompositeLit)
+			if !ok {
+				break
+			}
+			keys := make(map[string]bool)
+			for _, elt := range lit.Elts {
+				var key string
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if lit, ok := kv.Key.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						key, _ = strconv.Unquote(lit.Value)
+					}
+				}
+				if key == "" {
+					return nil, fmt.Errorf("%s: unexpected element of optionalEdges", path)
+				}
+				keys[key] = true
+			}
+			return keys, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no optionalEdges map", path)
+}
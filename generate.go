@@ -0,0 +1,287 @@
+package astrewrite
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// generatedPrefix starts the comment GenerateFromMarkers adds to the
+// declarations it generates.
+const generatedPrefix = "//astrewrite:generated"
+
+// GenerateReport describes a run of GenerateFromMarkers.
+type GenerateReport struct {
+	// Types holds the names of the marked types gen was called for, in
+	// the order they're declared.
+	Types []string
+
+	// Generated is the number of declarations added.
+	Generated int
+
+	// Replaced is the number of declarations generated by an earlier
+	// run that were removed.
+	Replaced int
+
+	// Err is the error gen failed with, or the error laying out its
+	// declarations, in which case f is left as it was, apart from what
+	// gen did to it.
+	Err error
+}
+
+// GenerateFromMarkers calls gen for every struct type of f marked by a
+// comment consisting of marker, like "//gen:builder", possibly followed by
+// arguments, in the doc comment of its spec or of the declaration holding
+// it. The declarations gen returns are added after that declaration, each
+// with a comment like
+//
+//	//astrewrite:generated marker=gen:builder from=Config
+//
+// at the end of its doc comment. Declarations carrying such a comment for
+// marker are removed before the types are looked up, so running
+// GenerateFromMarkers again replaces what an earlier run generated rather
+// than adding to it; given the same gen, the second run leaves the file as
+// the first one left it. gen may add the imports it needs to f with
+// AddImport.
+//
+// The generated declarations are laid out by the printer, without their
+// positions and comments other than doc comments, so gen can build them by
+// hand or take them from a Snippet. As that means the file has to be
+// printed and parsed again, the contents of f are replaced by the parsed
+// file, added to fset, the FileSet f was parsed with. Nodes of f held by
+// the caller, like those passed to gen, no longer belong to it afterwards.
+func GenerateFromMarkers(fset *token.FileSet, f *ast.File, marker string, gen func(ts *ast.TypeSpec, st *ast.StructType) ([]ast.Decl, error)) GenerateReport {
+	var report GenerateReport
+	marker = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(marker), "/"))
+
+	// drop what an earlier run generated
+	stale := make(map[ast.Decl]bool)
+	decls := f.Decls[:0:0]
+	for _, d := range f.Decls {
+		if generatedFor(d, marker) {
+			stale[d] = true
+			continue
+		}
+		decls = append(decls, d)
+	}
+
+	generated := make(map[ast.Decl][]ast.Decl)
+	for _, d := range decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || !hasMarker(ts.Doc, marker) && !hasMarker(gd.Doc, marker) {
+				continue
+			}
+			out, err := gen(ts, st)
+			if err != nil {
+				report.Err = fmt.Errorf("astrewrite: generating from %s: %v", ts.Name.Name, err)
+				return report
+			}
+			for _, g := range out {
+				markGenerated(g, marker, ts.Name.Name)
+			}
+			generated[gd] = append(generated[gd], out...)
+			report.Types = append(report.Types, ts.Name.Name)
+			report.Generated += len(out)
+		}
+	}
+	if len(stale) == 0 && len(generated) == 0 {
+		return report
+	}
+
+	// gen may have added imports
+	decls = decls[:0]
+	for _, d := range f.Decls {
+		if !stale[d] {
+			decls = append(decls, d)
+		}
+	}
+
+	src, err := printGenerated(fset, f, decls, stale, generated)
+	if err == nil {
+		var parsed *ast.File
+		name := ""
+		if tf := fset.File(f.Package); tf != nil {
+			name = tf.Name()
+		}
+		if parsed, err = parser.ParseFile(fset, name, src, parser.ParseComments); err == nil {
+			*f = *parsed
+			report.Replaced = len(stale)
+			return report
+		}
+	}
+	report.Err = fmt.Errorf("astrewrite: laying out generated declarations: %v", err)
+	report.Types, report.Generated = nil, 0
+	return report
+}
+
+// printGenerated prints f with decls in place of its declarations, leaving
+// out the comments of the stale ones and adding the generated declarations
+// after the declarations they were generated for.
+func printGenerated(fset *token.FileSet, f *ast.File, decls []ast.Decl, stale map[ast.Decl]bool, generated map[ast.Decl][]ast.Decl) ([]byte, error) {
+	// Each declaration with generated ones is followed by a placeholder
+	// declaration var _ = name, whose line is replaced by the generated
+	// ones once printed.
+	names := NewNameGen(f)
+	texts := make(map[string][]byte)
+	var withPlaceholders []ast.Decl
+	for _, d := range decls {
+		withPlaceholders = append(withPlaceholders, d)
+		if len(generated[d]) == 0 {
+			continue
+		}
+
+		var text bytes.Buffer
+		for j, g := range generated[d] {
+			if j > 0 {
+				text.WriteString("\n")
+			}
+			// the printer places doc comments by their positions, so
+			// they're written separately
+			var cg *ast.CommentGroup
+			doc := docOf(g)
+			if doc != nil && *doc != nil {
+				for _, c := range (*doc).List {
+					text.WriteString(c.Text + "\n")
+				}
+				cg, *doc = *doc, nil
+			}
+			clearPositions(g)
+			err := format.Node(&text, token.NewFileSet(), g)
+			if doc != nil {
+				*doc = cg
+			}
+			if err != nil {
+				return nil, err
+			}
+			text.WriteString("\n")
+		}
+		name := names.Name("generatedDecl")
+		texts["var _ = "+name+"\n"] = text.Bytes()
+
+		// like the trailing comments of d, the placeholder ends its line
+		pos := d.End()
+		if tf := fset.File(pos); tf != nil {
+			for _, cg := range f.Comments {
+				if cg.Pos() >= d.End() && tf.Line(cg.Pos()) == tf.Line(d.End()) {
+					pos = cg.End()
+				}
+			}
+		}
+		withPlaceholders = append(withPlaceholders, &ast.GenDecl{
+			TokPos: pos,
+			Tok:    token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names:  []*ast.Ident{{NamePos: pos, Name: "_"}},
+				Values: []ast.Expr{&ast.Ident{NamePos: pos, Name: name}},
+			}},
+		})
+	}
+
+	var comments []*ast.CommentGroup
+	for _, cg := range f.Comments {
+		inStale := false
+		for d := range stale {
+			inStale = inStale || cg.Pos() >= declStart(d) && cg.End() <= d.End()
+		}
+		if !inStale {
+			comments = append(comments, cg)
+		}
+	}
+
+	printed := *f
+	printed.Decls, printed.Comments = withPlaceholders, comments
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, &printed); err != nil {
+		return nil, err
+	}
+	src := buf.Bytes()
+	for line, text := range texts {
+		i := bytes.Index(src, []byte(line))
+		if i < 0 {
+			return nil, fmt.Errorf("placeholder %q not printed", line)
+		}
+		src = append(src[:i:i], append(text, src[i+len(line):]...)...)
+	}
+	return src, nil
+}
+
+// docOf returns the field holding the doc comment of d, or nil if d
+// can't have one.
+func docOf(d ast.Decl) **ast.CommentGroup {
+	switch d := d.(type) {
+	case *ast.GenDecl:
+		return &d.Doc
+	case *ast.FuncDecl:
+		return &d.Doc
+	}
+	return nil
+}
+
+// declStart returns the position of d or of its doc comment.
+func declStart(d ast.Decl) token.Pos {
+	if doc := docOf(d); doc != nil && *doc != nil {
+		return (*doc).Pos()
+	}
+	return d.Pos()
+}
+
+// hasMarker reports whether cg holds a comment consisting of marker,
+// possibly followed by arguments.
+func hasMarker(cg *ast.CommentGroup, marker string) bool {
+	if cg == nil {
+		return false
+	}
+	for _, c := range cg.List {
+		text := strings.TrimPrefix(c.Text, "//"+marker)
+		if text != c.Text && (text == "" || text[0] == ' ' || text[0] == '\t') {
+			return true
+		}
+	}
+	return false
+}
+
+// generatedFor reports whether d was generated by GenerateFromMarkers for
+// marker.
+func generatedFor(d ast.Decl, marker string) bool {
+	doc := docOf(d)
+	if doc == nil || *doc == nil {
+		return false
+	}
+	for _, c := range (*doc).List {
+		if !strings.HasPrefix(c.Text, generatedPrefix+" ") {
+			continue
+		}
+		for _, arg := range strings.Fields(c.Text[len(generatedPrefix):]) {
+			if arg == "marker="+marker {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markGenerated adds the comment identifying d as generated for marker
+// from the type typeName to the doc comment of d.
+func markGenerated(d ast.Decl, marker, typeName string) {
+	c := &ast.Comment{Text: fmt.Sprintf("%s marker=%s from=%s", generatedPrefix, marker, typeName)}
+	doc := docOf(d)
+	if doc == nil {
+		return
+	}
+	if *doc == nil {
+		*doc = &ast.CommentGroup{}
+	} else if len((*doc).List) > 0 {
+		(*doc).List = append((*doc).List, &ast.Comment{Text: "//"})
+	}
+	(*doc).List = append((*doc).List, c)
+}
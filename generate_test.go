@@ -0,0 +1,158 @@
+package astrewrite
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// genBuilder generates a builder type for st with a setter for every named
+// field.
+func genBuilder(f *ast.File) func(ts *ast.TypeSpec, st *ast.StructType) ([]ast.Decl, error) {
+	return func(ts *ast.TypeSpec, st *ast.StructType) ([]ast.Decl, error) {
+		name := ts.Name.Name
+		var src strings.Builder
+		fmt.Fprintf(&src, "// %[1]sBuilder builds a %[1]s.\ntype %[1]sBuilder struct{ v %[1]s }\n", name)
+		for _, field := range st.Fields.List {
+			for _, fn := range field.Names {
+				fmt.Fprintf(&src, "func (b *%[1]sBuilder) %[2]s(v %[3]s) *%[1]sBuilder { b.v.%[2]s = v; return b }\n",
+					name, fn.Name, types.ExprString(field.Type))
+			}
+		}
+		fmt.Fprintf(&src, "func (b *%[1]sBuilder) String() string { return fmt.Sprint(b.v) }\n", name)
+		s, err := ParseSnippetKind(src.String(), DeclSnippet)
+		if err != nil {
+			return nil, err
+		}
+		AddImport(f, "fmt")
+		return s.File.Decls, nil
+	}
+}
+
+func TestGenerateFromMarkers(t *testing.T) {
+	fset, file := parse(t, `package p
+
+// Config configures things.
+//
+//gen:builder
+type Config struct {
+	Name    string
+	Retries int
+}
+
+type (
+	plain struct{ n int }
+
+	//gen:builder
+	point struct{ x, y int } // a point
+)
+
+func use() {}
+`)
+	report := GenerateFromMarkers(fset, file, "//gen:builder", genBuilder(file))
+	if report.Err != nil {
+		t.Fatal(report.Err)
+	}
+	if got := strings.Join(report.Types, ","); got != "Config,point" || report.Generated != 8 || report.Replaced != 0 {
+		t.Errorf("got types %s, %d generated and %d replaced, want Config,point, 8 and 0", got, report.Generated, report.Replaced)
+	}
+	want := `package p
+
+import "fmt"
+
+// Config configures things.
+//
+//gen:builder
+type Config struct {
+	Name    string
+	Retries int
+}
+
+// ConfigBuilder builds a Config.
+//
+//astrewrite:generated marker=gen:builder from=Config
+type ConfigBuilder struct {
+	v Config
+}
+
+//astrewrite:generated marker=gen:builder from=Config
+func (b *ConfigBuilder) Name(v string) *ConfigBuilder {
+	b.v.Name = v
+	return b
+}
+
+//astrewrite:generated marker=gen:builder from=Config
+func (b *ConfigBuilder) Retries(v int) *ConfigBuilder {
+	b.v.Retries = v
+	return b
+}
+
+//astrewrite:generated marker=gen:builder from=Config
+func (b *ConfigBuilder) String() string {
+	return fmt.Sprint(b.v)
+}
+
+type (
+	plain struct{ n int }
+
+	//gen:builder
+	point struct{ x, y int } // a point
+)
+
+// pointBuilder builds a point.
+//
+//astrewrite:generated marker=gen:builder from=point
+type pointBuilder struct {
+	v point
+}
+
+//astrewrite:generated marker=gen:builder from=point
+func (b *pointBuilder) x(v int) *pointBuilder {
+	b.v.x = v
+	return b
+}
+
+//astrewrite:generated marker=gen:builder from=point
+func (b *pointBuilder) y(v int) *pointBuilder {
+	b.v.y = v
+	return b
+}
+
+//astrewrite:generated marker=gen:builder from=point
+func (b *pointBuilder) String() string {
+	return fmt.Sprint(b.v)
+}
+
+func use() {}
+`
+	checkSource(t, fset, file, want)
+
+	// a second run replaces the generated declarations by identical ones
+	report = GenerateFromMarkers(fset, file, "gen:builder", genBuilder(file))
+	if report.Err != nil {
+		t.Fatal(report.Err)
+	}
+	if report.Generated != 8 || report.Replaced != 8 {
+		t.Errorf("got %d generated and %d replaced, want 8 and 8", report.Generated, report.Replaced)
+	}
+	checkSource(t, fset, file, want)
+}
+
+func TestGenerateFromMarkersError(t *testing.T) {
+	src := `package p
+
+//gen:builder
+type T struct{ n int }
+`
+	fset, file := parse(t, src)
+	report := GenerateFromMarkers(fset, file, "gen:builder", func(*ast.TypeSpec, *ast.StructType) ([]ast.Decl, error) {
+		return nil, errors.New("unsupported")
+	})
+	if report.Err == nil || !strings.Contains(report.Err.Error(), "unsupported") {
+		t.Errorf("got error %v, want unsupported", report.Err)
+	}
+	checkSource(t, fset, file, src)
+}
@@ -0,0 +1,74 @@
+package astrewrite
+
+import "go/ast"
+
+// AssertionOption configures AssertionToGeneric.
+type AssertionOption func(*assertionConfig)
+
+type assertionConfig struct {
+	commaOk func(*ast.TypeAssertExpr) (*ast.CallExpr, bool)
+}
+
+// CommaOk makes AssertionToGeneric rewrite the assertions of the comma-ok
+// form, v, ok := x.(T), with the calls match returns, which must return the
+// value and whether it was found, like Lookup[T](c, key) returning (T, bool).
+func CommaOk(match func(assert *ast.TypeAssertExpr) (newCall *ast.CallExpr, ok bool)) AssertionOption {
+	return func(c *assertionConfig) {
+		c.commaOk = match
+	}
+}
+
+// AssertionToGeneric replaces the type assertions below node with the calls
+// match returns for them, for moving containers of interface{} values to
+// generic accessors: v := c.Get(key).(T) becomes v := Get[T](c, key), where
+// the call, built by the caller, has to panic like the assertion does if the
+// value isn't a T. match returns false for assertions that are left alone.
+//
+// Assertions of the comma-ok form, whose failure is reported rather than
+// panicked on, need an accessor with two results and are left alone unless
+// one is given with CommaOk; match isn't called for them. Type switches
+// aren't assertions to a type and are skipped too. It returns the number
+// of rewritten assertions.
+func AssertionToGeneric(node ast.Node, match func(assert *ast.TypeAssertExpr) (newCall *ast.CallExpr, ok bool), opts ...AssertionOption) int {
+	var cfg assertionConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	// the assertions yielding a value and whether it succeeded
+	commaOk := make(map[ast.Expr]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == 2 && len(n.Rhs) == 1 {
+				commaOk[ast.Unparen(n.Rhs[0])] = true
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) == 2 && len(n.Values) == 1 {
+				commaOk[ast.Unparen(n.Values[0])] = true
+			}
+		}
+		return true
+	})
+
+	n := 0
+	Walk(node, func(node ast.Node) (ast.Node, bool) {
+		assert, ok := node.(*ast.TypeAssertExpr)
+		if !ok || assert.Type == nil {
+			return node, true
+		}
+		fn := match
+		if commaOk[assert] {
+			if fn = cfg.commaOk; fn == nil {
+				return node, true
+			}
+		}
+		call, ok := fn(assert)
+		if !ok {
+			return node, true
+		}
+		n++
+		return call, true
+	})
+	return n
+}
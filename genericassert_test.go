@@ -0,0 +1,55 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestAssertionToGeneric(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(c *Cache, key string) {
+	n := c.Get(key).(int)
+	use(c.Get("name").(string))
+	s, ok := c.Get(key).(string)
+	var m, found = c.Get(key).(map[string]int)
+	_ = other.Get(key).(int)
+	switch v := c.Get(key).(type) {
+	case int:
+		_ = v
+	}
+}
+`)
+
+	// calls of Get on c become calls of the generic accessor name
+	accessor := func(name string) func(*ast.TypeAssertExpr) (*ast.CallExpr, bool) {
+		return func(assert *ast.TypeAssertExpr) (*ast.CallExpr, bool) {
+			call, ok := assert.X.(*ast.CallExpr)
+			if !ok || !isQualified(call.Fun, "c", "Get") {
+				return nil, false
+			}
+			sel := call.Fun.(*ast.SelectorExpr)
+			fun := &ast.IndexExpr{X: ast.NewIdent(name), Index: assert.Type}
+			return &ast.CallExpr{Fun: fun, Args: append([]ast.Expr{sel.X}, call.Args...)}, true
+		}
+	}
+
+	if n := AssertionToGeneric(file, accessor("Get")); n != 2 {
+		t.Errorf("rewrote %d assertions, want 2", n)
+	}
+	if n := AssertionToGeneric(file, accessor("Get"), CommaOk(accessor("Lookup"))); n != 2 {
+		t.Errorf("rewrote %d comma-ok assertions, want 2", n)
+	}
+
+	checkSource(t, fset, findFunc(file, "f"), `func f(c *Cache, key string) {
+	n := Get[int](c, key)
+	use(Get[string](c, "name"))
+	s, ok := Lookup[string](c, key)
+	var m, found = Lookup[map[string]int](c, key)
+	_ = other.Get(key).(int)
+	switch v := c.Get(key).(type) {
+	case int:
+		_ = v
+	}
+}`)
+}
@@ -0,0 +1,91 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// HandlerOption configures WrapHandlers.
+type HandlerOption func(*handlerConfig)
+
+type handlerConfig struct {
+	methods map[string]bool
+}
+
+// HandlerMethods sets the names of the methods registering handlers, which
+// are HandleFunc and Handle by default, like those of http and
+// http.ServeMux. Routers with a method per HTTP method take their names,
+// like HandlerMethods("Get", "Post").
+func HandlerMethods(names ...string) HandlerOption {
+	return func(c *handlerConfig) {
+		c.methods = make(map[string]bool)
+		for _, name := range names {
+			c.methods[name] = true
+		}
+	}
+}
+
+// WrapHandlers wraps the handlers registered in file for the routes pattern
+// selects with the middleware mwExpr, like
+//
+//	http.HandleFunc("/admin", admin)
+//
+// into http.HandleFunc("/admin", auth(admin)) for the mwExpr "auth". A
+// registration is a call of one of the methods set with HandlerMethods, on
+// any receiver, whose first argument is a string literal holding the route
+// and whose last argument is the handler. mwExpr can be any expression, like
+// mw.Auth or withLogging(logger); it has to yield a function returning a
+// handler of the type the method takes. Handlers wrapped with mwExpr
+// already are left alone, so running WrapHandlers again changes nothing.
+// It returns the number of wrapped handlers, or an error if mwExpr doesn't
+// parse.
+func WrapHandlers(file *ast.File, mwExpr string, pattern func(route string) bool, opts ...HandlerOption) (int, error) {
+	cfg := handlerConfig{methods: map[string]bool{"HandleFunc": true, "Handle": true}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	mw, err := parseExpr(mwExpr)
+	if err != nil {
+		return 0, fmt.Errorf("astrewrite: invalid middleware %q: %v", mwExpr, err)
+	}
+
+	n := 0
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 || call.Ellipsis.IsValid() {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !cfg.methods[sel.Sel.Name] {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		route, err := strconv.Unquote(lit.Value)
+		if err != nil || !pattern(route) {
+			return true
+		}
+		last := len(call.Args) - 1
+		handler := call.Args[last]
+		if wrapped, ok := handler.(*ast.CallExpr); ok && Equal(wrapped.Fun, mw) {
+			return true
+		}
+
+		pos := handler.Pos()
+		fun := Clone(mw).(ast.Expr)
+		placeAt(fun, pos)
+		call.Args[last] = &ast.CallExpr{
+			Fun:    fun,
+			Lparen: pos,
+			Args:   []ast.Expr{handler},
+			Rparen: handler.End(),
+		}
+		n++
+		return true
+	})
+	return n, nil
+}
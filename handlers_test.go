@@ -0,0 +1,70 @@
+package astrewrite
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrapHandlers(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func routes(mux *http.ServeMux) {
+	http.HandleFunc("/admin/users", users)
+	http.HandleFunc("/health", health)
+	mux.Handle("/admin/", http.StripPrefix("/admin", admin))
+	mux.Handle("/", index)
+	mux.HandleFunc(route, other)
+}
+`)
+	admin := func(route string) bool { return strings.HasPrefix(route, "/admin") }
+	for run := 0; run < 2; run++ {
+		n, err := WrapHandlers(file, "mw.Auth(roles)", admin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 2 * (1 - run); n != want {
+			t.Errorf("run %d: wrapped %d handlers, want %d", run, n, want)
+		}
+	}
+	checkSource(t, fset, file, `package p
+
+func routes(mux *http.ServeMux) {
+	http.HandleFunc("/admin/users", mw.Auth(roles)(users))
+	http.HandleFunc("/health", health)
+	mux.Handle("/admin/", mw.Auth(roles)(http.StripPrefix("/admin", admin)))
+	mux.Handle("/", index)
+	mux.HandleFunc(route, other)
+}
+`)
+
+	if _, err := WrapHandlers(file, "mw.(", admin); err == nil {
+		t.Error("got no error for an invalid middleware")
+	}
+}
+
+func TestWrapHandlersMethods(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func routes(r chi.Router) {
+	r.Get("/users", listUsers)
+	r.Post("/users", createUser)
+	r.Handle("/metrics", metrics)
+}
+`)
+	all := func(string) bool { return true }
+	n, err := WrapHandlers(file, "logged", all, HandlerMethods("Get", "Post"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("wrapped %d handlers, want 2", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func routes(r chi.Router) {
+	r.Get("/users", logged(listUsers))
+	r.Post("/users", logged(createUser))
+	r.Handle("/metrics", metrics)
+}
+`)
+}
@@ -0,0 +1,210 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+)
+
+// DeferredCallError is returned by Hoist for an expression of the call of a
+// defer or go statement.
+type DeferredCallError struct {
+	// Stmt is the *ast.DeferStmt or *ast.GoStmt.
+	Stmt ast.Stmt
+}
+
+func (e *DeferredCallError) Error() string {
+	kind := "defer"
+	if _, ok := e.Stmt.(*ast.GoStmt); ok {
+		kind = "go"
+	}
+	return fmt.Sprintf("astrewrite: can't hoist out of the call of a %s statement", kind)
+}
+
+// Hoist moves expr, an expression below root evaluated for its value, into
+// a variable name declared right before the statement holding it, and uses
+// the variable in its place: f(g(x)) becomes name := g(x) followed by
+// f(name). The name is up to the caller, see NewNameGen.
+//
+// Hoisting must not change when expr is evaluated, so it fails without
+// changing anything for expressions evaluated conditionally or repeatedly
+// by the statement, like the right operand of && or the condition of a
+// for loop, for those evaluated after operands with side effects, like b()
+// in g(a(), b()), for those using variables declared by the init statement
+// of an if or switch statement, and, with a *DeferredCallError, for those of
+// the call of a defer or go statement: the call runs after the statement,
+// its operands don't, and instrumentation moving them tends to confuse
+// the two. Cursor.InDefer and Cursor.InGoStmt tell such expressions apart
+// during a walk.
+func Hoist(root ast.Node, expr ast.Expr, name string) error {
+	path := pathTo(root, expr)
+	if path == nil {
+		return fmt.Errorf("astrewrite: expression to hoist not found")
+	}
+
+	// the innermost statement of a list holding expr
+	i := len(path) - 1
+	for ; i > 0; i-- {
+		if _, ok := path[i].(ast.Stmt); ok && stmtList(path[i-1]) != nil {
+			break
+		}
+	}
+	if i == 0 {
+		return fmt.Errorf("astrewrite: expression to hoist isn't part of a statement")
+	}
+	for j := i; j < len(path); j++ {
+		child := ast.Node(expr)
+		if j+1 < len(path) {
+			child = path[j+1]
+		}
+		if err := hoistBarrier(path[j], child, expr); err != nil {
+			return err
+		}
+	}
+
+	stmt, list := path[i].(ast.Stmt), stmtList(path[i-1])
+	if earlierSideEffects(stmt, expr) {
+		return fmt.Errorf("astrewrite: can't hoist an expression evaluated after operands with side effects")
+	}
+	if !replaceChild(path[len(path)-1], expr, &ast.Ident{NamePos: expr.Pos(), Name: name}) {
+		return fmt.Errorf("astrewrite: can't replace the expression to hoist")
+	}
+	decl := &ast.AssignStmt{
+		Lhs:    []ast.Expr{&ast.Ident{NamePos: stmt.Pos(), Name: name}},
+		TokPos: stmt.Pos(),
+		Tok:    token.DEFINE,
+		Rhs:    []ast.Expr{expr},
+	}
+	for k, s := range *list {
+		if s == stmt {
+			*list = append((*list)[:k], append([]ast.Stmt{decl}, (*list)[k:]...)...)
+			break
+		}
+	}
+	return nil
+}
+
+// hoistBarrier returns why expr, below child of n, can't be hoisted out of
+// n, or nil.
+func hoistBarrier(n, child ast.Node, expr ast.Expr) error {
+	switch n := n.(type) {
+	case *ast.DeferStmt:
+		return &DeferredCallError{Stmt: n}
+	case *ast.GoStmt:
+		return &DeferredCallError{Stmt: n}
+	case *ast.FuncLit:
+		return fmt.Errorf("astrewrite: can't hoist out of a function literal")
+	case *ast.BinaryExpr:
+		if (n.Op == token.LAND || n.Op == token.LOR) && child == n.Y {
+			return fmt.Errorf("astrewrite: can't hoist the conditionally evaluated operand of %s", n.Op)
+		}
+	case *ast.IfStmt:
+		if child == n.Else {
+			return fmt.Errorf("astrewrite: can't hoist out of an else if")
+		}
+		return initBarrier(n.Init, child, expr)
+	case *ast.SwitchStmt:
+		return initBarrier(n.Init, child, expr)
+	case *ast.TypeSwitchStmt:
+		return initBarrier(n.Init, child, expr)
+	case *ast.ForStmt:
+		if child == n.Cond || child == n.Post {
+			return fmt.Errorf("astrewrite: can't hoist out of the condition or post statement of a for loop")
+		}
+	case *ast.CaseClause, *ast.CommClause:
+		return fmt.Errorf("astrewrite: can't hoist out of a case")
+	}
+	return nil
+}
+
+// earlierSideEffects reports whether an expression of stmt evaluated before
+// expr may have side effects, which hoisting expr would make run after it.
+// Go evaluates calls and receives from left to right, so these are the
+// expressions preceding expr.
+func earlierSideEffects(stmt ast.Stmt, expr ast.Expr) bool {
+	found := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if found || n == nil || n.Pos() >= expr.Pos() {
+			return false
+		}
+		if e, ok := n.(ast.Expr); ok && e.End() <= expr.Pos() {
+			found = HasSideEffects(e)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// initBarrier returns an error if expr, below child of a statement with the
+// init statement init, uses variables it declares.
+func initBarrier(init ast.Stmt, child ast.Node, expr ast.Expr) error {
+	as, ok := init.(*ast.AssignStmt)
+	if !ok || child == init || as.Tok != token.DEFINE {
+		return nil
+	}
+	for _, lhs := range as.Lhs {
+		if id, ok := lhs.(*ast.Ident); ok && id.Name != "_" && mentions(expr, id.Name) {
+			return fmt.Errorf("astrewrite: can't hoist a use of %s out of its init statement's scope", id.Name)
+		}
+	}
+	return nil
+}
+
+// pathTo returns the ancestors of target below root, starting at root, or
+// nil if target isn't part of root.
+func pathTo(root, target ast.Node) []ast.Node {
+	var stack, path []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch {
+		case path != nil:
+			return false
+		case n == nil:
+			stack = stack[:len(stack)-1]
+			return false
+		case n == target:
+			path = append([]ast.Node(nil), stack...)
+			return false
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return path
+}
+
+// stmtList returns the statement list of n, a block, a case clause or a
+// select clause, or nil.
+func stmtList(n ast.Node) *[]ast.Stmt {
+	switch n := n.(type) {
+	case *ast.BlockStmt:
+		return &n.List
+	case *ast.CaseClause:
+		return &n.Body
+	case *ast.CommClause:
+		return &n.Body
+	}
+	return nil
+}
+
+// replaceChild replaces old, a child of parent, by new, and reports whether
+// it found it.
+func replaceChild(parent, old, new ast.Node) bool {
+	v := reflect.ValueOf(parent).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.Interface && !f.IsNil() && f.Interface() == old:
+			f.Set(reflect.ValueOf(new))
+			return true
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Interface:
+			for j := 0; j < f.Len(); j++ {
+				if e := f.Index(j); !e.IsNil() && e.Interface() == old {
+					e.Set(reflect.ValueOf(new))
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package astrewrite
+
+import (
+	"errors"
+	"go/ast"
+	"testing"
+)
+
+func TestHoist(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f() {
+	g(expensive())
+	defer g(expensive())
+	go g(expensive())
+	if ok && check(expensive()) {
+	}
+	g(setup(), expensive())
+}
+`)
+
+	// collect the calls of expensive along with the context they're in
+	var w *Walker
+	var calls []*ast.CallExpr
+	var contexts [][2]bool
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "expensive") {
+			calls = append(calls, call)
+			c := w.Cursor()
+			contexts = append(contexts, [2]bool{c.InDefer(), c.InGoStmt()})
+		}
+		return n, true
+	})
+	w.Walk(file)
+	want := [][2]bool{{false, false}, {true, false}, {false, true}, {false, false}, {false, false}}
+	if len(calls) != len(want) {
+		t.Fatalf("got %d calls, want %d", len(calls), len(want))
+	}
+	for i := range want {
+		if contexts[i] != want[i] {
+			t.Errorf("call %d: got InDefer, InGoStmt %v, want %v", i, contexts[i], want[i])
+		}
+	}
+
+	if err := Hoist(file, calls[0], "v"); err != nil {
+		t.Fatal(err)
+	}
+	for i, call := range calls[1:3] {
+		var deferred *DeferredCallError
+		if err := Hoist(file, call, "v"); !errors.As(err, &deferred) {
+			t.Errorf("call %d: got error %v, want a *DeferredCallError", i+1, err)
+		}
+	}
+	if err := Hoist(file, calls[3], "v"); err == nil {
+		t.Error("hoisted the right operand of &&")
+	}
+	// setup runs first
+	if err := Hoist(file, calls[4], "v"); err == nil {
+		t.Error("hoisted an operand evaluated after a call")
+	}
+
+	checkSource(t, fset, file, `package p
+
+func f() {
+	v := expensive()
+	g(v)
+	defer g(expensive())
+	go g(expensive())
+	if ok && check(expensive()) {
+	}
+	g(setup(), expensive())
+}
+`)
+}
+
+func TestCursorInClosure(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() {
+	a()
+	defer func() {
+		b()
+	}()
+	go func() {
+		c()
+	}()
+}
+`)
+
+	var w *Walker
+	got := make(map[string][3]bool)
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if id, ok := call.Fun.(*ast.Ident); ok {
+				c := w.Cursor()
+				got[id.Name] = [3]bool{c.InDefer(), c.InGoStmt(), c.InClosure()}
+			}
+		}
+		return n, true
+	})
+	w.Walk(file)
+
+	want := map[string][3]bool{
+		"a": {false, false, false},
+		"b": {true, false, true},
+		"c": {false, true, true},
+	}
+	for name, flags := range want {
+		if got[name] != flags {
+			t.Errorf("%s(): got InDefer, InGoStmt, InClosure %v, want %v", name, got[name], flags)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// HoistByteStringConversions moves the string conversions of variables out
+// of the loops in fn that don't change them, like
+//
+//	for _, k := range keys {
+//		if k == string(b) {
+//			n++
+//		}
+//	}
+//
+// into bStr := string(b) followed by the loop comparing k == bStr, so the
+// bytes are copied once rather than on every iteration. All conversions of
+// a variable in the loop share the hoisted one. A variable only counts as
+// unchanged if it appears nowhere else in the loop, so it's neither
+// assigned, declared, indexed nor passed anywhere; changes through other
+// variables sharing its backing array, or by other goroutines, have to be
+// ruled out by the caller. Conversions are hoisted out of the outermost
+// loop they're invariant in.
+//
+// Conversions of strings to byte slices, like []byte(s), are reported
+// rather than hoisted when they're invariant in the same way: each of them
+// yields a fresh copy, which the loop may modify, so sharing one is only
+// safe if it doesn't. It returns the number of hoisted conversions.
+func HoistByteStringConversions(fn *ast.FuncDecl) (hoisted int, flagged []*ast.CallExpr) {
+	if fn.Body == nil || shadows(fn, "string") {
+		return 0, nil
+	}
+	names := NewNameGen(fn)
+	seen := make(map[*ast.CallExpr]bool)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			n.List = hoistConversions(n.List, names, &hoisted)
+		case *ast.CaseClause:
+			n.Body = hoistConversions(n.Body, names, &hoisted)
+		case *ast.CommClause:
+			n.Body = hoistConversions(n.Body, names, &hoisted)
+		case *ast.ForStmt, *ast.RangeStmt:
+			for _, call := range invariantConversions(n.(ast.Stmt), "byte") {
+				if !seen[call] {
+					seen[call] = true
+					flagged = append(flagged, call)
+				}
+			}
+		}
+		return true
+	})
+	return hoisted, flagged
+}
+
+// hoistConversions hoists the invariant string conversions out of the loops
+// in list and returns the resulting list.
+func hoistConversions(list []ast.Stmt, names *NameGen, hoisted *int) []ast.Stmt {
+	var rewritten []ast.Stmt
+	for _, s := range list {
+		loop := s
+		if labeled, ok := s.(*ast.LabeledStmt); ok {
+			loop = labeled.Stmt
+		}
+		switch loop.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+		default:
+			rewritten = append(rewritten, s)
+			continue
+		}
+
+		vars := make(map[string]*ast.Ident)
+		for _, call := range invariantConversions(loop, "string") {
+			x := call.Args[0].(*ast.Ident)
+			if vars[x.Name] != nil {
+				continue
+			}
+			pos := s.Pos()
+			v := &ast.Ident{NamePos: pos, Name: names.Name(x.Name + "Str")}
+			vars[x.Name] = v
+			rewritten = append(rewritten, &ast.AssignStmt{
+				Lhs:    []ast.Expr{v},
+				TokPos: pos,
+				Tok:    token.DEFINE,
+				Rhs: []ast.Expr{&ast.CallExpr{
+					Fun:    &ast.Ident{NamePos: pos, Name: "string"},
+					Lparen: pos,
+					Args:   []ast.Expr{&ast.Ident{NamePos: pos, Name: x.Name}},
+					Rparen: pos,
+				}},
+			})
+			*hoisted++
+		}
+		if len(vars) > 0 {
+			Walk(loop, func(n ast.Node) (ast.Node, bool) {
+				if call, ok := n.(*ast.CallExpr); ok && conversionOf(call, "string") != nil {
+					if v := vars[call.Args[0].(*ast.Ident).Name]; v != nil {
+						return &ast.Ident{NamePos: call.Pos(), Name: v.Name}, false
+					}
+				}
+				return n, true
+			})
+		}
+		rewritten = append(rewritten, s)
+	}
+	return rewritten
+}
+
+// invariantConversions returns the conversions to string, or to []elem
+// otherwise, of the variables appearing nowhere else in loop, in the order
+// they appear.
+func invariantConversions(loop ast.Stmt, elem string) []*ast.CallExpr {
+	var convs []*ast.CallExpr
+	operands := make(map[*ast.Ident]bool)
+	ast.Inspect(loop, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if x := conversionOf(call, elem); x != nil {
+				convs = append(convs, call)
+				operands[x] = true
+			}
+		}
+		return true
+	})
+
+	// names appearing other than as an operand
+	other := make(map[string]bool)
+	ast.Inspect(loop, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !operands[id] {
+			other[id.Name] = true
+		}
+		return true
+	})
+	invariant := convs[:0]
+	for _, call := range convs {
+		if !other[call.Args[0].(*ast.Ident).Name] {
+			invariant = append(invariant, call)
+		}
+	}
+	return invariant
+}
+
+// conversionOf returns the variable converted by call if it converts one to
+// string, for elem "string", or to []elem otherwise.
+func conversionOf(call *ast.CallExpr, elem string) *ast.Ident {
+	if len(call.Args) != 1 || call.Ellipsis.IsValid() {
+		return nil
+	}
+	x, ok := call.Args[0].(*ast.Ident)
+	if !ok || x.Name == "nil" || x.Name == "_" {
+		return nil
+	}
+	if elem == "string" {
+		if !isIdent(call.Fun, "string") {
+			return nil
+		}
+		return x
+	}
+	at, ok := call.Fun.(*ast.ArrayType)
+	if !ok || at.Len != nil || !isIdent(at.Elt, elem) {
+		return nil
+	}
+	return x
+}
+
+// shadows reports whether the predeclared name is redeclared below node,
+// going by the objects resolved by the parser.
+func shadows(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name && id.Obj != nil {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
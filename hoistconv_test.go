@@ -0,0 +1,63 @@
+package astrewrite
+
+import "testing"
+
+func TestHoistByteStringConversions(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func count(keys []string, b []byte, s string) (n int) {
+	for _, k := range keys {
+		if k == string(b) || k+"!" == string(b) {
+			n++
+		}
+		for _, r := range k {
+			n += len(string(b)) + int(r)
+		}
+		use([]byte(s))
+	}
+	for i := range keys {
+		b[0] = byte(i)
+		if keys[i] == string(b) {
+			n++
+		}
+	}
+	for _, k := range keys {
+		k := []byte(k)
+		use(k)
+	}
+	return n
+}
+`)
+
+	fd := findFunc(file, "count")
+	hoisted, flagged := HoistByteStringConversions(fd)
+	if hoisted != 1 {
+		t.Errorf("hoisted %d conversions, want 1", hoisted)
+	}
+	if len(flagged) != 1 || fset.Position(flagged[0].Pos()).Line != 11 {
+		t.Errorf("got %d flagged conversions, want the one on line 11", len(flagged))
+	}
+	checkSource(t, fset, fd, `func count(keys []string, b []byte, s string) (n int) {
+	bStr := string(b)
+	for _, k := range keys {
+		if k == bStr || k+"!" == bStr {
+			n++
+		}
+		for _, r := range k {
+			n += len(bStr) + int(r)
+		}
+		use([]byte(s))
+	}
+	for i := range keys {
+		b[0] = byte(i)
+		if keys[i] == string(b) {
+			n++
+		}
+	}
+	for _, k := range keys {
+		k := []byte(k)
+		use(k)
+	}
+	return n
+}`)
+}
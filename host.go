@@ -0,0 +1,603 @@
+package astrewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Host parses and type checks a set of files once, runs any number of
+// independent pipelines of rules over them, and writes back the merged
+// changes of all pipelines once, so that running many rule sets doesn't
+// cost a parse and a print per rule set.
+//
+// Every pipeline works on its own copy of the files and never observes the
+// changes of another. Its changes are kept as edits of the top-level
+// declarations of the original files, which Flush applies. Pipelines may
+// run concurrently; a pipeline whose edits overlap those of a pipeline that
+// finished before, or depend on what it edited, is rejected with a
+// *ConflictError rather than applied in an order nobody chose.
+//
+// Load, Run and Flush stop when the context of the Host is done, and work
+// on up to a given number of files at the same time, see HostContext and
+// HostConcurrency.
+type Host struct {
+	fset  *token.FileSet
+	info  *types.Info
+	files []*hostFile
+
+	ctx     context.Context
+	workers int
+
+	mu      sync.Mutex
+	runs    []*hostRun
+	flushed bool
+}
+
+// hostFile is a file loaded by a Host.
+type hostFile struct {
+	path string
+	mode os.FileMode
+	src  []byte
+	file *ast.File
+	pkg  *types.Package
+}
+
+// HostOption configures a Host.
+type HostOption func(*Host)
+
+// HostContext makes Load, Run and Flush stop when ctx is done: no file is
+// started afterwards, the files being processed are finished, and they
+// return the error of ctx. Run then discards the edits of the pipeline.
+func HostContext(ctx context.Context) HostOption {
+	return func(h *Host) {
+		h.ctx = ctx
+	}
+}
+
+// HostConcurrency makes Load parse, Run run a pipeline over, and Flush
+// write up to n files at the same time rather than one after the other.
+// Rules must then be safe for concurrent use. Packages are still type
+// checked one after the other. n less than 1 is taken as 1.
+func HostConcurrency(n int) HostOption {
+	return func(h *Host) {
+		h.workers = max(n, 1)
+	}
+}
+
+// NewHost returns a Host without files.
+func NewHost(opts ...HostOption) *Host {
+	h := &Host{
+		fset: token.NewFileSet(),
+		info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		},
+		ctx:     context.Background(),
+		workers: 1,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// each calls fn with the indices from 0 to n-1, from up to h.workers
+// goroutines, in order, and stops starting calls after the first error or
+// once the context of h is done. It returns the error of the lowest index,
+// or that of the context.
+func (h *Host) each(n int, fn func(i int) error) error {
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+	errs := make([]error, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < h.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					continue
+				}
+				if errs[i] = fn(i); errs[i] != nil {
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return h.ctx.Err()
+}
+
+// Load parses and type checks the Go files given in patterns and the Go
+// files in the directory trees given in patterns, which are found like
+// Driver.Run finds them; a trailing /... is allowed and changes nothing.
+// The files of a directory declaring the same package are checked as a
+// package, importing other packages from source. Type errors don't fail
+// Load: rules get the type information that could be worked out.
+func (h *Host) Load(patterns ...string) error {
+	paths := make([]string, len(patterns))
+	for i, p := range patterns {
+		paths[i] = strings.TrimSuffix(strings.TrimSuffix(p, "..."), string(filepath.Separator))
+		if paths[i] == "" {
+			paths[i] = "."
+		}
+	}
+	names, err := goFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	files := make([]*hostFile, len(names))
+	err = h.each(len(names), func(i int) error {
+		path := names[i]
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file, err := parser.ParseFile(h.fset, path, src, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		files[i] = &hostFile{path: path, mode: fi.Mode().Perm(), src: src, file: file}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	type pkgKey struct{ dir, name string }
+	pkgs := make(map[pkgKey][]*hostFile)
+	var keys []pkgKey
+	for _, hf := range files {
+		h.files = append(h.files, hf)
+		k := pkgKey{filepath.Dir(hf.path), hf.file.Name.Name}
+		if pkgs[k] == nil {
+			keys = append(keys, k)
+		}
+		pkgs[k] = append(pkgs[k], hf)
+	}
+	sort.SliceStable(h.files, func(i, j int) bool { return h.files[i].path < h.files[j].path })
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(h.fset, "source", nil),
+		Error:    func(error) {},
+	}
+	for _, k := range keys {
+		if err := h.ctx.Err(); err != nil {
+			return err
+		}
+		files := make([]*ast.File, len(pkgs[k]))
+		for i, hf := range pkgs[k] {
+			files[i] = hf.file
+		}
+		pkg, _ := conf.Check(k.name, h.fset, files, h.info)
+		for _, hf := range pkgs[k] {
+			hf.pkg = pkg
+		}
+	}
+	return nil
+}
+
+// Rule is a step of a Pipeline, run once for every loaded file.
+type Rule func(*Pass) error
+
+// WalkRule returns a Rule walking the file with fn.
+func WalkRule(fn WalkFunc) Rule {
+	return func(p *Pass) error {
+		f, ok := Walk(p.File, fn).(*ast.File)
+		if !ok {
+			return fmt.Errorf("astrewrite: %s: file removed by walk", p.Path)
+		}
+		p.File = f
+		return nil
+	}
+}
+
+// Pipeline is a named sequence of rules run by Host.Run.
+type Pipeline struct {
+	Name  string
+	Rules []Rule
+}
+
+// Pass is the state of a pipeline running over a single file.
+type Pass struct {
+	// Path is the path of the file.
+	Path string
+
+	// Fset holds the positions of the file.
+	Fset *token.FileSet
+
+	// File is the copy of the file the pipeline works on. Rules may
+	// change it in place or replace it. Only changes of its declarations
+	// and of their comments are kept, see Host.
+	File *ast.File
+
+	// Pkg is the package of the file, as far as it could be checked.
+	Pkg *types.Package
+
+	info    *types.Info
+	origins map[ast.Node]ast.Node
+	reads   []span
+}
+
+// span is the source range [pos, end); an empty range is a point at which
+// declarations are inserted.
+type span struct {
+	pos, end token.Pos
+}
+
+// overlaps reports whether s and o overlap, or touch if either is a point.
+func (s span) overlaps(o span) bool {
+	if s.pos == s.end || o.pos == o.end {
+		return s.pos <= o.end && o.pos <= s.end
+	}
+	return s.pos < o.end && o.pos < s.end
+}
+
+// TypeOf returns the type of e, which is a node of File that was loaded
+// rather than added by a rule, or nil.
+func (p *Pass) TypeOf(e ast.Expr) types.Type {
+	if orig, ok := p.origins[e].(ast.Expr); ok {
+		return p.info.TypeOf(orig)
+	}
+	return nil
+}
+
+// ObjectOf returns the object id, which is a node of File that was loaded
+// rather than added by a rule, defines or uses, or nil.
+func (p *Pass) ObjectOf(id *ast.Ident) types.Object {
+	if orig, ok := p.origins[id].(*ast.Ident); ok {
+		return p.info.ObjectOf(orig)
+	}
+	return nil
+}
+
+// Read records that the changes of the pipeline depend on nodes, so that
+// an edit of another pipeline to their source conflicts with them. The
+// nodes the rules change are recorded anyway.
+func (p *Pass) Read(nodes ...ast.Node) {
+	for _, n := range nodes {
+		if !isNil(n) && n.Pos().IsValid() {
+			p.reads = append(p.reads, span{n.Pos(), n.End()})
+		}
+	}
+}
+
+// ImportedAs returns the name File refers to the package with the given
+// path by and whether it imports it at all, and records the imports of File
+// as read. If File doesn't import it, the name is the one the package would
+// be imported by.
+func (p *Pass) ImportedAs(path string) (string, bool) {
+	read := false
+	for _, d := range p.File.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			p.Read(gd)
+			read = true
+		}
+	}
+	if !read {
+		// where a new import declaration would go
+		end := p.File.Name.End()
+		p.reads = append(p.reads, span{end, end})
+	}
+	return importedAs(p.File, path)
+}
+
+// RunReport describes the changes of a pipeline, which Flush applies.
+type RunReport struct {
+	// Pipeline is the name of the pipeline.
+	Pipeline string
+
+	// Files holds a report for every file the pipeline changed, sorted
+	// by path, whose edits cover the changed declarations of the
+	// original file.
+	Files []*FileReport
+}
+
+// ConflictError is returned by Host.Run when a pipeline edits source that
+// a pipeline run before edited or read, or read source it edited.
+type ConflictError struct {
+	// Pipeline is the rejected pipeline, With the pipeline run before.
+	Pipeline, With string
+
+	// Pos is the position of the first conflicting edit or read of
+	// Pipeline.
+	Pos token.Position
+
+	// Read is set if the conflict is between an edit and a read rather
+	// than two edits.
+	Read bool
+}
+
+func (e *ConflictError) Error() string {
+	what := "their edits overlap"
+	if e.Read {
+		what = "one edits what the other read"
+	}
+	return fmt.Sprintf("astrewrite: pipeline %s conflicts with %s at %s: %s", e.Pipeline, e.With, e.Pos, what)
+}
+
+// hostRun is the accepted result of a pipeline.
+type hostRun struct {
+	name  string
+	files map[*hostFile]*runFile
+}
+
+// runFile holds the edits of a pipeline to a file, and what it read.
+type runFile struct {
+	file   *ast.File // the copy the edited nodes belong to
+	edits  []Edit
+	writes []span
+	reads  []span
+}
+
+// Run runs the rules of pipeline in order over a copy of every loaded file
+// and returns the edits they make, which Flush applies later unless Run
+// fails. It fails with the first error of a rule, or with a
+// *ConflictError if the edits conflict with those of a pipeline run
+// before, in which case they're discarded. Run may be called concurrently.
+func (h *Host) Run(pipeline Pipeline) (*RunReport, error) {
+	run := &hostRun{name: pipeline.Name, files: make(map[*hostFile]*runFile)}
+	report := &RunReport{Pipeline: pipeline.Name}
+	rfs := make([]*runFile, len(h.files))
+	err := h.each(len(h.files), func(i int) error {
+		hf := h.files[i]
+		cp, origins := cloneOrigins(hf.file)
+		p := &Pass{Path: hf.path, Fset: h.fset, File: cp.(*ast.File), Pkg: hf.pkg, info: h.info, origins: origins}
+		for _, rule := range pipeline.Rules {
+			if err := rule(p); err != nil {
+				return err
+			}
+		}
+		rf, err := h.declEdits(hf.file, p.File)
+		if err != nil {
+			return fmt.Errorf("astrewrite: %s: %v", hf.path, err)
+		}
+		rf.reads = p.reads
+		rfs[i] = rf
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, rf := range rfs {
+		hf := h.files[i]
+		if len(rf.edits) > 0 || len(rf.reads) > 0 {
+			run.files[hf] = rf
+		}
+		if len(rf.edits) > 0 {
+			report.Files = append(report.Files, &FileReport{Path: hf.path, Changed: true, Edits: rf.edits})
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.flushed {
+		return nil, fmt.Errorf("astrewrite: host already flushed")
+	}
+	if err := h.conflict(run); err != nil {
+		return nil, err
+	}
+	h.runs = append(h.runs, run)
+	return report, nil
+}
+
+// conflict returns the first conflict of run with the runs accepted
+// before, or nil.
+func (h *Host) conflict(run *hostRun) error {
+	for _, hf := range h.files {
+		rf := run.files[hf]
+		if rf == nil {
+			continue
+		}
+		for _, prev := range h.runs {
+			pf := prev.files[hf]
+			if pf == nil {
+				continue
+			}
+			if s, ok := firstOverlap(rf.writes, pf.writes); ok {
+				return &ConflictError{Pipeline: run.name, With: prev.name, Pos: h.fset.Position(s.pos)}
+			}
+			if s, ok := firstOverlap(rf.writes, pf.reads); ok {
+				return &ConflictError{Pipeline: run.name, With: prev.name, Pos: h.fset.Position(s.pos), Read: true}
+			}
+			if s, ok := firstOverlap(rf.reads, pf.writes); ok {
+				return &ConflictError{Pipeline: run.name, With: prev.name, Pos: h.fset.Position(s.pos), Read: true}
+			}
+		}
+	}
+	return nil
+}
+
+// firstOverlap returns the first span of a overlapping one of b.
+func firstOverlap(a, b []span) (span, bool) {
+	for _, s := range a {
+		for _, o := range b {
+			if s.overlaps(o) {
+				return s, true
+			}
+		}
+	}
+	return span{}, false
+}
+
+// declEdits returns the edits turning the declarations of orig into those
+// of cp, a copy of orig changed by a pipeline. Declarations of cp are
+// matched with those of orig by position: a declaration matching one of
+// orig but printed differently replaces it, one matching none is inserted
+// after the declaration of orig preceding it, and declarations of orig
+// matched by none are deleted.
+func (h *Host) declEdits(orig, cp *ast.File) (*runFile, error) {
+	rf := &runFile{file: cp}
+	byPos := make(map[token.Pos]int, len(orig.Decls))
+	for i, d := range orig.Decls {
+		byPos[d.Pos()] = i
+	}
+
+	matched := make([]bool, len(orig.Decls))
+	at := orig.Name.End()
+	for _, d := range cp.Decls {
+		i, ok := byPos[d.Pos()]
+		if !ok || matched[i] {
+			rf.edits = append(rf.edits, Edit{Pos: at, End: at, Node: d})
+			rf.writes = append(rf.writes, span{at, at})
+			continue
+		}
+		matched[i] = true
+		od := orig.Decls[i]
+		at = od.End()
+		a, err := declText(h.fset, orig, od)
+		if err != nil {
+			return nil, err
+		}
+		b, err := declText(h.fset, cp, d)
+		if err != nil {
+			return nil, err
+		}
+		if a != b {
+			rf.edits = append(rf.edits, Edit{Pos: declStart(od), End: od.End(), Node: d})
+			rf.writes = append(rf.writes, span{declStart(od), od.End()})
+		}
+	}
+	for i, d := range orig.Decls {
+		if !matched[i] {
+			rf.edits = append(rf.edits, Edit{Pos: declStart(d), End: d.End()})
+			rf.writes = append(rf.writes, span{declStart(d), d.End()})
+		}
+	}
+	sort.SliceStable(rf.edits, func(i, j int) bool { return rf.edits[i].Pos < rf.edits[j].Pos })
+	return rf, nil
+}
+
+// declText returns d printed with the comments of file.
+func declText(fset *token.FileSet, file *ast.File, d ast.Decl) (string, error) {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, &printer.CommentedNode{Node: d, Comments: file.Comments}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Flush applies the edits of all the pipelines run, writes back the files
+// they changed, formatted, and returns their paths. Like Driver.Run, it
+// writes every file to a temporary file first, which replaces it once
+// complete, so that failing or stopping never leaves a file half-written;
+// the paths of the files written before are returned along with the
+// error. The Host can't run pipelines anymore afterwards.
+func (h *Host) Flush() ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.flushed {
+		return nil, fmt.Errorf("astrewrite: host already flushed")
+	}
+	h.flushed = true
+
+	written := make([]bool, len(h.files))
+	err := h.each(len(h.files), func(i int) error {
+		hf := h.files[i]
+		out, ok, err := h.apply(hf)
+		if err != nil {
+			return fmt.Errorf("astrewrite: %s: %v", hf.path, err)
+		}
+		if !ok {
+			return nil
+		}
+		if err := writeFile(hf.path, out, hf.mode); err != nil {
+			return err
+		}
+		written[i] = true
+		return nil
+	})
+	var changed []string
+	for i, hf := range h.files {
+		if written[i] {
+			changed = append(changed, hf.path)
+		}
+	}
+	return changed, err
+}
+
+// apply returns the source of hf with the edits of all runs applied, and
+// whether there were any.
+func (h *Host) apply(hf *hostFile) ([]byte, bool, error) {
+	type hostEdit struct {
+		Edit
+		file *ast.File
+	}
+	var edits []hostEdit
+	for _, run := range h.runs {
+		if rf := run.files[hf]; rf != nil {
+			for _, e := range rf.edits {
+				edits = append(edits, hostEdit{e, rf.file})
+			}
+		}
+	}
+	if len(edits) == 0 {
+		return nil, false, nil
+	}
+	// conflicting runs were rejected, so edits at the same position come
+	// from a single run, in order
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Pos < edits[j].Pos })
+
+	tf := h.fset.File(hf.file.Pos())
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		start, end := tf.Offset(e.Pos), tf.Offset(e.End)
+		var text []byte
+		if e.Node != nil {
+			var err error
+			if text, err = printIndented(h.fset, e.file, e.Node, ""); err != nil {
+				return nil, false, err
+			}
+			if start == end {
+				text = append([]byte("\n\n"), text...)
+			}
+		} else {
+			start, end = deletionRange(hf.src, start, end)
+		}
+		buf.Write(hf.src[last:start])
+		buf.Write(text)
+		last = end
+	}
+	buf.Write(hf.src[last:])
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
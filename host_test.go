@@ -0,0 +1,257 @@
+package astrewrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// addStringsImport is a pipeline editing the imports of every file.
+var addStringsImport = Pipeline{
+	Name: "imports",
+	Rules: []Rule{func(p *Pass) error {
+		AddImport(p.File, "strings")
+		return nil
+	}},
+}
+
+// qualifyUpper is a pipeline reading the imports of every file, to rewrite
+// calls of upper to calls of strings.ToUpper.
+var qualifyUpper = Pipeline{
+	Name: "upper",
+	Rules: []Rule{func(p *Pass) error {
+		name, _ := p.ImportedAs("strings")
+		p.File = Walk(p.File, func(n ast.Node) (ast.Node, bool) {
+			if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "upper") {
+				call.Fun = qualified(name, "ToUpper", call.Fun.Pos())
+			}
+			return n, true
+		}).(*ast.File)
+		return nil
+	}},
+}
+
+func TestHost(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.go": `package p
+
+// F is renamed.
+func F() int { return n }
+
+// n is typed.
+var n = 1
+`,
+		"b.go": `package p
+
+func G() {}
+`,
+	})
+
+	h := NewHost()
+	if err := h.Load(dir + "/..."); err != nil {
+		t.Fatal(err)
+	}
+
+	var typ types.Type
+	rename := Pipeline{Name: "rename", Rules: []Rule{
+		func(p *Pass) error {
+			for _, d := range p.File.Decls {
+				if vs, ok := d.(*ast.GenDecl); ok {
+					typ = p.TypeOf(vs.Specs[0].(*ast.ValueSpec).Values[0])
+				}
+			}
+			return nil
+		},
+		WalkRule(func(n ast.Node) (ast.Node, bool) {
+			if fd, ok := n.(*ast.FuncDecl); ok && fd.Name.Name == "F" {
+				fd.Name.Name = "H"
+			}
+			return n, true
+		}),
+	}}
+	remove := Pipeline{Name: "remove", Rules: []Rule{WalkRule(func(n ast.Node) (ast.Node, bool) {
+		if fd, ok := n.(*ast.FuncDecl); ok && fd.Name.Name == "G" {
+			return Remove, false
+		}
+		return n, true
+	})}}
+
+	report, err := h.Run(rename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 1 || len(report.Files[0].Edits) != 1 {
+		t.Errorf("got report %+v, want a single edit of a.go", report.Files)
+	}
+	if typ == nil || typ.String() != "int" {
+		t.Errorf("got type %v, want int", typ)
+	}
+	if _, err := h.Run(remove); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file isn't written before Flush
+	if got := readFile(t, dir, "a.go"); !strings.Contains(got, "func F() int") {
+		t.Errorf("a.go changed before Flush:\n%s", got)
+	}
+
+	changed, err := h.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 2 {
+		t.Errorf("got changed files %v, want a.go and b.go", changed)
+	}
+	if got, want := readFile(t, dir, "a.go"), `package p
+
+// F is renamed.
+func H() int { return n }
+
+// n is typed.
+var n = 1
+`; got != want {
+		t.Errorf("got a.go:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := readFile(t, dir, "b.go"), "package p\n"; got != want {
+		t.Errorf("got b.go:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := h.Run(rename); err == nil {
+		t.Error("ran a pipeline after Flush")
+	}
+}
+
+func TestHostConflict(t *testing.T) {
+	src := `package p
+
+func f(s string) string { return upper(s) }
+`
+	for _, order := range [][2]Pipeline{{addStringsImport, qualifyUpper}, {qualifyUpper, addStringsImport}} {
+		dir := writeFiles(t, map[string]string{"a.go": src})
+		h := NewHost()
+		if err := h.Load(dir); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.Run(order[0]); err != nil {
+			t.Fatal(err)
+		}
+		_, err := h.Run(order[1])
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("running %s after %s: got error %v, want a conflict", order[1].Name, order[0].Name, err)
+		}
+		if conflict.Pipeline != order[1].Name || conflict.With != order[0].Name || !conflict.Read {
+			t.Errorf("got conflict %+v", conflict)
+		}
+		if filepath.Base(conflict.Pos.Filename) != "a.go" {
+			t.Errorf("got conflict at %s, want a.go", conflict.Pos)
+		}
+
+		// only the first pipeline is applied
+		if _, err := h.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{
+			"imports": "package p\n\nimport \"strings\"\n\nfunc f(s string) string { return upper(s) }\n",
+			"upper":   "package p\n\nfunc f(s string) string { return strings.ToUpper(s) }\n",
+		}[order[0].Name]
+		if got := readFile(t, dir, "a.go"); got != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestHostConcurrent(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.go": `package p
+
+func f(s string) string { return upper(s) }
+`})
+	h := NewHost()
+	if err := h.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, pl := range []Pipeline{addStringsImport, qualifyUpper} {
+		wg.Add(1)
+		go func(i int, pl Pipeline) {
+			defer wg.Done()
+			_, errs[i] = h.Run(pl)
+		}(i, pl)
+	}
+	wg.Wait()
+
+	conflicts := 0
+	for _, err := range errs {
+		var conflict *ConflictError
+		if errors.As(err, &conflict) {
+			conflicts++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conflicts != 1 {
+		t.Errorf("got errors %v, want a single conflict", errs)
+	}
+}
+
+func TestHostCancel(t *testing.T) {
+	const src = "package p\n\nfunc f(s string) string { return upper(s) }\n"
+	files := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("p%d/f%02d.go", i%5, i)] = src
+	}
+
+	// all files are rewritten with several workers
+	dir := writeFiles(t, files)
+	h := NewHost(HostConcurrency(4))
+	if err := h.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Run(addStringsImport); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := h.Flush(); err != nil || len(changed) != len(files) {
+		t.Fatalf("got %d files changed and error %v, want %d files", len(changed), err, len(files))
+	}
+
+	// canceling stops the pipeline, and the files are left alone
+	dir = writeFiles(t, files)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h = NewHost(HostContext(ctx), HostConcurrency(4))
+	if err := h.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	var passes atomic.Int32
+	stopping := Pipeline{Name: "stopping", Rules: []Rule{func(p *Pass) error {
+		if passes.Add(1) == 10 {
+			cancel()
+		}
+		return nil
+	}, addStringsImport.Rules[0]}}
+	if _, err := h.Run(stopping); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if n := passes.Load(); n >= int32(len(files)) {
+		t.Errorf("got %d files passed, want the pipeline stopped", n)
+	}
+	if changed, err := h.Flush(); !errors.Is(err, context.Canceled) || len(changed) != 0 {
+		t.Errorf("got %d files changed and error %v, want none and %v", len(changed), err, context.Canceled)
+	}
+	for name := range files {
+		if got := readFile(t, dir, name); got != src {
+			t.Errorf("%s changed:\n%s", name, got)
+		}
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "*", "*.tmp")); len(tmps) > 0 {
+		t.Errorf("got temporary files %q left", tmps)
+	}
+}
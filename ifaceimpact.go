@@ -0,0 +1,255 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Impact describes an interface a type stops implementing because of an
+// edit renaming or removing one of its methods.
+type Impact struct {
+	// Method is the renamed or removed method. It's a method of Type,
+	// possibly promoted from an embedded field, or a method of Interface.
+	Method *types.Func
+
+	// NewName is the name the method is renamed to, or empty if it's
+	// removed.
+	NewName string
+
+	// Type is the type that stops implementing Interface, a named type or
+	// a pointer to one if only the pointer implements it.
+	Type types.Type
+
+	// Interface is the interface Type stops implementing.
+	Interface *types.TypeName
+
+	// Fix holds the edits completing the rename under CoordinatedRename,
+	// shared by all the impacts of the method, or nil.
+	Fix []Edit
+}
+
+// ImpactOption configures InterfaceImpact.
+type ImpactOption func(*impactConfig)
+
+type impactConfig struct {
+	coordinated bool
+}
+
+// CoordinatedRename makes InterfaceImpact work out, for every renamed
+// method, the edits renaming along with it the methods of the interfaces it
+// implements, the methods of the other types implementing them, and so on,
+// along with all their uses, and put them in the Fix of its impacts.
+// Applying them with the planned edits keeps every type implementing the
+// interfaces it did.
+func CoordinatedRename() ImpactOption {
+	return func(c *impactConfig) {
+		c.coordinated = true
+	}
+}
+
+// InterfaceImpact reports the interface implementations the planned edits
+// would break, so that a rename or removal pass can refuse or fix them up
+// front rather than leave them to the compiler. info must hold the Defs and
+// Uses of the loaded packages. An edit renames a method if it replaces the
+// identifier declaring it with another identifier, or replaces its
+// declaration with a FuncDecl of another name; it removes a method if it
+// deletes a range holding the identifier declaring it. Other edits don't
+// matter.
+//
+// The implementations considered are those of the named interfaces
+// declared in the loaded packages by the named types declared in them,
+// leaving out generic types; interfaces of other packages, like
+// fmt.Stringer, aren't known to info. Impacts are ordered by the position
+// of the method, then of the interface and of the type.
+func InterfaceImpact(info *types.Info, edits []Edit, opts ...ImpactOption) []Impact {
+	var cfg impactConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var ifaces, named []*types.TypeName
+	methods := make(map[token.Pos]*types.Func)
+	for id, obj := range info.Defs {
+		switch obj := obj.(type) {
+		case *types.TypeName:
+			n, ok := obj.Type().(*types.Named)
+			if obj.IsAlias() || !ok || n.TypeParams().Len() > 0 {
+				continue
+			}
+			if iface, ok := n.Underlying().(*types.Interface); ok {
+				if iface.IsMethodSet() && iface.NumMethods() > 0 {
+					ifaces = append(ifaces, obj)
+				}
+				continue
+			}
+			named = append(named, obj)
+		case *types.Func:
+			if obj.Type().(*types.Signature).Recv() != nil {
+				methods[id.Pos()] = obj
+			}
+		}
+	}
+	byPos := func(objs []*types.TypeName) {
+		sort.Slice(objs, func(i, j int) bool { return objs[i].Pos() < objs[j].Pos() })
+	}
+	byPos(ifaces)
+	byPos(named)
+
+	changed := plannedMethodChanges(methods, edits)
+	var impacts []Impact
+	for _, m := range changed.order {
+		var fix []Edit
+		if cfg.coordinated && changed.names[m] != "" {
+			fix = renameGroupEdits(info, methodGroup(m, ifaces, named), changed.names[m], edits)
+		}
+		for _, iface := range ifaces {
+			it := iface.Type().Underlying().(*types.Interface)
+			im := interfaceMethod(it, m)
+			if im == nil {
+				continue
+			}
+			for _, tn := range named {
+				typ, sel := implementation(tn, it, im)
+				if typ == nil || sel != m && im != m {
+					continue
+				}
+				impacts = append(impacts, Impact{Method: m, NewName: changed.names[m], Type: typ, Interface: iface, Fix: fix})
+			}
+		}
+	}
+	return impacts
+}
+
+// methodChanges holds the methods renamed or removed by edits, in the order
+// of their positions, with their new names, empty for removals.
+type methodChanges struct {
+	order []*types.Func
+	names map[*types.Func]string
+}
+
+// plannedMethodChanges returns the changes edits make to methods, the
+// methods declared at every position.
+func plannedMethodChanges(methods map[token.Pos]*types.Func, edits []Edit) methodChanges {
+	c := methodChanges{names: make(map[*types.Func]string)}
+	add := func(m *types.Func, name string) {
+		if _, ok := c.names[m]; !ok {
+			c.order = append(c.order, m)
+		}
+		c.names[m] = name
+	}
+	for _, e := range edits {
+		switch n := e.Node.(type) {
+		case *ast.Ident:
+			if m := methods[e.Pos]; m != nil && e.End == e.Pos+token.Pos(len(m.Name())) && n.Name != m.Name() {
+				add(m, n.Name)
+			}
+		case *ast.FuncDecl:
+			for pos, m := range methods {
+				if e.Pos <= pos && pos < e.End && n.Name.Name != m.Name() {
+					add(m, n.Name.Name)
+				}
+			}
+		case nil:
+			for pos, m := range methods {
+				if e.Pos <= pos && pos < e.End {
+					add(m, "")
+				}
+			}
+		}
+	}
+	sort.Slice(c.order, func(i, j int) bool { return c.order[i].Pos() < c.order[j].Pos() })
+	return c
+}
+
+// interfaceMethod returns the method of iface m would have to implement,
+// or m itself if it's a method of iface.
+func interfaceMethod(iface *types.Interface, m *types.Func) *types.Func {
+	for i := 0; i < iface.NumMethods(); i++ {
+		im := iface.Method(i)
+		if im == m || im.Name() == m.Name() && (m.Exported() || im.Pkg() == m.Pkg()) {
+			return im
+		}
+	}
+	return nil
+}
+
+// implementation returns the type named by tn, or the pointer to it, that
+// implements iface, and the method it implements the method im with, or
+// nil if neither implements iface.
+func implementation(tn *types.TypeName, iface *types.Interface, im *types.Func) (types.Type, *types.Func) {
+	for _, typ := range []types.Type{tn.Type(), types.NewPointer(tn.Type())} {
+		if !types.Implements(typ, iface) {
+			continue
+		}
+		sel := types.NewMethodSet(typ).Lookup(im.Pkg(), im.Name())
+		if sel == nil {
+			return typ, nil
+		}
+		m, _ := sel.Obj().(*types.Func)
+		return typ, m
+	}
+	return nil, nil
+}
+
+// methodGroup returns the methods that have to be renamed along with m for
+// the implementations between the types named and the interfaces ifaces to
+// hold: the methods of the interfaces m implements or belongs to, the
+// methods implementing them, and so on.
+func methodGroup(m *types.Func, ifaces, named []*types.TypeName) map[*types.Func]bool {
+	group := map[*types.Func]bool{m: true}
+	for grown := true; grown; {
+		grown = false
+		for _, iface := range ifaces {
+			it := iface.Type().Underlying().(*types.Interface)
+			im := interfaceMethod(it, m)
+			if im == nil {
+				continue
+			}
+			linked := []*types.Func{im}
+			in := group[im]
+			for _, tn := range named {
+				if _, sel := implementation(tn, it, im); sel != nil {
+					linked = append(linked, sel)
+					in = in || group[sel]
+				}
+			}
+			if !in {
+				continue
+			}
+			for _, f := range linked {
+				if !group[f] {
+					group[f] = true
+					grown = true
+				}
+			}
+		}
+	}
+	return group
+}
+
+// renameGroupEdits returns the edits renaming the declarations and uses of
+// the methods of group to name that edits don't cover already.
+func renameGroupEdits(info *types.Info, group map[*types.Func]bool, name string, edits []Edit) []Edit {
+	covered := func(pos token.Pos) bool {
+		for _, e := range edits {
+			if e.Pos <= pos && pos < e.End {
+				return true
+			}
+		}
+		return false
+	}
+	var fix []Edit
+	for _, ids := range []map[*ast.Ident]types.Object{info.Defs, info.Uses} {
+		for id, obj := range ids {
+			f, ok := obj.(*types.Func)
+			if !ok || !group[f.Origin()] || covered(id.Pos()) {
+				continue
+			}
+			fix = append(fix, Edit{Pos: id.Pos(), End: id.End(), Node: &ast.Ident{NamePos: id.Pos(), Name: name}})
+		}
+	}
+	sort.Slice(fix, func(i, j int) bool { return fix[i].Pos < fix[j].Pos })
+	return fix
+}
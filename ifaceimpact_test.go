@@ -0,0 +1,80 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+const impactSrc = `package p
+
+type Namer interface {
+	Name() string
+}
+
+type User struct{ first, last string }
+
+func (u User) Name() string { return u.first + " " + u.last }
+
+type Group struct{ users []User }
+
+func (g *Group) Name() string { return "group of " + g.users[0].Name() }
+
+type Admin struct{ User }
+
+func greet(n Namer) string { return "hello " + n.Name() }
+`
+
+func TestInterfaceImpact(t *testing.T) {
+	fset, file := parse(t, impactSrc)
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	// rename User.Name to Title
+	var id *ast.Ident
+	for _, d := range file.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv != nil && types.ExprString(fd.Recv.List[0].Type) == "User" {
+			id = fd.Name
+		}
+	}
+	edits := []Edit{{Pos: id.Pos(), End: id.End(), Node: ast.NewIdent("Title")}}
+
+	var got []string
+	for _, imp := range InterfaceImpact(info, edits) {
+		got = append(got, types.TypeString(imp.Type, (*types.Package).Name)+" "+imp.Interface.Name()+" "+imp.NewName)
+		if imp.Fix != nil {
+			t.Error("got a fix without CoordinatedRename")
+		}
+	}
+	if want := "p.User Namer Title, p.Admin Namer Title"; strings.Join(got, ", ") != want {
+		t.Errorf("got impacts %q, want %q", got, want)
+	}
+
+	impacts := InterfaceImpact(info, edits, CoordinatedRename())
+	if len(impacts) != 2 {
+		t.Fatalf("got %d impacts, want 2", len(impacts))
+	}
+	src, err := SpliceEdits([]byte(impactSrc), fset, file, append(edits, impacts[0].Fix...), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.NewReplacer("Name()", "Title()", "Name() string", "Title() string").Replace(impactSrc)
+	if string(src) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", src, want)
+	}
+
+	// removing the method of Group breaks *Group only
+	var decl *ast.FuncDecl
+	for _, d := range file.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv != nil && types.ExprString(fd.Recv.List[0].Type) == "*Group" {
+			decl = fd
+		}
+	}
+	impacts = InterfaceImpact(info, []Edit{{Pos: decl.Pos(), End: decl.End()}}, CoordinatedRename())
+	if len(impacts) != 1 || impacts[0].NewName != "" || impacts[0].Fix != nil || types.TypeString(impacts[0].Type, nil) != "*p.Group" {
+		t.Errorf("got impacts %+v, want *p.Group losing its method", impacts)
+	}
+}
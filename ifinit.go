@@ -0,0 +1,237 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// HoistIfInit moves the init statements of the if statements below node in
+// front of them, like
+//
+//	if err := f(); err != nil {
+//		return err
+//	}
+//
+// into
+//
+//	err := f()
+//	if err != nil {
+//		return err
+//	}
+//
+// Hoisting a short variable declaration widens the scope of its variables
+// to the rest of the enclosing block, so it's only done if none of their
+// names appears in the other statements of the block, which could then no
+// longer declare or refer to another variable of that name, and if none of
+// them is declared in an enclosing scope, like the parameters and results
+// of the function, which its body shares a scope with. Only ifs that are
+// statements of a block or clause themselves are changed, not else ifs. It
+// returns the number of hoisted statements.
+func HoistIfInit(node ast.Node) int {
+	// the ifs declaring names that are declared outside of them
+	shadowing := make(map[ast.Stmt]bool)
+	var w *Walker
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		if ifs, ok := n.(*ast.IfStmt); ok && ifs.Init != nil {
+			for _, site := range stmtDecls(ifs.Init) {
+				if outer, ok := w.Cursor().Lookup(site.Name); ok && !isFileScope(outer.Scope) {
+					shadowing[ifs] = true
+				}
+			}
+		}
+		return n, true
+	})
+	w.Walk(node)
+
+	n := 0
+	forEachStmtList(node, func(list []ast.Stmt) []ast.Stmt {
+		var rewritten []ast.Stmt
+		for i, s := range list {
+			ifs, ok := s.(*ast.IfStmt)
+			if !ok || ifs.Init == nil || shadowing[ifs] || !hoistable(ifs.Init, list, i) {
+				rewritten = append(rewritten, s)
+				continue
+			}
+			rewritten = append(rewritten, ifs.Init, ifs)
+			ifs.Init = nil
+			n++
+		}
+		return rewritten
+	})
+	return n
+}
+
+// hoistable reports whether init, the init statement of list[i], can be
+// moved in front of it.
+func hoistable(init ast.Stmt, list []ast.Stmt, i int) bool {
+	as, ok := init.(*ast.AssignStmt)
+	if !ok || as.Tok != token.DEFINE {
+		return true
+	}
+	for _, lhs := range as.Lhs {
+		id, ok := lhs.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		if id.Name == "_" {
+			continue
+		}
+		for j, s := range list {
+			if j != i && mentions(s, id.Name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// InlineIfInit moves short variable declarations into the if statements
+// following them as their init statement, the reverse of HoistIfInit:
+//
+//	err := f()
+//	if err != nil {
+//		return err
+//	}
+//
+// becomes if err := f(); err != nil { ... }. As that narrows the scope of
+// the declared variables to the if statement, it's only done if the
+// condition of the if refers to one of them and none of their names appears
+// after the if in the enclosing block. Declarations assigning a variable
+// declared before in the same scope, like err in v, err := f() after
+// another err or in a function with a result named err, are left alone, as
+// the if would declare a new one rather than assign it. It returns the
+// number of inlined statements.
+func InlineIfInit(node ast.Node) int {
+	// the short variable declarations assigning existing variables
+	assigning := make(map[ast.Stmt]bool)
+	var w *Walker
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		if as, ok := n.(*ast.AssignStmt); ok && as.Tok == token.DEFINE {
+			c := w.Cursor()
+			for _, site := range stmtDecls(as) {
+				if prev, ok := c.Lookup(site.Name); ok && sameScope(prev.Scope, c.Parent()) {
+					assigning[as] = true
+				}
+			}
+		}
+		return n, true
+	})
+	w.Walk(node)
+
+	n := 0
+	forEachStmtList(node, func(list []ast.Stmt) []ast.Stmt {
+		var rewritten []ast.Stmt
+		for i := 0; i < len(list); i++ {
+			if i+1 < len(list) && !assigning[list[i]] && inlinable(list, i) {
+				// the if starts where the declaration did, so no blank
+				// line is left in its place
+				ifs := list[i+1].(*ast.IfStmt)
+				ifs.If = list[i].Pos()
+				stampPositions(list[i], ifs.If)
+				ifs.Init = list[i]
+				rewritten = append(rewritten, ifs)
+				i++
+				n++
+				continue
+			}
+			rewritten = append(rewritten, list[i])
+		}
+		return rewritten
+	})
+	return n
+}
+
+// inlinable reports whether list[i] can become the init statement of
+// list[i+1].
+func inlinable(list []ast.Stmt, i int) bool {
+	as, ok := list[i].(*ast.AssignStmt)
+	if !ok || as.Tok != token.DEFINE {
+		return false
+	}
+	ifs, ok := list[i+1].(*ast.IfStmt)
+	if !ok || ifs.Init != nil {
+		return false
+	}
+	checked := false
+	for _, lhs := range as.Lhs {
+		id, ok := lhs.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		if id.Name == "_" {
+			continue
+		}
+		for _, s := range list[i+2:] {
+			if mentions(s, id.Name) {
+				return false
+			}
+		}
+		checked = checked || mentions(ifs.Cond, id.Name)
+	}
+	return checked
+}
+
+// isFileScope reports whether scope, the scope of a DeclSite, is that of
+// the package or file.
+func isFileScope(scope ast.Node) bool {
+	switch scope.(type) {
+	case *ast.File, *ast.Package:
+		return true
+	}
+	return false
+}
+
+// sameScope reports whether the names declared in scope, the scope of a
+// DeclSite, are in the scope of the statements of list, a block or clause.
+func sameScope(scope, list ast.Node) bool {
+	switch fn := scope.(type) {
+	case *ast.FuncDecl:
+		return fn.Body == list
+	case *ast.FuncLit:
+		return fn.Body == list
+	}
+	return scope == list
+}
+
+// forEachStmtList replaces every statement list below node, those of
+// blocks and of case and comm clauses, by what fn returns for it. Nested
+// lists are handled before the list containing them.
+func forEachStmtList(node ast.Node, fn func([]ast.Stmt) []ast.Stmt) {
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			for _, s := range n.List {
+				ast.Inspect(s, visit)
+			}
+			n.List = fn(n.List)
+			return false
+		case *ast.CaseClause:
+			for _, s := range n.Body {
+				ast.Inspect(s, visit)
+			}
+			n.Body = fn(n.Body)
+			return false
+		case *ast.CommClause:
+			for _, s := range n.Body {
+				ast.Inspect(s, visit)
+			}
+			n.Body = fn(n.Body)
+			return false
+		}
+		return true
+	}
+	ast.Inspect(node, visit)
+}
+
+// mentions reports whether the identifier name appears in node.
+func mentions(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,141 @@
+package astrewrite
+
+import "testing"
+
+func TestHoistIfInit(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f() error {
+	if err := a(); err != nil {
+		return err
+	}
+	for _, x := range xs {
+		if v, ok := m[x]; ok {
+			use(v)
+		}
+	}
+	if err := b(); err != nil {
+		return err
+	}
+	if n = c(); n > 0 {
+		return nil
+	}
+	if z := 1; z > 0 {
+	} else if y := 2; y > 0 {
+	}
+	return nil
+}
+`)
+
+	// the two errs would clash, so both ifs declaring one are left alone
+	if n := HoistIfInit(file); n != 3 {
+		t.Errorf("hoisted %d statements, want 3", n)
+	}
+	checkSource(t, fset, findFunc(file, "f"), `func f() error {
+	if err := a(); err != nil {
+		return err
+	}
+	for _, x := range xs {
+		v, ok := m[x]
+		if ok {
+			use(v)
+		}
+	}
+	if err := b(); err != nil {
+		return err
+	}
+	n = c()
+	if n > 0 {
+		return nil
+	}
+	z := 1
+	if z > 0 {
+	} else if y := 2; y > 0 {
+	}
+	return nil
+}`)
+}
+
+func TestInlineIfInit(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f() error {
+	err := a()
+	if err != nil {
+		return err
+	}
+	v, ok := m[k]
+	if ok {
+		use(v)
+	}
+	n := c()
+	if n > 0 {
+		return nil
+	}
+	use(n)
+	x := 1
+	if y > 0 {
+	}
+	return nil
+}
+`)
+
+	if n := InlineIfInit(file); n != 2 {
+		t.Errorf("inlined %d statements, want 2", n)
+	}
+	checkSource(t, fset, findFunc(file, "f"), `func f() error {
+	if err := a(); err != nil {
+		return err
+	}
+	if v, ok := m[k]; ok {
+		use(v)
+	}
+	n := c()
+	if n > 0 {
+		return nil
+	}
+	use(n)
+	x := 1
+	if y > 0 {
+	}
+	return nil
+}`)
+}
+
+func TestIfInitScopes(t *testing.T) {
+	src := `package p
+
+func f(err error) error {
+	if err := g(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func h(s string) (n int) {
+	if n := len(s); n > 0 {
+		return n
+	}
+	return 0
+}
+
+func k() (n int, err error) {
+	v, err := g()
+	if err != nil {
+		return
+	}
+	return v, nil
+}
+`
+	// the hoisted declarations would assign the parameter and the result,
+	// and the inlined one would declare a new err rather than assign the
+	// result
+	fset, file := parse(t, src)
+	if n := HoistIfInit(file); n != 0 {
+		t.Errorf("hoisted %d statements, want none", n)
+	}
+	if n := InlineIfInit(file); n != 0 {
+		t.Errorf("inlined %d statements, want none", n)
+	}
+	checkSource(t, fset, file, src)
+}
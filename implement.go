@@ -0,0 +1,128 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ImplementInterface adds stubs to file for the methods of iface the type
+// typeName declared in file lacks, in the order of iface, and returns them.
+// A method counts as present if a method or field of that name is declared
+// in file, whatever its signature. Methods of embedded interfaces can't be
+// told without type information and are skipped.
+//
+// The stubs are appended to file with the signatures of iface and the
+// statements body returns for the method name, or panic("not implemented")
+// if body is nil. Their receiver is named and typed like that of the first
+// method of the type in file, or (t *T), after the first letter of the
+// type, if it has none yet; the type parameters of a generic type are
+// named like those of its declaration then. The caller adds the imports
+// the signatures need, if any.
+func ImplementInterface(file *ast.File, typeName string, iface *ast.InterfaceType, body func(method string) []ast.Stmt) []*ast.FuncDecl {
+	present := make(map[string]bool)
+	var recv *ast.Field
+	var spec *ast.TypeSpec
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, s := range decl.Specs {
+				if ts, ok := s.(*ast.TypeSpec); ok && ts.Name.Name == typeName {
+					spec = ts
+				}
+			}
+		case *ast.FuncDecl:
+			if name, _, _, ok := ReceiverType(decl); ok && name == typeName {
+				present[decl.Name.Name] = true
+				if recv == nil {
+					recv = decl.Recv.List[0]
+				}
+			}
+		}
+	}
+	if spec == nil {
+		return nil
+	}
+	if st, ok := spec.Type.(*ast.StructType); ok {
+		for _, f := range st.Fields.List {
+			for _, name := range f.Names {
+				present[name.Name] = true
+			}
+		}
+	}
+	if recv == nil {
+		recv = defaultReceiver(spec)
+	}
+
+	end := file.End()
+	var stubs []*ast.FuncDecl
+	for _, m := range iface.Methods.List {
+		ftype, ok := m.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+		for _, name := range m.Names {
+			if present[name.Name] {
+				continue
+			}
+			present[name.Name] = true
+
+			ftype := Clone(ftype).(*ast.FuncType)
+			r := Clone(recv).(*ast.Field)
+			r.Doc, r.Comment = nil, nil
+			if len(r.Names) > 0 && r.Names[0].Name != "_" && mentions(ftype, r.Names[0].Name) {
+				r.Names[0].Name = unusedName(ftype, r.Names[0].Name)
+			}
+			var stmts []ast.Stmt
+			if body != nil {
+				stmts = body(name.Name)
+			} else {
+				stmts = []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+					Fun:  ast.NewIdent("panic"),
+					Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote("not implemented")}},
+				}}}
+			}
+			fd := &ast.FuncDecl{
+				Recv: &ast.FieldList{List: []*ast.Field{r}},
+				Name: ast.NewIdent(name.Name),
+				Type: ftype,
+				Body: &ast.BlockStmt{List: stmts},
+			}
+			clearPositions(fd)
+			fd.Type.Func, fd.Name.NamePos = end, end
+			file.Decls = append(file.Decls, fd)
+			stubs = append(stubs, fd)
+		}
+	}
+	return stubs
+}
+
+// defaultReceiver returns the receiver (t *T) of the type declared by spec,
+// named after the first letter of its name, with its type parameters if
+// it's generic.
+func defaultReceiver(spec *ast.TypeSpec) *ast.Field {
+	name := "x"
+	if r, _ := utf8.DecodeRuneInString(spec.Name.Name); unicode.IsLetter(r) {
+		name = string(unicode.ToLower(r))
+	}
+
+	var typ ast.Expr = ast.NewIdent(spec.Name.Name)
+	var params []ast.Expr
+	if spec.TypeParams != nil {
+		for _, f := range spec.TypeParams.List {
+			for _, p := range f.Names {
+				params = append(params, ast.NewIdent(p.Name))
+			}
+		}
+	}
+	switch len(params) {
+	case 0:
+	case 1:
+		typ = &ast.IndexExpr{X: typ, Index: params[0]}
+	default:
+		typ = &ast.IndexListExpr{X: typ, Indices: params}
+	}
+	return &ast.Field{Names: []*ast.Ident{ast.NewIdent(name)}, Type: &ast.StarExpr{X: typ}}
+}
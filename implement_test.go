@@ -0,0 +1,65 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestImplementInterface(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type Store struct {
+	Name string
+}
+
+func (s *Store) Get(key string) ([]byte, error) {
+	return nil, nil
+}
+`)
+	expr, err := parseExpr(`interface {
+	Get(key string) ([]byte, error)
+	Put(key string, s []byte) error
+	Name() string
+	io.Closer
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stubs := ImplementInterface(file, "Store", expr.(*ast.InterfaceType), nil)
+	if len(stubs) != 1 || stubs[0].Name.Name != "Put" {
+		t.Fatalf("got %d stubs, want Put only", len(stubs))
+	}
+	checkSource(t, fset, file, `package p
+
+type Store struct {
+	Name string
+}
+
+func (s *Store) Get(key string) ([]byte, error) {
+	return nil, nil
+}
+func (s1 *Store) Put(key string, s []byte) error { panic("not implemented") }
+`)
+}
+
+func TestImplementInterfaceGeneric(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type List[T any] struct{}
+`)
+	expr, err := parseExpr(`interface{ Len() int }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := func(method string) []ast.Stmt {
+		return []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("0")}}}
+	}
+	ImplementInterface(file, "List", expr.(*ast.InterfaceType), body)
+	checkSource(t, fset, file, `package p
+
+type List[T any] struct{}
+
+func (l *List[T]) Len() int { return 0 }
+`)
+}
@@ -0,0 +1,193 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// GroupImports sorts the specs of each parenthesized import declaration of
+// f by path into groups for the standard library, third party packages and
+// the packages below each of localPrefixes, in that order, and separates
+// the groups by blank lines, like goimports -local does. fset is the
+// FileSet f was parsed with.
+//
+// Unlike NormalizeImports, GroupImports only moves specs: declarations
+// aren't merged, duplicates aren't dropped and names are kept, so named,
+// blank and dot imports are placed in the group of their path. Specs move
+// along with their doc and line comments, by rearranging the line table of
+// the file, so offsets in the file no longer correspond to the original
+// source. A blank line between groups takes a byte of the blank lines
+// already in the declaration or else the indentation of the spec following
+// it. Declarations whose specs share lines, that contain comments not
+// belonging to a spec, or that leave no room for the blank lines are left
+// alone, in which case GroupImports returns false.
+func GroupImports(fset *token.FileSet, f *ast.File, localPrefixes []string) bool {
+	grouped := true
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || !gd.Lparen.IsValid() || len(gd.Specs) < 2 {
+			continue
+		}
+		if !groupImportDecl(fset, f, gd, localPrefixes) {
+			grouped = false
+		}
+	}
+
+	var imports []*ast.ImportSpec
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			for _, s := range gd.Specs {
+				imports = append(imports, s.(*ast.ImportSpec))
+			}
+		}
+	}
+	f.Imports = imports
+	sort.Slice(f.Comments, func(i, j int) bool {
+		return f.Comments[i].Pos() < f.Comments[j].Pos()
+	})
+	return grouped
+}
+
+// importSegment is the range of lines of an import spec, its doc and line
+// comments included, as offsets in its file.
+type importSegment struct {
+	start, end int
+
+	// indented tells whether the first line doesn't start with a token
+	indented bool
+}
+
+// groupImportDecl groups the specs of gd and reports whether it did.
+func groupImportDecl(fset *token.FileSet, f *ast.File, gd *ast.GenDecl, prefixes []string) bool {
+	tf := fset.File(gd.Lparen)
+	if tf == nil || !gd.Rparen.IsValid() {
+		return false
+	}
+	base := tf.Base()
+	lineAfter := func(pos token.Pos) int {
+		if line := tf.Line(pos); line < tf.LineCount() {
+			return tf.Offset(tf.LineStart(line + 1))
+		}
+		return tf.Size()
+	}
+	regionStart := lineAfter(gd.Lparen)
+	regionEnd := tf.Offset(tf.LineStart(tf.Line(gd.Rparen)))
+	if regionEnd < regionStart {
+		return false
+	}
+
+	specs := make([]*ast.ImportSpec, len(gd.Specs))
+	segs := make([]importSegment, len(gd.Specs))
+	used, prev := 0, regionStart
+	for i, s := range gd.Specs {
+		spec := s.(*ast.ImportSpec)
+		start, end := spec.Pos(), spec.End()
+		if spec.Doc != nil {
+			start = spec.Doc.Pos()
+		}
+		if spec.Comment != nil {
+			end = spec.Comment.End()
+		}
+		seg := importSegment{
+			start: tf.Offset(tf.LineStart(tf.Line(start))),
+			end:   lineAfter(end - 1),
+		}
+		if seg.start < prev || seg.end > regionEnd {
+			return false
+		}
+		seg.indented = tf.Offset(start) > seg.start
+		specs[i], segs[i] = spec, seg
+		used += seg.end - seg.start
+		prev = seg.end
+	}
+	for _, cg := range f.Comments {
+		off := int(cg.Pos()) - base
+		if off < regionStart || off >= regionEnd {
+			continue
+		}
+		inside := false
+		for _, seg := range segs {
+			inside = inside || off >= seg.start && off < seg.end
+		}
+		if !inside {
+			return false
+		}
+	}
+
+	group := func(i int) int {
+		return importGroup(importPath(specs[i]), prefixes)
+	}
+	order := make([]int, len(specs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		gi, gj := group(order[i]), group(order[j])
+		if gi != gj {
+			return gi < gj
+		}
+		return importPath(specs[order[i]]) < importPath(specs[order[j]])
+	})
+
+	// Lay out the segments in their new order, with the line table of the
+	// region along the way.
+	oldLines := tf.Lines()
+	var lines []int
+	for _, l := range oldLines {
+		if l < regionStart {
+			lines = append(lines, l)
+		}
+	}
+	delta := make([]int, len(specs))
+	offset, slack := regionStart, regionEnd-regionStart-used
+	for k, i := range order {
+		seg := segs[i]
+		blank := k > 0 && group(i) != group(order[k-1])
+		shared := false
+		switch {
+		case !blank:
+		case slack > 0:
+			lines = append(lines, offset)
+			offset++
+			slack--
+		case seg.indented:
+			// the blank line is made of the indentation
+			lines = append(lines, offset)
+			shared = true
+		default:
+			return false
+		}
+		delta[i] = offset - seg.start
+		for _, l := range oldLines {
+			if l >= seg.start && l < seg.end {
+				if l == seg.start && shared {
+					l++
+				}
+				lines = append(lines, l+delta[i])
+			}
+		}
+		offset += seg.end - seg.start
+	}
+	for _, l := range oldLines {
+		if l >= regionEnd {
+			lines = append(lines, l)
+		}
+	}
+	if !tf.SetLines(lines) {
+		return false
+	}
+
+	gd.Specs = gd.Specs[:0]
+	for _, i := range order {
+		d := token.Pos(delta[i])
+		mapPositions(specs[i], func(p token.Pos) token.Pos {
+			if !p.IsValid() {
+				return p
+			}
+			return p + d
+		})
+		gd.Specs = append(gd.Specs, specs[i])
+	}
+	return true
+}
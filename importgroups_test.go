@@ -0,0 +1,78 @@
+package astrewrite
+
+import "testing"
+
+func TestGroupImports(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	"example.com/me/util"
+	"fmt"
+	"github.com/pkg/errors"
+	_ "embed"
+	// str shortens the calls
+	str "strings"
+
+	. "example.com/me/dot"
+	"os" // for exit
+)
+
+func f() {
+	fmt.Println(util.X, errors.New(""), str.ToUpper(""), Dot)
+	os.Exit(0)
+}
+`)
+
+	if !GroupImports(fset, file, []string{"example.com/me"}) {
+		t.Fatal("imports weren't grouped")
+	}
+	checkSource(t, fset, file, `package p
+
+import (
+	_ "embed"
+	"fmt"
+	"os" // for exit
+	// str shortens the calls
+	str "strings"
+
+	"github.com/pkg/errors"
+
+	. "example.com/me/dot"
+	"example.com/me/util"
+)
+
+func f() {
+	fmt.Println(util.X, errors.New(""), str.ToUpper(""), Dot)
+	os.Exit(0)
+}
+`)
+	for i, want := range []string{"embed", "fmt", "os", "strings", "github.com/pkg/errors", "example.com/me/dot", "example.com/me/util"} {
+		if got := importPath(file.Imports[i]); got != want {
+			t.Errorf("import %d is %s, want %s", i, got, want)
+		}
+	}
+
+	// grouping again changes nothing
+	before := render(t, fset, file)
+	if !GroupImports(fset, file, []string{"example.com/me"}) {
+		t.Fatal("imports weren't grouped again")
+	}
+	if after := render(t, fset, file); after != before {
+		t.Errorf("grouping again gave:\n%s", after)
+	}
+
+	// a comment of its own can't be moved along with a spec
+	fset, file = parse(t, `package p
+
+import (
+	"github.com/pkg/errors"
+
+	// standard library
+
+	"fmt"
+)
+`)
+	if GroupImports(fset, file, nil) {
+		t.Error("grouped imports with a free-standing comment")
+	}
+}
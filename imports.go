@@ -0,0 +1,516 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddImport adds an unnamed import of path to f, unless f already imports it
+// that way. The new spec goes into the first import declaration at its sorted
+// position, or into a new declaration right after the package clause. It
+// reports whether f was changed.
+func AddImport(f *ast.File, path string) bool {
+	for _, imp := range f.Imports {
+		if imp.Name == nil && importPath(imp) == path {
+			return false
+		}
+	}
+
+	spec := &ast.ImportSpec{
+		Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)},
+	}
+
+	var decl *ast.GenDecl
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			decl = gd
+			break
+		}
+	}
+
+	if decl == nil {
+		decl = &ast.GenDecl{TokPos: f.Name.End(), Tok: token.IMPORT}
+		spec.Path.ValuePos = decl.TokPos
+		decl.Specs = []ast.Spec{spec}
+		f.Decls = append([]ast.Decl{decl}, f.Decls...)
+	} else {
+		i := 0
+		for ; i < len(decl.Specs); i++ {
+			if imp, ok := decl.Specs[i].(*ast.ImportSpec); ok && importPath(imp) > path {
+				break
+			}
+		}
+		// reuse the position of the previous spec so the printer keeps
+		// the new one on its own line without adding blank lines
+		if i > 0 {
+			spec.Path.ValuePos = decl.Specs[i-1].Pos()
+		} else {
+			spec.Path.ValuePos = decl.TokPos
+		}
+		if !decl.Lparen.IsValid() {
+			decl.Lparen = decl.TokPos
+		}
+		decl.Specs = append(decl.Specs, nil)
+		copy(decl.Specs[i+1:], decl.Specs[i:])
+		decl.Specs[i] = spec
+	}
+
+	f.Imports = append(f.Imports, spec)
+	return true
+}
+
+// RemoveRedundantImportAliases drops the names of the imports of file that
+// equal the default name of their package, as given by defaultName. Other
+// names, including _ and ., are kept. If defaultName is nil, the default
+// name is guessed from the last element of the path.
+func RemoveRedundantImportAliases(file *ast.File, defaultName func(path string) string) {
+	if defaultName == nil {
+		defaultName = defaultImportName
+	}
+	for _, spec := range file.Imports {
+		if spec.Name != nil && spec.Name.Name == defaultName(importPath(spec)) {
+			spec.Name = nil
+		}
+	}
+}
+
+// removeImport removes spec from f, along with its declaration if it was
+// the only spec of it.
+func removeImport(f *ast.File, spec *ast.ImportSpec) {
+	decls := f.Decls[:0]
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			specs := gd.Specs[:0]
+			for _, s := range gd.Specs {
+				if s != spec {
+					specs = append(specs, s)
+				}
+			}
+			if gd.Specs = specs; len(specs) == 0 {
+				continue
+			}
+		}
+		decls = append(decls, d)
+	}
+	f.Decls = decls
+
+	imports := f.Imports[:0]
+	for _, imp := range f.Imports {
+		if imp != spec {
+			imports = append(imports, imp)
+		}
+	}
+	f.Imports = imports
+}
+
+// importedAs returns the name file refers to the package with the given
+// path by and whether it imports it at all. If it doesn't, or file is nil,
+// the name is the one the package would be imported by.
+func importedAs(file *ast.File, path string) (string, bool) {
+	if file != nil {
+		for _, imp := range file.Imports {
+			if importPath(imp) == path {
+				return importName(imp), true
+			}
+		}
+	}
+	return defaultImportName(path), false
+}
+
+func importPath(spec *ast.ImportSpec) string {
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// ImportOption configures NormalizeImports.
+type ImportOption func(*importConfig)
+
+type importConfig struct {
+	fset     *token.FileSet
+	prefixes []string
+}
+
+// ImportGroups adds a group for each of the given path prefixes, placed after
+// the standard library and third party groups in the given order.
+func ImportGroups(prefixes ...string) ImportOption {
+	return func(c *importConfig) {
+		c.prefixes = append(c.prefixes, prefixes...)
+	}
+}
+
+// ImportFileSet passes the FileSet f was parsed with, which is needed to
+// separate the import groups by blank lines.
+func ImportFileSet(fset *token.FileSet) ImportOption {
+	return func(c *importConfig) {
+		c.fset = fset
+	}
+}
+
+// NormalizeImports merges all import declarations of f into a single
+// parenthesized one right after the package clause and rebuilds f.Imports.
+//
+// Identical specs are merged and blank imports of paths imported otherwise
+// are dropped. Imports of the same path under different names are reduced to
+// one name; if both are in use, the qualifiers of the later one are rewritten.
+// Dot imports can't be rewritten that way, so a dot import of a path also
+// imported under a used name is an error. Imports of the package itself, as
+// named by an import comment on the package clause, are dropped along with
+// their qualifiers.
+//
+// Imports are sorted by path into groups for the standard library, third
+// party packages and each prefix given with ImportGroups. Separating the
+// groups by blank lines requires ImportFileSet and enough lines in the
+// region of the original first import declaration. The doc and line comments
+// of the kept imports move along with them, which requires the same; a
+// declaration of a single import passes its doc to the import. Other
+// comments inside the merged declarations are dropped.
+func NormalizeImports(f *ast.File, opts ...ImportOption) error {
+	var cfg importConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var (
+		decls []*ast.GenDecl
+		specs []*ast.ImportSpec
+		other []ast.Decl
+	)
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			decls = append(decls, gd)
+			for _, s := range gd.Specs {
+				specs = append(specs, s.(*ast.ImportSpec))
+			}
+			continue
+		}
+		other = append(other, d)
+	}
+	if len(decls) == 0 {
+		return nil
+	}
+
+	used := usedQualifiers(f)
+	self := importComment(f)
+	var kept []*ast.ImportSpec
+	byPath := make(map[string][]*ast.ImportSpec)
+	for _, spec := range specs {
+		path := importPath(spec)
+		if path == self {
+			renameQualifier(f, importName(spec), "")
+			continue
+		}
+
+		dup := false
+		for _, k := range byPath[path] {
+			if name := importName(spec); name == importName(k) {
+				dup = true
+			}
+		}
+		if !dup {
+			byPath[path] = append(byPath[path], spec)
+		}
+	}
+
+	for _, spec := range specs {
+		path := importPath(spec)
+		same := byPath[path]
+		if len(same) == 0 || same[0] != spec {
+			continue
+		}
+
+		// keep the first used name of the path, preferring the default
+		// one, and rewrite the others to it
+		var keep *ast.ImportSpec
+		for _, s := range same {
+			if name := importName(s); name != "_" && name != "." && used[name] &&
+				(keep == nil || keep.Name != nil && s.Name == nil) {
+				keep = s
+			}
+		}
+		for _, s := range same {
+			if importName(s) == "." {
+				if keep != nil {
+					return fmt.Errorf("astrewrite: %s is dot imported and imported as %s", path, importName(keep))
+				}
+				keep = s
+			}
+		}
+		if keep == nil {
+			keep = same[0]
+			for _, s := range same {
+				if importName(s) != "_" {
+					keep = s
+					break
+				}
+			}
+		}
+		for _, s := range same {
+			if name := importName(s); s != keep && name != "_" && used[name] {
+				renameQualifier(f, name, importName(keep))
+			}
+		}
+		kept = append(kept, keep)
+	}
+
+	group := func(spec *ast.ImportSpec) int {
+		return importGroup(importPath(spec), cfg.prefixes)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		gi, gj := group(kept[i]), group(kept[j])
+		if gi != gj {
+			return gi < gj
+		}
+		return importPath(kept[i]) < importPath(kept[j])
+	})
+
+	// the doc of a declaration of a single import documents the import
+	for _, gd := range decls {
+		if len(gd.Specs) == 1 && !gd.Lparen.IsValid() {
+			if spec := gd.Specs[0].(*ast.ImportSpec); spec.Doc == nil {
+				spec.Doc, gd.Doc = gd.Doc, nil
+			}
+		}
+	}
+
+	// take the comments of the merged declarations out of the file; those
+	// of the kept specs are put back once the specs are laid out
+	attached := make(map[*ast.CommentGroup]bool)
+	for _, spec := range specs {
+		for _, cg := range []*ast.CommentGroup{spec.Doc, spec.Comment} {
+			if cg != nil {
+				attached[cg] = true
+			}
+		}
+	}
+	var comments []*ast.CommentGroup
+	for _, cg := range f.Comments {
+		inside := attached[cg]
+		for _, gd := range decls {
+			start := gd.Pos()
+			if gd.Doc != nil {
+				start = gd.Doc.Pos()
+			}
+			if cg.Pos() >= start && cg.End() <= gd.End() {
+				inside = true
+			}
+		}
+		if !inside {
+			comments = append(comments, cg)
+		}
+	}
+	f.Comments = comments
+
+	decl := &ast.GenDecl{TokPos: decls[0].TokPos, Tok: token.IMPORT, Lparen: decls[0].TokPos}
+	for _, spec := range kept {
+		decl.Specs = append(decl.Specs, spec)
+	}
+	laidOut := false
+	if f.Decls[0] == ast.Decl(decls[0]) {
+		laidOut = layoutImports(&cfg, f, decl, decls[0], group)
+	} else {
+		// the first import comes after other declarations, its
+		// positions can't be used for a declaration placed before them
+		decl.TokPos = f.Name.End()
+		layoutImports(&importConfig{}, f, decl, nil, group)
+	}
+	for _, spec := range kept {
+		if !laidOut {
+			spec.Doc, spec.Comment = nil, nil
+			continue
+		}
+		for _, cg := range []*ast.CommentGroup{spec.Doc, spec.Comment} {
+			if cg != nil {
+				f.Comments = append(f.Comments, cg)
+			}
+		}
+	}
+	sort.Slice(f.Comments, func(i, j int) bool { return f.Comments[i].Pos() < f.Comments[j].Pos() })
+
+	f.Decls = append([]ast.Decl{decl}, other...)
+	f.Imports = kept
+	return nil
+}
+
+// importGroup returns the group of the import path: 0 for the standard
+// library, 1 for third party packages and i+2 for packages below
+// prefixes[i], the last one matching taking precedence.
+func importGroup(path string, prefixes []string) int {
+	for i := len(prefixes) - 1; i >= 0; i-- {
+		if p := prefixes[i]; path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return i + 2
+		}
+	}
+	if first := strings.SplitN(path, "/", 2)[0]; !strings.Contains(first, ".") {
+		return 0
+	}
+	return 1
+}
+
+// layoutImports positions the specs of decl on consecutive lines starting at
+// the line of first, each preceded by the lines of its doc comment and
+// leaving a blank line between groups, and reports whether it did. Without a
+// FileSet or enough lines before whatever follows first, all positions are
+// cleared and the printer puts the specs on consecutive lines.
+func layoutImports(cfg *importConfig, f *ast.File, decl, first *ast.GenDecl, group func(*ast.ImportSpec) int) bool {
+	clear := func() {
+		decl.Lparen, decl.Rparen = token.NoPos, token.NoPos
+		for _, s := range decl.Specs {
+			clearPositions(s)
+		}
+	}
+	if cfg.fset == nil {
+		clear()
+		return false
+	}
+
+	tf := cfg.fset.File(first.Pos())
+	limit := token.Pos(tf.Base() + tf.Size())
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); !ok || gd.Tok != token.IMPORT {
+			if pos := d.Pos(); pos > first.Pos() && pos < limit {
+				limit = pos
+			}
+			break
+		}
+	}
+	for _, cg := range f.Comments {
+		if pos := cg.Pos(); pos > first.Pos() && pos < limit {
+			limit = pos
+		}
+	}
+
+	line := tf.Line(first.Pos())
+	var lines []int
+	for i, s := range decl.Specs {
+		line++
+		if i > 0 && group(s.(*ast.ImportSpec)) != group(decl.Specs[i-1].(*ast.ImportSpec)) {
+			line++
+		}
+		if doc := s.(*ast.ImportSpec).Doc; doc != nil {
+			for _, c := range doc.List {
+				line += strings.Count(c.Text, "\n") + 1
+			}
+		}
+		lines = append(lines, line)
+	}
+	if line+1 >= tf.Line(limit) {
+		clear()
+		return false
+	}
+
+	for i, s := range decl.Specs {
+		// the line comment shares the position of the spec, which puts
+		// it after the spec on its line
+		spec := s.(*ast.ImportSpec)
+		stampPositions(spec, tf.LineStart(lines[i]))
+		if spec.Doc == nil {
+			continue
+		}
+		line := lines[i]
+		for j := len(spec.Doc.List) - 1; j >= 0; j-- {
+			c := spec.Doc.List[j]
+			line -= strings.Count(c.Text, "\n") + 1
+			c.Slash = tf.LineStart(line)
+		}
+	}
+	decl.Rparen = tf.LineStart(line + 1)
+	return true
+}
+
+// importComment returns the path of the import comment of f's package
+// clause, like package foo // import "example.com/foo", or "".
+func importComment(f *ast.File) string {
+	for _, cg := range f.Comments {
+		if cg.Pos() < f.Name.End() {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(cg.List[0].Text, "//"))
+		if path, err := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(text, "import"))); err == nil && strings.HasPrefix(text, "import") {
+			return path
+		}
+		break
+	}
+	return ""
+}
+
+// importName returns the name under which spec's package is visible in the
+// file: its explicit name or the default one guessed from its path.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	return defaultImportName(importPath(spec))
+}
+
+// defaultImportName guesses the package name of an import path from its
+// last element, skipping major version suffixes like /v2 and gopkg.in
+// style .v2 suffixes, and dropping go- prefixes.
+func defaultImportName(path string) string {
+	name := pathpkg.Base(path)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" && strings.Contains(path, "/") {
+		name = pathpkg.Base(pathpkg.Dir(path))
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// usedQualifiers returns the names used as the package qualifier of a
+// selector expression in f. Identifiers declared as something else where
+// they're used, going by Cursor.Lookup, are not counted.
+func usedQualifiers(f *ast.File) map[string]bool {
+	used := make(map[string]bool)
+	var w *Walker
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && isQualifier(w.Cursor(), id.Name) {
+				used[id.Name] = true
+			}
+		}
+		return n, true
+	})
+	w.Walk(f)
+	return used
+}
+
+// renameQualifier renames the package qualifier old in the selector
+// expressions of f to new. An empty new drops the qualifier.
+func renameQualifier(f *ast.File, old, new string) {
+	var w *Walker
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return n, true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && id.Name == old && isQualifier(w.Cursor(), old) {
+			if new == "" {
+				return sel.Sel, false
+			}
+			id.Name = new
+		}
+		return n, true
+	})
+	w.Walk(f)
+}
+
+// isQualifier reports whether name refers to a package at the node of c,
+// being imported or not declared at all.
+func isQualifier(c *Cursor, name string) bool {
+	site, ok := c.Lookup(name)
+	return !ok || site.Kind == ast.Pkg
+}
@@ -0,0 +1,212 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+)
+
+func TestAddImport(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	"fmt"
+	"strings"
+)
+`)
+
+	if !AddImport(file, "os") {
+		t.Error("os not added")
+	}
+	if AddImport(file, "fmt") {
+		t.Error("fmt added twice")
+	}
+	checkSource(t, fset, file, `package p
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+`)
+}
+
+const importsFixture = `package p // import "example.com/p"
+
+import "fmt"
+
+import (
+	"os"
+	str "strings"
+	"example.com/p"
+)
+
+import (
+	"example.com/lib"
+	f "fmt"
+	_ "os"
+)
+
+import "strings"
+
+import (
+	"example.com/internal/x"
+	"errors"
+	"os"
+)
+
+func main() {
+	fmt.Println(str.ToUpper("x"), strings.ToLower("Y"), errors.New("z"))
+	f.Println(os.Args, lib.V, x.V, p.Local)
+}
+`
+
+func TestNormalizeImports(t *testing.T) {
+	fset, file := parse(t, importsFixture)
+
+	if err := NormalizeImports(file, ImportGroups("example.com/internal"), ImportFileSet(fset)); err != nil {
+		t.Fatal(err)
+	}
+	checkSource(t, fset, file, `package p // import "example.com/p"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/lib"
+
+	"example.com/internal/x"
+)
+
+func main() {
+	fmt.Println(strings.ToUpper("x"), strings.ToLower("Y"), errors.New("z"))
+	fmt.Println(os.Args, lib.V, x.V, Local)
+}
+`)
+
+	var paths []string
+	for _, imp := range file.Imports {
+		paths = append(paths, importPath(imp))
+	}
+	if got, want := len(paths), 6; got != want {
+		t.Errorf("got %d imports %v, want %d", got, paths, want)
+	}
+}
+
+func TestNormalizeImportsComments(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	// for printing
+	"fmt"
+	"os" // exit codes
+)
+
+import "strings" // joins
+
+// for the rest
+import "errors"
+
+func main() {
+	fmt.Println(strings.Join(nil, ""), errors.New("x"))
+	os.Exit(1)
+}
+`)
+	if err := NormalizeImports(file, ImportFileSet(fset)); err != nil {
+		t.Fatal(err)
+	}
+	checkSource(t, fset, file, `package p
+
+import (
+	// for the rest
+	"errors"
+	// for printing
+	"fmt"
+	"os"      // exit codes
+	"strings" // joins
+)
+
+func main() {
+	fmt.Println(strings.Join(nil, ""), errors.New("x"))
+	os.Exit(1)
+}
+`)
+}
+
+func TestNormalizeImportsNoFileSet(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "os"
+
+import (
+	"example.com/lib"
+	"fmt"
+)
+
+func init() {}
+
+var _ = fmt.Sprint(os.Args, lib.V)
+`)
+	// as left behind by a careless edit
+	d := file.Decls
+	file.Decls = []ast.Decl{d[2], d[0], d[1], d[3]}
+
+	if err := NormalizeImports(file); err != nil {
+		t.Fatal(err)
+	}
+	checkSource(t, fset, file, `package p
+
+import (
+	"fmt"
+	"os"
+	"example.com/lib"
+)
+
+func init() {}
+
+var _ = fmt.Sprint(os.Args, lib.V)
+`)
+}
+
+func TestNormalizeImportsDotConflict(t *testing.T) {
+	_, file := parse(t, `package p
+
+import . "fmt"
+import f "fmt"
+
+var _ = f.Sprint(Sprint())
+`)
+	if err := NormalizeImports(file, ImportFileSet(token.NewFileSet())); err == nil {
+		t.Error("merged a dot import with a used named import")
+	}
+}
+
+func TestRemoveRedundantImportAliases(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	_ "example.com/baz"
+	foo "example.com/foo"
+	bar "example.com/go-bar"
+	yaml "gopkg.in/yaml.v3"
+)
+`)
+
+	RemoveRedundantImportAliases(file, func(path string) string {
+		if path == "example.com/go-bar" {
+			return "gobar"
+		}
+		return defaultImportName(path)
+	})
+	checkSource(t, fset, file, `package p
+
+import (
+	_ "example.com/baz"
+	"example.com/foo"
+	bar "example.com/go-bar"
+	"gopkg.in/yaml.v3"
+)
+`)
+}
@@ -0,0 +1,41 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"strconv"
+)
+
+// RenameInit renames the init functions of file to newName, numbering them
+// from the second one on (newName2, newName3, ...) since a file may have
+// several. Names already used in the file are skipped. It returns the new
+// names in source order, which is the order the init functions ran in; the
+// caller is responsible for calling them.
+func RenameInit(file *ast.File, newName string) []string {
+	declared := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			declared[id.Name] = true
+		}
+		return true
+	})
+
+	var names []string
+	for _, d := range file.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Recv != nil || fd.Name.Name != "init" {
+			continue
+		}
+
+		name := newName
+		for i := len(names) + 1; i > 1 || declared[name]; i++ {
+			name = newName + strconv.Itoa(i)
+			if !declared[name] {
+				break
+			}
+		}
+		declared[name] = true
+		fd.Name.Name = name
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,42 @@
+package astrewrite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenameInit(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func init() {
+	register("a")
+}
+
+func setup2() {}
+
+func (t T) init() {}
+
+func init() {
+	register("b")
+}
+`)
+
+	names := RenameInit(file, "setup")
+	if want := []string{"setup", "setup3"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+	checkSource(t, fset, file, `package p
+
+func setup() {
+	register("a")
+}
+
+func setup2() {}
+
+func (t T) init() {}
+
+func setup3() {
+	register("b")
+}
+`)
+}
@@ -0,0 +1,344 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// InlineLocalClosure inlines the function literals without results that
+// the body of fn assigns to a local variable and calls exactly once, like
+//
+//	cleanup := func() {
+//		os.Remove(tmp)
+//	}
+//	...
+//	cleanup()
+//
+// by replacing the call with the body of the literal and removing the
+// assignment. The call must be a statement of the same list as the
+// assignment, so that it runs once, when the literal would have; calls
+// nested in loops, conditions or other literals, deferred calls and calls
+// of variables used otherwise, like passed as a value, are left alone, as
+// are recursive literals. The arguments of the call must be identifiers or
+// literals the body doesn't assign, and the body must neither assign nor
+// redeclare the parameters. Parameters are substituted by arguments known
+// to be of their type, and declared with their type and the argument
+// otherwise, var d time.Duration = 5, so that untyped constants and values
+// converted to interfaces keep behaving the same.
+//
+// The body must not hold statements meaning something else outside the
+// literal, return, defer and labeled statements, and the statements between
+// the assignment and the call must not redeclare the variables it captures.
+// The body is spliced into the list of the call, or kept as a block if it
+// declares variables of its own. The comments inside the body stay where
+// the literal was. It returns the number of literals inlined.
+func InlineLocalClosure(fn *ast.FuncDecl) int {
+	if fn.Body == nil {
+		return 0
+	}
+	n := 0
+	forEachStmtList(fn.Body, func(list []ast.Stmt) []ast.Stmt {
+		for i := 0; i < len(list); i++ {
+			name, lit := localClosure(list[i])
+			if lit == nil || countIdents(fn.Body, name) != 2 {
+				continue
+			}
+			j := callStmt(list, i, name)
+			if j < 0 {
+				continue
+			}
+			call := list[j].(*ast.ExprStmt).X.(*ast.CallExpr)
+			stmts, ok := inlinedClosure(lit, call, name, list[i+1:j])
+			if !ok {
+				continue
+			}
+
+			out := append([]ast.Stmt(nil), list[:i]...)
+			out = append(out, list[i+1:j]...)
+			out = append(out, stmts...)
+			list = append(out, list[j+1:]...)
+			n++
+			i--
+		}
+		return list
+	})
+	return n
+}
+
+// localClosure returns the variable s assigns a function literal without
+// results to, f := func() { ... } or var f = func() { ... }, and the
+// literal, or nil.
+func localClosure(s ast.Stmt) (string, *ast.FuncLit) {
+	var lhs, rhs ast.Expr
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		if s.Tok != token.DEFINE || len(s.Lhs) != 1 || len(s.Rhs) != 1 {
+			return "", nil
+		}
+		lhs, rhs = s.Lhs[0], s.Rhs[0]
+	case *ast.DeclStmt:
+		gd, ok := s.Decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR || len(gd.Specs) != 1 {
+			return "", nil
+		}
+		vs := gd.Specs[0].(*ast.ValueSpec)
+		if len(vs.Names) != 1 || len(vs.Values) != 1 || vs.Type != nil {
+			return "", nil
+		}
+		lhs, rhs = vs.Names[0], vs.Values[0]
+	default:
+		return "", nil
+	}
+	id, ok := lhs.(*ast.Ident)
+	lit, _ := ast.Unparen(rhs).(*ast.FuncLit)
+	if !ok || id.Name == "_" || lit == nil || lit.Type.Results.NumFields() > 0 {
+		return "", nil
+	}
+	return id.Name, lit
+}
+
+// countIdents returns the number of identifiers name below node.
+func countIdents(node ast.Node, name string) int {
+	n := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		if id, ok := node.(*ast.Ident); ok && id.Name == name {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// callStmt returns the index of the statement of list after i calling
+// name, or -1.
+func callStmt(list []ast.Stmt, i int, name string) int {
+	for j := i + 1; j < len(list); j++ {
+		es, ok := list[j].(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		if call, ok := es.X.(*ast.CallExpr); ok && isIdent(call.Fun, name) {
+			return j
+		}
+	}
+	return -1
+}
+
+// inlinedClosure returns the statements replacing call, a call of the
+// literal lit assigned to name, which the statements between precede, and
+// whether it can be inlined.
+func inlinedClosure(lit *ast.FuncLit, call *ast.CallExpr, name string, between []ast.Stmt) ([]ast.Stmt, bool) {
+	body := lit.Body
+	if mentions(body, name) || !inlinableBody(body) {
+		return nil, false
+	}
+	for _, s := range between {
+		for _, site := range stmtDecls(s) {
+			for _, free := range FreeVars(lit) {
+				if site.Name == free {
+					// the body would refer to the new variable
+					return nil, false
+				}
+			}
+		}
+	}
+
+	var params []*ast.Ident
+	var types []ast.Expr
+	for _, f := range lit.Type.Params.List {
+		if _, ok := f.Type.(*ast.Ellipsis); ok {
+			return nil, false
+		}
+		for _, name := range f.Names {
+			params = append(params, name)
+			types = append(types, f.Type)
+		}
+	}
+	if len(params) != len(call.Args) || call.Ellipsis.IsValid() {
+		return nil, false
+	}
+	subst := make(map[string]ast.Expr)
+	var decls []ast.Stmt
+	for i, p := range params {
+		arg := call.Args[i]
+		switch arg := arg.(type) {
+		case *ast.Ident:
+			if assignedIn(body, arg.Name) || declaredIn(body, arg.Name) {
+				return nil, false
+			}
+		case *ast.BasicLit:
+		default:
+			return nil, false
+		}
+		if p.Name == "_" {
+			continue
+		}
+		if assignedIn(body, p.Name) || declaredIn(body, p.Name) || usedAsKey(body, p.Name) {
+			return nil, false
+		}
+		if hasType(arg, types[i]) {
+			subst[p.Name] = arg
+			continue
+		}
+
+		// the argument would lose the type of the parameter, like an
+		// untyped constant or a value converted to an interface, so the
+		// parameter is declared, unless an argument refers to one declared
+		// before it
+		for _, prev := range params[:i] {
+			if mentions(arg, prev.Name) {
+				return nil, false
+			}
+		}
+		pos := lit.Body.Lbrace
+		typ := Clone(types[i]).(ast.Expr)
+		value := Clone(arg).(ast.Expr)
+		stampPositions(typ, pos)
+		stampPositions(value, pos)
+		decls = append(decls, &ast.DeclStmt{Decl: &ast.GenDecl{
+			TokPos: pos,
+			Tok:    token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names:  []*ast.Ident{{NamePos: pos, Name: p.Name}},
+				Type:   typ,
+				Values: []ast.Expr{value},
+			}},
+		}})
+	}
+
+	if len(subst) > 0 {
+		// field and method names aren't references to parameters
+		names := make(map[*ast.Ident]bool)
+		ast.Inspect(body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				names[n.Sel] = true
+			case *ast.Field:
+				for _, id := range n.Names {
+					names[id] = true
+				}
+			}
+			return true
+		})
+		body = Walk(body, func(n ast.Node) (ast.Node, bool) {
+			id, ok := n.(*ast.Ident)
+			if !ok || names[id] || subst[id.Name] == nil {
+				return n, true
+			}
+			arg := Clone(subst[id.Name]).(ast.Expr)
+			stampPositions(arg, id.Pos())
+			return arg, false
+		}).(*ast.BlockStmt)
+	}
+
+	if len(decls) > 0 {
+		body.List = append(decls, body.List...)
+	}
+	for _, s := range body.List {
+		if len(stmtDecls(s)) > 0 {
+			return []ast.Stmt{body}, true
+		}
+	}
+	return body.List, true
+}
+
+// hasType reports whether arg, an identifier or a basic literal, is known to
+// have the type typ without type information: it's a variable or parameter
+// declared with the same type, or an untyped constant whose default type is
+// the predeclared typ, like 3 for int or "x" for string.
+func hasType(arg ast.Expr, typ ast.Expr) bool {
+	switch arg := arg.(type) {
+	case *ast.Ident:
+		if arg.Obj == nil || arg.Obj.Kind != ast.Var {
+			return false
+		}
+		var declared ast.Expr
+		switch decl := arg.Obj.Decl.(type) {
+		case *ast.Field:
+			declared = decl.Type
+		case *ast.ValueSpec:
+			declared = decl.Type
+		}
+		return declared != nil && Equal(declared, typ)
+	case *ast.BasicLit:
+		id, ok := typ.(*ast.Ident)
+		if !ok || id.Obj != nil {
+			return false
+		}
+		defaults := map[token.Token]string{
+			token.INT:    "int",
+			token.FLOAT:  "float64",
+			token.IMAG:   "complex128",
+			token.CHAR:   "rune",
+			token.STRING: "string",
+		}
+		return id.Name == defaults[arg.Kind]
+	}
+	return false
+}
+
+// inlinableBody reports whether body, the body of a function literal,
+// means the same outside of the literal: it holds no return, defer or
+// labeled statements of its own.
+func inlinableBody(body *ast.BlockStmt) bool {
+	ok := true
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt, *ast.DeferStmt, *ast.LabeledStmt:
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// assignedIn reports whether the variable name may be changed in node: it's
+// assigned, incremented or decremented, or its address is taken.
+func assignedIn(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, e := range n.Lhs {
+				found = found || isIdent(e, name)
+			}
+		case *ast.IncDecStmt:
+			found = found || isIdent(n.X, name)
+		case *ast.UnaryExpr:
+			found = found || n.Op == token.AND && isIdent(n.X, name)
+		case *ast.RangeStmt:
+			found = found || n.Key != nil && isIdent(n.Key, name) || n.Value != nil && isIdent(n.Value, name)
+		}
+		return !found
+	})
+	return found
+}
+
+// declaredIn reports whether the identifier name appears in node without
+// being free in it, that is, node declares it somewhere.
+func declaredIn(node ast.Node, name string) bool {
+	if !mentions(node, name) {
+		return false
+	}
+	for _, free := range FreeVars(node) {
+		if free == name {
+			return false
+		}
+	}
+	return true
+}
+
+// usedAsKey reports whether the identifier name is a key of a composite
+// literal in node, which can be a field name rather than a variable.
+func usedAsKey(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if kv, ok := n.(*ast.KeyValueExpr); ok && isIdent(kv.Key, name) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,147 @@
+package astrewrite
+
+import "testing"
+
+func TestInlineLocalClosure(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(tmp string, n int) {
+	cleanup := func() {
+		os.Remove(tmp)
+		log.Print("removed")
+	}
+	work(n)
+	cleanup()
+
+	report := func(name string, count int) {
+		log.Printf("%s: %d", name, count)
+	}
+	report(tmp, 3)
+
+	scoped := func() {
+		err := check()
+		log.Print(err)
+	}
+	scoped()
+}
+`)
+
+	if n := InlineLocalClosure(findFunc(file, "f")); n != 3 {
+		t.Errorf("inlined %d closures, want 3", n)
+	}
+
+	checkSource(t, fset, file, `package p
+
+func f(tmp string, n int) {
+
+	work(n)
+	os.Remove(tmp)
+	log.Print("removed")
+
+	log.Printf("%s: %d", tmp, 3)
+
+	{
+		err := check()
+		log.Print(err)
+	}
+
+}
+`)
+}
+
+func TestInlineLocalClosureSkipped(t *testing.T) {
+	src := `package p
+
+func f(n int) {
+	var walk func(n int)
+	walk = func(n int) {
+		if n > 0 {
+			walk(n - 1)
+		}
+	}
+	walk(n)
+
+	fact := func() {
+		fact()
+	}
+	fact()
+
+	twice := func() { step() }
+	twice()
+	twice()
+
+	value := func() { step() }
+	register(value)
+
+	looped := func() { step() }
+	for i := 0; i < n; i++ {
+		looped()
+	}
+
+	early := func() {
+		if n == 0 {
+			return
+		}
+		step()
+	}
+	early()
+
+	shadowed := func() { log.Print(n) }
+	n := 2
+	shadowed()
+
+	assigned := func(x int) { x++; log.Print(x) }
+	assigned(n)
+
+	computed := func(x int) { log.Print(x) }
+	computed(n + 1)
+}
+`
+	fset, file := parse(t, src)
+	if n := InlineLocalClosure(findFunc(file, "f")); n != 0 {
+		t.Errorf("inlined %d closures, want none", n)
+	}
+	checkSource(t, fset, file, src)
+}
+
+func TestInlineLocalClosureTypes(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(p *T, half float64) {
+	show := func(d time.Duration, x float64) {
+		fmt.Println(d, x/2)
+	}
+	show(5, half)
+
+	check := func(err error) {
+		if err != nil {
+			panic(err)
+		}
+	}
+	check(p)
+}
+`)
+
+	if n := InlineLocalClosure(findFunc(file, "f")); n != 2 {
+		t.Errorf("inlined %d closures, want 2", n)
+	}
+
+	// the untyped constant and the pointer keep the types of the parameters
+	checkSource(t, fset, file, `package p
+
+func f(p *T, half float64) {
+	{
+		var d time.Duration = 5
+		fmt.Println(d, half/2)
+	}
+
+	{
+		var err error = p
+		if err != nil {
+			panic(err)
+		}
+	}
+
+}
+`)
+}
@@ -0,0 +1,77 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// InsertIntConversions makes the conversions explicit that the binary
+// expressions below node rely on constants being untyped for, as told by
+// needsConv, which needs type information the caller has. For every binary
+// expression needsConv returns a type for, like int64, one operand is
+// wrapped in a conversion to it, turning d * 1000 into d * int64(1000): the
+// operand made of literals only, if there's exactly one, or else the right
+// operand, or the left one if the right one is already converted to the
+// type. Parentheses around the operand are dropped, since the conversion
+// encloses it anyway, and added around types that need them, like *T. Type
+// strings that don't parse as expressions are ignored. It returns the number
+// of conversions inserted.
+func InsertIntConversions(node ast.Node, needsConv func(bin *ast.BinaryExpr) (convType string, ok bool)) int {
+	n := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		bin, ok := node.(*ast.BinaryExpr)
+		if !ok {
+			return true
+		}
+		convType, ok := needsConv(bin)
+		if !ok {
+			return true
+		}
+		typ, err := parseExpr(convType)
+		if err != nil {
+			return true
+		}
+		switch typ.(type) {
+		case *ast.StarExpr, *ast.FuncType, *ast.ChanType:
+			typ = &ast.ParenExpr{X: typ}
+		}
+		if isConversion(bin.X, typ) && isConversion(bin.Y, typ) {
+			return true
+		}
+
+		operand := &bin.Y
+		switch {
+		case isConversion(bin.Y, typ):
+			operand = &bin.X
+		case literalsOnly(bin.X) && !literalsOnly(bin.Y):
+			operand = &bin.X
+		}
+		x := ast.Unparen(*operand)
+		placeAt(typ, x.Pos())
+		*operand = &ast.CallExpr{Fun: typ, Lparen: x.Pos(), Args: []ast.Expr{x}, Rparen: x.End()}
+		n++
+		return true
+	})
+	return n
+}
+
+// isConversion reports whether e is a conversion to typ.
+func isConversion(e ast.Expr, typ ast.Expr) bool {
+	call, ok := ast.Unparen(e).(*ast.CallExpr)
+	return ok && len(call.Args) == 1 && Equal(ast.Unparen(call.Fun), ast.Unparen(typ))
+}
+
+// literalsOnly reports whether e is made of basic literals and operators.
+func literalsOnly(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return literalsOnly(e.X)
+	case *ast.UnaryExpr:
+		return e.Op != token.AND && e.Op != token.ARROW && literalsOnly(e.X)
+	case *ast.BinaryExpr:
+		return literalsOnly(e.X) && literalsOnly(e.Y)
+	}
+	return false
+}
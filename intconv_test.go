@@ -0,0 +1,48 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+)
+
+func TestInsertIntConversions(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(d int64, n int, p *T) {
+	_ = d * 1000
+	_ = (60 * 60) * d
+	_ = d + (x)
+	_ = d - int64(n)
+	_ = y / p
+	_ = n + 1
+}
+`)
+
+	// the oracle stands in for type information: everything mentioning d
+	// is int64, y / p converts to *T
+	oracle := func(bin *ast.BinaryExpr) (string, bool) {
+		switch {
+		case bin.Op == token.QUO:
+			return "*T", true
+		case mentions(bin, "d"):
+			return "int64", true
+		}
+		return "", false
+	}
+	if n := InsertIntConversions(file, oracle); n != 5 {
+		t.Errorf("inserted %d conversions, want 5", n)
+	}
+
+	checkSource(t, fset, file, `package p
+
+func f(d int64, n int, p *T) {
+	_ = d * int64(1000)
+	_ = int64(60*60) * d
+	_ = d + int64(x)
+	_ = int64(d) - int64(n)
+	_ = y / (*T)(p)
+	_ = n + 1
+}
+`)
+}
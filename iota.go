@@ -0,0 +1,176 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// UsesIota reports whether gd is a const declaration whose values depend on
+// the positions of its specs through iota, so that removing, reordering or
+// ungrouping its specs changes the values of others. Passes doing so should
+// leave such declarations alone unless they've been materialized with
+// MaterializeIota.
+func UsesIota(gd *ast.GenDecl) bool {
+	if gd.Tok != token.CONST {
+		return false
+	}
+	for _, spec := range gd.Specs {
+		for _, v := range spec.(*ast.ValueSpec).Values {
+			if mentionsIota(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mentionsIota reports whether e refers to the predeclared iota.
+func mentionsIota(e ast.Expr) bool {
+	found := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "iota" && id.Obj == nil {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// MaterializeIota rewrites the const declaration gd so that no spec depends
+// on its position anymore: values involving iota are replaced by the
+// literals of the values they compute, like 1 << iota by 1, 2, 4 and so on,
+// and specs repeating the values of an earlier one get copies of them, along
+// with its type. info must hold the Defs of gd, whose constant values are
+// used.
+//
+// Literals keep the kind of their untyped constants, so 'a' + iota becomes
+// 'b' rather than 98, and values of a named type without a type in their
+// spec are converted to it, like Flag(2), qualified by the name of its
+// package if it's declared elsewhere. An error is returned if gd isn't a
+// const declaration or a value can't be written as a literal, like a float
+// that isn't exactly representable, in which case nothing is changed.
+func MaterializeIota(gd *ast.GenDecl, info *types.Info) error {
+	if gd.Tok != token.CONST {
+		return fmt.Errorf("astrewrite: %s declaration isn't a const declaration", gd.Tok)
+	}
+
+	typs := make([]ast.Expr, len(gd.Specs))
+	values := make([][]ast.Expr, len(gd.Specs))
+	var typ ast.Expr
+	var inherited []ast.Expr
+	for i, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		implicit := len(vs.Values) == 0
+		if !implicit {
+			typ, inherited = vs.Type, vs.Values
+		}
+		pos := vs.Names[len(vs.Names)-1].End()
+		typs[i] = vs.Type
+		if implicit && typ != nil {
+			typs[i] = Clone(typ).(ast.Expr)
+			placeAt(typs[i], pos)
+		}
+
+		for j, name := range vs.Names {
+			if j >= len(inherited) {
+				return fmt.Errorf("astrewrite: missing value for constant %s", name.Name)
+			}
+			if !mentionsIota(inherited[j]) {
+				v := inherited[j]
+				if implicit {
+					v = Clone(v).(ast.Expr)
+					placeAt(v, pos)
+				}
+				values[i] = append(values[i], v)
+				continue
+			}
+			c, ok := info.Defs[name].(*types.Const)
+			if !ok {
+				return fmt.Errorf("astrewrite: no constant value for %s", name.Name)
+			}
+			lit, err := constLiteral(c, typs[i] == nil, pos)
+			if err != nil {
+				return err
+			}
+			values[i] = append(values[i], lit)
+		}
+	}
+
+	for i, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		vs.Type, vs.Values = typs[i], values[i]
+	}
+	return nil
+}
+
+// constLiteral returns the literal of the value of c, placed at pos. If
+// bare is set, there's no type in the spec of c, so the literal carries its
+// type itself: untyped constants get a literal of their kind, others a
+// conversion.
+func constLiteral(c *types.Const, bare bool, pos token.Pos) (ast.Expr, error) {
+	basic, ok := c.Type().Underlying().(*types.Basic)
+	if !ok {
+		return nil, fmt.Errorf("astrewrite: constant %s of type %s", c.Name(), c.Type())
+	}
+	val := c.Val()
+	isUntyped := basic.Info()&types.IsUntyped != 0
+
+	var lit ast.Expr
+	neg := (val.Kind() == constant.Int || val.Kind() == constant.Float) && constant.Sign(val) < 0
+	if neg {
+		val = constant.UnaryOp(token.SUB, val, 0)
+	}
+	switch val.Kind() {
+	case constant.Bool:
+		lit = &ast.Ident{NamePos: pos, Name: val.ExactString()}
+	case constant.String:
+		lit = &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: val.ExactString()}
+	case constant.Int:
+		if basic.Kind() == types.UntypedRune {
+			r, _ := constant.Int64Val(val)
+			lit = &ast.BasicLit{ValuePos: pos, Kind: token.CHAR, Value: strconv.QuoteRune(rune(r))}
+		} else {
+			lit = &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: val.ExactString()}
+		}
+		if basic.Kind() == types.UntypedFloat {
+			lit.(*ast.BasicLit).Value += ".0"
+		}
+	case constant.Float:
+		f, exact := constant.Float64Val(val)
+		if !exact {
+			return nil, fmt.Errorf("astrewrite: value of constant %s isn't exactly representable", c.Name())
+		}
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		lit = &ast.BasicLit{ValuePos: pos, Kind: token.FLOAT, Value: s}
+	default:
+		return nil, fmt.Errorf("astrewrite: value of constant %s can't be written as a literal", c.Name())
+	}
+	if neg {
+		lit = &ast.UnaryExpr{OpPos: pos, Op: token.SUB, X: lit}
+	}
+	if !bare || isUntyped {
+		return lit, nil
+	}
+
+	qualifier := func(pkg *types.Package) string {
+		if pkg == c.Pkg() {
+			return ""
+		}
+		return pkg.Name()
+	}
+	conv, err := parser.ParseExpr(types.TypeString(c.Type(), qualifier))
+	if err != nil {
+		return nil, fmt.Errorf("astrewrite: type of constant %s: %v", c.Name(), err)
+	}
+	placeAt(conv, pos)
+	return &ast.CallExpr{Fun: conv, Lparen: pos, Args: []ast.Expr{lit}, Rparen: pos}, nil
+}
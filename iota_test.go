@@ -0,0 +1,123 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/types"
+	"testing"
+)
+
+func TestMaterializeIota(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type Flag uint
+
+const (
+	Read Flag = 1 << iota
+	Write
+	Exec
+)
+
+const (
+	Low = Flag(1) << iota
+	High
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+
+const (
+	a = 'a' + iota
+	b
+	name = "x"
+	other
+)
+`)
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range file.Decls[1:] {
+		gd := d.(*ast.GenDecl)
+		if !UsesIota(gd) {
+			t.Errorf("UsesIota is false for the block at %s", fset.Position(gd.Pos()))
+		}
+		if err := MaterializeIota(gd, info); err != nil {
+			t.Fatal(err)
+		}
+		if UsesIota(gd) {
+			t.Errorf("UsesIota is true for the materialized block at %s", fset.Position(gd.Pos()))
+		}
+	}
+	checkSource(t, fset, file, `package p
+
+type Flag uint
+
+const (
+	Read  Flag = 1
+	Write Flag = 2
+	Exec  Flag = 4
+)
+
+const (
+	Low  = Flag(1)
+	High = Flag(2)
+)
+
+const (
+	_  = 0
+	KB = 1024
+	MB = 1048576
+	GB = 1073741824
+)
+
+const (
+	a     = 'a'
+	b     = 'b'
+	name  = "x"
+	other = "x"
+)
+`)
+
+	if err := MaterializeIota(file.Decls[0].(*ast.GenDecl), info); err == nil {
+		t.Error("materialized a type declaration")
+	}
+}
+
+func TestStripDebugIota(t *testing.T) {
+	src := `package p
+
+const (
+	debug = false
+	A     = iota
+	B
+)
+`
+	// removing debug would renumber A and B
+	fset, file := parse(t, src)
+	report := StripDebug([]*ast.File{file}, DebugConfig{Guards: []string{"debug"}})
+	if len(report.Guards) != 0 {
+		t.Errorf("removed guards %v from a block using iota", report.Guards)
+	}
+
+	fset, file = parse(t, src)
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+	if err := MaterializeIota(file.Decls[0].(*ast.GenDecl), info); err != nil {
+		t.Fatal(err)
+	}
+	StripDebug([]*ast.File{file}, DebugConfig{Guards: []string{"debug"}})
+	checkSource(t, fset, file, `package p
+
+const (
+	A = 1
+	B = 2
+)
+`)
+}
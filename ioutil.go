@@ -0,0 +1,113 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// ioutilMoves maps the names of io/ioutil to the import path and name of
+// their replacements.
+var ioutilMoves = map[string][2]string{
+	"ReadAll":   {"io", "ReadAll"},
+	"ReadFile":  {"os", "ReadFile"},
+	"WriteFile": {"os", "WriteFile"},
+	"TempDir":   {"os", "MkdirTemp"},
+	"TempFile":  {"os", "CreateTemp"},
+	"NopCloser": {"io", "NopCloser"},
+	"Discard":   {"io", "Discard"},
+}
+
+// IoutilReport describes what MigrateIoutil did.
+type IoutilReport struct {
+	// Migrated is the number of rewritten references to io/ioutil.
+	Migrated int
+
+	// ReadDir holds the references to ioutil.ReadDir, which are left
+	// alone: os.ReadDir returns []os.DirEntry rather than []fs.FileInfo,
+	// so its callers need more than a new name.
+	ReadDir []*ast.SelectorExpr
+}
+
+// MigrateIoutil replaces the references to the deprecated io/ioutil package
+// in file by their equivalents in io and os, like ioutil.ReadAll by
+// io.ReadAll and ioutil.TempDir by os.MkdirTemp, adding the imports of io
+// and os as needed. The import of io/ioutil is removed once nothing refers
+// to it anymore.
+//
+// If info is given, a qualifier only counts as io/ioutil if info resolves it
+// to that package, otherwise if the parser didn't resolve it to a local
+// object. info isn't updated. A file dot importing io/ioutil is left alone,
+// as are references to io and os that would be shadowed in file, which
+// keep the import of io/ioutil.
+func MigrateIoutil(file *ast.File, info *types.Info) IoutilReport {
+	var report IoutilReport
+	var spec *ast.ImportSpec
+	for _, imp := range file.Imports {
+		if importPath(imp) == "io/ioutil" {
+			spec = imp
+		}
+	}
+	if spec == nil || importName(spec) == "." || importName(spec) == "_" {
+		return report
+	}
+	name := importName(spec)
+	isIoutil := func(x *ast.Ident) bool {
+		if x.Name != name {
+			return false
+		}
+		if info != nil {
+			pn, ok := info.Uses[x].(*types.PkgName)
+			return ok && pn.Imported().Path() == "io/ioutil"
+		}
+		return x.Obj == nil
+	}
+
+	// the qualifiers of io and os, or "" if they're taken
+	qualifiers := make(map[string]string)
+	imported := make(map[string]bool)
+	for _, path := range []string{"io", "os"} {
+		for _, imp := range file.Imports {
+			if n := importName(imp); importPath(imp) == path && n != "." && n != "_" {
+				qualifiers[path], imported[path] = n, true
+			}
+		}
+		if !imported[path] && !usesName(file, path) {
+			qualifiers[path] = path
+		}
+	}
+
+	remaining := 0
+	needed := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || !isIoutil(x) {
+			return true
+		}
+		move, ok := ioutilMoves[sel.Sel.Name]
+		if !ok || qualifiers[move[0]] == "" {
+			if sel.Sel.Name == "ReadDir" {
+				report.ReadDir = append(report.ReadDir, sel)
+			}
+			remaining++
+			return true
+		}
+		x.Name, sel.Sel.Name = qualifiers[move[0]], move[1]
+		needed[move[0]] = true
+		report.Migrated++
+		return true
+	})
+
+	for _, path := range []string{"io", "os"} {
+		if needed[path] && !imported[path] {
+			AddImport(file, path)
+		}
+	}
+	if report.Migrated > 0 && remaining == 0 {
+		removeImport(file, spec)
+	}
+	return report
+}
@@ -0,0 +1,78 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/types"
+	"testing"
+)
+
+func TestMigrateIoutil(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "io/ioutil"
+
+func f() {
+	fis, _ := ioutil.ReadDir(".")
+	_, _ = ioutil.ReadAll(nil)
+	_ = fis
+}
+`)
+
+	report := MigrateIoutil(file, nil)
+	if report.Migrated != 1 || len(report.ReadDir) != 1 {
+		t.Errorf("got %d migrated and %d ReadDir calls, want 1 and 1", report.Migrated, len(report.ReadDir))
+	}
+	if pos := fset.Position(report.ReadDir[0].Pos()); pos.Line != 6 {
+		t.Errorf("got ReadDir at %s, want line 6", pos)
+	}
+	checkSource(t, fset, file, `package p
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+func f() {
+	fis, _ := ioutil.ReadDir(".")
+	_, _ = io.ReadAll(nil)
+	_ = fis
+}
+`)
+}
+
+func TestMigrateIoutilTypes(t *testing.T) {
+	// a local package named ioutil is only told apart with type info
+	fset, file := parse(t, `package p
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+type localutil struct{}
+
+func (localutil) ReadFile(string) ([]byte, error) { return nil, nil }
+
+func f() {
+	var ioutil localutil
+	_, _ = ioutil.ReadFile("a")
+}
+
+func g() { _, _ = ioutil.ReadFile("b"); _ = os.Args }
+`)
+	info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	if report := MigrateIoutil(file, info); report.Migrated != 1 {
+		t.Errorf("migrated %d references, want 1", report.Migrated)
+	}
+	checkSource(t, fset, findFunc(file, "f"), `func f() {
+	var ioutil localutil
+	_, _ = ioutil.ReadFile("a")
+}`)
+	checkSource(t, fset, findFunc(file, "g"), `func g() { _, _ = os.ReadFile("b"); _ = os.Args }`)
+}
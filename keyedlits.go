@@ -0,0 +1,102 @@
+package astrewrite
+
+import "go/ast"
+
+// KeyAllStructLiterals turns the positional struct literals of file into
+// keyed ones, like T{1, "a"} into T{ID: 1, Name: "a"}, and returns the
+// number of converted literals. fields returns the names of the fields of
+// a struct type in order, or nil if typeExpr isn't a struct type or isn't
+// known; the names of a struct type literal are read from it if fields
+// returns nil for it. Literals whose type is elided in an array, slice or
+// map literal are resolved with the element type of that literal. Array,
+// slice and map literals are left alone, as are empty and keyed literals and
+// literals whose number of elements doesn't match the number of fields.
+func KeyAllStructLiterals(file *ast.File, fields func(typeExpr ast.Expr) []string) int {
+	n := 0
+	implied := make(map[*ast.CompositeLit]ast.Expr)
+	ast.Inspect(file, func(node ast.Node) bool {
+		lit, ok := node.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		typ := lit.Type
+		if typ == nil {
+			typ = implied[lit]
+		}
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+
+		switch t := typ.(type) {
+		case nil:
+		case *ast.ArrayType:
+			impliedElems(lit.Elts, t.Elt, nil, implied)
+		case *ast.MapType:
+			impliedElems(lit.Elts, t.Value, t.Key, implied)
+		default:
+			if keyLiteral(lit, typ, fields) {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
+
+// impliedElems records elem as the type of the elements of a literal with
+// elided types, and key as the type of its keys.
+func impliedElems(elts []ast.Expr, elem, key ast.Expr, implied map[*ast.CompositeLit]ast.Expr) {
+	for _, e := range elts {
+		if kv, ok := e.(*ast.KeyValueExpr); ok {
+			if lit, ok := kv.Key.(*ast.CompositeLit); ok && lit.Type == nil && key != nil {
+				implied[lit] = key
+			}
+			e = kv.Value
+		}
+		if u, ok := e.(*ast.UnaryExpr); ok {
+			// &T{} elided as {} in a []*T literal
+			e = u.X
+		}
+		if lit, ok := e.(*ast.CompositeLit); ok && lit.Type == nil {
+			implied[lit] = elem
+		}
+	}
+}
+
+// keyLiteral keys the elements of the positional struct literal lit of type
+// typ and reports whether it did.
+func keyLiteral(lit *ast.CompositeLit, typ ast.Expr, fields func(ast.Expr) []string) bool {
+	if len(lit.Elts) == 0 {
+		return false
+	}
+	for _, e := range lit.Elts {
+		if _, ok := e.(*ast.KeyValueExpr); ok {
+			return false
+		}
+	}
+	names := fields(typ)
+	if st, ok := typ.(*ast.StructType); ok && names == nil {
+		for _, f := range st.Fields.List {
+			if len(f.Names) == 0 {
+				if id := embeddedName(f.Type); id != nil {
+					names = append(names, id.Name)
+				}
+				continue
+			}
+			for _, id := range f.Names {
+				names = append(names, id.Name)
+			}
+		}
+	}
+	if len(names) != len(lit.Elts) {
+		return false
+	}
+	for i, e := range lit.Elts {
+		lit.Elts[i] = &ast.KeyValueExpr{
+			Key:   &ast.Ident{NamePos: e.Pos(), Name: names[i]},
+			Colon: e.Pos(),
+			Value: e,
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestKeyAllStructLiterals(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type Point struct{ X, Y int }
+
+type Line struct {
+	From, To Point
+	Name     string
+}
+
+func f() []Line {
+	l := Line{Point{0, 0}, Point{X: 1, Y: 1}, "diagonal"}
+	pts := []*Point{{1, 2}, &Point{3, 4}}
+	m := map[Point]Point{{0, 0}: {1, 1}}
+	ints := []int{1, 2}
+	anon := struct {
+		A int
+		B string
+	}{1, "b"}
+	return []Line{l, {Point{}, pts[0], "x"}}
+}
+`)
+
+	resolve := func(typ ast.Expr) []string {
+		id, ok := typ.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		switch id.Name {
+		case "Point":
+			return []string{"X", "Y"}
+		case "Line":
+			return []string{"From", "To", "Name"}
+		}
+		return nil
+	}
+	if n := KeyAllStructLiterals(file, resolve); n != 8 {
+		t.Errorf("keyed %d literals, want 8", n)
+	}
+
+	checkSource(t, fset, file, `package p
+
+type Point struct{ X, Y int }
+
+type Line struct {
+	From, To Point
+	Name     string
+}
+
+func f() []Line {
+	l := Line{From: Point{X: 0, Y: 0}, To: Point{X: 1, Y: 1}, Name: "diagonal"}
+	pts := []*Point{{X: 1, Y: 2}, &Point{X: 3, Y: 4}}
+	m := map[Point]Point{{X: 0, Y: 0}: {X: 1, Y: 1}}
+	ints := []int{1, 2}
+	anon := struct {
+		A int
+		B string
+	}{A: 1, B: "b"}
+	return []Line{l, {From: Point{}, To: pts[0], Name: "x"}}
+}
+`)
+}
@@ -0,0 +1,133 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// labelScope holds the labels of a single function body. Labels don't cross
+// function literal boundaries, so every FuncLit has its own scope.
+type labelScope struct {
+	labels   map[string]*ast.LabeledStmt
+	branches []*ast.BranchStmt
+}
+
+func scanLabels(body *ast.BlockStmt) *labelScope {
+	s := &labelScope{labels: make(map[string]*ast.LabeledStmt)}
+	if body == nil {
+		return s
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.LabeledStmt:
+			s.labels[n.Label.Name] = n
+		case *ast.BranchStmt:
+			if n.Label != nil {
+				s.branches = append(s.branches, n)
+			}
+		}
+		return true
+	})
+	return s
+}
+
+// RenameLabel renames the label old declared in the body of fd to new,
+// updating every break, continue and goto referring to it. Labels of function
+// literals inside fd are separate and left alone. It fails if new isn't an
+// identifier.
+func RenameLabel(fd *ast.FuncDecl, old, new string) error {
+	if !token.IsIdentifier(new) || new == "_" {
+		return fmt.Errorf("astrewrite: invalid label name %q", new)
+	}
+	s := scanLabels(fd.Body)
+	l, ok := s.labels[old]
+	if !ok {
+		return fmt.Errorf("astrewrite: label %s not declared in %s", old, fd.Name.Name)
+	}
+	if _, ok := s.labels[new]; ok {
+		return fmt.Errorf("astrewrite: label %s already declared in %s", new, fd.Name.Name)
+	}
+
+	l.Label.Name = new
+	for _, b := range s.branches {
+		if b.Label.Name == old {
+			b.Label.Name = new
+		}
+	}
+	return nil
+}
+
+// RemoveLabel removes the label name declared in the body of fd, keeping the
+// labeled statement, which moves up to the line of the label. It fails if a
+// branch statement still refers to it.
+func RemoveLabel(fd *ast.FuncDecl, name string) error {
+	s := scanLabels(fd.Body)
+	l, ok := s.labels[name]
+	if !ok {
+		return fmt.Errorf("astrewrite: label %s not declared in %s", name, fd.Name.Name)
+	}
+	for _, b := range s.branches {
+		if b.Label.Name == name {
+			return fmt.Errorf("astrewrite: label %s is used by a %s statement", name, b.Tok)
+		}
+	}
+
+	Walk(fd.Body, func(n ast.Node) (ast.Node, bool) {
+		if n == ast.Node(l) {
+			from := l.Stmt.Pos()
+			mapPositions(l.Stmt, func(p token.Pos) token.Pos {
+				if p == from {
+					return l.Pos()
+				}
+				return p
+			})
+			return l.Stmt, false
+		}
+		return n, true
+	})
+	return nil
+}
+
+// LabelIdents returns the identifiers below root naming labels, both in
+// labeled statements and in branch statements. Passes renaming identifiers
+// by name can use it to skip labels, which live in their own namespace.
+func LabelIdents(root ast.Node) map[*ast.Ident]bool {
+	idents := make(map[*ast.Ident]bool)
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LabeledStmt:
+			idents[n.Label] = true
+		case *ast.BranchStmt:
+			if n.Label != nil {
+				idents[n.Label] = true
+			}
+		}
+		return true
+	})
+	return idents
+}
+
+// hasBreak reports whether list contains an unlabeled break leaving the
+// statement the list belongs to, i.e. one that isn't nested in a loop,
+// switch, select or function literal of its own.
+func hasBreak(list []ast.Stmt) bool {
+	found := false
+	for _, s := range list {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BranchStmt:
+				if n.Tok == token.BREAK && n.Label == nil {
+					found = true
+				}
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt,
+				*ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+				return false
+			}
+			return !found
+		})
+	}
+	return found
+}
@@ -0,0 +1,133 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+const labelsSrc = `package p
+
+func f(m [][]int) {
+L:
+	for _, row := range m {
+		for _, v := range row {
+			if v < 0 {
+				break L
+			}
+			if v == 0 {
+				continue L
+			}
+		}
+	}
+
+	g := func() {
+	L:
+		for {
+			break L
+		}
+	}
+	g()
+}
+`
+
+func TestRenameLabel(t *testing.T) {
+	fset, file := parse(t, labelsSrc)
+	fd := findFunc(file, "f")
+
+	if err := RenameLabel(fd, "L", "Rows"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameLabel(fd, "L", "Rows"); err == nil {
+		t.Error("renaming an unknown label succeeded")
+	}
+	for _, name := range []string{"", "_", "2nd", "a-b", "for"} {
+		if err := RenameLabel(fd, "Rows", name); err == nil {
+			t.Errorf("renaming a label to %q succeeded", name)
+		}
+	}
+
+	checkSource(t, fset, file, `package p
+
+func f(m [][]int) {
+Rows:
+	for _, row := range m {
+		for _, v := range row {
+			if v < 0 {
+				break Rows
+			}
+			if v == 0 {
+				continue Rows
+			}
+		}
+	}
+
+	g := func() {
+	L:
+		for {
+			break L
+		}
+	}
+	g()
+}
+`)
+}
+
+func TestRemoveLabel(t *testing.T) {
+	fset, file := parse(t, labelsSrc)
+	fd := findFunc(file, "f")
+
+	if err := RemoveLabel(fd, "L"); err == nil {
+		t.Fatal("removed a label that is still used")
+	}
+
+	fset, file = parse(t, `package p
+
+func f() {
+L:
+	for {
+		g := func() {
+		L:
+			for {
+				break L
+			}
+		}
+		g()
+		break
+	}
+}
+`)
+	if err := RemoveLabel(findFunc(file, "f"), "L"); err != nil {
+		t.Fatal(err)
+	}
+	// the statement moves up to the line of the removed label
+	checkSource(t, fset, file, `package p
+
+func f() {
+	for {
+		g := func() {
+		L:
+			for {
+				break L
+			}
+		}
+		g()
+		break
+	}
+}
+`)
+}
+
+func TestLabelIdents(t *testing.T) {
+	_, file := parse(t, labelsSrc)
+
+	labels := LabelIdents(file)
+	if len(labels) != 5 {
+		t.Errorf("got %d label identifiers, want 5", len(labels))
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && labels[id] && id.Name != "L" {
+			t.Errorf("%s reported as a label", id.Name)
+		}
+		return true
+	})
+}
@@ -0,0 +1,315 @@
+package astrewrite
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"sort"
+)
+
+// LazyBodies makes the Driver skip function bodies when parsing, which
+// speeds up walks that are only interested in signatures, imports and type
+// declarations.
+//
+// A cheap scan of the source records where the bodies of top-level
+// functions are, and the file is parsed without them and without object
+// resolution. The walk function sees an empty placeholder BlockStmt for
+// every skipped body, which Skipped recognizes. If it needs the real body,
+// it calls LoadBody. Before a changed file is written, all bodies that
+// weren't loaded are put back in place, so bodies are preserved whether or
+// not they were looked at.
+func LazyBodies() DriverOption {
+	return func(d *Driver) {
+		d.lazyBodies = true
+	}
+}
+
+// lazyBody describes a function body skipped when parsing.
+type lazyBody struct {
+	file *ast.File
+	tf   *token.File
+	src  []byte
+
+	// lbrace and rbrace are the offsets of the braces of the body.
+	lbrace, rbrace int
+
+	placeholder *ast.BlockStmt
+
+	// fd and loaded are set once the body is loaded, along with the
+	// digest of the body at that time and its comments.
+	fd       *ast.FuncDecl
+	loaded   *ast.BlockStmt
+	digest   uint64
+	comments []*ast.CommentGroup
+}
+
+// Skipped reports whether body is the placeholder of a body that was
+// skipped when parsing.
+func (d *Driver) Skipped(body *ast.BlockStmt) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.bodies[body]
+	return ok
+}
+
+// LoadBody returns the body of fd, parsing it first if it was skipped. A
+// skipped body replaces the placeholder in fd, and the comments inside it
+// are added to the file.
+func (d *Driver) LoadBody(fd *ast.FuncDecl) (*ast.BlockStmt, error) {
+	d.mu.Lock()
+	lb, ok := d.bodies[fd.Body]
+	d.mu.Unlock()
+	if !ok {
+		return fd.Body, nil
+	}
+	if lb.loaded != nil {
+		fd.Body = lb.loaded
+		return lb.loaded, nil
+	}
+	if err := lb.load(fd); err != nil {
+		return nil, err
+	}
+	return fd.Body, nil
+}
+
+// parseSkeleton parses src with all top-level function bodies skipped.
+func (d *Driver) parseSkeleton(fset *token.FileSet, path string, src []byte, fr *FileReport) (*ast.File, error) {
+	skeleton, ranges := skipBodies(src)
+	file, err := parser.ParseFile(fset, path, skeleton, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(file.Package)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.bodies == nil {
+		d.bodies = make(map[*ast.BlockStmt]*lazyBody)
+	}
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		lbrace := tf.Offset(fd.Body.Lbrace)
+		rbrace, ok := ranges[lbrace]
+		if !ok {
+			continue
+		}
+		d.bodies[fd.Body] = &lazyBody{
+			file:        file,
+			tf:          tf,
+			src:         src,
+			lbrace:      lbrace,
+			rbrace:      rbrace,
+			placeholder: fd.Body,
+		}
+		fr.SkippedBodies++
+	}
+	return file, nil
+}
+
+// skipBodies returns a copy of src with the contents of the bodies of all
+// top-level functions blanked out, keeping newlines so that positions and
+// lines stay the same. It also returns the offsets of the closing braces of
+// the bodies, keyed by the offsets of their opening braces.
+func skipBodies(src []byte) ([]byte, map[int]int) {
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	offset := func(pos token.Pos) int { return int(pos) - 1 }
+
+	skeleton := append([]byte(nil), src...)
+	ranges := make(map[int]int)
+
+	prev, depth := token.SEMICOLON, 0
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return skeleton, ranges
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.FUNC:
+			if depth != 0 || prev != token.SEMICOLON {
+				break
+			}
+			// Find the opening brace of the body, skipping those
+			// of struct and interface types in the signature.
+			var nested int
+			last := tok
+			for {
+				pos, tok, _ = s.Scan()
+				if tok == token.EOF || (tok == token.SEMICOLON && nested == 0) {
+					break
+				}
+				if tok == token.LBRACE && nested == 0 && last != token.STRUCT && last != token.INTERFACE {
+					break
+				}
+				switch tok {
+				case token.LPAREN, token.LBRACK, token.LBRACE:
+					nested++
+				case token.RPAREN, token.RBRACK, token.RBRACE:
+					nested--
+				}
+				last = tok
+			}
+			if tok != token.LBRACE {
+				break
+			}
+			lbrace := offset(pos)
+			for nested = 1; nested > 0; {
+				pos, tok, _ = s.Scan()
+				switch tok {
+				case token.EOF:
+					return skeleton, ranges
+				case token.LBRACE:
+					nested++
+				case token.RBRACE:
+					nested--
+				}
+			}
+			rbrace := offset(pos)
+			for i := lbrace + 1; i < rbrace; i++ {
+				if skeleton[i] != '\n' {
+					skeleton[i] = ' '
+				}
+			}
+			ranges[lbrace] = rbrace
+		}
+		prev = tok
+	}
+}
+
+// load parses the skipped body and puts it in place of the placeholder in
+// fd.
+func (lb *lazyBody) load(fd *ast.FuncDecl) error {
+	// Parse a file consisting of just the body, preceded by a function
+	// header in place of whatever came before it. The FileSet is padded
+	// so that the body's positions match the skeleton's.
+	const header = "package p;func _()"
+	src := bytes.Repeat([]byte{' '}, len(lb.src))
+	copy(src, header)
+	copy(src[lb.lbrace:], lb.src[lb.lbrace:lb.rbrace+1])
+
+	fset := token.NewFileSet()
+	if lb.tf.Base() > 1 {
+		fset.AddFile("", -1, lb.tf.Base()-2)
+	}
+	f, err := parser.ParseFile(fset, lb.tf.Name(), src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return fmt.Errorf("astrewrite: loading body of %s: %v", fd.Name.Name, err)
+	}
+	body := f.Decls[0].(*ast.FuncDecl).Body
+	lb.fd, lb.loaded, lb.digest, lb.comments = fd, body, digest(body), f.Comments
+	fd.Body = body
+
+	lb.file.Comments = append(lb.file.Comments, f.Comments...)
+	sort.Slice(lb.file.Comments, func(i, j int) bool {
+		return lb.file.Comments[i].Pos() < lb.file.Comments[j].Pos()
+	})
+	return nil
+}
+
+// fileBodies returns the skipped bodies of tf.
+func (d *Driver) fileBodies(tf *token.File) []*lazyBody {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var bodies []*lazyBody
+	for _, lb := range d.bodies {
+		if lb.tf == tf {
+			bodies = append(bodies, lb)
+		}
+	}
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i].lbrace < bodies[j].lbrace })
+	return bodies
+}
+
+// unload puts the placeholders of the loaded bodies of tf back in place,
+// removing their comments from the file, and returns a function undoing
+// that.
+func (d *Driver) unload(tf *token.File) (restore func()) {
+	var undo []*lazyBody
+	hidden := make(map[*ast.CommentGroup]bool)
+	for _, lb := range d.fileBodies(tf) {
+		if lb.loaded != nil && lb.fd.Body == lb.loaded {
+			lb.fd.Body = lb.placeholder
+			undo = append(undo, lb)
+			for _, cg := range lb.comments {
+				hidden[cg] = true
+			}
+		}
+	}
+	if len(undo) == 0 {
+		return func() {}
+	}
+
+	file := undo[0].file
+	comments := file.Comments
+	file.Comments = nil
+	for _, cg := range comments {
+		if !hidden[cg] {
+			file.Comments = append(file.Comments, cg)
+		}
+	}
+	return func() {
+		for _, lb := range undo {
+			lb.fd.Body = lb.loaded
+		}
+		file.Comments = comments
+	}
+}
+
+// loaded returns the number of skipped bodies of tf that were loaded.
+func (d *Driver) loaded(tf *token.File) int {
+	n := 0
+	for _, lb := range d.fileBodies(tf) {
+		if lb.loaded != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// bodiesChanged reports whether any loaded body of tf changed since it was
+// loaded.
+func (d *Driver) bodiesChanged(tf *token.File) bool {
+	for _, lb := range d.fileBodies(tf) {
+		if lb.loaded == nil || lb.fd.Body != lb.loaded {
+			continue
+		}
+		if digest(lb.loaded) != lb.digest {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAll loads all skipped bodies still in place in the top-level functions
+// of file.
+func (d *Driver) loadAll(file *ast.File) error {
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Body != nil {
+			if _, err := d.LoadBody(fd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forget drops the skipped bodies of tf.
+func (d *Driver) forget(tf *token.File) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for body, lb := range d.bodies {
+		if lb.tf == tf {
+			delete(d.bodies, body)
+		}
+	}
+}
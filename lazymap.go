@@ -0,0 +1,154 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// LazyMapInit initializes the maps declared in the body of fn without a
+// value, var m map[K]V, where they're declared if they're written to,
+// var m = make(map[K]V), and removes their nil guards,
+//
+//	if m == nil {
+//		m = make(map[K]V)
+//	}
+//
+// which can't be taken anymore. A size hint given in a guard is dropped.
+//
+// A nil map and an empty one only behave the same when they're indexed,
+// ranged over, or passed to len, delete or clear, so maps used in any other
+// way, like being passed, returned, assigned, compared to nil outside a
+// guard or declared again, are left alone, as are maps that are only read:
+// those may be intentionally left nil. It returns the number of maps
+// initialized.
+func LazyMapInit(fn *ast.FuncDecl) int {
+	if fn.Body == nil {
+		return 0
+	}
+	var specs []*ast.ValueSpec
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if gd, ok := n.(*ast.GenDecl); ok && gd.Tok == token.VAR {
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if _, ok := vs.Type.(*ast.MapType); ok && len(vs.Names) == 1 && len(vs.Values) == 0 && vs.Names[0].Name != "_" {
+					specs = append(specs, vs)
+				}
+			}
+		}
+		return true
+	})
+
+	guards := make(map[ast.Stmt]bool)
+	n := 0
+	for _, vs := range specs {
+		found, written, ok := mapUses(fn, vs)
+		if !ok || !written && len(found) == 0 {
+			continue
+		}
+		for _, g := range found {
+			guards[g] = true
+		}
+		pos := vs.Type.Pos()
+		vs.Values = []ast.Expr{&ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: pos, Name: "make"},
+			Lparen: pos,
+			Args:   []ast.Expr{vs.Type},
+			Rparen: vs.Type.End(),
+		}}
+		vs.Type = nil
+		n++
+	}
+	if len(guards) > 0 {
+		Walk(fn.Body, func(n ast.Node) (ast.Node, bool) {
+			if s, ok := n.(ast.Stmt); ok && guards[s] {
+				return Remove, false
+			}
+			return n, true
+		})
+	}
+	return n
+}
+
+// mapUses returns the nil guards of the map declared by vs in fn and
+// whether it's written to, or false if it's used in a way a nil map and an
+// empty one can be told apart by.
+func mapUses(fn *ast.FuncDecl, vs *ast.ValueSpec) (guards []ast.Stmt, written, ok bool) {
+	decl := vs.Names[0]
+	name := decl.Name
+	ok = true
+	var stack []ast.Node
+	ast.Inspect(fn, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if !ok {
+			return false
+		}
+		if ifs, isIf := n.(*ast.IfStmt); isIf && isNilGuard(ifs, name, vs.Type) {
+			guards = append(guards, ifs)
+			return false
+		}
+		id, isIdent := n.(*ast.Ident)
+		if isIdent && id.Name == name && id != decl {
+			var write bool
+			write, ok = mapUse(stack, id)
+			written = written || write
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return guards, written, ok
+}
+
+// mapUse tells whether the identifier id, whose ancestors are path, refers
+// to a map in a way that can't tell a nil map from an empty one, and if so
+// whether it writes to it. Selections of fields and methods named like the
+// map don't refer to it.
+func mapUse(path []ast.Node, id *ast.Ident) (write, ok bool) {
+	switch p := path[len(path)-1].(type) {
+	case *ast.SelectorExpr:
+		return false, p.Sel == id
+	case *ast.RangeStmt:
+		return false, p.X == id
+	case *ast.CallExpr:
+		return false, len(p.Args) > 0 && p.Args[0] == id &&
+			(isIdent(p.Fun, "len") || isIdent(p.Fun, "delete") || isIdent(p.Fun, "clear"))
+	case *ast.IndexExpr:
+		if p.X != id {
+			return false, false
+		}
+		switch s := path[len(path)-2].(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range s.Lhs {
+				if lhs == p {
+					return true, s.Tok != token.DEFINE
+				}
+			}
+		case *ast.IncDecStmt:
+			return true, true
+		}
+		return false, true
+	}
+	return false, false
+}
+
+// isNilGuard reports whether ifs is if name == nil { name = make(typ) },
+// possibly with a size hint without side effects.
+func isNilGuard(ifs *ast.IfStmt, name string, typ ast.Expr) bool {
+	if ifs.Init != nil || ifs.Else != nil || len(ifs.Body.List) != 1 {
+		return false
+	}
+	cond, ok := ifs.Cond.(*ast.BinaryExpr)
+	if !ok || cond.Op != token.EQL ||
+		!(isIdent(cond.X, name) && isIdent(cond.Y, "nil") || isIdent(cond.X, "nil") && isIdent(cond.Y, name)) {
+		return false
+	}
+	as, ok := ifs.Body.List[0].(*ast.AssignStmt)
+	if !ok || as.Tok != token.ASSIGN || len(as.Lhs) != 1 || len(as.Rhs) != 1 || !isIdent(as.Lhs[0], name) {
+		return false
+	}
+	call, ok := as.Rhs[0].(*ast.CallExpr)
+	return ok && isIdent(call.Fun, "make") && len(call.Args) > 0 && len(call.Args) <= 2 && Equal(call.Args[0], typ) &&
+		(len(call.Args) == 1 || !HasSideEffects(call.Args[1]))
+}
@@ -0,0 +1,67 @@
+package astrewrite
+
+import "testing"
+
+func TestLazyMapInit(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func count(words []string) int {
+	var seen map[string]int
+	for _, w := range words {
+		if seen == nil {
+			seen = make(map[string]int, len(words))
+		}
+		seen[w]++
+	}
+	return len(seen)
+}
+
+func lookup(k string) string {
+	var names map[string]string
+	return names[k]
+}
+
+func build(keys []string) map[string]bool {
+	var set map[string]bool
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+`)
+
+	if n := LazyMapInit(findFunc(file, "count")); n != 1 {
+		t.Errorf("initialized %d maps in count, want 1", n)
+	}
+	if n := LazyMapInit(findFunc(file, "lookup")); n != 0 {
+		t.Errorf("initialized %d read-only maps, want 0", n)
+	}
+	if n := LazyMapInit(findFunc(file, "build")); n != 0 {
+		t.Errorf("initialized %d returned maps, want 0", n)
+	}
+
+	checkSource(t, fset, file, `package p
+
+func count(words []string) int {
+	var seen = make(map[string]int)
+	for _, w := range words {
+
+		seen[w]++
+	}
+	return len(seen)
+}
+
+func lookup(k string) string {
+	var names map[string]string
+	return names[k]
+}
+
+func build(keys []string) map[string]bool {
+	var set map[string]bool
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+`)
+}
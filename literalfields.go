@@ -0,0 +1,172 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// FieldOrder is an order of the fields of a struct literal.
+type FieldOrder int
+
+const (
+	// OrderByName orders the fields by name.
+	OrderByName FieldOrder = iota
+
+	// OrderByDeclaration orders the fields like the struct type declares
+	// them.
+	OrderByDeclaration
+)
+
+// SortLiteralFields sorts the elements of the keyed struct literal lit in
+// the given order and reports whether it did. Each element takes the place
+// of the one it replaces, so a single-line literal stays on a single line
+// and one with an element per line keeps that layout. fset is the FileSet
+// lit was parsed with. The type of lit is looked up in info for
+// OrderByDeclaration, which fails if it's unknown; info may be nil for
+// OrderByName.
+//
+// Literals with positional elements, elements spanning several lines, like
+// multi-line nested literals, or keys that aren't fields of the type are
+// left alone. Nested literals are moved along with their element, but not
+// sorted themselves. Comments inside lit keep their place, so callers
+// should leave literals with comments between elements alone.
+func SortLiteralFields(fset *token.FileSet, info *types.Info, lit *ast.CompositeLit, order FieldOrder) bool {
+	keys, ok := literalKeys(fset, lit)
+	if !ok {
+		return false
+	}
+
+	rank := func(name string) int { return 0 }
+	if order == OrderByDeclaration {
+		if info == nil {
+			return false
+		}
+		typ := info.TypeOf(lit)
+		if typ == nil {
+			return false
+		}
+		st, ok := typ.Underlying().(*types.Struct)
+		if !ok {
+			return false
+		}
+		index := make(map[string]int)
+		for i := 0; i < st.NumFields(); i++ {
+			index[st.Field(i).Name()] = i
+		}
+		for _, key := range keys {
+			if _, ok := index[key]; !ok {
+				return false
+			}
+		}
+		rank = func(name string) int { return index[name] }
+	}
+
+	slots := make([]token.Pos, len(lit.Elts))
+	for i, e := range lit.Elts {
+		slots[i] = e.Pos()
+	}
+	sort.SliceStable(lit.Elts, func(i, j int) bool {
+		a, b := lit.Elts[i].(*ast.KeyValueExpr).Key.(*ast.Ident).Name, lit.Elts[j].(*ast.KeyValueExpr).Key.(*ast.Ident).Name
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		return order == OrderByName && a < b
+	})
+	for i, e := range lit.Elts {
+		stampPositions(e, slots[i])
+	}
+	return true
+}
+
+// InsertLiteralField inserts kv into the keyed struct literal lit right
+// after the element with the key after, or first if after is empty, and
+// reports whether it did. fset is the FileSet lit was parsed with. kv is
+// put on the line of its neighbors in a single-line literal and on a line
+// of its own in a multi-line one, whose later elements move down a line
+// each, with the closing brace taking the line after it. That line must
+// exist in the file, which it does unless lit ends the file, and if it was
+// blank, the printed file loses it.
+//
+// Literals with positional elements or elements spanning several lines
+// are left alone, as are literals that already have an element with the key
+// of kv. The positions of kv are overwritten.
+func InsertLiteralField(fset *token.FileSet, lit *ast.CompositeLit, kv *ast.KeyValueExpr, after string) bool {
+	keys, ok := literalKeys(fset, lit)
+	key, isIdent := kv.Key.(*ast.Ident)
+	if !ok || !isIdent {
+		return false
+	}
+	i := 0
+	if after != "" {
+		i = -1
+	}
+	for j, k := range keys {
+		if k == key.Name {
+			return false
+		}
+		if k == after {
+			i = j + 1
+		}
+	}
+	if i < 0 {
+		return false
+	}
+
+	tf := fset.File(lit.Lbrace)
+	n := len(lit.Elts)
+	singleLine := tf.Line(lit.Lbrace) == tf.Line(lit.Rbrace)
+	if n > 0 {
+		singleLine = tf.Line(lit.Lbrace) == tf.Line(lit.Elts[0].Pos()) && tf.Line(lit.Lbrace) == tf.Line(lit.Elts[n-1].End())
+	}
+
+	elts := append(append(append([]ast.Expr(nil), lit.Elts[:i]...), kv), lit.Elts[i:]...)
+	if singleLine {
+		pos := lit.Lbrace
+		if i > 0 {
+			pos = lit.Elts[i-1].End()
+		}
+		placeAt(kv, pos)
+		lit.Elts = elts
+		return true
+	}
+
+	rbraceLine := tf.Line(lit.Rbrace)
+	if rbraceLine >= tf.LineCount() {
+		return false
+	}
+	slots := make([]token.Pos, 0, n+1)
+	for _, e := range lit.Elts[i:] {
+		slots = append(slots, e.Pos())
+	}
+	slots = append(slots, tf.LineStart(rbraceLine))
+	for j, e := range elts[i:] {
+		placeAt(e, slots[j])
+	}
+	lit.Rbrace = tf.LineStart(rbraceLine + 1)
+	lit.Elts = elts
+	return true
+}
+
+// literalKeys returns the keys of the elements of lit, which must all be
+// keyed by identifiers and fit on a single line.
+func literalKeys(fset *token.FileSet, lit *ast.CompositeLit) ([]string, bool) {
+	tf := fset.File(lit.Lbrace)
+	if tf == nil {
+		return nil, false
+	}
+	var keys []string
+	for _, e := range lit.Elts {
+		kv, ok := e.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, false
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok || tf.Line(e.Pos()) != tf.Line(e.End()) {
+			return nil, false
+		}
+		keys = append(keys, key.Name)
+	}
+	return keys, true
+}
@@ -0,0 +1,110 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+const literalsSrc = `package p
+
+type Config struct {
+	Name    string
+	Retries int
+	Inner   Inner
+	Debug   bool
+}
+
+type Inner struct{ B, A int }
+
+var single = Config{Retries: 3, Name: "x", Debug: true}
+
+var multi = Config{
+	Retries: 3,
+	Inner:   Inner{B: 1, A: 2},
+	Name:    "x",
+}
+
+var nested = Config{
+	Name: "x",
+	Inner: Inner{
+		B: 1,
+	},
+}
+
+func f() {}
+`
+
+// literals parses literalsSrc and returns the literal of each variable.
+func literals(t *testing.T) (*token.FileSet, *types.Info, map[string]*ast.CompositeLit) {
+	t.Helper()
+	fset, file := parse(t, literalsSrc)
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+	lits := make(map[string]*ast.CompositeLit)
+	for _, d := range file.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.VAR {
+			vs := gd.Specs[0].(*ast.ValueSpec)
+			lits[vs.Names[0].Name] = vs.Values[0].(*ast.CompositeLit)
+		}
+	}
+	return fset, info, lits
+}
+
+func TestSortLiteralFields(t *testing.T) {
+	fset, info, lits := literals(t)
+
+	if !SortLiteralFields(fset, info, lits["single"], OrderByName) {
+		t.Fatal("single-line literal not sorted")
+	}
+	checkSource(t, fset, lits["single"], `Config{Debug: true, Name: "x", Retries: 3}`)
+
+	if !SortLiteralFields(fset, info, lits["multi"], OrderByDeclaration) {
+		t.Fatal("multi-line literal not sorted")
+	}
+	checkSource(t, fset, lits["multi"], `Config{
+	Name:    "x",
+	Retries: 3,
+	Inner:   Inner{B: 1, A: 2},
+}`)
+
+	// the nested literal spans several lines
+	if SortLiteralFields(fset, info, lits["nested"], OrderByName) {
+		t.Error("literal with a multi-line element sorted")
+	}
+	if SortLiteralFields(fset, nil, lits["single"], OrderByDeclaration) {
+		t.Error("sorted by declaration without type info")
+	}
+}
+
+func TestInsertLiteralField(t *testing.T) {
+	fset, _, lits := literals(t)
+	kv := func(key, value string) *ast.KeyValueExpr {
+		return &ast.KeyValueExpr{Key: ast.NewIdent(key), Value: ast.NewIdent(value)}
+	}
+
+	if !InsertLiteralField(fset, lits["single"], kv("Inner", "Inner{}"), "Name") {
+		t.Fatal("not inserted into the single-line literal")
+	}
+	checkSource(t, fset, lits["single"], `Config{Retries: 3, Name: "x", Inner: Inner{}, Debug: true}`)
+
+	if !InsertLiteralField(fset, lits["multi"], kv("Debug", "true"), "Retries") {
+		t.Fatal("not inserted into the multi-line literal")
+	}
+	checkSource(t, fset, lits["multi"], `Config{
+	Retries: 3,
+	Debug:   true,
+	Inner:   Inner{B: 1, A: 2},
+	Name:    "x",
+}`)
+
+	if InsertLiteralField(fset, lits["multi"], kv("Name", `"y"`), "") {
+		t.Error("inserted a duplicate key")
+	}
+	if InsertLiteralField(fset, lits["multi"], kv("X", "1"), "Missing") {
+		t.Error("inserted after a missing key")
+	}
+}
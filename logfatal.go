@@ -0,0 +1,100 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// LogFatalToError turns the log.Fatal and log.Fatalf calls of fn, which
+// have no business in a library, into returns of an error made by
+// fmt.Errorf from the same message, along with the zero values of the
+// other results. It returns the number of calls converted.
+//
+// If fn doesn't return an error yet, an error result is added to it, named
+// if its results are, its returns get nil for the error, except for naked
+// returns of named results, and a function that had no results gets a
+// final return nil if needed. Calls in function literals are left alone,
+// since returning from them doesn't return from fn, and so are calls of fn,
+// which are up to the caller, like importing fmt into the file.
+//
+// It fails without changing anything if fn has no body, no calls to
+// convert or forwards the results of a call with return g().
+func LogFatalToError(fn *ast.FuncDecl) (int, error) {
+	if fn.Body == nil {
+		return 0, fmt.Errorf("astrewrite: %s has no body", fn.Name.Name)
+	}
+	results := fn.Type.Results
+	rets := returnStmts(fn.Body)
+	for _, ret := range rets {
+		if len(ret.Results) > 0 && len(ret.Results) != results.NumFields() {
+			return 0, fmt.Errorf("astrewrite: %s forwards the results of a call", fn.Name.Name)
+		}
+	}
+	fatals := logFatals(fn.Body)
+	if len(fatals) == 0 {
+		return 0, fmt.Errorf("astrewrite: %s has no log.Fatal calls", fn.Name.Name)
+	}
+
+	if n := results.NumFields(); n == 0 || !isIdent(results.List[len(results.List)-1].Type, "error") {
+		results = addErrorResult(fn, rets)
+	}
+	forEachStmtList(fn.Body, func(list []ast.Stmt) []ast.Stmt {
+		for i, s := range list {
+			if call, ok := fatals[s]; ok {
+				list[i] = &ast.ReturnStmt{Return: s.Pos(), Results: zeroResults(results, fatalError(call))}
+			}
+		}
+		return list
+	})
+	endWithReturn(fn)
+	return len(fatals), nil
+}
+
+// logFatals returns the statements of body that are calls of log.Fatal or
+// log.Fatalf, outside of function literals, mapped to the call.
+func logFatals(body *ast.BlockStmt) map[ast.Stmt]*ast.CallExpr {
+	fatals := make(map[ast.Stmt]*ast.CallExpr)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ExprStmt:
+			call, ok := n.X.(*ast.CallExpr)
+			if ok && (isQualified(call.Fun, "log", "Fatal") || isQualified(call.Fun, "log", "Fatalf") && len(call.Args) > 0) {
+				fatals[n] = call
+			}
+		}
+		return true
+	})
+	return fatals
+}
+
+// fatalError returns the fmt.Errorf call making an error of the message
+// call, a call of log.Fatal or log.Fatalf, would have logged.
+func fatalError(call *ast.CallExpr) *ast.CallExpr {
+	pos := call.Pos()
+	errorf := &ast.CallExpr{Fun: qualified("fmt", "Errorf", pos), Lparen: pos, Rparen: pos}
+	format := func(s string) *ast.BasicLit {
+		return &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: strconv.Quote(s)}
+	}
+	switch {
+	case call.Fun.(*ast.SelectorExpr).Sel.Name == "Fatalf":
+		errorf.Args, errorf.Ellipsis = call.Args, call.Ellipsis
+	case len(call.Args) == 1 && call.Ellipsis == token.NoPos:
+		// a constant message is kept as the format, unless it has verbs
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING && !strings.Contains(lit.Value, "%") {
+			errorf.Args = call.Args
+		} else {
+			errorf.Args = []ast.Expr{format("%v"), call.Args[0]}
+		}
+	default:
+		// log.Fatal formats like fmt.Sprint, which spaces operands unlike
+		// the verbs of fmt.Errorf do
+		sprint := &ast.CallExpr{Fun: qualified("fmt", "Sprint", pos), Lparen: pos, Args: call.Args, Ellipsis: call.Ellipsis, Rparen: pos}
+		errorf.Args = []ast.Expr{format("%s"), sprint}
+	}
+	return errorf
+}
@@ -0,0 +1,111 @@
+package astrewrite
+
+import "testing"
+
+func TestLogFatalToError(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func setup(path string) {
+	if path == "" {
+		log.Fatal("no path")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	go func() {
+		log.Fatal(run(f))
+	}()
+	if err := check(f); err != nil {
+		log.Fatal(err)
+	}
+	if !ready() {
+		log.Fatal("not ready:", path)
+	}
+}
+`)
+
+	n, err := LogFatalToError(findFunc(file, "setup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("converted %d calls, want 4", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func setup(path string) error {
+	if path == "" {
+		return fmt.Errorf("no path")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	go func() {
+		log.Fatal(run(f))
+	}()
+	if err := check(f); err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	if !ready() {
+		return fmt.Errorf("%s", fmt.Sprint("not ready:", path))
+	}
+	return nil
+}
+`)
+}
+
+func TestLogFatalToErrorReturningError(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func load(path string) (*Config, error) {
+	if path == "" {
+		return nil, errors.New("no path")
+	}
+	c, err := parse(path)
+	if err != nil {
+		log.Fatalf("parse %s: %v", path, err)
+	}
+	return c, nil
+}
+`)
+
+	n, err := LogFatalToError(findFunc(file, "load"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("converted %d calls, want 1", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func load(path string) (*Config, error) {
+	if path == "" {
+		return nil, errors.New("no path")
+	}
+	c, err := parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return c, nil
+}
+`)
+
+	_, file = parse(t, `package p
+
+func f() (int, error) {
+	return g()
+}
+
+func h() {}
+`)
+	if _, err := LogFatalToError(findFunc(file, "f")); err == nil {
+		t.Error("converted a function forwarding the results of a call")
+	}
+	if _, err := LogFatalToError(findFunc(file, "h")); err == nil {
+		t.Error("converted a function without log.Fatal calls")
+	}
+}
@@ -0,0 +1,184 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// UseMapsKeys replaces the loops below node collecting the keys or values of
+// a map into a slice by calls of slices.Collect over maps.Keys or
+// maps.Values, like
+//
+//	keys := make([]string, 0, len(m))
+//	for k := range m {
+//		keys = append(keys, k)
+//	}
+//
+// into keys := slices.Collect(maps.Keys(m)), and likewise for loops
+// appending v in for _, v := range m. The slice must be set right before
+// the loop, with make, with an empty composite literal or by a var
+// declaration without a value; loops doing anything but appending, like
+// filtering, are left alone. Without type information the ranged
+// expression is taken to be a map whose key or value type is the element
+// type of the slice; callers ranging over anything else have to filter
+// those themselves. Unlike the loop, slices.Collect returns nil for an
+// empty map.
+//
+// If node is a file, the imports of slices and maps are added to it if
+// needed and existing aliases of them are used; otherwise adding them is
+// up to the caller. It returns the number of replaced loops.
+func UseMapsKeys(node ast.Node) int {
+	file, _ := node.(*ast.File)
+	slicesPkg, slicesImported := importedAs(file, "slices")
+	mapsPkg, mapsImported := importedAs(file, "maps")
+	if !slicesImported && mentions(node, slicesPkg) || !mapsImported && mentions(node, mapsPkg) {
+		// the names are taken by something else
+		return 0
+	}
+
+	n := 0
+	forEachStmtList(node, func(list []ast.Stmt) []ast.Stmt {
+		var rewritten []ast.Stmt
+		for _, s := range list {
+			loop, ok := s.(*ast.RangeStmt)
+			if !ok || len(rewritten) == 0 {
+				rewritten = append(rewritten, s)
+				continue
+			}
+			slice, fn := collectLoop(loop)
+			if slice == nil || !resetsSlice(rewritten[len(rewritten)-1], slice.Name) {
+				rewritten = append(rewritten, s)
+				continue
+			}
+
+			// replaces the reset, so it takes its place
+			reset := rewritten[len(rewritten)-1]
+			pos, tok := reset.Pos(), token.DEFINE
+			if as, ok := reset.(*ast.AssignStmt); ok {
+				tok = as.Tok
+			}
+			stampPositions(loop.X, pos)
+			rewritten[len(rewritten)-1] = &ast.AssignStmt{
+				Lhs:    []ast.Expr{&ast.Ident{NamePos: pos, Name: slice.Name}},
+				TokPos: pos,
+				Tok:    tok,
+				Rhs: []ast.Expr{&ast.CallExpr{
+					Fun:    qualified(slicesPkg, "Collect", pos),
+					Lparen: pos,
+					Args: []ast.Expr{&ast.CallExpr{
+						Fun:    qualified(mapsPkg, fn, pos),
+						Lparen: pos,
+						Args:   []ast.Expr{loop.X},
+						Rparen: pos,
+					}},
+					Rparen: pos,
+				}},
+			}
+			n++
+		}
+		return rewritten
+	})
+
+	if n > 0 && file != nil {
+		if !slicesImported {
+			AddImport(file, "slices")
+		}
+		if !mapsImported {
+			AddImport(file, "maps")
+		}
+	}
+	return n
+}
+
+// collectLoop returns the slice loop appends the keys or values of the
+// ranged map to, along with the function of package maps iterating over
+// them.
+func collectLoop(loop *ast.RangeStmt) (*ast.Ident, string) {
+	if loop.Tok != token.DEFINE || len(loop.Body.List) != 1 {
+		return nil, ""
+	}
+	key, _ := loop.Key.(*ast.Ident)
+	value, _ := loop.Value.(*ast.Ident)
+	var elem *ast.Ident
+	fn := "Keys"
+	switch {
+	case key != nil && key.Name != "_" && loop.Value == nil:
+		elem = key
+	case key != nil && key.Name == "_" && value != nil && value.Name != "_":
+		elem, fn = value, "Values"
+	default:
+		return nil, ""
+	}
+
+	as, ok := loop.Body.List[0].(*ast.AssignStmt)
+	if !ok || !singleAssign(as) {
+		return nil, ""
+	}
+	slice, ok := as.Lhs[0].(*ast.Ident)
+	if !ok || slice.Name == "_" || mentions(loop.X, slice.Name) || mentions(loop.X, elem.Name) {
+		return nil, ""
+	}
+	call, ok := as.Rhs[0].(*ast.CallExpr)
+	if !ok || !isIdent(call.Fun, "append") || call.Ellipsis.IsValid() || len(call.Args) != 2 {
+		return nil, ""
+	}
+	if !isIdent(call.Args[0], slice.Name) || !isIdent(call.Args[1], elem.Name) {
+		return nil, ""
+	}
+	return slice, fn
+}
+
+// resetsSlice reports whether s sets the slice named name to an empty
+// slice, or declares it without a value.
+func resetsSlice(s ast.Stmt, name string) bool {
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		return len(s.Lhs) == 1 && len(s.Rhs) == 1 && isIdent(s.Lhs[0], name) && emptySlice(s.Rhs[0])
+	case *ast.DeclStmt:
+		gd, ok := s.Decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR || len(gd.Specs) != 1 {
+			return false
+		}
+		vs := gd.Specs[0].(*ast.ValueSpec)
+		if len(vs.Names) != 1 || vs.Names[0].Name != name {
+			return false
+		}
+		if len(vs.Values) == 0 {
+			_, ok := vs.Type.(*ast.ArrayType)
+			return ok
+		}
+		return vs.Type == nil && emptySlice(vs.Values[0])
+	}
+	return false
+}
+
+// emptySlice reports whether e makes an empty slice, with make or a
+// composite literal without elements.
+func emptySlice(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.CompositeLit:
+		at, ok := e.Type.(*ast.ArrayType)
+		return ok && at.Len == nil && len(e.Elts) == 0
+	case *ast.CallExpr:
+		if !isIdent(e.Fun, "make") || len(e.Args) < 2 {
+			return false
+		}
+		for _, arg := range e.Args[2:] {
+			if HasSideEffects(arg) {
+				return false
+			}
+		}
+		at, ok := e.Args[0].(*ast.ArrayType)
+		if !ok || at.Len != nil {
+			return false
+		}
+		lit, ok := e.Args[1].(*ast.BasicLit)
+		return ok && lit.Value == "0"
+	}
+	return false
+}
+
+// qualified returns the selector pkg.name placed at pos.
+func qualified(pkg, name string, pos token.Pos) *ast.SelectorExpr {
+	return &ast.SelectorExpr{X: &ast.Ident{NamePos: pos, Name: pkg}, Sel: &ast.Ident{NamePos: pos, Name: name}}
+}
@@ -0,0 +1,75 @@
+package astrewrite
+
+import "testing"
+
+func TestUseMapsKeys(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "fmt"
+
+func f(m map[string]int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	var values []int
+	for _, v := range m {
+		values = append(values, v)
+	}
+	fmt.Println(keys, values)
+}
+
+func g(m map[string]int) []string {
+	keys := []string{}
+	for k, v := range m {
+		if v > 0 {
+			keys = append(keys, k)
+		}
+	}
+	var more []string
+	for k := range m {
+		if k != "" {
+			more = append(more, k)
+		}
+	}
+	return append(keys, more...)
+}
+`)
+
+	if n := UseMapsKeys(file); n != 2 {
+		t.Errorf("replaced %d loops, want 2", n)
+	}
+	// the replaced loops leave blank lines behind
+	checkSource(t, fset, file, `package p
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+func f(m map[string]int) {
+	keys := slices.Collect(maps.Keys(m))
+
+	values := slices.Collect(maps.Values(m))
+
+	fmt.Println(keys, values)
+}
+
+func g(m map[string]int) []string {
+	keys := []string{}
+	for k, v := range m {
+		if v > 0 {
+			keys = append(keys, k)
+		}
+	}
+	var more []string
+	for k := range m {
+		if k != "" {
+			more = append(more, k)
+		}
+	}
+	return append(keys, more...)
+}
+`)
+}
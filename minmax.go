@@ -0,0 +1,117 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// UseMinMaxBuiltins replaces the if statements below node that assign the
+// smaller or larger of two operands to a variable by calls of the min and
+// max builtins, like
+//
+//	if a > b {
+//		m = a
+//	} else {
+//		m = b
+//	}
+//
+// into m = max(a, b). Both branches must consist of a single assignment to
+// the same target, one of each operand, and the condition must compare the
+// operands with <, <=, > or >=. An if without an else branch is left alone,
+// as it only assigns in one case, and so are else ifs and operands and
+// targets with side effects, which the if evaluates a different number of
+// times. If min or max is declared in node, or the target mentions it, it's
+// not used either. For floating-point operands the builtins differ when an
+// operand is NaN, which callers with type information have to rule out
+// themselves. It returns the number of replaced ifs.
+func UseMinMaxBuiltins(node ast.Node) int {
+	shadowed := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Obj != nil && (id.Name == "min" || id.Name == "max") {
+			shadowed[id.Name] = true
+		}
+		return true
+	})
+
+	n := 0
+	elseIfs := make(map[ast.Stmt]bool)
+	Walk(node, func(node ast.Node) (ast.Node, bool) {
+		ifs, ok := node.(*ast.IfStmt)
+		if !ok {
+			return node, true
+		}
+		// an else if can't become an assignment
+		elseIfs[ifs.Else] = true
+		if elseIfs[ifs] {
+			return node, true
+		}
+		as, fn := minMaxAssign(ifs)
+		if as == nil || shadowed[fn] || mentions(as.Lhs[0], fn) {
+			return node, true
+		}
+		cond := ifs.Cond.(*ast.BinaryExpr)
+		pos := ifs.If
+		as.Rhs = []ast.Expr{&ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: pos, Name: fn},
+			Lparen: pos,
+			Args:   []ast.Expr{cond.X, cond.Y},
+			Rparen: pos,
+		}}
+		stampPositions(as, pos)
+		n++
+		return as, false
+	})
+	return n
+}
+
+// minMaxAssign returns the assignment of the then branch of ifs and the
+// builtin it computes, if ifs assigns the smaller or larger of two operands.
+func minMaxAssign(ifs *ast.IfStmt) (*ast.AssignStmt, string) {
+	if ifs.Init != nil || ifs.Else == nil {
+		return nil, ""
+	}
+	els, ok := ifs.Else.(*ast.BlockStmt)
+	if !ok || len(ifs.Body.List) != 1 || len(els.List) != 1 {
+		return nil, ""
+	}
+	cond, ok := ifs.Cond.(*ast.BinaryExpr)
+	if !ok || HasSideEffects(cond.X) || HasSideEffects(cond.Y) {
+		return nil, ""
+	}
+	less := false
+	switch cond.Op {
+	case token.LSS, token.LEQ:
+		less = true
+	case token.GTR, token.GEQ:
+	default:
+		return nil, ""
+	}
+
+	then, ok := ifs.Body.List[0].(*ast.AssignStmt)
+	other, ok2 := els.List[0].(*ast.AssignStmt)
+	if !ok || !ok2 || !singleAssign(then) || !singleAssign(other) {
+		return nil, ""
+	}
+	if !Equal(then.Lhs[0], other.Lhs[0]) || HasSideEffects(then.Lhs[0]) {
+		return nil, ""
+	}
+
+	// with a < b, assigning a makes for the smaller one
+	var takesX bool
+	switch {
+	case Equal(then.Rhs[0], cond.X) && Equal(other.Rhs[0], cond.Y):
+		takesX = true
+	case Equal(then.Rhs[0], cond.Y) && Equal(other.Rhs[0], cond.X):
+	default:
+		return nil, ""
+	}
+	if takesX == less {
+		return then, "min"
+	}
+	return then, "max"
+}
+
+// singleAssign reports whether as assigns a single value with =.
+func singleAssign(as *ast.AssignStmt) bool {
+	return as.Tok == token.ASSIGN && len(as.Lhs) == 1 && len(as.Rhs) == 1
+}
@@ -0,0 +1,96 @@
+package astrewrite
+
+import "testing"
+
+func TestUseMinMaxBuiltins(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(a, b int, xs []int) {
+	var hi, lo, m int
+	if a > b {
+		hi = a
+	} else {
+		hi = b
+	}
+	if a <= b {
+		lo = a
+	} else {
+		lo = b
+	}
+	if xs[0] >= a {
+		m = a
+	} else {
+		m = xs[0]
+	}
+	if a > b {
+		m = a
+	}
+	if a > next() {
+		m = a
+	} else {
+		m = next()
+	}
+	if a > b {
+		hi = a
+	} else {
+		lo = b
+	}
+	if a == b {
+		m = a
+	} else if a > b {
+		m = a
+	} else {
+		m = b
+	}
+}
+`)
+
+	if n := UseMinMaxBuiltins(file); n != 3 {
+		t.Errorf("replaced %d ifs, want 3", n)
+	}
+	checkSource(t, fset, findFunc(file, "f"), `func f(a, b int, xs []int) {
+	var hi, lo, m int
+	hi = max(a, b)
+
+	lo = min(a, b)
+
+	m = min(xs[0], a)
+
+	if a > b {
+		m = a
+	}
+	if a > next() {
+		m = a
+	} else {
+		m = next()
+	}
+	if a > b {
+		hi = a
+	} else {
+		lo = b
+	}
+	if a == b {
+		m = a
+	} else if a > b {
+		m = a
+	} else {
+		m = b
+	}
+}`)
+
+	_, file = parse(t, `package p
+
+func g(a, b int) int {
+	max := 0
+	if a > b {
+		max = a
+	} else {
+		max = b
+	}
+	return max
+}
+`)
+	if n := UseMinMaxBuiltins(file); n != 0 {
+		t.Errorf("replaced %d ifs with a shadowed max, want 0", n)
+	}
+}
@@ -0,0 +1,140 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// ModuleReport describes what RewriteModulePath did.
+type ModuleReport struct {
+	// Imports is the number of rewritten import paths.
+	Imports int
+
+	// Strings is the number of rewritten string literals.
+	Strings int
+
+	// Aliased holds the imports that got the name they had before as an
+	// alias, since the default name of the new path differs.
+	Aliased []*ast.ImportSpec
+
+	// Comments holds the comments mentioning the old path, which are left
+	// alone, like //go:generate directives.
+	Comments []*ast.Comment
+}
+
+// ModOption configures RewriteModulePath.
+type ModOption func(*modConfig)
+
+type modConfig struct {
+	strings func(lit *ast.BasicLit) bool
+}
+
+// ModStrings makes RewriteModulePath rewrite the occurrences of the path in
+// the string literals match returns true for, like embedded build info
+// checks. Import paths aren't passed to match.
+func ModStrings(match func(lit *ast.BasicLit) bool) ModOption {
+	return func(c *modConfig) {
+		c.strings = match
+	}
+}
+
+// RewriteModulePath replaces the module path oldPrefix by newPrefix in the
+// import paths of files. Only whole path elements match, so example.com/foo
+// matches example.com/foo and example.com/foo/bar, but not
+// example.com/foobar. An import whose default package name changes, as with
+// example.com/foo becoming example.com/bar, gets its former name as an alias
+// so that its qualifiers stay valid, and an alias that turns into the
+// default name is dropped.
+//
+// String literals are only rewritten if enabled with ModStrings. Comments
+// mentioning oldPrefix are never changed, but reported.
+func RewriteModulePath(files []*ast.File, oldPrefix, newPrefix string, opts ...ModOption) ModuleReport {
+	var c modConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	var report ModuleReport
+	for _, f := range files {
+		paths := make(map[*ast.BasicLit]bool)
+		for _, imp := range f.Imports {
+			paths[imp.Path] = true
+			path := importPath(imp)
+			if path != oldPrefix && !strings.HasPrefix(path, oldPrefix+"/") {
+				continue
+			}
+			newPath := newPrefix + strings.TrimPrefix(path, oldPrefix)
+			oldName, newName := defaultImportName(path), defaultImportName(newPath)
+			switch {
+			case imp.Name == nil && oldName != newName:
+				imp.Name = &ast.Ident{NamePos: imp.Path.Pos(), Name: oldName}
+				report.Aliased = append(report.Aliased, imp)
+			case imp.Name != nil && imp.Name.Name == newName:
+				imp.Name = nil
+			}
+			imp.Path.Value = strconv.Quote(newPath)
+			report.Imports++
+		}
+
+		if c.strings != nil {
+			ast.Inspect(f, func(n ast.Node) bool {
+				lit, ok := n.(*ast.BasicLit)
+				if !ok || paths[lit] || !c.strings(lit) {
+					return true
+				}
+				value, err := StringValue(lit)
+				if err != nil {
+					return true
+				}
+				if s, n := replaceModulePath(value, oldPrefix, newPrefix); n > 0 {
+					SetStringValue(lit, s, false)
+					report.Strings++
+				}
+				return true
+			})
+		}
+
+		for _, cg := range f.Comments {
+			for _, cm := range cg.List {
+				if _, n := replaceModulePath(cm.Text, oldPrefix, ""); n > 0 {
+					report.Comments = append(report.Comments, cm)
+				}
+			}
+		}
+	}
+	return report
+}
+
+// replaceModulePath replaces the occurrences of the module path old in s
+// that are whole path elements by new, and returns the result along with the
+// number of replacements.
+func replaceModulePath(s, old, new string) (string, int) {
+	if old == "" {
+		return s, 0
+	}
+	var sb strings.Builder
+	n := 0
+	for {
+		i := strings.Index(s, old)
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), n
+		}
+		end := i + len(old)
+		if (i > 0 && isPathByte(s[i-1])) || (end < len(s) && isPathByte(s[end]) && s[end] != '/') {
+			sb.WriteString(s[:end])
+			s = s[end:]
+			continue
+		}
+		sb.WriteString(s[:i])
+		sb.WriteString(new)
+		s = s[end:]
+		n++
+	}
+}
+
+// isPathByte reports whether b can be part of a path element.
+func isPathByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("-._~/", b) >= 0
+}
@@ -0,0 +1,99 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"strings"
+	"testing"
+)
+
+// modGenerate is split so that go generate doesn't run it.
+const modGenerate = "//go:" + "generate go run example.com/mod/cmd/gen -out example.com/modx.go"
+
+func TestRewriteModulePath(t *testing.T) {
+	src := `package p
+
+` + modGenerate + `
+
+import (
+	"example.com/mod"
+	"example.com/mod/sub/pkg"
+	util "example.com/mod/util"
+	"example.com/modx"
+)
+
+const self = "example.com/mod/sub"
+
+var (
+	_ = mod.X
+	_ = pkg.Y
+	_ = util.Z
+	_ = modx.W
+	_ = "see example.com/modx and example.com/mod@v1"
+)
+`
+	fset, file := parse(t, src)
+	report := RewriteModulePath([]*ast.File{file}, "example.com/mod", "example.org/newmod")
+	checkSource(t, fset, file, `package p
+
+`+modGenerate+`
+
+import (
+	"example.com/modx"
+	mod "example.org/newmod"
+	"example.org/newmod/sub/pkg"
+	"example.org/newmod/util"
+)
+
+const self = "example.com/mod/sub"
+
+var (
+	_ = mod.X
+	_ = pkg.Y
+	_ = util.Z
+	_ = modx.W
+	_ = "see example.com/modx and example.com/mod@v1"
+)
+`)
+	if report.Imports != 3 || report.Strings != 0 {
+		t.Errorf("got %d imports and %d strings, want 3 and 0", report.Imports, report.Strings)
+	}
+	if len(report.Aliased) != 1 || report.Aliased[0].Name.Name != "mod" {
+		t.Errorf("got aliased %v, want mod", report.Aliased)
+	}
+	if len(report.Comments) != 1 || !strings.HasPrefix(report.Comments[0].Text, "//go:generate") {
+		t.Errorf("got comments %v, want the go:generate line", report.Comments)
+	}
+
+	// a nested module with the strings that mention it
+	fset, file = parse(t, src)
+	report = RewriteModulePath([]*ast.File{file}, "example.com/mod/sub", "example.com/sub", ModStrings(func(*ast.BasicLit) bool { return true }))
+	checkSource(t, fset, file, `package p
+
+`+modGenerate+`
+
+import (
+	"example.com/mod"
+	util "example.com/mod/util"
+	"example.com/modx"
+	"example.com/sub/pkg"
+)
+
+const self = "example.com/sub"
+
+var (
+	_ = mod.X
+	_ = pkg.Y
+	_ = util.Z
+	_ = modx.W
+	_ = "see example.com/modx and example.com/mod@v1"
+)
+`)
+	if report.Imports != 1 || report.Strings != 1 || len(report.Aliased) != 0 || len(report.Comments) != 0 {
+		t.Errorf("got report %+v", report)
+	}
+
+	// only whole path elements of strings are rewritten
+	if s, n := replaceModulePath("see example.com/modx and example.com/mod@v1 or xexample.com/mod", "example.com/mod", "m"); n != 1 || s != "see example.com/modx and m@v1 or xexample.com/mod" {
+		t.Errorf("got %q, %d", s, n)
+	}
+}
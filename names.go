@@ -0,0 +1,50 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"strconv"
+)
+
+// NameGen generates identifiers that don't collide with the identifiers of
+// a tree, or with each other.
+type NameGen struct {
+	used map[string]bool
+}
+
+// NewNameGen returns a NameGen avoiding all identifiers used below root.
+func NewNameGen(root ast.Node) *NameGen {
+	g := &NameGen{used: make(map[string]bool)}
+	if !isNil(root) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				g.used[id.Name] = true
+			}
+			return true
+		})
+	}
+	return g
+}
+
+// Reserve marks names as used.
+func (g *NameGen) Reserve(names ...string) {
+	for _, name := range names {
+		g.used[name] = true
+	}
+}
+
+// Name returns base, or base followed by the smallest number making it
+// unused, and reserves it.
+func (g *NameGen) Name(base string) string {
+	name := base
+	for i := 1; g.used[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	g.used[name] = true
+	return name
+}
+
+// unusedName returns base, or base followed by a number, so that no
+// identifier below root has that name.
+func unusedName(root ast.Node, base string) string {
+	return NewNameGen(root).Name(base)
+}
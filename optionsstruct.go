@@ -0,0 +1,214 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ToOptionsStruct turns the parameters of the function funcName declared in
+// file into the fields of an options struct, named funcName + "Options",
+// which the function takes instead:
+//
+//	func F(verbose bool, retries int)
+//
+// becomes
+//
+//	type FOptions struct {
+//		Verbose bool
+//		Retries int
+//	}
+//
+//	func F(opts FOptions)
+//
+// References to the parameters in the body become field selectors, and
+// calls of the function in file become calls with a composite literal,
+// leaving out arguments that are the zero value of their parameter, like
+// false for a bool or nil. Calls are matched by name; uses of the function
+// other than calls, calls passing a multi-valued call, and calls in other
+// files are left alone. Parameter references are found through the objects
+// of the parser, so file must have been parsed with object resolution, and
+// keys of composite literals are never treated as references. The options
+// type is declared right before the function and returned.
+func ToOptionsStruct(file *ast.File, funcName string) (*ast.TypeSpec, error) {
+	var fd *ast.FuncDecl
+	for _, d := range file.Decls {
+		if f, ok := d.(*ast.FuncDecl); ok && f.Recv == nil && f.Name.Name == funcName {
+			fd = f
+			break
+		}
+	}
+	if fd == nil {
+		return nil, fmt.Errorf("astrewrite: function %s not found", funcName)
+	}
+	if len(fd.Type.Params.List) == 0 {
+		return nil, fmt.Errorf("astrewrite: function %s has no parameters", funcName)
+	}
+
+	typeName := funcName + "Options"
+	declared := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == typeName {
+			declared = true
+		}
+		return !declared
+	})
+	if declared {
+		return nil, fmt.Errorf("astrewrite: %s is already declared", typeName)
+	}
+
+	var (
+		fields  []*ast.Field
+		types   []ast.Expr // the type of each parameter
+		names   []string   // the field name of each parameter
+		objects = make(map[*ast.Object]string)
+		taken   = make(map[string]bool)
+	)
+	for _, p := range fd.Type.Params.List {
+		if len(p.Names) == 0 {
+			return nil, fmt.Errorf("astrewrite: function %s has unnamed parameters", funcName)
+		}
+		if _, ok := p.Type.(*ast.Ellipsis); ok {
+			return nil, fmt.Errorf("astrewrite: function %s is variadic", funcName)
+		}
+		field := &ast.Field{Type: Clone(p.Type).(ast.Expr)}
+		for _, id := range p.Names {
+			name := exportedName(id.Name)
+			if id.Name == "_" || taken[name] {
+				return nil, fmt.Errorf("astrewrite: can't name field for parameter %s of %s", id.Name, funcName)
+			}
+			taken[name] = true
+			field.Names = append(field.Names, ast.NewIdent(name))
+			types = append(types, p.Type)
+			names = append(names, name)
+			if id.Obj != nil {
+				objects[id.Obj] = name
+			}
+		}
+		fields = append(fields, field)
+	}
+
+	// rewrite the body
+	opts := unusedName(fd, "opts")
+	if fd.Body != nil {
+		keys := make(map[ast.Node]bool)
+		Walk(fd.Body, func(n ast.Node) (ast.Node, bool) {
+			switch n := n.(type) {
+			case *ast.CompositeLit:
+				for _, e := range n.Elts {
+					if kv, ok := e.(*ast.KeyValueExpr); ok {
+						keys[kv.Key] = true
+					}
+				}
+			case *ast.Ident:
+				if field, ok := objects[n.Obj]; ok && n.Obj != nil && !keys[n] {
+					return &ast.SelectorExpr{
+						X:   &ast.Ident{NamePos: n.NamePos, Name: opts},
+						Sel: &ast.Ident{NamePos: n.NamePos, Name: field},
+					}, false
+				}
+			}
+			return n, true
+		})
+	}
+
+	// rewrite the signature
+	params := fd.Type.Params
+	params.List = []*ast.Field{{
+		Names: []*ast.Ident{{NamePos: params.List[0].Pos(), Name: opts}},
+		Type:  &ast.Ident{NamePos: params.List[0].Pos(), Name: typeName},
+	}}
+
+	// declare the options type, positioned at the end of the previous
+	// declaration so that it's printed before the doc comment of fd
+	spec := &ast.TypeSpec{
+		Name: ast.NewIdent(typeName),
+		Type: &ast.StructType{Fields: &ast.FieldList{List: fields}},
+	}
+	decl := &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{spec}}
+	for i, d := range file.Decls {
+		if d == fd {
+			pos := file.Name.End()
+			if i > 0 {
+				pos = file.Decls[i-1].End()
+			}
+			mapPositions(decl, func(token.Pos) token.Pos { return pos })
+			decl.Lparen, decl.Rparen, spec.Assign = token.NoPos, token.NoPos, token.NoPos
+			file.Decls = append(file.Decls[:i], append([]ast.Decl{decl}, file.Decls[i:]...)...)
+			break
+		}
+	}
+
+	// rewrite the calls
+	Walk(file, func(n ast.Node) (ast.Node, bool) {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return n, true
+		}
+		id, ok := call.Fun.(*ast.Ident)
+		if !ok || id.Name != funcName || (id.Obj != nil && id.Obj.Decl != fd) ||
+			call.Ellipsis.IsValid() || len(call.Args) != len(names) {
+			return n, true
+		}
+		lit := &ast.CompositeLit{
+			Type:   &ast.Ident{NamePos: call.Lparen, Name: typeName},
+			Lbrace: call.Lparen,
+			Rbrace: call.Rparen,
+		}
+		for i, arg := range call.Args {
+			if isZeroValue(arg, types[i]) {
+				continue
+			}
+			lit.Elts = append(lit.Elts, &ast.KeyValueExpr{
+				Key:   &ast.Ident{NamePos: arg.Pos(), Name: names[i]},
+				Colon: arg.Pos(),
+				Value: arg,
+			})
+		}
+		call.Args = []ast.Expr{lit}
+		return call, true
+	})
+
+	return spec, nil
+}
+
+// exportedName returns name with its first letter in upper case.
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// basicTypes holds the predeclared types whose zero value is written as a
+// zero literal or false.
+var basicTypes = map[string]bool{
+	"bool": true, "string": true, "byte": true, "rune": true, "uintptr": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+}
+
+// isZeroValue reports whether e is the literal zero value of typ. Literals
+// only count for predeclared types, since a named type might be an interface
+// for which 0 isn't the zero value.
+func isZeroValue(e ast.Expr, typ ast.Expr) bool {
+	if id, ok := e.(*ast.Ident); ok && id.Name == "nil" {
+		return true
+	}
+	if t, ok := typ.(*ast.Ident); !ok || !basicTypes[t.Name] {
+		return false
+	}
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name == "false"
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			return e.Value == `""` || e.Value == "``"
+		}
+		v := constant.MakeFromLiteral(e.Value, e.Kind, 0)
+		return v.Kind() != constant.Unknown && constant.Sign(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package astrewrite
+
+import "testing"
+
+func TestToOptionsStruct(t *testing.T) {
+	fset, file := parse(t, `package p
+
+// F does things.
+func F(verbose bool, retries int, name string) error {
+	for retries > 0 {
+		if verbose {
+			println(name, T{name: "x"})
+		}
+		retries--
+	}
+	return nil
+}
+
+func main() {
+	F(true, 3, "a")
+	F(false, 0, "")
+	F(verbose(), 0x0, name)
+}
+`)
+
+	spec, err := ToOptionsStruct(file, "F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name.Name != "FOptions" {
+		t.Errorf("got type %s, want FOptions", spec.Name.Name)
+	}
+	checkSource(t, fset, file, `package p
+
+type FOptions struct {
+	Verbose bool
+	Retries int
+	Name    string
+}
+
+// F does things.
+func F(opts FOptions) error {
+	for opts.Retries > 0 {
+		if opts.Verbose {
+			println(opts.Name, T{name: "x"})
+		}
+		opts.Retries--
+	}
+	return nil
+}
+
+func main() {
+	F(FOptions{Verbose: true, Retries: 3, Name: "a"})
+	F(FOptions{})
+	F(FOptions{Verbose: verbose(), Name: name})
+}
+`)
+}
+
+func TestToOptionsStructErrors(t *testing.T) {
+	for _, src := range []string{
+		`package p; func G(a int) {}`,
+		`package p; func F() {}`,
+		`package p; func F(int, string) {}`,
+		`package p; func F(a ...int) {}`,
+		`package p; func F(a, A int) {}`,
+		`package p; type FOptions int; func F(a int) {}`,
+	} {
+		_, file := parse(t, src)
+		if _, err := ToOptionsStruct(file, "F"); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Hazard describes an edit that may change what a program does by changing
+// when expressions with side effects are evaluated.
+type Hazard struct {
+	// Edit is the edit at fault.
+	Edit Edit
+
+	// Pos is the position the expression evaluated out of order or more
+	// than once had before the edit.
+	Pos token.Pos
+
+	// Before is the position an expression now evaluated after the one at
+	// Pos, although it used to be evaluated first, had before the edit,
+	// or NoPos if the expression at Pos is duplicated.
+	Before token.Pos
+
+	// Reason explains the hazard.
+	Reason string
+}
+
+// OrderHazards reports the edits among edits that reorder or duplicate the
+// expressions with side effects they move, as told by HasSideEffects: the
+// calls in a migration swapping the arguments of f(a(), b()), a call hoisted
+// out of a statement past another one, or a call copied with Clone. Go
+// evaluates the calls and receives of a statement in lexical left to right
+// order, the operands of a call or receive before it, so the order moved
+// expressions used to be evaluated in is that of the end of their positions,
+// which moved and copied nodes keep, while new nodes have none and are
+// ignored. The statements of a replacement are taken in order and function
+// literals are skipped, as they don't run where they're written.
+//
+// The analysis is conservative: expressions evaluated conditionally, like
+// the right operand of &&, count as evaluated, so some hazards can't
+// happen. Since edits don't hold the nodes they replace, dropping an
+// expression with side effects, like an operand collapsed away, isn't
+// reported, and neither are deletions.
+func OrderHazards(edits []Edit) []Hazard {
+	var hazards []Hazard
+	for _, e := range edits {
+		if isNil(e.Node) {
+			continue
+		}
+		evals := evaluations(e.Node, nil)
+
+		seen := make(map[[2]token.Pos]bool)
+		for i, x := range evals {
+			key := [2]token.Pos{x.Pos(), x.End()}
+			if seen[key] {
+				hazards = append(hazards, Hazard{
+					Edit:   e,
+					Pos:    x.Pos(),
+					Reason: fmt.Sprintf("%s is evaluated more than once", types.ExprString(x)),
+				})
+				continue
+			}
+			seen[key] = true
+			for _, y := range evals[i+1:] {
+				if y.End() < x.End() {
+					hazards = append(hazards, Hazard{
+						Edit:   e,
+						Pos:    x.Pos(),
+						Before: y.Pos(),
+						Reason: fmt.Sprintf("%s is now evaluated before %s, which used to be evaluated first", types.ExprString(x), types.ExprString(y)),
+					})
+				}
+			}
+		}
+	}
+	return hazards
+}
+
+// evaluations appends the calls and receives with side effects below node
+// that have positions to evals, in the order Go evaluates them, and returns
+// the result.
+func evaluations(node ast.Node, evals []ast.Expr) []ast.Expr {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			evals = evaluations(n.Fun, evals)
+			for _, arg := range n.Args {
+				evals = evaluations(arg, evals)
+			}
+			if !pureBuiltins[calleeName(n)] && n.Pos().IsValid() && n.Rparen.IsValid() {
+				evals = append(evals, n)
+			}
+			return false
+		case *ast.UnaryExpr:
+			if n.Op != token.ARROW {
+				return true
+			}
+			evals = evaluations(n.X, evals)
+			if n.OpPos.IsValid() && n.X.End().IsValid() {
+				evals = append(evals, n)
+			}
+			return false
+		}
+		return true
+	})
+	return evals
+}
@@ -0,0 +1,75 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+)
+
+func TestOrderHazards(t *testing.T) {
+	// the migration of Copy(dst, src) to CopyFrom(src, dst)
+	migrate := func(n ast.Node) (ast.Node, bool) {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isIdent(call.Fun, "Copy") {
+			return n, true
+		}
+		return &ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: call.Pos(), Name: "CopyFrom"},
+			Lparen: call.Lparen,
+			Args:   []ast.Expr{call.Args[1], call.Args[0]},
+			Rparen: call.Rparen,
+		}, false
+	}
+
+	_, file := parse(t, `package p
+
+func f() {
+	Copy(dst(), src())
+}
+`)
+	_, edits := WalkEdits(file, migrate)
+	hazards := OrderHazards(edits)
+	if len(hazards) != 1 {
+		t.Fatalf("got hazards %v, want one", hazards)
+	}
+	if got, want := hazards[0].Reason, "src() is now evaluated before dst(), which used to be evaluated first"; got != want {
+		t.Errorf("got reason %q, want %q", got, want)
+	}
+
+	_, file = parse(t, `package p
+
+func f() {
+	Copy(dst, src)
+	Copy(dst, src())
+}
+`)
+	_, edits = WalkEdits(file, migrate)
+	if len(edits) != 2 {
+		t.Fatalf("got %d edits, want 2", len(edits))
+	}
+	if hazards := OrderHazards(edits); len(hazards) != 0 {
+		t.Errorf("got hazards %v, want none", hazards)
+	}
+}
+
+func TestOrderHazardsDuplicate(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() {
+	_ = square(next())
+	_ = square(n)
+}
+`)
+	_, edits := WalkEdits(file, func(n ast.Node) (ast.Node, bool) {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isIdent(call.Fun, "square") {
+			return n, true
+		}
+		x := call.Args[0]
+		return &ast.BinaryExpr{X: x, OpPos: x.End(), Op: token.MUL, Y: Clone(x).(ast.Expr)}, false
+	})
+	hazards := OrderHazards(edits)
+	if len(hazards) != 1 || hazards[0].Before.IsValid() {
+		t.Errorf("got hazards %v, want next() evaluated twice", hazards)
+	}
+}
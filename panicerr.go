@@ -0,0 +1,362 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// PanicReport describes what PanicValidationToError did.
+type PanicReport struct {
+	// Panics is the number of panics turned into returned errors.
+	Panics int
+
+	// Calls is the number of calls updated to check the error.
+	Calls int
+
+	// Skipped holds the calls of the function left alone, in source order,
+	// which have to be updated by hand: those that aren't a statement of
+	// their own or the only value of a short variable declaration, like
+	// g(f()), return f() or x = f().
+	Skipped []*ast.CallExpr
+}
+
+// PanicOption configures PanicValidationToError.
+type PanicOption func(*panicConfig)
+
+type panicConfig struct {
+	onError func(caller *ast.FuncType, err *ast.Ident) []ast.Stmt
+}
+
+// OnCallError sets the statements updated calls run when the function
+// returns an error, as returned by handle for the type of the function or
+// function literal making the call and the variable holding the error.
+//
+// By default, callers whose last result is an error return it, along with
+// the zero values of their other results, and other callers panic with
+// it, like the function used to.
+func OnCallError(handle func(caller *ast.FuncType, err *ast.Ident) []ast.Stmt) PanicOption {
+	return func(c *panicConfig) {
+		c.onError = handle
+	}
+}
+
+// PanicValidationToError turns the function funcName of file, which
+// validates its input by panicking, into one returning an error, and
+// updates its calls in file to check it.
+//
+// An error result is added to the function, named if its results are, and
+// its panics with a string literal or a message formatted by fmt.Sprintf
+// become returns of errors.New or fmt.Errorf, along with the zero values
+// of the other results; other panics, like those re-panicking with a
+// recovered value, are left alone. Its returns get nil for the error,
+// except for naked returns of named results, and a function that had no
+// results gets a final return nil if needed. Calls that are statements of
+// their own become if err := f(); err != nil { ... }, discarding the other
+// results with _ if there are any, and calls that are the only value of a
+// short variable declaration get the error assigned along with the other
+// results and checked right after, see OnCallError. Other calls are
+// reported as skipped. Calls in other files of the package are up to the
+// caller.
+//
+// It fails without changing anything if funcName isn't a function of file
+// with a body, already returns an error, has no panics to convert or
+// forwards the results of a call with return g().
+func PanicValidationToError(file *ast.File, funcName string, opts ...PanicOption) (PanicReport, error) {
+	cfg := panicConfig{onError: returnOrPanic}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var fd *ast.FuncDecl
+	for _, d := range file.Decls {
+		if d, ok := d.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == funcName && d.Body != nil {
+			fd = d
+		}
+	}
+	if fd == nil {
+		return PanicReport{}, fmt.Errorf("astrewrite: no function %s with a body", funcName)
+	}
+	results := fd.Type.Results
+	if n := results.NumFields(); n > 0 && isIdent(results.List[len(results.List)-1].Type, "error") {
+		return PanicReport{}, fmt.Errorf("astrewrite: %s already returns an error", funcName)
+	}
+	rets := returnStmts(fd.Body)
+	for _, ret := range rets {
+		if len(ret.Results) > 0 && len(ret.Results) != results.NumFields() {
+			return PanicReport{}, fmt.Errorf("astrewrite: %s forwards the results of a call", funcName)
+		}
+	}
+	panics := validationPanics(fd.Body)
+	if len(panics) == 0 {
+		return PanicReport{}, fmt.Errorf("astrewrite: %s has no validation panics", funcName)
+	}
+
+	errorsPkg, imported := importedAs(file, "errors")
+	fmtPkg, _ := importedAs(file, "fmt")
+
+	// the signature and body of the function
+	results = addErrorResult(fd, rets)
+	report := PanicReport{Panics: len(panics)}
+	usesErrors := false
+	forEachStmtList(fd.Body, func(list []ast.Stmt) []ast.Stmt {
+		for i, s := range list {
+			call, ok := panics[s]
+			if !ok {
+				continue
+			}
+			msg := &ast.CallExpr{Fun: qualified(errorsPkg, "New", call.Pos()), Args: call.Args}
+			if inner, ok := call.Args[0].(*ast.CallExpr); ok {
+				msg = &ast.CallExpr{Fun: qualified(fmtPkg, "Errorf", call.Pos()), Args: inner.Args, Ellipsis: inner.Ellipsis}
+			} else {
+				usesErrors = true
+			}
+			list[i] = &ast.ReturnStmt{Return: s.Pos(), Results: zeroResults(results, msg)}
+		}
+		return list
+	})
+	endWithReturn(fd)
+	if usesErrors && !imported {
+		AddImport(file, "errors")
+	}
+
+	// the calls of the function
+	isCall := func(e ast.Expr) (*ast.CallExpr, bool) {
+		call, ok := e.(*ast.CallExpr)
+		if !ok {
+			return nil, false
+		}
+		id, ok := call.Fun.(*ast.Ident)
+		return call, ok && id.Name == funcName && (id.Obj == nil || id.Obj.Decl == fd)
+	}
+	callers := enclosingFuncs(file)
+	updated := make(map[*ast.CallExpr]bool)
+	forEachStmtList(file, func(list []ast.Stmt) []ast.Stmt {
+		var out []ast.Stmt
+		for _, s := range list {
+			caller := callers[s]
+			switch s := s.(type) {
+			case *ast.ExprStmt:
+				if call, ok := isCall(s.X); ok && caller != nil {
+					// the other results are discarded, like they were
+					var lhs []ast.Expr
+					for i := 1; i < results.NumFields(); i++ {
+						lhs = append(lhs, &ast.Ident{NamePos: s.Pos(), Name: "_"})
+					}
+					errID := &ast.Ident{NamePos: s.Pos(), Name: "err"}
+					out = append(out, &ast.IfStmt{
+						If: s.Pos(),
+						Init: &ast.AssignStmt{
+							Lhs:    append(lhs, errID),
+							TokPos: s.Pos(),
+							Tok:    token.DEFINE,
+							Rhs:    []ast.Expr{call},
+						},
+						Cond: notNil(errID),
+						Body: &ast.BlockStmt{List: cfg.onError(funcType(caller), errID)},
+					})
+					updated[call] = true
+					continue
+				}
+			case *ast.AssignStmt:
+				if call, ok := isCall(s.Rhs[0]); ok && caller != nil && s.Tok == token.DEFINE && len(s.Rhs) == 1 {
+					errID := &ast.Ident{NamePos: s.End(), Name: "err"}
+					if mentions(caller, "err") {
+						// err might be declared with another type
+						errID.Name = unusedName(caller, "err")
+					}
+					s.Lhs = append(s.Lhs, errID)
+					out = append(out, s, &ast.IfStmt{
+						If:   s.End(),
+						Cond: notNil(errID),
+						Body: &ast.BlockStmt{List: cfg.onError(funcType(caller), errID)},
+					})
+					updated[call] = true
+					continue
+				}
+			}
+			out = append(out, s)
+		}
+		return out
+	})
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expr); ok {
+			if call, ok := isCall(e); ok && !updated[call] {
+				report.Skipped = append(report.Skipped, call)
+			}
+		}
+		return true
+	})
+	report.Calls = len(updated)
+	return report, nil
+}
+
+// addErrorResult adds an error result to fd, named if its results are, and
+// nil for it to rets, the returns of fd, except for naked returns of named
+// results. It returns the results of fd.
+func addErrorResult(fd *ast.FuncDecl, rets []*ast.ReturnStmt) *ast.FieldList {
+	errField := &ast.Field{Type: ast.NewIdent("error")}
+	results := fd.Type.Results
+	if results == nil {
+		results = &ast.FieldList{}
+		fd.Type.Results = results
+	}
+	named := len(resultNames(fd)) > 0
+	if named {
+		errField.Names = []*ast.Ident{ast.NewIdent(unusedName(fd, "err"))}
+	}
+	results.List = append(results.List, errField)
+	if len(results.List) > 1 && !results.Opening.IsValid() {
+		results.Opening, results.Closing = results.Pos(), results.End()
+	}
+	for _, ret := range rets {
+		if len(ret.Results) > 0 || !named {
+			ret.Results = append(ret.Results, &ast.Ident{NamePos: ret.End(), Name: "nil"})
+		}
+	}
+	return results
+}
+
+// endWithReturn adds a final return nil to fd, whose only result is an
+// error, if its body doesn't end with a return: a function that had no
+// results could end without one.
+func endWithReturn(fd *ast.FuncDecl) {
+	n := len(fd.Body.List)
+	if len(fd.Type.Results.List) != 1 || n > 0 && isReturn(fd.Body.List[n-1]) {
+		return
+	}
+	fd.Body.List = append(fd.Body.List, &ast.ReturnStmt{
+		Return:  fd.Body.Rbrace,
+		Results: []ast.Expr{&ast.Ident{NamePos: fd.Body.Rbrace, Name: "nil"}},
+	})
+}
+
+// validationPanics returns the statements of body panicking with a string
+// literal or with a message formatted by fmt.Sprintf, leaving out those of
+// function literals, along with their calls of panic.
+func validationPanics(body *ast.BlockStmt) map[ast.Stmt]*ast.CallExpr {
+	panics := make(map[ast.Stmt]*ast.CallExpr)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ExprStmt:
+			call, ok := n.X.(*ast.CallExpr)
+			if !ok || len(call.Args) != 1 || !isIdent(call.Fun, "panic") || call.Fun.(*ast.Ident).Obj != nil {
+				return true
+			}
+			switch arg := call.Args[0].(type) {
+			case *ast.BasicLit:
+				if arg.Kind == token.STRING {
+					panics[n] = call
+				}
+			case *ast.CallExpr:
+				if isQualified(arg.Fun, "fmt", "Sprintf") {
+					panics[n] = call
+				}
+			}
+		}
+		return true
+	})
+	return panics
+}
+
+// enclosingFuncs maps the statements of file to the innermost function
+// declaration or literal they belong to.
+func enclosingFuncs(file *ast.File) map[ast.Stmt]ast.Node {
+	funcs := make(map[ast.Stmt]ast.Node)
+	var visit func(fn ast.Node, body *ast.BlockStmt)
+	visit = func(fn ast.Node, body *ast.BlockStmt) {
+		ast.Inspect(body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				visit(n, n.Body)
+				return false
+			case ast.Stmt:
+				funcs[n] = fn
+			}
+			return true
+		})
+	}
+	for _, d := range file.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Body != nil {
+			visit(fd, fd.Body)
+		}
+	}
+	return funcs
+}
+
+// funcType returns the type of fn, a function declaration or literal.
+func funcType(fn ast.Node) *ast.FuncType {
+	if lit, ok := fn.(*ast.FuncLit); ok {
+		return lit.Type
+	}
+	return fn.(*ast.FuncDecl).Type
+}
+
+// returnOrPanic is the default handler of OnCallError.
+func returnOrPanic(caller *ast.FuncType, err *ast.Ident) []ast.Stmt {
+	results := caller.Results
+	if n := results.NumFields(); n > 0 && isIdent(results.List[len(results.List)-1].Type, "error") {
+		return []ast.Stmt{&ast.ReturnStmt{Results: zeroResults(results, err)}}
+	}
+	return []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("panic"), Args: []ast.Expr{err}}}}
+}
+
+// zeroResults returns the zero values of results, a list ending with an
+// error, followed by err for the error.
+func zeroResults(results *ast.FieldList, err ast.Expr) []ast.Expr {
+	var values []ast.Expr
+	for _, f := range results.List {
+		for i := 0; i < len(f.Names) || i == 0 && len(f.Names) == 0; i++ {
+			values = append(values, zeroValue(f.Type))
+		}
+	}
+	values[len(values)-1] = err
+	return values
+}
+
+// zeroValue returns the zero value of typ, like 0, "" or nil, and *new(T)
+// for types whose kind can't be told from their name.
+func zeroValue(typ ast.Expr) ast.Expr {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "bool":
+			return ast.NewIdent("false")
+		case "string":
+			return &ast.BasicLit{Kind: token.STRING, Value: `""`}
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"byte", "rune", "float32", "float64", "complex64", "complex128":
+			if t.Obj == nil {
+				return &ast.BasicLit{Kind: token.INT, Value: "0"}
+			}
+		case "error", "any":
+			if t.Obj == nil {
+				return ast.NewIdent("nil")
+			}
+		}
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return ast.NewIdent("nil")
+		}
+		return &ast.CompositeLit{Type: Clone(t).(ast.Expr)}
+	case *ast.StructType:
+		return &ast.CompositeLit{Type: Clone(t).(ast.Expr)}
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return ast.NewIdent("nil")
+	}
+	return &ast.StarExpr{X: &ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{Clone(typ).(ast.Expr)}}}
+}
+
+// isReturn reports whether s is a return statement.
+func isReturn(s ast.Stmt) bool {
+	_, ok := s.(*ast.ReturnStmt)
+	return ok
+}
+
+// notNil returns the expression id != nil.
+func notNil(id *ast.Ident) ast.Expr {
+	return &ast.BinaryExpr{X: id, OpPos: id.Pos(), Op: token.NEQ, Y: &ast.Ident{NamePos: id.Pos(), Name: "nil"}}
+}
@@ -0,0 +1,172 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/types"
+	"testing"
+)
+
+func TestPanicValidationToError(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "fmt"
+
+func parsePort(s string, max int) int {
+	if s == "" {
+		panic("empty port")
+	}
+	n := atoi(s)
+	if n > max {
+		panic(fmt.Sprintf("port %d above %d", n, max))
+	}
+	return n
+}
+
+func listen(addr string) error {
+	port := parsePort(addr, 65535)
+	return bind(port)
+}
+
+func mustListen() {
+	parsePort("80", 1024)
+	fmt.Println(parsePort("81", 1024))
+}
+`)
+	report, err := PanicValidationToError(file, "parsePort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Panics != 2 || report.Calls != 2 || len(report.Skipped) != 1 {
+		t.Errorf("got %d panics, %d calls and %d skipped calls, want 2, 2 and 1", report.Panics, report.Calls, len(report.Skipped))
+	}
+	checkSource(t, fset, file, `package p
+
+import (
+	"errors"
+	"fmt"
+)
+
+func parsePort(s string, max int) (int, error) {
+	if s == "" {
+		return 0, errors.New("empty port")
+	}
+	n := atoi(s)
+	if n > max {
+		return 0, fmt.Errorf("port %d above %d", n, max)
+	}
+	return n, nil
+}
+
+func listen(addr string) error {
+	port, err := parsePort(addr, 65535)
+	if err != nil {
+		return err
+	}
+	return bind(port)
+}
+
+func mustListen() {
+	if _, err := parsePort("80", 1024); err != nil {
+		panic(err)
+	}
+	fmt.Println(parsePort("81", 1024))
+}
+`)
+
+	if _, err := PanicValidationToError(file, "parsePort"); err == nil {
+		t.Error("converted a function already returning an error")
+	}
+}
+
+func TestPanicValidationToErrorHandler(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func check(v *Value) {
+	if v == nil {
+		panic("nil value")
+	}
+}
+
+func use(v *Value) {
+	check(v)
+}
+`)
+	logged := func(caller *ast.FuncType, err *ast.Ident) []ast.Stmt {
+		return []ast.Stmt{
+			&ast.ExprStmt{X: &ast.CallExpr{Fun: qualified("log", "Print", 0), Args: []ast.Expr{err}}},
+			&ast.ReturnStmt{},
+		}
+	}
+	if _, err := PanicValidationToError(file, "check", OnCallError(logged)); err != nil {
+		t.Fatal(err)
+	}
+	checkSource(t, fset, file, `package p
+
+import "errors"
+
+func check(v *Value) error {
+	if v == nil {
+		return errors.New("nil value")
+	}
+	return nil
+}
+
+func use(v *Value) {
+	if err := check(v); err != nil {
+		log.Print(err)
+		return
+	}
+}
+`)
+}
+
+func TestPanicValidationToErrorTypes(t *testing.T) {
+	// only formatted messages, so errors isn't imported, and a call
+	// discarding the other result
+	fset, file := parse(t, `package p
+
+import "fmt"
+
+func parse(s string) int {
+	if s == "" {
+		panic(fmt.Sprintf("empty input %q", s))
+	}
+	return len(s)
+}
+
+func run() error {
+	parse("x")
+	return nil
+}
+`)
+	report, err := PanicValidationToError(file, "parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Panics != 1 || report.Calls != 1 {
+		t.Errorf("got report %+v, want 1 panic and 1 call", report)
+	}
+	checkSource(t, fset, file, `package p
+
+import "fmt"
+
+func parse(s string) (int, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty input %q", s)
+	}
+	return len(s), nil
+}
+
+func run() error {
+	if _, err := parse("x"); err != nil {
+		return err
+	}
+	return nil
+}
+`)
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("p", fset, []*ast.File{file}, nil); err != nil {
+		t.Error(err)
+	}
+}
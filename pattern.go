@@ -0,0 +1,118 @@
+package astrewrite
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RewritePattern rewrites the expressions below root matching pattern into
+// replacement, like gofmt -r, and returns the rewritten root along with the
+// number of rewritten expressions. It works on the trees of any Backend b.
+//
+// pattern and replacement are expressions in which identifiers of a single
+// lowercase letter are wildcards. A wildcard matches any expression, the
+// same one wherever it appears more than once in pattern, and stands for a
+// copy of what it matched in replacement, like in RewritePattern(AST, root,
+// "a[b:len(a)]", "a[b:]"). Matched expressions are rewritten as they're
+// found, walking down from root; the expressions matched by wildcards are
+// rewritten before they're copied into the replacement, which isn't walked
+// again, so that a replacement matching the pattern doesn't loop.
+func RewritePattern(b Backend, root Node, pattern, replacement string) (Node, int, error) {
+	p, err := b.ParseExpr(pattern)
+	if err != nil {
+		return nil, 0, fmt.Errorf("astrewrite: parsing pattern: %v", err)
+	}
+	r, err := b.ParseExpr(replacement)
+	if err != nil {
+		return nil, 0, fmt.Errorf("astrewrite: parsing replacement: %v", err)
+	}
+	if _, ok := wildcard(b, p); ok {
+		return nil, 0, fmt.Errorf("astrewrite: pattern %s matches everything", pattern)
+	}
+	wild := wildcards(b, p)
+	for name := range wildcards(b, r) {
+		if !wild[name] {
+			return nil, 0, fmt.Errorf("astrewrite: wildcard %s of replacement isn't in pattern", name)
+		}
+	}
+
+	n := 0
+	var rewrite func(Node) (Node, bool)
+	rewrite = func(node Node) (Node, bool) {
+		binds := make(map[string]Node)
+		if !matchPattern(b, p, node, binds) {
+			return node, true
+		}
+		n++
+		return b.Walk(b.Clone(r), func(node Node) (Node, bool) {
+			if name, ok := wildcard(b, node); ok {
+				return b.Walk(b.Clone(binds[name]), rewrite), false
+			}
+			return node, true
+		}), false
+	}
+	return b.Walk(root, rewrite), n, nil
+}
+
+// wildcard returns the name of n if it's a wildcard of a pattern.
+func wildcard(b Backend, n Node) (string, bool) {
+	if b.Kind(n) != "Ident" {
+		return "", false
+	}
+	name := b.Attrs(n)["Name"]
+	return name, len(name) == 1 && 'a' <= name[0] && name[0] <= 'z'
+}
+
+// wildcards returns the names of the wildcards of the pattern p.
+func wildcards(b Backend, p Node) map[string]bool {
+	names := make(map[string]bool)
+	b.Walk(p, func(n Node) (Node, bool) {
+		if name, ok := wildcard(b, n); ok {
+			names[name] = true
+		}
+		return n, true
+	})
+	return names
+}
+
+// matchPattern reports whether the tree rooted at n matches the pattern p,
+// recording what its wildcards match in binds. With nil binds, p has no
+// wildcards and must equal n. Comments don't matter.
+func matchPattern(b Backend, p, n Node, binds map[string]Node) bool {
+	if p == nil || n == nil {
+		return p == nil && n == nil
+	}
+	if name, ok := wildcard(b, p); ok && binds != nil {
+		if bound, ok := binds[name]; ok {
+			return matchPattern(b, bound, n, nil)
+		}
+		binds[name] = n
+		return true
+	}
+
+	kind := b.Kind(p)
+	if b.Kind(n) != kind || !reflect.DeepEqual(b.Attrs(p), b.Attrs(n)) {
+		return false
+	}
+	for _, e := range schema[kind] {
+		if e.Type == "*CommentGroup" {
+			continue
+		}
+		if e.Kind != EdgeSlice {
+			if !matchPattern(b, b.Child(p, e.Name), b.Child(n, e.Name), binds) {
+				return false
+			}
+			continue
+		}
+		ps, ns := b.Children(p, e.Name), b.Children(n, e.Name)
+		if len(ps) != len(ns) {
+			return false
+		}
+		for i := range ps {
+			if !matchPattern(b, ps[i], ns[i], binds) {
+				return false
+			}
+		}
+	}
+	return true
+}
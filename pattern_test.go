@@ -0,0 +1,43 @@
+package astrewrite
+
+import "testing"
+
+func TestRewritePattern(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(s, t []int, m map[string]int) {
+	_ = s[1:len(s)]
+	_ = t[len(s):len(t)]
+	_ = s[1:len(t)]
+	_ = s[s[0]:len(s)][1:len(s[s[0]:len(s)])]
+	_ = len(m) == 0 // not an expression of the pattern
+}
+`)
+	_, n, err := RewritePattern(AST, file, "a[b:len(a)]", "a[b:]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("rewrote %d expressions, want 4", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func f(s, t []int, m map[string]int) {
+	_ = s[1:]
+	_ = t[len(s):]
+	_ = s[1:len(t)]
+	_ = s[s[0]:][1:]
+	_ = len(m) == 0 // not an expression of the pattern
+}
+`)
+
+	for _, tc := range []struct{ pattern, replacement string }{
+		{"a[b:len(a)]", "a[c:]"},
+		{"x", "y"},
+		{"f(", "g()"},
+	} {
+		if _, _, err := RewritePattern(AST, file, tc.pattern, tc.replacement); err == nil {
+			t.Errorf("%s -> %s: got no error", tc.pattern, tc.replacement)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// PackageReport describes what RenamePackage did.
+type PackageReport struct {
+	// Files is the number of renamed package clauses.
+	Files int
+
+	// Imports is the number of imports of the package whose qualifiers
+	// were renamed.
+	Imports int
+
+	// Aliased holds the imports that got the old package name as an alias
+	// instead, since the new name is already used in their file.
+	Aliased []*ast.ImportSpec
+
+	// DotImports holds the dot imports of the package, which are left
+	// alone as the new name doesn't appear in their files.
+	DotImports []*ast.ImportSpec
+}
+
+// RenamePackage renames the package made of pkg, the files of the package
+// importable as path, to newName, and updates the files importing it. The
+// package clauses of pkg are renamed, keeping the _test suffix of external
+// test packages, and the qualifiers referring to the package in pkg and
+// importers are renamed along with their imports. An import that already
+// has an alias keeps it, unless it is newName, which makes it redundant. If
+// newName is used in a file in any other way, the import gets the old name
+// as an alias instead, which is reported. Dot imports are reported, not
+// rewritten. An error is returned if newName isn't an identifier or the
+// files of pkg disagree on the package name, in which case nothing is
+// changed.
+func RenamePackage(pkg, importers []*ast.File, path, newName string) (PackageReport, error) {
+	var report PackageReport
+	if !token.IsIdentifier(newName) || newName == "_" {
+		return report, fmt.Errorf("astrewrite: invalid package name %q", newName)
+	}
+	oldName := ""
+	for _, f := range pkg {
+		name := strings.TrimSuffix(f.Name.Name, "_test")
+		if oldName != "" && name != oldName {
+			return report, fmt.Errorf("astrewrite: files of %s are in packages %s and %s", path, oldName, name)
+		}
+		oldName = name
+	}
+	if oldName == "" || oldName == newName {
+		return report, nil
+	}
+
+	for _, f := range pkg {
+		if strings.HasSuffix(f.Name.Name, "_test") {
+			f.Name.Name = newName + "_test"
+		} else {
+			f.Name.Name = newName
+		}
+		report.Files++
+	}
+
+	for _, f := range append(pkg, importers...) {
+		for _, imp := range f.Imports {
+			if importPath(imp) != path {
+				continue
+			}
+			switch {
+			case imp.Name == nil:
+				if usesName(f, newName) {
+					imp.Name = &ast.Ident{NamePos: imp.Path.Pos(), Name: oldName}
+					report.Aliased = append(report.Aliased, imp)
+					continue
+				}
+				renameQualifier(f, oldName, newName)
+				report.Imports++
+			case imp.Name.Name == ".":
+				report.DotImports = append(report.DotImports, imp)
+			case imp.Name.Name == newName:
+				imp.Name = nil
+			}
+		}
+	}
+	return report, nil
+}
+
+// usesName reports whether name appears as an identifier anywhere in the
+// declarations of f, which is how conservative RenamePackage is about
+// taking it.
+func usesName(f *ast.File, name string) bool {
+	for _, decl := range f.Decls {
+		if mentions(decl, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestRenamePackage(t *testing.T) {
+	srcs := []string{`package store
+
+func Open() *DB { return nil }
+`, `package store
+
+func TestOpen() { _ = Open() }
+`, `package store_test
+
+import "example.com/store"
+
+func TestExternal() { _ = store.Open() }
+`, `package main
+
+import "example.com/store"
+
+func main() { _ = store.Open() }
+`, `package cache
+
+import "example.com/store"
+
+var kv = 1
+
+func get() { _ = store.Open(); _ = kv }
+`, `package dot
+
+import . "example.com/store"
+
+func f() { _ = Open() }
+`, `package alias
+
+import (
+	kv "example.com/store"
+	s "example.com/store/v2"
+)
+
+func f() { _, _ = kv.Open(), s.Open() }
+`}
+
+	var fsets []*token.FileSet
+	var files []*ast.File
+	for _, src := range srcs {
+		fset, f := parse(t, src)
+		fsets = append(fsets, fset)
+		files = append(files, f)
+	}
+	report, err := RenamePackage(files[:3], files[3:], "example.com/store", "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`package kv
+
+func Open() *DB { return nil }
+`, `package kv
+
+func TestOpen() { _ = Open() }
+`, `package kv_test
+
+import "example.com/store"
+
+func TestExternal() { _ = kv.Open() }
+`, `package main
+
+import "example.com/store"
+
+func main() { _ = kv.Open() }
+`, `package cache
+
+import store "example.com/store"
+
+var kv = 1
+
+func get() { _ = store.Open(); _ = kv }
+`, `package dot
+
+import . "example.com/store"
+
+func f() { _ = Open() }
+`, `package alias
+
+import (
+	"example.com/store"
+	s "example.com/store/v2"
+)
+
+func f() { _, _ = kv.Open(), s.Open() }
+`}
+	for i, f := range files {
+		checkSource(t, fsets[i], f, want[i])
+	}
+	if report.Files != 3 || report.Imports != 2 {
+		t.Errorf("got %d files and %d imports, want 3 and 2", report.Files, report.Imports)
+	}
+	if len(report.Aliased) != 1 || report.Aliased[0].Name.Name != "store" {
+		t.Errorf("got aliased %v, want the import of cache", report.Aliased)
+	}
+	if len(report.DotImports) != 1 || report.DotImports[0] != files[5].Imports[0] {
+		t.Errorf("got dot imports %v, want the import of dot", report.DotImports)
+	}
+
+	if _, err := RenamePackage(files[:3], nil, "example.com/store", "no-name"); err == nil {
+		t.Errorf("got no error for an invalid name")
+	}
+}
+
+func TestRenamePackageShadowed(t *testing.T) {
+	// without resolved objects, the qualifiers are told apart from local
+	// variables by their scopes
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "src.go", `package main
+
+import "example.com/store"
+
+func main() {
+	_ = store.Open()
+	for _, store := range stores {
+		_ = store.Name
+	}
+	func(store *DB) { _ = store.Name }(nil)
+}
+`, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pkg := parse(t, "package store\n")
+	if _, err := RenamePackage([]*ast.File{pkg}, []*ast.File{file}, "example.com/store", "db"); err != nil {
+		t.Fatal(err)
+	}
+	checkSource(t, fset, file, `package main
+
+import "example.com/store"
+
+func main() {
+	_ = db.Open()
+	for _, store := range stores {
+		_ = store.Name
+	}
+	func(store *DB) { _ = store.Name }(nil)
+}
+`)
+}
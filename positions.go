@@ -0,0 +1,105 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+)
+
+var (
+	posType    = reflect.TypeOf(token.NoPos)
+	objectType = reflect.TypeOf((*ast.Object)(nil))
+	scopeType  = reflect.TypeOf((*ast.Scope)(nil))
+)
+
+// mapPositions replaces every token.Pos in the tree rooted at node with the
+// result of fn. Object and scope links are not followed, and nodes reachable
+// along several paths, like doc comments of a file, are mapped once.
+func mapPositions(node ast.Node, fn func(token.Pos) token.Pos) {
+	mapPos(reflect.ValueOf(node), fn, make(map[uintptr]bool))
+}
+
+func mapPos(v reflect.Value, fn func(token.Pos) token.Pos, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		mapPos(v.Elem(), fn, seen)
+	case reflect.Interface:
+		if !v.IsNil() {
+			mapPos(v.Elem(), fn, seen)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			mapPos(v.Index(i), fn, seen)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if f.Type() == posType {
+				f.SetInt(int64(fn(token.Pos(f.Int()))))
+				continue
+			}
+			mapPos(f, fn, seen)
+		}
+	}
+}
+
+// clearPositions resets all positions in the tree rooted at node, which is
+// needed for nodes parsed with a different FileSet before they're inserted.
+func clearPositions(node ast.Node) {
+	mapPositions(node, func(token.Pos) token.Pos { return token.NoPos })
+}
+
+// parseExpr parses x and clears the positions of the result.
+func parseExpr(x string) (ast.Expr, error) {
+	e, err := parser.ParseExpr(x)
+	if err != nil {
+		return nil, err
+	}
+	clearPositions(e)
+	return e, nil
+}
+
+// stampPositions moves every valid position in the tree rooted at node to
+// pos, which keeps the printer from spreading a node assembled from parts of
+// different lines over several lines.
+func stampPositions(node ast.Node, pos token.Pos) {
+	mapPositions(node, func(p token.Pos) token.Pos {
+		if p.IsValid() {
+			return pos
+		}
+		return p
+	})
+}
+
+// placeAt moves every position in the tree rooted at node to pos, including
+// the unset ones, except for those whose absence means something, like the
+// ellipsis of a call.
+func placeAt(node ast.Node, pos token.Pos) {
+	var unset []*token.Pos
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			unset = append(unset, &n.Ellipsis)
+		case *ast.TypeSpec:
+			unset = append(unset, &n.Assign)
+		case *ast.GenDecl:
+			unset = append(unset, &n.Lparen, &n.Rparen)
+		}
+		return true
+	})
+	var keep []*token.Pos
+	for _, p := range unset {
+		if !p.IsValid() {
+			keep = append(keep, p)
+		}
+	}
+	mapPositions(node, func(token.Pos) token.Pos { return pos })
+	for _, p := range keep {
+		*p = token.NoPos
+	}
+}
@@ -0,0 +1,64 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// AddPragma adds the directive pragma, like "//go:noinline" or
+// "mytool:skip", as the last line of the doc comment of fn, creating it if
+// fn has none, and adds a new doc comment to f.Comments so it's printed.
+// The directive is written as "//" immediately followed by pragma without
+// its leading slashes and spaces, since tools only recognize directives
+// written tight. Nothing changes if fn already carries the directive.
+//
+// fset is the FileSet f was parsed with. Since directives need a line of
+// their own, AddPragma splits the line ending right before fn in the line
+// table of the file if it isn't blank, so offsets after it no longer
+// correspond to the original source. An error is returned if fn doesn't
+// start a line of f.
+func AddPragma(fset *token.FileSet, f *ast.File, fn *ast.FuncDecl, pragma string) error {
+	text := "//" + strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(pragma), "/"))
+	if text == "//" || strings.ContainsAny(text, "\n\r") {
+		return fmt.Errorf("astrewrite: invalid pragma %q", pragma)
+	}
+	if fn.Doc != nil {
+		for _, c := range fn.Doc.List {
+			if strings.TrimRight(c.Text, " \t") == text {
+				return nil
+			}
+		}
+	}
+
+	tf := fset.File(fn.Pos())
+	if tf == nil || tf.LineStart(tf.Line(fn.Pos())) != fn.Pos() || tf.Offset(fn.Pos()) == 0 {
+		return fmt.Errorf("astrewrite: func %s doesn't start a line", fn.Name.Name)
+	}
+
+	// the pragma takes the newline ending the line before fn, which becomes
+	// a line of its own unless it's blank already
+	pos := fn.Pos() - 1
+	if start := tf.LineStart(tf.Line(pos)); start != pos {
+		lines := tf.Lines()
+		i := sort.SearchInts(lines, tf.Offset(pos))
+		lines = append(lines[:i], append([]int{tf.Offset(pos)}, lines[i:]...)...)
+		if !tf.SetLines(lines) {
+			return fmt.Errorf("astrewrite: func %s doesn't start a line", fn.Name.Name)
+		}
+	}
+
+	c := &ast.Comment{Slash: pos, Text: text}
+	if fn.Doc != nil {
+		fn.Doc.List = append(fn.Doc.List, c)
+		return nil
+	}
+	fn.Doc = &ast.CommentGroup{List: []*ast.Comment{c}}
+	f.Comments = append(f.Comments, fn.Doc)
+	sort.SliceStable(f.Comments, func(i, j int) bool {
+		return f.Comments[i].Pos() < f.Comments[j].Pos()
+	})
+	return nil
+}
@@ -0,0 +1,42 @@
+package astrewrite
+
+import "testing"
+
+func TestAddPragma(t *testing.T) {
+	fset, file := parse(t, `package p
+
+// add returns the sum of a and b.
+func add(a, b int) int { return a + b }
+func sub(a, b int) int { return a - b }
+
+func neg(a int) int { return -a }
+`)
+	for _, p := range []struct{ fn, pragma string }{
+		{"add", "//go:noinline"},
+		{"sub", "// go:noinline"},
+		{"sub", "//go:noinline"},
+		{"sub", "mytool:skip"},
+		{"neg", "go:nosplit"},
+	} {
+		if err := AddPragma(fset, file, findFunc(file, p.fn), p.pragma); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkSource(t, fset, file, `package p
+
+// add returns the sum of a and b.
+//go:noinline
+func add(a, b int) int { return a + b }
+
+//go:noinline
+//mytool:skip
+func sub(a, b int) int { return a - b }
+
+//go:nosplit
+func neg(a int) int { return -a }
+`)
+
+	if err := AddPragma(fset, file, findFunc(file, "add"), "//"); err == nil {
+		t.Error("got no error for an empty pragma")
+	}
+}
@@ -0,0 +1,131 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// RemoveRandSeed is a WalkFunc removing the statements calling Seed of
+// math/rand, which is deprecated since Go 1.20, where the global source is
+// seeded randomly. A seed whose computation may have side effects is kept
+// as an assignment to the blank identifier, like _ = next(); reading the
+// clock, like time.Now().UnixNano(), doesn't count. Since Go 1.24 Seed does
+// nothing at all; before, removing a constant seed makes the sequence of
+// random numbers differ between runs.
+//
+// Called with a file, RemoveRandSeed handles the whole file and doesn't
+// walk it further: math/rand is recognized by its import, under any name,
+// and the imports of math/rand and time nothing refers to anymore are
+// removed. Called with any other node, it handles the statement it's
+// called with, taking qualifiers named rand the parser didn't resolve to
+// a local object for math/rand and time for time, and imports are up to
+// the caller.
+func RemoveRandSeed(n ast.Node) (ast.Node, bool) {
+	if f, ok := n.(*ast.File); ok {
+		removeRandSeeds(f)
+		return f, false
+	}
+	s, ok := n.(*ast.ExprStmt)
+	if !ok {
+		return n, true
+	}
+	arg, rand := randSeedArg(s, "rand")
+	if arg == nil || rand.Obj != nil {
+		return n, true
+	}
+	return keptSeed(arg, "time"), false
+}
+
+// removeRandSeeds removes the calls of rand.Seed in f.
+func removeRandSeeds(f *ast.File) {
+	randName, ok := importedAs(f, "math/rand")
+	if !ok || randName == "." || randName == "_" {
+		return
+	}
+	timeName, _ := importedAs(f, "time")
+
+	removed := false
+	var w *Walker
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		s, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return n, true
+		}
+		if arg, _ := randSeedArg(s, randName); arg != nil && isQualifier(w.Cursor(), randName) {
+			removed = true
+			return keptSeed(arg, timeName), false
+		}
+		return n, true
+	})
+	w.Walk(f)
+	if !removed {
+		return
+	}
+
+	used := usedQualifiers(f)
+	for _, imp := range append([]*ast.ImportSpec(nil), f.Imports...) {
+		name := importName(imp)
+		if path := importPath(imp); path != "math/rand" && path != "time" || name == "_" || name == "." {
+			continue
+		}
+		if !used[name] {
+			removeImport(f, imp)
+		}
+	}
+}
+
+// randSeedArg returns the argument of s and the qualifier of the call if s
+// calls randName.Seed.
+func randSeedArg(s *ast.ExprStmt, randName string) (ast.Expr, *ast.Ident) {
+	call, ok := s.X.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+		return nil, nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Seed" || !isIdent(sel.X, randName) {
+		return nil, nil
+	}
+	return call.Args[0], sel.X.(*ast.Ident)
+}
+
+// keptSeed returns the statement keeping the side effects of the seed arg,
+// or nil if it has none.
+func keptSeed(arg ast.Expr, timeName string) ast.Stmt {
+	if !HasSideEffects(arg) || clockReading(arg, timeName) {
+		return nil
+	}
+	return &ast.AssignStmt{
+		Lhs:    []ast.Expr{&ast.Ident{NamePos: arg.Pos(), Name: "_"}},
+		TokPos: arg.Pos(),
+		Tok:    token.ASSIGN,
+		Rhs:    []ast.Expr{arg},
+	}
+}
+
+// clockReading reports whether e reads the clock, like time.Now().Unix(),
+// possibly converted, like int64(time.Now().Nanosecond()).
+func clockReading(e ast.Expr, timeName string) bool {
+	call, ok := ast.Unparen(e).(*ast.CallExpr)
+	if !ok || len(call.Args) > 1 {
+		return false
+	}
+	if len(call.Args) == 1 {
+		// a conversion to a basic integer type
+		switch calleeName(call) {
+		case "int", "int64", "uint64", "uint":
+			return clockReading(call.Args[0], timeName)
+		}
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	switch sel.Sel.Name {
+	case "Unix", "UnixNano", "UnixMilli", "UnixMicro", "Nanosecond":
+	default:
+		return false
+	}
+	now, ok := sel.X.(*ast.CallExpr)
+	return ok && len(now.Args) == 0 && calleeName(now) == timeName+".Now"
+}
@@ -0,0 +1,90 @@
+package astrewrite
+
+import "testing"
+
+func TestRemoveRandSeed(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	"math/rand"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+func roll() int {
+	return rand.Intn(6)
+}
+`)
+	Walk(file, RemoveRandSeed)
+	checkSource(t, fset, file, `package p
+
+import (
+	"math/rand"
+)
+
+func init() {
+
+}
+
+func roll() int {
+	return rand.Intn(6)
+}
+`)
+}
+
+func TestRemoveRandSeedSideEffects(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import (
+	mrand "math/rand"
+	"time"
+)
+
+func setup(start time.Time) {
+	mrand.Seed(nextSeed())
+	mrand.Seed(int64(time.Now().Nanosecond()))
+	rand.Seed(1)
+}
+`)
+	Walk(file, RemoveRandSeed)
+	checkSource(t, fset, file, `package p
+
+import (
+	"time"
+)
+
+func setup(start time.Time) {
+	_ = nextSeed()
+
+	rand.Seed(1)
+}
+`)
+
+	// outside of a file, rand is taken for math/rand unless declared
+	fset, file = parse(t, `package p
+
+func f(rand *Source) {
+	rand.Seed(1)
+}
+
+func g() {
+	rand.Seed(1)
+}
+`)
+	for _, name := range []string{"f", "g"} {
+		Walk(findFunc(file, name), RemoveRandSeed)
+	}
+	checkSource(t, fset, file, `package p
+
+func f(rand *Source) {
+	rand.Seed(1)
+}
+
+func g() {
+
+}
+`)
+}
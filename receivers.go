@@ -0,0 +1,171 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// ReceiverType returns the name of the base type of the receiver of the
+// method fd, the identifiers its type parameters are bound to and whether
+// the receiver is a pointer. Parentheses are looked through wherever they
+// can appear, so (s *Stack[T]), (s (*Stack[T])) and (s *(Stack[T])) all
+// give Stack, [T] and true. ok is false if fd isn't a method or its
+// receiver type isn't a valid one, like a qualified or doubly indirected
+// type.
+func ReceiverType(fd *ast.FuncDecl) (name string, typeParams []*ast.Ident, ptr bool, ok bool) {
+	if fd.Recv == nil || len(fd.Recv.List) != 1 {
+		return "", nil, false, false
+	}
+	typ := ast.Unparen(fd.Recv.List[0].Type)
+	if star, isStar := typ.(*ast.StarExpr); isStar {
+		typ, ptr = ast.Unparen(star.X), true
+	}
+
+	var indices []ast.Expr
+	switch t := typ.(type) {
+	case *ast.IndexExpr:
+		typ, indices = t.X, []ast.Expr{t.Index}
+	case *ast.IndexListExpr:
+		typ, indices = t.X, t.Indices
+	}
+	id, isIdent := ast.Unparen(typ).(*ast.Ident)
+	if !isIdent {
+		return "", nil, false, false
+	}
+	for _, index := range indices {
+		param, isIdent := index.(*ast.Ident)
+		if !isIdent {
+			return "", nil, false, false
+		}
+		typeParams = append(typeParams, param)
+	}
+	return id.Name, typeParams, ptr, true
+}
+
+// ReceiverReport describes what NormalizeReceiverKind did.
+type ReceiverReport struct {
+	// Pointer is set if the methods were normalized to pointer receivers.
+	Pointer bool
+
+	// Changed holds the methods whose receivers were changed.
+	Changed []*ast.FuncDecl
+
+	// Kept holds the methods of the minority that were left alone, because
+	// their receiver is used for more than reading its fields.
+	Kept []*ast.FuncDecl
+}
+
+// NormalizeReceiverKind makes the methods of the type typeName declared in
+// file consistently use pointer receivers, or value receivers, whichever
+// most of them use already. Nothing changes if there are as many of
+// either.
+//
+// Whether a method works on a copy of its receiver or on the original
+// changes what modifying it does, so only methods that read the fields of
+// their receiver are changed. Those that use it otherwise, by assigning to
+// it or its fields, taking its address, calling methods on it or passing it
+// on, are left alone and reported as kept.
+//
+// Call sites aren't looked at: a method that now takes a pointer can't be
+// called on values that aren't addressable, like map elements or results
+// of calls, and the value type no longer has it in its method set, which
+// can break the interfaces it implements. Those show up when the code is
+// compiled or type checked.
+func NormalizeReceiverKind(file *ast.File, typeName string) ReceiverReport {
+	var methods []*ast.FuncDecl
+	ptrs := 0
+	for _, d := range file.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if name, _, ptr, ok := ReceiverType(fd); ok && name == typeName {
+			methods = append(methods, fd)
+			if ptr {
+				ptrs++
+			}
+		}
+	}
+	var report ReceiverReport
+	if 2*ptrs == len(methods) {
+		return report
+	}
+	report.Pointer = 2*ptrs > len(methods)
+
+	for _, fd := range methods {
+		if _, _, ptr, _ := ReceiverType(fd); ptr == report.Pointer {
+			continue
+		}
+		if !readsReceiverOnly(fd) {
+			report.Kept = append(report.Kept, fd)
+			continue
+		}
+		recv := fd.Recv.List[0]
+		if report.Pointer {
+			recv.Type = &ast.StarExpr{Star: recv.Type.Pos(), X: recv.Type}
+		} else {
+			typ := ast.Unparen(recv.Type)
+			recv.Type = ast.Unparen(typ.(*ast.StarExpr).X)
+		}
+		report.Changed = append(report.Changed, fd)
+	}
+	return report
+}
+
+// readsReceiverOnly reports whether the method fd uses its receiver only to
+// read its fields.
+func readsReceiverOnly(fd *ast.FuncDecl) bool {
+	names := fd.Recv.List[0].Names
+	if len(names) == 0 || names[0].Name == "_" || fd.Body == nil {
+		return true
+	}
+	name := names[0].Name
+	rooted := func(e ast.Expr) bool {
+		for {
+			switch x := e.(type) {
+			case *ast.Ident:
+				return x.Name == name
+			case *ast.SelectorExpr:
+				e = x.X
+			case *ast.IndexExpr:
+				e = x.X
+			case *ast.SliceExpr:
+				e = x.X
+			case *ast.StarExpr:
+				e = x.X
+			case *ast.ParenExpr:
+				e = x.X
+			default:
+				return false
+			}
+		}
+	}
+
+	fields := make(map[*ast.Ident]bool)
+	ok := true
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				ok = ok && !rooted(lhs)
+			}
+		case *ast.RangeStmt:
+			ok = ok && (n.Tok == token.DEFINE || !rooted(n.Key) && !rooted(n.Value))
+		case *ast.IncDecStmt:
+			ok = ok && !rooted(n.X)
+		case *ast.UnaryExpr:
+			ok = ok && (n.Op != token.AND || !rooted(n.X))
+		case *ast.CallExpr:
+			_, method := n.Fun.(*ast.SelectorExpr)
+			ok = ok && (!method || !rooted(n.Fun))
+		case *ast.SelectorExpr:
+			if id, isIdent := n.X.(*ast.Ident); isIdent {
+				fields[id] = true
+			}
+		case *ast.Ident:
+			ok = ok && (n.Name != name || fields[n])
+		}
+		return ok
+	})
+	return ok
+}
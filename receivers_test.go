@@ -0,0 +1,136 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestReceiverType(t *testing.T) {
+	_, file := parse(t, `package p
+
+func (s Stack) A()
+func (s *Stack) B()
+func (Stack) C()
+func (s (Stack)) D()
+func (s (*Stack)) E()
+func (s *(Stack)) F()
+func (s *Stack[T]) G()
+func (s Pair[K, V]) H()
+func (s *(Stack[T])) I()
+func (s (*Stack[_])) J()
+func (s **Stack) K()
+func (s pkg.Stack) L()
+func M()
+`)
+
+	tests := []struct {
+		name       string
+		typeParams []string
+		ptr, ok    bool
+	}{
+		{"Stack", nil, false, true},
+		{"Stack", nil, true, true},
+		{"Stack", nil, false, true},
+		{"Stack", nil, false, true},
+		{"Stack", nil, true, true},
+		{"Stack", nil, true, true},
+		{"Stack", []string{"T"}, true, true},
+		{"Pair", []string{"K", "V"}, false, true},
+		{"Stack", []string{"T"}, true, true},
+		{"Stack", []string{"_"}, true, true},
+		{"", nil, false, false},
+		{"", nil, false, false},
+		{"", nil, false, false},
+	}
+	for i, tt := range tests {
+		fd := file.Decls[i].(*ast.FuncDecl)
+		name, typeParams, ptr, ok := ReceiverType(fd)
+		var params []string
+		for _, p := range typeParams {
+			params = append(params, p.Name)
+		}
+		if name != tt.name || !reflect.DeepEqual(params, tt.typeParams) || ptr != tt.ptr || ok != tt.ok {
+			t.Errorf("%s: got %q, %v, %v, %v, want %q, %v, %v, %v", fd.Name.Name,
+				name, params, ptr, ok, tt.name, tt.typeParams, tt.ptr, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeReceiverKind(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type Counter struct{ n, max int }
+
+func (c *Counter) Inc() { c.n++ }
+
+func (c *Counter) Reset() { c.n = 0 }
+
+func (c Counter) Value() int { return c.n }
+
+func (c Counter) Full() bool { return c.n >= c.max }
+
+func (c Counter) WithMax(max int) Counter {
+	c.max = max
+	return c
+}
+
+func (Counter) Kind() string { return "counter" }
+
+func (c *Counter) Add(n int) { c.n += n }
+
+func (c *Counter) Left() int { return c.max - c.n }
+
+func (c *Counter) Max() int { return c.max }
+`)
+	report := NormalizeReceiverKind(file, "Counter")
+	if !report.Pointer {
+		t.Error("normalized to value receivers, want pointers")
+	}
+	var changed, kept []string
+	for _, fd := range report.Changed {
+		changed = append(changed, fd.Name.Name)
+	}
+	for _, fd := range report.Kept {
+		kept = append(kept, fd.Name.Name)
+	}
+	if !reflect.DeepEqual(changed, []string{"Value", "Full", "Kind"}) || !reflect.DeepEqual(kept, []string{"WithMax"}) {
+		t.Errorf("changed %v and kept %v, want [Value Full Kind] and [WithMax]", changed, kept)
+	}
+	checkSource(t, fset, file, `package p
+
+type Counter struct{ n, max int }
+
+func (c *Counter) Inc() { c.n++ }
+
+func (c *Counter) Reset() { c.n = 0 }
+
+func (c *Counter) Value() int { return c.n }
+
+func (c *Counter) Full() bool { return c.n >= c.max }
+
+func (c Counter) WithMax(max int) Counter {
+	c.max = max
+	return c
+}
+
+func (*Counter) Kind() string { return "counter" }
+
+func (c *Counter) Add(n int) { c.n += n }
+
+func (c *Counter) Left() int { return c.max - c.n }
+
+func (c *Counter) Max() int { return c.max }
+`)
+
+	// a tie leaves the methods alone
+	_, file = parse(t, `package p
+
+func (p *Point) Move(dx int) { p.x += dx }
+
+func (p Point) X() int { return p.x }
+`)
+	if report := NormalizeReceiverKind(file, "Point"); len(report.Changed)+len(report.Kept) != 0 {
+		t.Errorf("got %+v for a tie", report)
+	}
+}
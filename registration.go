@@ -0,0 +1,176 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// RegistrationReport describes what EnsureInitRegistration did.
+type RegistrationReport struct {
+	// Registered holds the names of the types registration statements
+	// were added for, sorted.
+	Registered []string
+
+	// Registrar is the function holding the registrations, or nil if no
+	// type matched and there's none.
+	Registrar *ast.FuncDecl
+
+	// Created is set if Registrar was added to the file.
+	Created bool
+}
+
+// RegistrationOption configures EnsureInitRegistration.
+type RegistrationOption func(*registrationConfig)
+
+type registrationConfig struct {
+	name    string
+	imports []string
+}
+
+// Registrar makes EnsureInitRegistration register types in the function
+// name, which the caller is responsible for calling, rather than in init.
+func Registrar(name string) RegistrationOption {
+	return func(c *registrationConfig) {
+		c.name = name
+	}
+}
+
+// RegistrationImports makes EnsureInitRegistration import the packages
+// with the given paths, which the registration calls refer to, whenever it
+// adds a registration.
+func RegistrationImports(paths ...string) RegistrationOption {
+	return func(c *registrationConfig) {
+		c.imports = append(c.imports, paths...)
+	}
+}
+
+// EnsureInitRegistration makes sure every package level type of f that
+// match reports true for is registered in the init function of f, by a
+// statement calling the expression buildCall returns for the name of the
+// type, like registry.Register("Plugin", new(Plugin)). A type counts as
+// registered if the registrar has a statement equal to that call, as told
+// by Equal, so running it again adds nothing. buildCall may return nil for
+// types it can't register.
+//
+// The registrations are kept together and sorted by type name for stable
+// diffs: new ones join the existing ones, which are sorted as well, or go
+// at the end of the registrar if there are none, and a registrar is added
+// at the end of f if f has none. With several init functions the first one
+// is used, but registrations in any of them are found.
+func EnsureInitRegistration(f *ast.File, match func(*ast.TypeSpec) bool, buildCall func(typeName string) ast.Expr, opts ...RegistrationOption) RegistrationReport {
+	cfg := registrationConfig{name: "init"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var report RegistrationReport
+	var registrars []*ast.FuncDecl
+	calls := make(map[string]ast.Stmt)
+	var names []string
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name == cfg.name && d.Body != nil {
+				registrars = append(registrars, d)
+			}
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if _, dup := calls[ts.Name.Name]; dup || !match(ts) {
+					continue
+				}
+				if call := buildCall(ts.Name.Name); call != nil {
+					calls[ts.Name.Name] = &ast.ExprStmt{X: call}
+					names = append(names, ts.Name.Name)
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		if len(registrars) > 0 {
+			report.Registrar = registrars[0]
+		}
+		return report
+	}
+	sort.Strings(names)
+
+	// the registrations already there, by type name
+	registered := make(map[string]ast.Stmt)
+	for _, fd := range registrars {
+		for _, s := range fd.Body.List {
+			for _, name := range names {
+				if Equal(s, calls[name]) {
+					registered[name] = s
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		if registered[name] == nil {
+			report.Registered = append(report.Registered, name)
+		}
+	}
+	if len(report.Registered) == 0 {
+		report.Registrar = registrars[0]
+		return report
+	}
+
+	if len(registrars) == 0 {
+		end := f.End()
+		registrars = append(registrars, &ast.FuncDecl{
+			Name: &ast.Ident{NamePos: end, Name: cfg.name},
+			Type: &ast.FuncType{Func: end, Params: &ast.FieldList{}},
+			Body: &ast.BlockStmt{},
+		})
+		f.Decls = append(f.Decls, registrars[0])
+		report.Created = true
+	}
+	fd := registrars[0]
+	report.Registrar = fd
+
+	// the registrations of fd, sorted, take the place of the first one
+	var sorted []ast.Stmt
+	for _, name := range names {
+		if s := registered[name]; s == nil || containsStmt(fd.Body.List, s) {
+			sorted = append(sorted, calls[name])
+			if s != nil {
+				sorted[len(sorted)-1] = s
+			}
+		}
+	}
+	var list []ast.Stmt
+	placed := false
+	for _, s := range fd.Body.List {
+		if !containsStmt(sorted, s) {
+			list = append(list, s)
+			continue
+		}
+		if !placed {
+			list = append(list, sorted...)
+			placed = true
+		}
+	}
+	if !placed {
+		list = append(list, sorted...)
+	}
+	fd.Body.List = list
+
+	for _, path := range cfg.imports {
+		AddImport(f, path)
+	}
+	return report
+}
+
+// containsStmt reports whether list holds s.
+func containsStmt(list []ast.Stmt, s ast.Stmt) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
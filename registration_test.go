@@ -0,0 +1,123 @@
+package astrewrite
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// registerPlugin builds plugin.Register("name", new(name)).
+func registerPlugin(name string) ast.Expr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{X: ast.NewIdent("plugin"), Sel: ast.NewIdent("Register")},
+		Args: []ast.Expr{
+			&ast.BasicLit{Kind: token.STRING, Value: `"` + name + `"`},
+			&ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{ast.NewIdent(name)}},
+		},
+	}
+}
+
+func isPlugin(ts *ast.TypeSpec) bool {
+	return strings.HasSuffix(ts.Name.Name, "Plugin")
+}
+
+func TestEnsureInitRegistration(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "example.com/plugin"
+
+type ZipPlugin struct{}
+
+type helper struct{}
+
+type (
+	GzipPlugin struct{}
+	TarPlugin  struct{}
+)
+
+func init() {
+	setup()
+	plugin.Register("TarPlugin", new(TarPlugin))
+}
+`)
+
+	want := `package p
+
+import "example.com/plugin"
+
+type ZipPlugin struct{}
+
+type helper struct{}
+
+type (
+	GzipPlugin struct{}
+	TarPlugin  struct{}
+)
+
+func init() {
+	setup()
+	plugin.Register("GzipPlugin", new(GzipPlugin))
+	plugin.Register("TarPlugin", new(TarPlugin))
+	plugin.Register("ZipPlugin", new(ZipPlugin))
+}
+`
+	opts := RegistrationImports("example.com/plugin")
+	report := EnsureInitRegistration(file, isPlugin, registerPlugin, opts)
+	if got := strings.Join(report.Registered, " "); got != "GzipPlugin ZipPlugin" || report.Created {
+		t.Errorf("got report %+v, want GzipPlugin and ZipPlugin registered in the existing init", report)
+	}
+	checkSource(t, fset, file, want)
+
+	// running again changes nothing
+	report = EnsureInitRegistration(file, isPlugin, registerPlugin, opts)
+	if len(report.Registered) != 0 || report.Registrar != findFunc(file, "init") {
+		t.Errorf("got report %+v on the second run, want nothing registered", report)
+	}
+	checkSource(t, fset, file, want)
+}
+
+func TestEnsureInitRegistrationCreate(t *testing.T) {
+	src := `package p
+
+type ZipPlugin struct{}
+
+type GzipPlugin struct{}
+`
+	want := `package p
+
+import "example.com/plugin"
+
+type ZipPlugin struct{}
+
+type GzipPlugin struct{}
+
+func registerPlugins() {
+	plugin.Register("GzipPlugin", new(GzipPlugin))
+	plugin.Register("ZipPlugin", new(ZipPlugin))
+}
+`
+	opts := []RegistrationOption{Registrar("registerPlugins"), RegistrationImports("example.com/plugin")}
+	for i := 0; i < 3; i++ {
+		fset, file := parse(t, src)
+		report := EnsureInitRegistration(file, isPlugin, registerPlugin, opts...)
+		wantRegistered := 0
+		if i == 0 {
+			wantRegistered = 2
+		}
+		if report.Created != (i == 0) || len(report.Registered) != wantRegistered {
+			t.Errorf("run %d: got report %+v, want the registrar created on the first run only", i, report)
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, file); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("run %d: got\n%s\nwant\n%s", i, buf.String(), want)
+		}
+		src = buf.String()
+		want = src
+	}
+}
@@ -0,0 +1,178 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"reflect"
+)
+
+// Behavior describes what happens when the walk function removes a child
+// of a node.
+type Behavior int
+
+const (
+	// UnknownEdge is returned for fields that don't hold children.
+	UnknownEdge Behavior = iota
+	// PropagateRemoval removes the parent along with the child, as the
+	// parent can't do without it. The removal propagates further up if
+	// the parent can't be removed from its own parent either.
+	PropagateRemoval
+	// ClearField sets the field holding the child to nil.
+	ClearField
+	// DropElement drops the child from the slice holding it.
+	DropElement
+	// DropOrPropagate drops the child from the slice holding it, and
+	// removes the parent if the slice ends up empty.
+	DropOrPropagate
+	// NotWalked means the child is never passed to the walk function, so
+	// it can't be removed.
+	NotWalked
+)
+
+func (b Behavior) String() string {
+	switch b {
+	case UnknownEdge:
+		return "unknown edge"
+	case PropagateRemoval:
+		return "propagate"
+	case ClearField:
+		return "clear"
+	case DropElement:
+		return "drop"
+	case DropOrPropagate:
+		return "drop or propagate"
+	case NotWalked:
+		return "not walked"
+	}
+	return "Behavior(?)"
+}
+
+type edgeKey struct {
+	kind, edge string
+}
+
+// removalOverrides holds the behaviors that differ from the default of
+// their kind of edge, see RemovalBehavior.
+var removalOverrides = map[edgeKey]Behavior{
+	// a parameter or result type can't be left out
+	{"Field", "Type"}: PropagateRemoval,
+
+	// lists that make no sense empty
+	{"FieldList", "List"}:        DropOrPropagate,
+	{"GenDecl", "Specs"}:         DropOrPropagate,
+	{"IndexListExpr", "Indices"}: DropOrPropagate,
+
+	// optional fields whose absence changes what the node means
+	{"ArrayType", "Len"}:       PropagateRemoval,
+	{"Ellipsis", "Elt"}:        PropagateRemoval,
+	{"TypeAssertExpr", "Type"}: PropagateRemoval,
+	{"FuncDecl", "Recv"}:       PropagateRemoval,
+	{"ForStmt", "Cond"}:        PropagateRemoval,
+	{"SwitchStmt", "Tag"}:      PropagateRemoval,
+
+	// removable as a whole, see FuncType and InterfaceType
+	{"FuncType", "Params"}:       ClearField,
+	{"InterfaceType", "Methods"}: ClearField,
+
+	// not part of the schema, which leaves out ast.Package
+	{"Package", "Files"}: DropElement,
+}
+
+// removal holds the behavior of every edge, built from the schema.
+var removal = func() map[edgeKey]Behavior {
+	m := make(map[edgeKey]Behavior)
+	for kind, edges := range schema {
+		for _, e := range edges {
+			b := PropagateRemoval
+			switch e.Kind {
+			case EdgeOptional:
+				b = ClearField
+			case EdgeSlice:
+				b = DropElement
+			}
+			m[edgeKey{kind, e.Name}] = b
+		}
+	}
+	for k, b := range removalOverrides {
+		m[k] = b
+	}
+	return m
+}()
+
+// RemovalBehavior returns what happens when the walk function removes the
+// child held by the field edgeName of a node of type parentKind, named like
+// in Schema, for example RemovalBehavior("IfStmt", "Cond"). The walker
+// follows this table.
+//
+// By default, removing a child that is always set removes the parent,
+// removing an optional child clears its field, and removing an element of a
+// slice drops it. The exceptions are
+//
+//   - the type of a Field, the length of an ArrayType, the element type of
+//     an Ellipsis, the type of a TypeAssertExpr, the receiver of a
+//     FuncDecl, the condition of a ForStmt and the tag of a SwitchStmt,
+//     whose removal removes the parent
+//   - the fields of a FieldList, the specs of a GenDecl and the indices of
+//     an IndexListExpr, whose parent is removed once they are all gone
+//   - the parameters of a FuncType and the methods of an InterfaceType,
+//     which are cleared
+//   - the terms of union type elements, which are dropped from the union
+//     instead of removing the BinaryExpr holding them
+//
+// Files removed from an ast.Package are deleted from its Files.
+func RemovalBehavior(parentKind, edgeName string) Behavior {
+	return removal[edgeKey{parentKind, edgeName}]
+}
+
+// walkEdge walks the child of parent held by edge and returns what takes its
+// place. It returns false if parent has to be removed along with the
+// removed child, in which case the child is returned to stay in place, so
+// that the removed parent remains well-formed. A child of the wrong type
+// panics, like it would when assigned.
+func walkEdge[T ast.Node](w *walker, parent ast.Node, edge string, child T) (T, bool) {
+	if isNil(child) {
+		return child, true
+	}
+	rewritten := w.walk(child)
+	if !isNil(rewritten) {
+		return rewritten.(T), true
+	}
+	kind := reflect.TypeOf(parent).Elem().Name()
+	if removal[edgeKey{kind, edge}] == PropagateRemoval {
+		return child, false
+	}
+	var zero T
+	return zero, true
+}
+
+// walkList walks the children of parent held by the slice edge, like
+// walkEdge. It returns false if parent has to be removed because the list
+// was emptied, see DropOrPropagate.
+func walkList[T ast.Node](w *walker, parent ast.Node, edge string, list []T) ([]T, bool) {
+	if len(list) == 0 {
+		return list, true
+	}
+	list = walkNodes(w, list)
+	kind := reflect.TypeOf(parent).Elem().Name()
+	return list, len(list) > 0 || removal[edgeKey{kind, edge}] != DropOrPropagate
+}
+
+// walkNodes walks each node of list and returns the rewritten list, without
+// the nodes that were removed or replaced by a node of another type. It
+// reuses the backing array of list.
+func walkNodes[T ast.Node](w *walker, list []T) []T {
+	out := list[:0]
+	for _, x := range list {
+		v := w.walk(x)
+		if e, ok := v.(ast.Expr); ok && w.wrapExprs {
+			if _, ok := v.(T); !ok {
+				v = AsStmt(e)
+			}
+		}
+		if v, ok := v.(T); ok {
+			out = append(out, v)
+		} else {
+			w.remove(x)
+		}
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+// TestRemovalBehavior removes every child of the schema from a node holding
+// one child per edge and checks that the walker does what RemovalBehavior
+// declares.
+func TestRemovalBehavior(t *testing.T) {
+	for name, edges := range schema {
+		for i, e := range edges {
+			b := RemovalBehavior(name, e.Name)
+			if b == UnknownEdge {
+				t.Errorf("%s.%s: no removal behavior", name, e.Name)
+				continue
+			}
+
+			node, children := schemaNode(name, true)
+			child := children[i]
+			shown := false
+			var rewritten ast.Node
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%s.%s: removal panics: %v", name, e.Name, r)
+					}
+				}()
+				rewritten = Walk(node, func(n ast.Node) (ast.Node, bool) {
+					if n == child {
+						shown = true
+						return nil, false
+					}
+					return n, true
+				})
+			}()
+
+			field := reflect.ValueOf(node).Elem().FieldByName(e.Name)
+			var ok bool
+			switch b {
+			case NotWalked:
+				ok = !shown && rewritten == node
+			case PropagateRemoval:
+				ok = isNil(rewritten)
+			case ClearField:
+				ok = rewritten == node && field.IsNil()
+			case DropElement:
+				ok = rewritten == node && field.Len() == 0
+			case DropOrPropagate:
+				// the only element is gone
+				ok = isNil(rewritten)
+			}
+			if !ok {
+				t.Errorf("%s.%s: removal doesn't %v", name, e.Name, b)
+			}
+		}
+	}
+}
+
+func TestRemovalBehaviorPackage(t *testing.T) {
+	pkg := &ast.Package{Files: map[string]*ast.File{
+		"a.go": {Name: ast.NewIdent("a")},
+		"b.go": {Name: ast.NewIdent("b")},
+	}}
+	Walk(pkg, func(n ast.Node) (ast.Node, bool) {
+		if f, ok := n.(*ast.File); ok && f.Name.Name == "a" {
+			return nil, false
+		}
+		return n, true
+	})
+	if len(pkg.Files) != 1 || pkg.Files["b.go"] == nil {
+		t.Errorf("got files %v, want b.go", pkg.Files)
+	}
+	if b := RemovalBehavior("Package", "Files"); b != DropElement {
+		t.Errorf("Package.Files: got %v, want %v", b, DropElement)
+	}
+	if b := RemovalBehavior("IfStmt", "Pos"); b != UnknownEdge {
+		t.Errorf("IfStmt.Pos: got %v, want %v", b, UnknownEdge)
+	}
+}
+
+func TestRemovalBehaviorMeaning(t *testing.T) {
+	// clearing the condition would loop forever, clearing the tag wouldn't
+	// compile, so the statements go along with them
+	for _, src := range []string{
+		`for cond() {
+		work()
+	}`,
+		`switch cond() {
+	case 1:
+		work()
+	}`,
+	} {
+		_, file := parse(t, "package p\n\nfunc f() {\n\t"+src+"\n\tdone()\n}\n")
+		Walk(file, func(n ast.Node) (ast.Node, bool) {
+			if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "cond") {
+				return nil, false
+			}
+			return n, true
+		})
+		body := findFunc(file, "f").Body.List
+		if len(body) != 1 {
+			t.Errorf("%s: got %d statements left, want done() only", src, len(body))
+		}
+	}
+	for _, e := range [][2]string{{"ForStmt", "Cond"}, {"SwitchStmt", "Tag"}} {
+		if b := RemovalBehavior(e[0], e[1]); b != PropagateRemoval {
+			t.Errorf("%s.%s: got %v, want %v", e[0], e[1], b, PropagateRemoval)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// RenameReport describes what RenameAll did.
+type RenameReport struct {
+	// Renamed maps the renamed objects to their new names.
+	Renamed map[types.Object]string
+
+	// Refused holds the objects that weren't renamed because their names
+	// matter or the new name would conflict, in source order.
+	Refused []RenameRefusal
+}
+
+// RenameRefusal describes an object RenameAll didn't rename.
+type RenameRefusal struct {
+	Object types.Object
+	Reason string
+}
+
+// RenameAll renames the non-exported objects declared in files, the files of
+// a package type checked into info, as given by policy. Declarations and
+// uses are renamed together, across all files. policy returns the new name
+// of an object and whether to rename it at all; info must hold Defs, Uses
+// and Implicits.
+//
+// Objects whose names matter are never renamed and are reported as refused:
+// struct fields with tags, which reflection-based encoders read, objects
+// named by //go:linkname or //export directives, methods sharing their name
+// with a method of an interface, embedded fields and the types embedded by
+// them, the implicit variables of type switches, and init and main
+// functions. Imported package names and labels are left alone. Renames that
+// would make a name conflict with or capture another one are refused too.
+func RenameAll(files []*ast.File, info *types.Info, policy func(obj types.Object) (string, bool)) RenameReport {
+	r := &renamer{
+		info:   info,
+		report: RenameReport{Renamed: make(map[types.Object]string)},
+		idents: make(map[types.Object][]*ast.Ident),
+		fields: make(map[types.Object]*fieldSet),
+	}
+	load := r.loadBearing(files)
+
+	var objs []types.Object
+	seen := make(map[types.Object]bool)
+	for id, obj := range info.Defs {
+		if obj != nil && !seen[obj] && obj.Pkg() != nil && !obj.Exported() && obj.Name() != "_" {
+			seen[obj] = true
+			objs = append(objs, obj)
+		}
+		if obj != nil {
+			r.idents[obj] = append(r.idents[obj], id)
+		}
+	}
+	for id, obj := range info.Uses {
+		r.idents[obj] = append(r.idents[obj], id)
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Pos() < objs[j].Pos() })
+
+	// Defs and Uses are maps; order everything taken from them by position
+	// so the reported conflicts don't depend on their iteration order
+	for obj, ids := range r.idents {
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+		r.objects = append(r.objects, obj)
+	}
+	sort.Slice(r.objects, func(i, j int) bool {
+		return r.idents[r.objects[i]][0].Pos() < r.idents[r.objects[j]][0].Pos()
+	})
+
+	for _, obj := range objs {
+		switch obj.(type) {
+		case *types.PkgName, *types.Label:
+			continue
+		}
+		if reason, ok := load[obj]; ok {
+			r.refuse(obj, reason)
+			continue
+		}
+		name, ok := policy(obj)
+		if !ok || name == obj.Name() {
+			continue
+		}
+		if reason := r.conflict(obj, name); reason != "" {
+			r.refuse(obj, reason)
+			continue
+		}
+		r.report.Renamed[obj] = name
+		r.renamed = append(r.renamed, obj)
+	}
+
+	for obj, name := range r.report.Renamed {
+		for _, id := range r.idents[obj] {
+			id.Name = name
+		}
+	}
+	return r.report
+}
+
+type renamer struct {
+	info   *types.Info
+	report RenameReport
+
+	// idents holds the identifiers defining and using each object, in
+	// source order, and objects its keys, ordered by their first identifier
+	idents  map[types.Object][]*ast.Ident
+	objects []types.Object
+
+	// renamed holds the keys of report.Renamed in the order they were
+	// decided
+	renamed []types.Object
+
+	// fields holds the fields of the struct declaring each field
+	fields map[types.Object]*fieldSet
+}
+
+// fieldSet holds the fields of a struct type and the named type it's the
+// underlying type of, if any.
+type fieldSet struct {
+	fields []types.Object
+	named  *types.TypeName
+}
+
+func (r *renamer) refuse(obj types.Object, reason string) {
+	r.report.Refused = append(r.report.Refused, RenameRefusal{Object: obj, Reason: reason})
+}
+
+// name returns the name obj has after the renames decided so far.
+func (r *renamer) name(obj types.Object) string {
+	if name, ok := r.report.Renamed[obj]; ok {
+		return name
+	}
+	return obj.Name()
+}
+
+// loadBearing returns the objects declared in files whose names matter,
+// along with the reason.
+func (r *renamer) loadBearing(files []*ast.File) map[types.Object]string {
+	load := make(map[types.Object]string)
+	directives := make(map[string]string)
+	interfaceMethods := make(map[string]bool)
+	for _, f := range files {
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				for _, d := range []string{"//go:linkname ", "//export "} {
+					if fields := strings.Fields(strings.TrimPrefix(c.Text, d)); strings.HasPrefix(c.Text, d) && len(fields) > 0 {
+						directives[fields[0]] = "named by " + strings.TrimSpace(d)
+					}
+				}
+			}
+		}
+		named := make(map[*ast.StructType]*types.TypeName)
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.TypeSpec:
+				if st, ok := n.Type.(*ast.StructType); ok {
+					named[st], _ = r.info.Defs[n.Name].(*types.TypeName)
+				}
+			case *ast.InterfaceType:
+				for _, m := range n.Methods.List {
+					for _, id := range m.Names {
+						interfaceMethods[id.Name] = true
+					}
+				}
+			case *ast.StructType:
+				set := &fieldSet{named: named[n]}
+				for _, field := range n.Fields.List {
+					for _, id := range field.Names {
+						if obj := r.info.Defs[id]; obj != nil {
+							set.fields = append(set.fields, obj)
+							r.fields[obj] = set
+						}
+					}
+					if len(field.Names) == 0 {
+						id := embeddedName(field.Type)
+						if id == nil {
+							continue
+						}
+						if obj := r.info.Defs[id]; obj != nil {
+							set.fields = append(set.fields, obj)
+							load[obj] = "embedded field"
+						}
+						if obj := r.info.Uses[id]; obj != nil {
+							load[obj] = "embedded type"
+						}
+						continue
+					}
+					if field.Tag == nil {
+						continue
+					}
+					for _, id := range field.Names {
+						if obj := r.info.Defs[id]; obj != nil {
+							load[obj] = "field has a tag"
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	for _, obj := range r.info.Implicits {
+		load[obj] = "implicit variable"
+	}
+	for _, obj := range r.info.Defs {
+		if obj == nil {
+			continue
+		}
+		fn, isFunc := obj.(*types.Func)
+		switch {
+		case obj.Parent() == obj.Pkg().Scope() && directives[obj.Name()] != "":
+			load[obj] = directives[obj.Name()]
+		case isFunc && obj.Parent() == obj.Pkg().Scope() && (obj.Name() == "init" || obj.Name() == "main"):
+			load[obj] = "special function"
+		case isFunc && fn.Type().(*types.Signature).Recv() != nil && interfaceMethods[obj.Name()]:
+			load[obj] = "method of an interface"
+		}
+	}
+	return load
+}
+
+// embeddedName returns the type name of an embedded field of type typ.
+func embeddedName(typ ast.Expr) *ast.Ident {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	}
+	return nil
+}
+
+// conflict returns why obj can't be renamed to name, or "".
+func (r *renamer) conflict(obj types.Object, name string) string {
+	// fields and methods live in the namespace of their type
+	if v, ok := obj.(*types.Var); ok && v.IsField() {
+		return r.fieldConflict(v, name)
+	}
+	if fn, ok := obj.(*types.Func); ok && fn.Type().(*types.Signature).Recv() != nil {
+		return r.methodConflict(fn, name)
+	}
+
+	scope := obj.Parent()
+	if scope == nil {
+		return "unknown scope"
+	}
+	pkgScope := obj.Pkg().Scope()
+
+	// the uses of obj mustn't resolve to another object of that name
+	for _, id := range r.idents[obj] {
+		s := pkgScope.Innermost(id.Pos())
+		if s == nil {
+			s = scope
+		}
+		if _, other := s.LookupParent(name, id.Pos()); other != nil && other != obj && r.name(other) == name {
+			return "conflicts with " + other.String()
+		}
+		for _, other := range r.renamed {
+			n, p := r.report.Renamed[other], other.Parent()
+			if n != name || p == nil || !inScope(p, pkgScope, id.Pos()) || (p != pkgScope && other.Pos() > id.Pos()) {
+				continue
+			}
+			if p == scope || encloses(scope, p) {
+				return "conflicts with " + other.String()
+			}
+		}
+	}
+	scopes := []*types.Scope{scope}
+	if scope == pkgScope {
+		// package level names mustn't collide with imports either
+		for i := 0; i < scope.NumChildren(); i++ {
+			scopes = append(scopes, scope.Child(i))
+		}
+	}
+	for _, s := range scopes {
+		for _, other := range s.Names() {
+			if o := s.Lookup(other); o != obj && r.name(o) == name {
+				return "conflicts with " + o.String()
+			}
+		}
+	}
+
+	// and the uses of objects declared outside of the scope of obj
+	// mustn't resolve to obj
+	for _, other := range r.objects {
+		if other == obj || r.name(other) != name {
+			continue
+		}
+		for _, id := range r.idents[other] {
+			if id.Pos() < obj.Pos() && scope != pkgScope {
+				continue
+			}
+			if inScope(scope, pkgScope, id.Pos()) && other.Parent() != nil && encloses(other.Parent(), scope) {
+				return "would capture " + other.String()
+			}
+		}
+	}
+	return ""
+}
+
+// inScope reports whether pos is inside scope, which for the package scope
+// means inside any of its files.
+func inScope(scope, pkgScope *types.Scope, pos token.Pos) bool {
+	if scope == pkgScope {
+		return pkgScope.Innermost(pos) != nil
+	}
+	return scope.Contains(pos)
+}
+
+// encloses reports whether outer is inner or one of its parents, other than
+// inner itself being the scope of the object.
+func encloses(outer, inner *types.Scope) bool {
+	for s := inner.Parent(); s != nil; s = s.Parent() {
+		if s == outer {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldConflict returns why the field v can't be renamed to name, or "".
+func (r *renamer) fieldConflict(v *types.Var, name string) string {
+	set := r.fields[v]
+	if set == nil {
+		return "unknown struct"
+	}
+	for _, f := range set.fields {
+		if f != v && r.name(f) == name {
+			return "conflicts with " + f.String()
+		}
+	}
+	if set.named != nil {
+		if named, ok := set.named.Type().(*types.Named); ok {
+			for i := 0; i < named.NumMethods(); i++ {
+				if m := named.Method(i); r.name(m) == name {
+					return "conflicts with " + m.String()
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// methodConflict returns why the method fn can't be renamed to name, or "".
+func (r *renamer) methodConflict(fn *types.Func, name string) string {
+	recv := fn.Type().(*types.Signature).Recv().Type()
+	if p, ok := recv.(*types.Pointer); ok {
+		recv = p.Elem()
+	}
+	named, ok := recv.(*types.Named)
+	if !ok {
+		return "unknown receiver"
+	}
+	for i := 0; i < named.NumMethods(); i++ {
+		if m := named.Method(i); m != fn && r.name(m) == name {
+			return "conflicts with " + m.String()
+		}
+	}
+	if s, ok := named.Underlying().(*types.Struct); ok {
+		for i := 0; i < s.NumFields(); i++ {
+			if f := s.Field(i); r.name(f) == name {
+				return "conflicts with " + f.String()
+			}
+		}
+	}
+	return ""
+}
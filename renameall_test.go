@@ -0,0 +1,141 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestRenameAll(t *testing.T) {
+	srcs := []string{`package p
+
+type config struct {
+	Name    string ` + "`json:\"name\"`" + `
+	retries int    ` + "`json:\"retries\"`" + `
+	timeout int
+}
+
+type runner interface {
+	run() error
+}
+
+type job struct{ cfg config }
+
+func (j *job) run() error { return nil }
+
+func (j *job) describe() string {
+	total := j.cfg.retries + j.cfg.timeout
+	return j.cfg.Name + itoa(total)
+}
+
+func New(name string) runner {
+	c := config{Name: name, timeout: 3}
+	return &job{cfg: c}
+}
+`, `package p
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+func itoa(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	var digits []byte
+	for n > 0 {
+		digits = append([]byte{byte('0' + n%10)}, digits...)
+		n /= 10
+	}
+	return string(digits)
+}
+`}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, src := range srcs {
+		f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	info := &types.Info{
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	if _, err := new(types.Config).Check("p", fset, files, info); err != nil {
+		t.Fatal(err)
+	}
+
+	i := 0
+	report := RenameAll(files, info, func(obj types.Object) (string, bool) {
+		switch obj.Name() {
+		case "n":
+			return "", false
+		case "digits":
+			// conflicts with the parameter n, which is kept
+			return "n", true
+		}
+		i++
+		return fmt.Sprintf("x%d", i), true
+	})
+
+	refused := make(map[string]string)
+	for _, r := range report.Refused {
+		refused[r.Object.Name()] += r.Reason + ";"
+	}
+	wantRefused := map[string]string{
+		"retries":  "field has a tag;",
+		"run":      "method of an interface;method of an interface;",
+		"nanotime": "named by //go:linkname;",
+		"digits":   "conflicts with var n int;",
+	}
+	if fmt.Sprint(refused) != fmt.Sprint(wantRefused) {
+		t.Errorf("got refused %v, want %v", refused, wantRefused)
+	}
+
+	var renamed []string
+	for obj := range report.Renamed {
+		renamed = append(renamed, obj.Name())
+	}
+	// config, timeout, runner, job, cfg, j twice, describe, total, name,
+	// c and itoa
+	if len(renamed) != 12 {
+		t.Errorf("renamed %d objects, want 12: %v", len(renamed), renamed)
+	}
+
+	var out []string
+	for _, f := range files {
+		out = append(out, render(t, fset, f))
+	}
+	src := strings.Join(out, "\n")
+	for _, name := range []string{"retries int", "Name ", "run()", "func nanotime", "digits", "n int", "func New("} {
+		if !strings.Contains(src, name) {
+			t.Errorf("%q renamed:\n%s", name, src)
+		}
+	}
+	for _, name := range []string{"config", "timeout", "runner", "describe", "total", "itoa", " c "} {
+		if strings.Contains(src, name) {
+			t.Errorf("%q not renamed:\n%s", name, src)
+		}
+	}
+
+	// the renamed package still type checks
+	fset2 := token.NewFileSet()
+	var printed []*ast.File
+	for _, o := range out {
+		f, err := parser.ParseFile(fset2, "", o, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		printed = append(printed, f)
+	}
+	if _, err := new(types.Config).Check("p", fset2, printed, nil); err != nil {
+		t.Errorf("renamed package doesn't type check: %v\n%s", err, src)
+	}
+}
@@ -0,0 +1,198 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// Placement tells ReorderTopLevel where to put a kind of function among the
+// other functions.
+type Placement int
+
+const (
+	// InPlace keeps the function where it is relative to the others.
+	InPlace Placement = iota
+	// First moves the function before all other functions.
+	First
+	// Last moves the function after all other functions.
+	Last
+)
+
+// ReorderOption configures ReorderTopLevel.
+type ReorderOption func(*reorderConfig)
+
+type reorderConfig struct {
+	fset *token.FileSet
+	init Placement
+	main Placement
+}
+
+// PlaceInit sets the placement of init functions, InPlace by default.
+func PlaceInit(p Placement) ReorderOption {
+	return func(c *reorderConfig) {
+		c.init = p
+	}
+}
+
+// PlaceMain sets the placement of the main function, InPlace by default.
+func PlaceMain(p Placement) ReorderOption {
+	return func(c *reorderConfig) {
+		c.main = p
+	}
+}
+
+// ReorderFileSet passes the FileSet file was parsed with, which is needed to
+// print the reordered file faithfully.
+func ReorderFileSet(fset *token.FileSet) ReorderOption {
+	return func(c *reorderConfig) {
+		c.fset = fset
+	}
+}
+
+// ReorderTopLevel stably sorts the declarations of file into imports,
+// constants, variables, types and functions, methods included. Init and main
+// functions are placed as configured with PlaceInit and PlaceMain.
+//
+// Given ReorderFileSet, every declaration moves along with the lines before
+// it up to the previous declaration, which carry its doc comment and any
+// other comments in between. The positions of file then refer to a copy of
+// its token.File added to the FileSet, whose line table is rearranged to
+// match, and whose offsets no longer correspond to the original source; the
+// token.File itself, which other nodes may share, is left alone. Without a
+// FileSet, or if declarations share lines, only the order of file.Decls
+// changes and comments are printed at their old places.
+func ReorderTopLevel(file *ast.File, opts ...ReorderOption) {
+	var cfg reorderConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	rank := func(d ast.Decl) int {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			switch d.Tok {
+			case token.IMPORT:
+				return 0
+			case token.CONST:
+				return 1
+			case token.VAR:
+				return 2
+			case token.TYPE:
+				return 3
+			}
+		case *ast.FuncDecl:
+			p := InPlace
+			if d.Recv == nil && d.Name.Name == "init" {
+				p = cfg.init
+			} else if d.Recv == nil && d.Name.Name == "main" {
+				p = cfg.main
+			}
+			switch p {
+			case First:
+				return 4
+			case Last:
+				return 6
+			}
+			return 5
+		}
+		return 5
+	}
+
+	decls := make([]ast.Decl, len(file.Decls))
+	copy(decls, file.Decls)
+	sort.SliceStable(decls, func(i, j int) bool {
+		return rank(decls[i]) < rank(decls[j])
+	})
+
+	if cfg.fset != nil {
+		moveDecls(cfg.fset, file, decls)
+	}
+	file.Decls = decls
+}
+
+// moveDecls moves the positions of file to a copy of its token.File in fset,
+// rearranged so that the declarations appear in the order of decls, moving
+// the lines between declarations along with the following one.
+func moveDecls(fset *token.FileSet, file *ast.File, decls []ast.Decl) {
+	if len(decls) == 0 || !file.Package.IsValid() {
+		return
+	}
+	tf := fset.File(file.Package)
+	lineAfter := func(pos token.Pos) int {
+		if line := tf.Line(pos); line < tf.LineCount() {
+			return tf.Offset(tf.LineStart(line + 1))
+		}
+		return tf.Size()
+	}
+
+	// bounds[i] is the offset where the lines of file.Decls[i] start.
+	bounds := make([]int, len(file.Decls)+1)
+	index := make(map[ast.Decl]int)
+	for i, d := range file.Decls {
+		start := d.Pos()
+		if doc := docComment(d); doc != nil {
+			start = doc.Pos()
+		}
+		if !start.IsValid() || !d.End().IsValid() {
+			return
+		}
+		if i == 0 {
+			bounds[i] = tf.Offset(tf.LineStart(tf.Line(start)))
+		} else {
+			bounds[i] = lineAfter(file.Decls[i-1].End() - 1)
+		}
+		if bounds[i] > tf.Offset(start) || (i > 0 && bounds[i] < bounds[i-1]) {
+			return
+		}
+		index[d] = i
+	}
+	bounds[len(file.Decls)] = lineAfter(file.Decls[len(file.Decls)-1].End() - 1)
+
+	// Lay out the segments in their new order and compute the new line
+	// table along the way.
+	delta := make([]int, len(file.Decls))
+	oldLines := tf.Lines()
+	var lines []int
+	for _, l := range oldLines {
+		if l < bounds[0] {
+			lines = append(lines, l)
+		}
+	}
+	offset := bounds[0]
+	for _, d := range decls {
+		i := index[d]
+		delta[i] = offset - bounds[i]
+		for _, l := range oldLines {
+			if l >= bounds[i] && l < bounds[i+1] {
+				lines = append(lines, l+delta[i])
+			}
+		}
+		offset += bounds[i+1] - bounds[i]
+	}
+	for _, l := range oldLines {
+		if l >= bounds[len(bounds)-1] {
+			lines = append(lines, l)
+		}
+	}
+
+	nf := fset.AddFile(tf.Name(), -1, tf.Size())
+	if !nf.SetLines(lines) {
+		return
+	}
+	base := tf.Base()
+	mapPositions(file, func(p token.Pos) token.Pos {
+		if !p.IsValid() || int(p) < base || int(p) > base+tf.Size() {
+			return p
+		}
+		off := int(p) - base
+		if off >= bounds[0] && off < bounds[len(bounds)-1] {
+			i := sort.Search(len(file.Decls), func(i int) bool { return bounds[i+1] > off })
+			off += delta[i]
+		}
+		return nf.Pos(off)
+	})
+	sort.Slice(file.Comments, func(i, j int) bool {
+		return file.Comments[i].Pos() < file.Comments[j].Pos()
+	})
+}
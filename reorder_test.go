@@ -0,0 +1,113 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestReorderTopLevel(t *testing.T) {
+	fset, file := parse(t, `package main
+
+import "fmt"
+
+// main runs.
+func main() {
+	// Say hello.
+	fmt.Println(greeting)
+}
+
+// T is a type.
+type T int
+
+func init() {}
+
+// greeting is printed by main.
+var greeting = "hello"
+
+// String implements fmt.Stringer.
+func (T) String() string { return "T" }
+
+// Floating comment.
+
+const (
+	a = 1 // a is one
+	b = 2
+)
+`)
+
+	tf := fset.File(file.Package)
+	lines := tf.Lines()
+	ReorderTopLevel(file, ReorderFileSet(fset), PlaceInit(First), PlaceMain(Last))
+	// the token.File of the source is left alone
+	if !reflect.DeepEqual(tf.Lines(), lines) {
+		t.Error("the lines of the token.File changed")
+	}
+	if fset.File(file.Package) == tf {
+		t.Error("the positions of the file weren't moved to a copy of its token.File")
+	}
+
+	checkSource(t, fset, file, `package main
+
+import "fmt"
+
+// Floating comment.
+
+const (
+	a = 1 // a is one
+	b = 2
+)
+
+// greeting is printed by main.
+var greeting = "hello"
+
+// T is a type.
+type T int
+
+func init() {}
+
+// String implements fmt.Stringer.
+func (T) String() string { return "T" }
+
+// main runs.
+func main() {
+	// Say hello.
+	fmt.Println(greeting)
+}
+`)
+}
+
+func TestReorderTopLevelDecls(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() {}
+func init() {}
+type T int
+var v int
+func main() {}
+const c = 0
+func (T) m() {}
+var w int
+`)
+
+	ReorderTopLevel(file, PlaceMain(First))
+
+	var got []string
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			switch s := d.Specs[0].(type) {
+			case *ast.ValueSpec:
+				got = append(got, s.Names[0].Name)
+			case *ast.TypeSpec:
+				got = append(got, s.Name.Name)
+			}
+		case *ast.FuncDecl:
+			got = append(got, d.Name.Name)
+		}
+	}
+	want := []string{"c", "v", "w", "T", "main", "f", "init", "m"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,228 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// returnStmts returns the return statements of the function body, leaving
+// out the ones belonging to function literals.
+func returnStmts(body *ast.BlockStmt) []*ast.ReturnStmt {
+	var rets []*ast.ReturnStmt
+	if body == nil {
+		return nil
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			rets = append(rets, n)
+		}
+		return true
+	})
+	return rets
+}
+
+// resultNames returns the names of the results of fd, or nil if they're
+// unnamed.
+func resultNames(fd *ast.FuncDecl) []*ast.Ident {
+	var names []*ast.Ident
+	if fd.Type.Results == nil {
+		return nil
+	}
+	for _, f := range fd.Type.Results.List {
+		names = append(names, f.Names...)
+	}
+	return names
+}
+
+// ExpandNakedReturns rewrites the naked returns of a function with named
+// results into returns listing the results explicitly. It fails if one of
+// the results is the blank identifier, which can't be referred to.
+func ExpandNakedReturns(fd *ast.FuncDecl) error {
+	names := resultNames(fd)
+	if len(names) == 0 {
+		return nil
+	}
+
+	for _, ret := range returnStmts(fd.Body) {
+		if len(ret.Results) > 0 {
+			continue
+		}
+		for _, name := range names {
+			if name.Name == "_" {
+				return fmt.Errorf("astrewrite: can't expand naked return of %s with blank result", fd.Name.Name)
+			}
+		}
+		for _, name := range names {
+			ret.Results = append(ret.Results, &ast.Ident{NamePos: ret.Return, Name: name.Name})
+		}
+	}
+	return nil
+}
+
+// WrapReturns replaces every result expression of the return statements of
+// fd with the one returned by wrap, which is called with the index of the
+// result. Returning nil from wrap leaves the expression alone. Naked returns
+// are expanded first; returns forwarding a multi-valued call are skipped
+// since their results can't be wrapped one by one.
+func WrapReturns(fd *ast.FuncDecl, wrap func(resultIndex int, e ast.Expr) ast.Expr) error {
+	if err := ExpandNakedReturns(fd); err != nil {
+		return err
+	}
+
+	n := fd.Type.Results.NumFields()
+	for _, ret := range returnStmts(fd.Body) {
+		if len(ret.Results) != n {
+			continue
+		}
+		for i, e := range ret.Results {
+			if v := wrap(i, e); v != nil {
+				ret.Results[i] = v
+			}
+		}
+	}
+	return nil
+}
+
+// NameResults names the unnamed results of fd, so that a deferred function
+// can read and set them, like the error of func f() (int, error) becoming
+// err in func f() (r int, err error). names holds the name of every result
+// in order; results without one, or with an empty one, get a name that
+// doesn't collide with any identifier of fd, err for errors and r
+// otherwise. It fails if fd has no results, if they're already named or if
+// a given name is already used in fd, as a parameter or a variable of the
+// body it would collide with. Naked returns don't need updating: a function
+// with unnamed results can't have any.
+func NameResults(fd *ast.FuncDecl, names ...string) error {
+	results := fd.Type.Results
+	if results.NumFields() == 0 {
+		return fmt.Errorf("astrewrite: %s has no results to name", fd.Name.Name)
+	}
+	if len(resultNames(fd)) > 0 {
+		return fmt.Errorf("astrewrite: results of %s are already named", fd.Name.Name)
+	}
+	if len(names) > len(results.List) {
+		return fmt.Errorf("astrewrite: %d names for the %d results of %s", len(names), len(results.List), fd.Name.Name)
+	}
+
+	gen := NewNameGen(fd)
+	given := make(map[string]bool)
+	for _, name := range names {
+		if name == "" || name == "_" {
+			continue
+		}
+		if !token.IsIdentifier(name) {
+			return fmt.Errorf("astrewrite: invalid result name %q", name)
+		}
+		if mentions(fd, name) || given[name] {
+			return fmt.Errorf("astrewrite: result name %s is already used in %s", name, fd.Name.Name)
+		}
+		given[name] = true
+	}
+	gen.Reserve(names...)
+
+	for i, f := range results.List {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		switch {
+		case name != "":
+		case isIdent(f.Type, "error"):
+			name = gen.Name("err")
+		default:
+			name = gen.Name("r")
+		}
+		f.Names = []*ast.Ident{{NamePos: f.Type.Pos(), Name: name}}
+	}
+	if !results.Opening.IsValid() {
+		results.Opening = results.Pos()
+		results.Closing = results.End()
+	}
+	return nil
+}
+
+// UnnameResults removes the names of the results of fd, splitting grouped
+// ones like (a, b int) into (int, int). It fails if fd has a naked return
+// or if its body mentions one of the names, even as another identifier of
+// the same name, since the body would depend on them.
+func UnnameResults(fd *ast.FuncDecl) error {
+	names := resultNames(fd)
+	if len(names) == 0 {
+		return nil
+	}
+	for _, ret := range returnStmts(fd.Body) {
+		if len(ret.Results) == 0 {
+			return fmt.Errorf("astrewrite: naked return of %s depends on its result names", fd.Name.Name)
+		}
+	}
+	for _, name := range names {
+		if name.Name != "_" && fd.Body != nil && mentions(fd.Body, name.Name) {
+			return fmt.Errorf("astrewrite: body of %s refers to result %s", fd.Name.Name, name.Name)
+		}
+	}
+
+	results := fd.Type.Results
+	var list []*ast.Field
+	for _, f := range results.List {
+		for i := range f.Names {
+			field := &ast.Field{Type: f.Type}
+			if i > 0 {
+				field.Type = Clone(f.Type).(ast.Expr)
+			}
+			if i == 0 {
+				field.Doc = f.Doc
+			}
+			if i == len(f.Names)-1 {
+				field.Comment = f.Comment
+			}
+			list = append(list, field)
+		}
+	}
+	results.List = list
+	return nil
+}
+
+// ExpandNakedReturnsIfLong expands the naked returns of the functions of
+// file with more than maxStmts statements, like ExpandNakedReturns, and
+// leaves shorter ones alone, where the results are easy to keep track of.
+// Statements are counted through the whole body, nested ones and those of
+// function literals included, except for blocks, which only group others.
+// Functions with a blank result are skipped, since their naked returns
+// can't be expanded. It returns the number of functions whose returns were
+// expanded.
+func ExpandNakedReturnsIfLong(file *ast.File, maxStmts int) int {
+	n := 0
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil || countStmts(fd.Body) <= maxStmts {
+			continue
+		}
+		naked := false
+		for _, ret := range returnStmts(fd.Body) {
+			naked = naked || len(ret.Results) == 0
+		}
+		if naked && len(resultNames(fd)) > 0 && ExpandNakedReturns(fd) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// countStmts returns the number of statements below body, blocks aside.
+func countStmts(body *ast.BlockStmt) int {
+	n := 0
+	ast.Inspect(body, func(node ast.Node) bool {
+		if _, ok := node.(ast.Stmt); ok {
+			n++
+		}
+		if _, ok := node.(*ast.BlockStmt); ok {
+			n--
+		}
+		return true
+	})
+	return n
+}
@@ -0,0 +1,184 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestWrapReturns(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func open(name string) (f *file, err error) {
+	if name == "" {
+		return nil, errEmpty
+	}
+	f = &file{name: name}
+	cleanup := func() (*file, error) {
+		return nil, nil
+	}
+	_ = cleanup
+	return
+}
+`)
+
+	wrap := func(i int, e ast.Expr) ast.Expr {
+		if i != 0 {
+			return nil
+		}
+		return &ast.CallExpr{Fun: ast.NewIdent("wrap"), Args: []ast.Expr{e}}
+	}
+	if err := WrapReturns(findFunc(file, "open"), wrap); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSource(t, fset, file, `package p
+
+func open(name string) (f *file, err error) {
+	if name == "" {
+		return wrap(nil), errEmpty
+	}
+	f = &file{name: name}
+	cleanup := func() (*file, error) {
+		return nil, nil
+	}
+	_ = cleanup
+	return wrap(f), err
+}
+`)
+}
+
+func TestExpandNakedReturnsBlank(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() (_ int, err error) {
+	return
+}
+`)
+	if err := ExpandNakedReturns(findFunc(file, "f")); err == nil {
+		t.Error("expanded a naked return with a blank result")
+	}
+}
+
+func TestNameResults(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func (s *store) load(key string) (*item, bool, error) {
+	r := s.m[key]
+	return r, r != nil, nil
+}
+
+func split(s string) (head, tail string, err error) {
+	return s[:1], s[1:], nil
+}
+
+func closeAll() error {
+	return nil
+}
+`)
+	if err := NameResults(findFunc(file, "closeAll")); err != nil {
+		t.Fatal(err)
+	}
+	load := findFunc(file, "load")
+	if err := NameResults(load, "", "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NameResults(load); err == nil {
+		t.Error("named results twice")
+	}
+	if err := UnnameResults(findFunc(file, "split")); err != nil {
+		t.Fatal(err)
+	}
+	checkSource(t, fset, file, `package p
+
+func (s *store) load(key string) (r1 *item, ok bool, err error) {
+	r := s.m[key]
+	return r, r != nil, nil
+}
+
+func split(s string) (string, string, error) {
+	return s[:1], s[1:], nil
+}
+
+func closeAll() (err error) {
+	return nil
+}
+`)
+
+	if err := NameResults(findFunc(file, "split"), "s"); err == nil {
+		t.Error("named a result after a parameter")
+	}
+}
+
+func TestUnnameResultsDependent(t *testing.T) {
+	_, file := parse(t, `package p
+
+func naked() (n int, err error) {
+	n = 1
+	return
+}
+
+func deferred() (err error) {
+	defer func() {
+		if err != nil {
+			err = wrap(err)
+		}
+	}()
+	return run()
+}
+`)
+	for _, name := range []string{"naked", "deferred"} {
+		if err := UnnameResults(findFunc(file, name)); err == nil {
+			t.Errorf("%s: removed result names the body depends on", name)
+		}
+	}
+}
+
+func TestExpandNakedReturnsIfLong(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func parse(s string) (n int, err error) {
+	if s == "" {
+		err = errEmpty
+		return
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			err = errDigit
+			return
+		}
+		n = n*10 + int(r-'0')
+	}
+	return
+}
+
+func half(n int) (h int, odd bool) {
+	h, odd = n/2, n%2 == 1
+	return
+}
+`)
+	if n := ExpandNakedReturnsIfLong(file, 5); n != 1 {
+		t.Errorf("expanded the returns of %d functions, want 1", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func parse(s string) (n int, err error) {
+	if s == "" {
+		err = errEmpty
+		return n, err
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			err = errDigit
+			return n, err
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n, err
+}
+
+func half(n int) (h int, odd bool) {
+	h, odd = n/2, n%2 == 1
+	return
+}
+`)
+}
@@ -0,0 +1,123 @@
+package astrewrite_test
+
+import (
+	"go/ast"
+	"testing"
+
+	"github.com/fatih/astrewrite"
+	"github.com/fatih/astrewrite/ruletest"
+)
+
+func TestRulesCollapseNestedIf(t *testing.T) {
+	ruletest.Run(t, func(n ast.Node) (ast.Node, bool) {
+		astrewrite.CollapseNestedIf(n)
+		return n, false
+	}, []ruletest.Case{
+		{
+			Name: "nested",
+			In:   "if a {\n\tif b || c {\n\t\tf()\n\t}\n}",
+			Out:  "if a && (b || c) {\n\tf()\n}",
+		},
+		{
+			Name: "else",
+			In:   "if a {\n\tif b {\n\t\tf()\n\t}\n} else {\n\tg()\n}",
+			Same: true,
+		},
+	})
+}
+
+func TestRulesSwitchToIfElse(t *testing.T) {
+	ruletest.RunErr(t, func(n ast.Node) (ast.Node, bool, error) {
+		if sw, ok := n.(*ast.SwitchStmt); ok {
+			s, err := astrewrite.SwitchToIfElse(sw)
+			return s, false, err
+		}
+		return n, true, nil
+	}, []ruletest.Case{
+		{
+			Name: "tag",
+			In:   "switch x {\ncase 1, 2:\n\tf()\ndefault:\n\tg()\n}",
+			Out:  "if x == 1 || x == 2 {\n\tf()\n} else {\n\tg()\n}",
+		},
+		{
+			Name:        "fallthrough",
+			In:          "switch x {\ncase 1:\n\tfallthrough\ncase 2:\n\tf()\n}",
+			ErrContains: "fallthrough",
+		},
+	})
+}
+
+func TestRulesRemove(t *testing.T) {
+	ruletest.Run(t, func(n ast.Node) (ast.Node, bool) {
+		if es, ok := n.(*ast.ExprStmt); ok {
+			if call, ok := es.X.(*ast.CallExpr); ok {
+				if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "debug" {
+					return astrewrite.Remove, false
+				}
+			}
+		}
+		return n, true
+	}, []ruletest.Case{
+		{Name: "stmt", In: "debug(x)\nf(x)", Out: "f(x)"},
+		{Name: "func", In: "func f() {\n\tdebug()\n}", Out: "func f() {\n}"},
+	})
+}
+
+func TestRulesMigrateIoutil(t *testing.T) {
+	migrate := func(n ast.Node) (ast.Node, bool) {
+		if f, ok := n.(*ast.File); ok {
+			astrewrite.MigrateIoutil(f, nil)
+		}
+		return n, false
+	}
+	file := func(imports, body string) string {
+		return "package p\n\nimport (\n" + imports + ")\n\nfunc f() {\n" + body + "\n}\n"
+	}
+	ruletest.Run(t, migrate, []ruletest.Case{
+		{
+			Name: "ReadAll",
+			In:   file("\t\"io/ioutil\"\n\t\"os\"\n", "_, _ = ioutil.ReadAll(os.Stdin)"),
+			Out:  file("\t\"io\"\n\t\"os\"\n", "_, _ = io.ReadAll(os.Stdin)"),
+		},
+		{
+			Name: "ReadFile",
+			In:   file("\t\"io/ioutil\"\n", "_, _ = ioutil.ReadFile(\"a\")"),
+			Out:  file("\t\"os\"\n", "_, _ = os.ReadFile(\"a\")"),
+		},
+		{
+			Name: "WriteFile",
+			In:   file("\t\"io/ioutil\"\n", "_ = ioutil.WriteFile(\"a\", nil, 0o644)"),
+			Out:  file("\t\"os\"\n", "_ = os.WriteFile(\"a\", nil, 0o644)"),
+		},
+		{
+			Name: "TempDir",
+			In:   file("\t\"io/ioutil\"\n", "_, _ = ioutil.TempDir(\"\", \"x\")"),
+			Out:  file("\t\"os\"\n", "_, _ = os.MkdirTemp(\"\", \"x\")"),
+		},
+		{
+			Name: "TempFile",
+			In:   file("\t\"io/ioutil\"\n", "_, _ = ioutil.TempFile(\"\", \"x\")"),
+			Out:  file("\t\"os\"\n", "_, _ = os.CreateTemp(\"\", \"x\")"),
+		},
+		{
+			Name: "NopCloser",
+			In:   file("\t\"io/ioutil\"\n\t\"strings\"\n", "_ = ioutil.NopCloser(strings.NewReader(\"\"))"),
+			Out:  file("\t\"io\"\n\t\"strings\"\n", "_ = io.NopCloser(strings.NewReader(\"\"))"),
+		},
+		{
+			Name: "Discard",
+			In:   file("\tutil \"io/ioutil\"\n\tstdio \"io\"\n", "var _ stdio.Writer = util.Discard"),
+			Out:  file("\tstdio \"io\"\n", "var _ stdio.Writer = stdio.Discard"),
+		},
+		{
+			Name: "ReadDir",
+			In:   file("\t\"io/ioutil\"\n", "_, _ = ioutil.ReadDir(\".\")\n_, _ = ioutil.ReadFile(\"a\")"),
+			Out:  file("\t\"io/ioutil\"\n\t\"os\"\n", "_, _ = ioutil.ReadDir(\".\")\n_, _ = os.ReadFile(\"a\")"),
+		},
+		{
+			Name: "shadowed",
+			In:   file("\t\"io/ioutil\"\n", "os := 1\n_, _ = ioutil.ReadFile(\"a\")\n_ = os"),
+			Same: true,
+		},
+	})
+}
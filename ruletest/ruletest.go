@@ -0,0 +1,123 @@
+// Package ruletest runs table-driven tests of astrewrite walk functions on
+// source snippets.
+//
+// A case gives the input as a source file, a list of declarations, a list of
+// statements or an expression, see astrewrite.ParseSnippet, along with the
+// expected output. Both are formatted before they're compared, so the
+// expected output doesn't need to match the printer's layout of the
+// rewritten AST byte for byte. Blank lines are ignored as well, since
+// rewrites tend to leave some behind where nodes were removed.
+package ruletest
+
+import (
+	"go/ast"
+	"strings"
+	"testing"
+
+	"github.com/fatih/astrewrite"
+)
+
+// Case is a test case for a walk function.
+type Case struct {
+	// Name names the subtest the case runs in.
+	Name string
+
+	// In is the source walked.
+	In string
+
+	// Out is the expected source after the walk. It must be of the same
+	// kind as In and is ignored if Same is set.
+	Out string
+
+	// Same is set if the walk must leave In as it is.
+	Same bool
+
+	// ErrContains is set if the walk must fail with an error containing
+	// it. Out and Same are ignored then.
+	ErrContains string
+}
+
+// Run runs each case in a subtest of t, walking the case's input with fn.
+func Run(t *testing.T, fn astrewrite.WalkFunc, cases []Case) {
+	t.Helper()
+	RunErr(t, func(n ast.Node) (ast.Node, bool, error) {
+		r, ok := fn(n)
+		return r, ok, nil
+	}, cases)
+}
+
+// RunErr is like Run for walk functions that can fail, which are run with
+// astrewrite.WalkErr.
+func RunErr(t *testing.T, fn astrewrite.WalkErrFunc, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			t.Helper()
+			run(t, fn, c)
+		})
+	}
+}
+
+func run(t *testing.T, fn astrewrite.WalkErrFunc, c Case) {
+	t.Helper()
+	s, err := astrewrite.ParseSnippet(c.In)
+	if err != nil {
+		t.Fatalf("parsing input: %v", err)
+	}
+	want := c.Out
+	if c.Same {
+		want = c.In
+	}
+	if c.ErrContains == "" {
+		if want, err = format(want, s.Kind); err != nil {
+			t.Fatalf("parsing expected output: %v", err)
+		}
+	}
+
+	s.Node, err = astrewrite.WalkErr(s.Node, fn)
+	switch {
+	case c.ErrContains != "" && err == nil:
+		t.Fatalf("got no error, want error containing %q", c.ErrContains)
+	case c.ErrContains != "" && !strings.Contains(err.Error(), c.ErrContains):
+		t.Fatalf("got error %q, want error containing %q", err, c.ErrContains)
+	case c.ErrContains != "":
+		return
+	case err != nil:
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	got, err := s.Source()
+	if err != nil {
+		t.Fatalf("printing result: %v", err)
+	}
+	if got, err = format(got, s.Kind); err != nil {
+		t.Fatalf("parsing result: %v\n%s", err, got)
+	}
+	if got != want {
+		t.Errorf("result differs from expected output (-want +got):\n%s", diff(want, got))
+	}
+}
+
+// format returns src formatted as a snippet of the given kind, without
+// blank lines. The empty string stands for a removed snippet.
+func format(src string, kind astrewrite.SnippetKind) (string, error) {
+	if strings.TrimSpace(src) == "" {
+		return "", nil
+	}
+	s, err := astrewrite.ParseSnippetKind(src, kind)
+	if err != nil {
+		return "", err
+	}
+	if src, err = s.Source(); err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, line := range strings.SplitAfter(src, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
@@ -0,0 +1,31 @@
+package ruletest
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	got := diff("a\nb\nc\n", "a\nx\nc\nd\n")
+	want := " a\n-b\n+x\n c\n+d\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	rename := func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "a" {
+			id.Name = "b"
+		}
+		return n, true
+	}
+
+	Run(t, rename, []Case{
+		{Name: "expr", In: "a+1", Out: "b + 1"},
+		{Name: "stmts", In: "a := 1\nprintln(a)", Out: "b := 1\nprintln(b)"},
+		{Name: "decls", In: "var a = 1\nfunc f() { a++ }", Out: "var b = 1\n\nfunc f() { b++ }"},
+		{Name: "file", In: "// doc\npackage p\n\nvar a int", Out: "// doc\npackage p\n\nvar b int\n"},
+		{Name: "same", In: "x + y", Same: true},
+	})
+}
@@ -0,0 +1,107 @@
+package astrewrite
+
+//go:generate go run gen_schema.go
+
+// EdgeKind describes how a node holds a child.
+type EdgeKind int
+
+const (
+	// EdgeSingle is a field holding a single child that is always set in
+	// a well-formed AST.
+	EdgeSingle EdgeKind = iota
+	// EdgeSlice is a field holding a slice of children.
+	EdgeSlice
+	// EdgeOptional is a field holding a single child that may be nil.
+	EdgeOptional
+)
+
+func (k EdgeKind) String() string {
+	switch k {
+	case EdgeSingle:
+		return "single"
+	case EdgeSlice:
+		return "slice"
+	case EdgeOptional:
+		return "optional"
+	}
+	return "EdgeKind(?)"
+}
+
+// EdgeInfo describes a field of a node holding children.
+type EdgeInfo struct {
+	// Name is the name of the field, like "Cond".
+	Name string
+
+	// Kind tells whether the field holds a single, optional or slice of
+	// children.
+	Kind EdgeKind
+
+	// Type is the type of the field as written in go/ast, without the
+	// package qualifier, like "Expr", "*BlockStmt" or "[]Stmt".
+	Type string
+}
+
+// Schema returns the fields holding children of every node type of go/ast,
+// keyed by the type name without package and pointer, like "IfStmt". Fields
+// are listed in the order they are declared in. Like ast.Walk, the schema
+// leaves out the Imports, Unresolved and Comments of a File, which hold nodes
+// reachable otherwise, and ast.Package, which holds its files in a map.
+//
+// The schema is generated from the type definitions of go/ast, see
+// gen_schema.go, along with the code walking the children of nodes, so Walk
+// visits the edges of a node in the order of the schema. The tests check
+// that every edge is visited. The returned map is a copy the caller may
+// modify.
+func Schema() map[string][]EdgeInfo {
+	s := make(map[string][]EdgeInfo, len(schema))
+	for name, edges := range schema {
+		s[name] = append([]EdgeInfo(nil), edges...)
+	}
+	return s
+}
+
+// optionalEdges lists the fields holding a single child that may be nil in a
+// well-formed AST, by type and field name. gen_schema.go reads it to mark
+// the edges of the schema as EdgeOptional, and the tests check it against
+// go/ast.
+var optionalEdges = map[string]bool{
+	"ArrayType.Len":       true,
+	"BranchStmt.Label":    true,
+	"CommClause.Comm":     true,
+	"CompositeLit.Type":   true,
+	"Ellipsis.Elt":        true,
+	"Field.Doc":           true,
+	"Field.Type":          true,
+	"Field.Tag":           true,
+	"Field.Comment":       true,
+	"File.Doc":            true,
+	"ForStmt.Init":        true,
+	"ForStmt.Cond":        true,
+	"ForStmt.Post":        true,
+	"FuncDecl.Doc":        true,
+	"FuncDecl.Recv":       true,
+	"FuncDecl.Body":       true,
+	"FuncType.TypeParams": true,
+	"FuncType.Results":    true,
+	"GenDecl.Doc":         true,
+	"IfStmt.Init":         true,
+	"IfStmt.Else":         true,
+	"ImportSpec.Doc":      true,
+	"ImportSpec.Name":     true,
+	"ImportSpec.Comment":  true,
+	"RangeStmt.Key":       true,
+	"RangeStmt.Value":     true,
+	"SliceExpr.Low":       true,
+	"SliceExpr.High":      true,
+	"SliceExpr.Max":       true,
+	"SwitchStmt.Init":     true,
+	"SwitchStmt.Tag":      true,
+	"TypeAssertExpr.Type": true,
+	"TypeSpec.Doc":        true,
+	"TypeSpec.TypeParams": true,
+	"TypeSpec.Comment":    true,
+	"TypeSwitchStmt.Init": true,
+	"ValueSpec.Doc":       true,
+	"ValueSpec.Type":      true,
+	"ValueSpec.Comment":   true,
+}
@@ -0,0 +1,656 @@
+// Code generated by gen_schema.go from go/ast; DO NOT EDIT.
+
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+)
+
+var schema = map[string][]EdgeInfo{
+	"ArrayType": {
+		{Name: "Len", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Elt", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"AssignStmt": {
+		{Name: "Lhs", Kind: EdgeSlice, Type: "[]Expr"},
+		{Name: "Rhs", Kind: EdgeSlice, Type: "[]Expr"},
+	},
+	"BadDecl":  {},
+	"BadExpr":  {},
+	"BadStmt":  {},
+	"BasicLit": {},
+	"BinaryExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Y", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"BlockStmt": {
+		{Name: "List", Kind: EdgeSlice, Type: "[]Stmt"},
+	},
+	"BranchStmt": {
+		{Name: "Label", Kind: EdgeOptional, Type: "*Ident"},
+	},
+	"CallExpr": {
+		{Name: "Fun", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Args", Kind: EdgeSlice, Type: "[]Expr"},
+	},
+	"CaseClause": {
+		{Name: "List", Kind: EdgeSlice, Type: "[]Expr"},
+		{Name: "Body", Kind: EdgeSlice, Type: "[]Stmt"},
+	},
+	"ChanType": {
+		{Name: "Value", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"CommClause": {
+		{Name: "Comm", Kind: EdgeOptional, Type: "Stmt"},
+		{Name: "Body", Kind: EdgeSlice, Type: "[]Stmt"},
+	},
+	"Comment": {},
+	"CommentGroup": {
+		{Name: "List", Kind: EdgeSlice, Type: "[]*Comment"},
+	},
+	"CompositeLit": {
+		{Name: "Type", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Elts", Kind: EdgeSlice, Type: "[]Expr"},
+	},
+	"DeclStmt": {
+		{Name: "Decl", Kind: EdgeSingle, Type: "Decl"},
+	},
+	"DeferStmt": {
+		{Name: "Call", Kind: EdgeSingle, Type: "*CallExpr"},
+	},
+	"Ellipsis": {
+		{Name: "Elt", Kind: EdgeOptional, Type: "Expr"},
+	},
+	"EmptyStmt": {},
+	"ExprStmt": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"Field": {
+		{Name: "Doc", Kind: EdgeOptional, Type: "*CommentGroup"},
+		{Name: "Names", Kind: EdgeSlice, Type: "[]*Ident"},
+		{Name: "Type", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Tag", Kind: EdgeOptional, Type: "*BasicLit"},
+		{Name: "Comment", Kind: EdgeOptional, Type: "*CommentGroup"},
+	},
+	"FieldList": {
+		{Name: "List", Kind: EdgeSlice, Type: "[]*Field"},
+	},
+	"File": {
+		{Name: "Doc", Kind: EdgeOptional, Type: "*CommentGroup"},
+		{Name: "Name", Kind: EdgeSingle, Type: "*Ident"},
+		{Name: "Decls", Kind: EdgeSlice, Type: "[]Decl"},
+	},
+	"ForStmt": {
+		{Name: "Init", Kind: EdgeOptional, Type: "Stmt"},
+		{Name: "Cond", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Post", Kind: EdgeOptional, Type: "Stmt"},
+		{Name: "Body", Kind: EdgeSingle, Type: "*BlockStmt"},
+	},
+	"FuncDecl": {
+		{Name: "Doc", Kind: EdgeOptional, Type: "*CommentGroup"},
+		{Name: "Recv", Kind: EdgeOptional, Type: "*FieldList"},
+		{Name: "Name", Kind: EdgeSingle, Type: "*Ident"},
+		{Name: "Type", Kind: EdgeSingle, Type: "*FuncType"},
+		{Name: "Body", Kind: EdgeOptional, Type: "*BlockStmt"},
+	},
+	"FuncLit": {
+		{Name: "Type", Kind: EdgeSingle, Type: "*FuncType"},
+		{Name: "Body", Kind: EdgeSingle, Type: "*BlockStmt"},
+	},
+	"FuncType": {
+		{Name: "TypeParams", Kind: EdgeOptional, Type: "*FieldList"},
+		{Name: "Params", Kind: EdgeSingle, Type: "*FieldList"},
+		{Name: "Results", Kind: EdgeOptional, Type: "*FieldList"},
+	},
+	"GenDecl": {
+		{Name: "Doc", Kind: EdgeOptional, Type: "*CommentGroup"},
+		{Name: "Specs", Kind: EdgeSlice, Type: "[]Spec"},
+	},
+	"GoStmt": {
+		{Name: "Call", Kind: EdgeSingle, Type: "*CallExpr"},
+	},
+	"Ident": {},
+	"IfStmt": {
+		{Name: "Init", Kind: EdgeOptional, Type: "Stmt"},
+		{Name: "Cond", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Body", Kind: EdgeSingle, Type: "*BlockStmt"},
+		{Name: "Else", Kind: EdgeOptional, Type: "Stmt"},
+	},
+	"ImportSpec": {
+		{Name: "Doc", Kind: EdgeOptional, Type: "*CommentGroup"},
+		{Name: "Name", Kind: EdgeOptional, Type: "*Ident"},
+		{Name: "Path", Kind: EdgeSingle, Type: "*BasicLit"},
+		{Name: "Comment", Kind: EdgeOptional, Type: "*CommentGroup"},
+	},
+	"IncDecStmt": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"IndexExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Index", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"IndexListExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Indices", Kind: EdgeSlice, Type: "[]Expr"},
+	},
+	"InterfaceType": {
+		{Name: "Methods", Kind: EdgeSingle, Type: "*FieldList"},
+	},
+	"KeyValueExpr": {
+		{Name: "Key", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Value", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"LabeledStmt": {
+		{Name: "Label", Kind: EdgeSingle, Type: "*Ident"},
+		{Name: "Stmt", Kind: EdgeSingle, Type: "Stmt"},
+	},
+	"MapType": {
+		{Name: "Key", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Value", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"ParenExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"RangeStmt": {
+		{Name: "Key", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Value", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Body", Kind: EdgeSingle, Type: "*BlockStmt"},
+	},
+	"ReturnStmt": {
+		{Name: "Results", Kind: EdgeSlice, Type: "[]Expr"},
+	},
+	"SelectStmt": {
+		{Name: "Body", Kind: EdgeSingle, Type: "*BlockStmt"},
+	},
+	"SelectorExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Sel", Kind: EdgeSingle, Type: "*Ident"},
+	},
+	"SendStmt": {
+		{Name: "Chan", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Value", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"SliceExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Low", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "High", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Max", Kind: EdgeOptional, Type: "Expr"},
+	},
+	"StarExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"StructType": {
+		{Name: "Fields", Kind: EdgeSingle, Type: "*FieldList"},
+	},
+	"SwitchStmt": {
+		{Name: "Init", Kind: EdgeOptional, Type: "Stmt"},
+		{Name: "Tag", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Body", Kind: EdgeSingle, Type: "*BlockStmt"},
+	},
+	"TypeAssertExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Type", Kind: EdgeOptional, Type: "Expr"},
+	},
+	"TypeSpec": {
+		{Name: "Doc", Kind: EdgeOptional, Type: "*CommentGroup"},
+		{Name: "Name", Kind: EdgeSingle, Type: "*Ident"},
+		{Name: "TypeParams", Kind: EdgeOptional, Type: "*FieldList"},
+		{Name: "Type", Kind: EdgeSingle, Type: "Expr"},
+		{Name: "Comment", Kind: EdgeOptional, Type: "*CommentGroup"},
+	},
+	"TypeSwitchStmt": {
+		{Name: "Init", Kind: EdgeOptional, Type: "Stmt"},
+		{Name: "Assign", Kind: EdgeSingle, Type: "Stmt"},
+		{Name: "Body", Kind: EdgeSingle, Type: "*BlockStmt"},
+	},
+	"UnaryExpr": {
+		{Name: "X", Kind: EdgeSingle, Type: "Expr"},
+	},
+	"ValueSpec": {
+		{Name: "Doc", Kind: EdgeOptional, Type: "*CommentGroup"},
+		{Name: "Names", Kind: EdgeSlice, Type: "[]*Ident"},
+		{Name: "Type", Kind: EdgeOptional, Type: "Expr"},
+		{Name: "Values", Kind: EdgeSlice, Type: "[]Expr"},
+		{Name: "Comment", Kind: EdgeOptional, Type: "*CommentGroup"},
+	},
+}
+
+var nodeTypes = map[string]reflect.Type{
+	"ArrayType":      reflect.TypeOf(ast.ArrayType{}),
+	"AssignStmt":     reflect.TypeOf(ast.AssignStmt{}),
+	"BadDecl":        reflect.TypeOf(ast.BadDecl{}),
+	"BadExpr":        reflect.TypeOf(ast.BadExpr{}),
+	"BadStmt":        reflect.TypeOf(ast.BadStmt{}),
+	"BasicLit":       reflect.TypeOf(ast.BasicLit{}),
+	"BinaryExpr":     reflect.TypeOf(ast.BinaryExpr{}),
+	"BlockStmt":      reflect.TypeOf(ast.BlockStmt{}),
+	"BranchStmt":     reflect.TypeOf(ast.BranchStmt{}),
+	"CallExpr":       reflect.TypeOf(ast.CallExpr{}),
+	"CaseClause":     reflect.TypeOf(ast.CaseClause{}),
+	"ChanType":       reflect.TypeOf(ast.ChanType{}),
+	"CommClause":     reflect.TypeOf(ast.CommClause{}),
+	"Comment":        reflect.TypeOf(ast.Comment{}),
+	"CommentGroup":   reflect.TypeOf(ast.CommentGroup{}),
+	"CompositeLit":   reflect.TypeOf(ast.CompositeLit{}),
+	"DeclStmt":       reflect.TypeOf(ast.DeclStmt{}),
+	"DeferStmt":      reflect.TypeOf(ast.DeferStmt{}),
+	"Ellipsis":       reflect.TypeOf(ast.Ellipsis{}),
+	"EmptyStmt":      reflect.TypeOf(ast.EmptyStmt{}),
+	"ExprStmt":       reflect.TypeOf(ast.ExprStmt{}),
+	"Field":          reflect.TypeOf(ast.Field{}),
+	"FieldList":      reflect.TypeOf(ast.FieldList{}),
+	"File":           reflect.TypeOf(ast.File{}),
+	"ForStmt":        reflect.TypeOf(ast.ForStmt{}),
+	"FuncDecl":       reflect.TypeOf(ast.FuncDecl{}),
+	"FuncLit":        reflect.TypeOf(ast.FuncLit{}),
+	"FuncType":       reflect.TypeOf(ast.FuncType{}),
+	"GenDecl":        reflect.TypeOf(ast.GenDecl{}),
+	"GoStmt":         reflect.TypeOf(ast.GoStmt{}),
+	"Ident":          reflect.TypeOf(ast.Ident{}),
+	"IfStmt":         reflect.TypeOf(ast.IfStmt{}),
+	"ImportSpec":     reflect.TypeOf(ast.ImportSpec{}),
+	"IncDecStmt":     reflect.TypeOf(ast.IncDecStmt{}),
+	"IndexExpr":      reflect.TypeOf(ast.IndexExpr{}),
+	"IndexListExpr":  reflect.TypeOf(ast.IndexListExpr{}),
+	"InterfaceType":  reflect.TypeOf(ast.InterfaceType{}),
+	"KeyValueExpr":   reflect.TypeOf(ast.KeyValueExpr{}),
+	"LabeledStmt":    reflect.TypeOf(ast.LabeledStmt{}),
+	"MapType":        reflect.TypeOf(ast.MapType{}),
+	"ParenExpr":      reflect.TypeOf(ast.ParenExpr{}),
+	"RangeStmt":      reflect.TypeOf(ast.RangeStmt{}),
+	"ReturnStmt":     reflect.TypeOf(ast.ReturnStmt{}),
+	"SelectStmt":     reflect.TypeOf(ast.SelectStmt{}),
+	"SelectorExpr":   reflect.TypeOf(ast.SelectorExpr{}),
+	"SendStmt":       reflect.TypeOf(ast.SendStmt{}),
+	"SliceExpr":      reflect.TypeOf(ast.SliceExpr{}),
+	"StarExpr":       reflect.TypeOf(ast.StarExpr{}),
+	"StructType":     reflect.TypeOf(ast.StructType{}),
+	"SwitchStmt":     reflect.TypeOf(ast.SwitchStmt{}),
+	"TypeAssertExpr": reflect.TypeOf(ast.TypeAssertExpr{}),
+	"TypeSpec":       reflect.TypeOf(ast.TypeSpec{}),
+	"TypeSwitchStmt": reflect.TypeOf(ast.TypeSwitchStmt{}),
+	"UnaryExpr":      reflect.TypeOf(ast.UnaryExpr{}),
+	"ValueSpec":      reflect.TypeOf(ast.ValueSpec{}),
+}
+
+// walkEdges walks the children of node in the order of their fields, as
+// described by the schema. It returns false if node has to be removed
+// because a child it can't do without was removed, see RemovalBehavior.
+func (w *walker) walkEdges(node ast.Node) bool {
+	var ok bool
+	switch n := node.(type) {
+	case *ast.ArrayType:
+		if n.Len, ok = walkEdge(w, n, "Len", n.Len); !ok {
+			return false
+		}
+		if n.Elt, ok = walkEdge(w, n, "Elt", n.Elt); !ok {
+			return false
+		}
+	case *ast.AssignStmt:
+		if n.Lhs, ok = walkList(w, n, "Lhs", n.Lhs); !ok {
+			return false
+		}
+		if n.Rhs, ok = walkList(w, n, "Rhs", n.Rhs); !ok {
+			return false
+		}
+	case *ast.BadDecl:
+	case *ast.BadExpr:
+	case *ast.BadStmt:
+	case *ast.BasicLit:
+	case *ast.BinaryExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+		if n.Y, ok = walkEdge(w, n, "Y", n.Y); !ok {
+			return false
+		}
+	case *ast.BlockStmt:
+		if n.List, ok = walkList(w, n, "List", n.List); !ok {
+			return false
+		}
+	case *ast.BranchStmt:
+		if n.Label, ok = walkEdge(w, n, "Label", n.Label); !ok {
+			return false
+		}
+	case *ast.CallExpr:
+		if n.Fun, ok = walkEdge(w, n, "Fun", n.Fun); !ok {
+			return false
+		}
+		if n.Args, ok = walkList(w, n, "Args", n.Args); !ok {
+			return false
+		}
+	case *ast.CaseClause:
+		if n.List, ok = walkList(w, n, "List", n.List); !ok {
+			return false
+		}
+		if n.Body, ok = walkList(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.ChanType:
+		if n.Value, ok = walkEdge(w, n, "Value", n.Value); !ok {
+			return false
+		}
+	case *ast.CommClause:
+		if n.Comm, ok = walkEdge(w, n, "Comm", n.Comm); !ok {
+			return false
+		}
+		if n.Body, ok = walkList(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.Comment:
+	case *ast.CommentGroup:
+		if n.List, ok = walkList(w, n, "List", n.List); !ok {
+			return false
+		}
+	case *ast.CompositeLit:
+		if n.Type, ok = walkEdge(w, n, "Type", n.Type); !ok {
+			return false
+		}
+		if n.Elts, ok = walkList(w, n, "Elts", n.Elts); !ok {
+			return false
+		}
+	case *ast.DeclStmt:
+		if n.Decl, ok = walkEdge(w, n, "Decl", n.Decl); !ok {
+			return false
+		}
+	case *ast.DeferStmt:
+		if n.Call, ok = walkEdge(w, n, "Call", n.Call); !ok {
+			return false
+		}
+	case *ast.Ellipsis:
+		if n.Elt, ok = walkEdge(w, n, "Elt", n.Elt); !ok {
+			return false
+		}
+	case *ast.EmptyStmt:
+	case *ast.ExprStmt:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+	case *ast.Field:
+		if n.Doc, ok = walkEdge(w, n, "Doc", n.Doc); !ok {
+			return false
+		}
+		if n.Names, ok = walkList(w, n, "Names", n.Names); !ok {
+			return false
+		}
+		if n.Type, ok = walkEdge(w, n, "Type", n.Type); !ok {
+			return false
+		}
+		if n.Tag, ok = walkEdge(w, n, "Tag", n.Tag); !ok {
+			return false
+		}
+		if n.Comment, ok = walkEdge(w, n, "Comment", n.Comment); !ok {
+			return false
+		}
+	case *ast.FieldList:
+		if n.List, ok = walkList(w, n, "List", n.List); !ok {
+			return false
+		}
+	case *ast.File:
+		if n.Doc, ok = walkEdge(w, n, "Doc", n.Doc); !ok {
+			return false
+		}
+		if n.Name, ok = walkEdge(w, n, "Name", n.Name); !ok {
+			return false
+		}
+		if n.Decls, ok = walkList(w, n, "Decls", n.Decls); !ok {
+			return false
+		}
+	case *ast.ForStmt:
+		if n.Init, ok = walkEdge(w, n, "Init", n.Init); !ok {
+			return false
+		}
+		if n.Cond, ok = walkEdge(w, n, "Cond", n.Cond); !ok {
+			return false
+		}
+		if n.Post, ok = walkEdge(w, n, "Post", n.Post); !ok {
+			return false
+		}
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.FuncDecl:
+		if n.Doc, ok = walkEdge(w, n, "Doc", n.Doc); !ok {
+			return false
+		}
+		if n.Recv, ok = walkEdge(w, n, "Recv", n.Recv); !ok {
+			return false
+		}
+		if n.Name, ok = walkEdge(w, n, "Name", n.Name); !ok {
+			return false
+		}
+		if n.Type, ok = walkEdge(w, n, "Type", n.Type); !ok {
+			return false
+		}
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.FuncLit:
+		if n.Type, ok = walkEdge(w, n, "Type", n.Type); !ok {
+			return false
+		}
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.FuncType:
+		if n.TypeParams, ok = walkEdge(w, n, "TypeParams", n.TypeParams); !ok {
+			return false
+		}
+		if n.Params, ok = walkEdge(w, n, "Params", n.Params); !ok {
+			return false
+		}
+		if n.Results, ok = walkEdge(w, n, "Results", n.Results); !ok {
+			return false
+		}
+	case *ast.GenDecl:
+		if n.Doc, ok = walkEdge(w, n, "Doc", n.Doc); !ok {
+			return false
+		}
+		if n.Specs, ok = walkList(w, n, "Specs", n.Specs); !ok {
+			return false
+		}
+	case *ast.GoStmt:
+		if n.Call, ok = walkEdge(w, n, "Call", n.Call); !ok {
+			return false
+		}
+	case *ast.Ident:
+	case *ast.IfStmt:
+		if n.Init, ok = walkEdge(w, n, "Init", n.Init); !ok {
+			return false
+		}
+		if n.Cond, ok = walkEdge(w, n, "Cond", n.Cond); !ok {
+			return false
+		}
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+		if n.Else, ok = walkEdge(w, n, "Else", n.Else); !ok {
+			return false
+		}
+	case *ast.ImportSpec:
+		if n.Doc, ok = walkEdge(w, n, "Doc", n.Doc); !ok {
+			return false
+		}
+		if n.Name, ok = walkEdge(w, n, "Name", n.Name); !ok {
+			return false
+		}
+		if n.Path, ok = walkEdge(w, n, "Path", n.Path); !ok {
+			return false
+		}
+		if n.Comment, ok = walkEdge(w, n, "Comment", n.Comment); !ok {
+			return false
+		}
+	case *ast.IncDecStmt:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+	case *ast.IndexExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+		if n.Index, ok = walkEdge(w, n, "Index", n.Index); !ok {
+			return false
+		}
+	case *ast.IndexListExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+		if n.Indices, ok = walkList(w, n, "Indices", n.Indices); !ok {
+			return false
+		}
+	case *ast.InterfaceType:
+		if n.Methods, ok = walkEdge(w, n, "Methods", n.Methods); !ok {
+			return false
+		}
+	case *ast.KeyValueExpr:
+		if n.Key, ok = walkEdge(w, n, "Key", n.Key); !ok {
+			return false
+		}
+		if n.Value, ok = walkEdge(w, n, "Value", n.Value); !ok {
+			return false
+		}
+	case *ast.LabeledStmt:
+		if n.Label, ok = walkEdge(w, n, "Label", n.Label); !ok {
+			return false
+		}
+		if n.Stmt, ok = walkEdge(w, n, "Stmt", n.Stmt); !ok {
+			return false
+		}
+	case *ast.MapType:
+		if n.Key, ok = walkEdge(w, n, "Key", n.Key); !ok {
+			return false
+		}
+		if n.Value, ok = walkEdge(w, n, "Value", n.Value); !ok {
+			return false
+		}
+	case *ast.ParenExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+	case *ast.RangeStmt:
+		if n.Key, ok = walkEdge(w, n, "Key", n.Key); !ok {
+			return false
+		}
+		if n.Value, ok = walkEdge(w, n, "Value", n.Value); !ok {
+			return false
+		}
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.ReturnStmt:
+		if n.Results, ok = walkList(w, n, "Results", n.Results); !ok {
+			return false
+		}
+	case *ast.SelectStmt:
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.SelectorExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+		if n.Sel, ok = walkEdge(w, n, "Sel", n.Sel); !ok {
+			return false
+		}
+	case *ast.SendStmt:
+		if n.Chan, ok = walkEdge(w, n, "Chan", n.Chan); !ok {
+			return false
+		}
+		if n.Value, ok = walkEdge(w, n, "Value", n.Value); !ok {
+			return false
+		}
+	case *ast.SliceExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+		if n.Low, ok = walkEdge(w, n, "Low", n.Low); !ok {
+			return false
+		}
+		if n.High, ok = walkEdge(w, n, "High", n.High); !ok {
+			return false
+		}
+		if n.Max, ok = walkEdge(w, n, "Max", n.Max); !ok {
+			return false
+		}
+	case *ast.StarExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+	case *ast.StructType:
+		if n.Fields, ok = walkEdge(w, n, "Fields", n.Fields); !ok {
+			return false
+		}
+	case *ast.SwitchStmt:
+		if n.Init, ok = walkEdge(w, n, "Init", n.Init); !ok {
+			return false
+		}
+		if n.Tag, ok = walkEdge(w, n, "Tag", n.Tag); !ok {
+			return false
+		}
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.TypeAssertExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+		if n.Type, ok = walkEdge(w, n, "Type", n.Type); !ok {
+			return false
+		}
+	case *ast.TypeSpec:
+		if n.Doc, ok = walkEdge(w, n, "Doc", n.Doc); !ok {
+			return false
+		}
+		if n.Name, ok = walkEdge(w, n, "Name", n.Name); !ok {
+			return false
+		}
+		if n.TypeParams, ok = walkEdge(w, n, "TypeParams", n.TypeParams); !ok {
+			return false
+		}
+		if n.Type, ok = walkEdge(w, n, "Type", n.Type); !ok {
+			return false
+		}
+		if n.Comment, ok = walkEdge(w, n, "Comment", n.Comment); !ok {
+			return false
+		}
+	case *ast.TypeSwitchStmt:
+		if n.Init, ok = walkEdge(w, n, "Init", n.Init); !ok {
+			return false
+		}
+		if n.Assign, ok = walkEdge(w, n, "Assign", n.Assign); !ok {
+			return false
+		}
+		if n.Body, ok = walkEdge(w, n, "Body", n.Body); !ok {
+			return false
+		}
+	case *ast.UnaryExpr:
+		if n.X, ok = walkEdge(w, n, "X", n.X); !ok {
+			return false
+		}
+	case *ast.ValueSpec:
+		if n.Doc, ok = walkEdge(w, n, "Doc", n.Doc); !ok {
+			return false
+		}
+		if n.Names, ok = walkList(w, n, "Names", n.Names); !ok {
+			return false
+		}
+		if n.Type, ok = walkEdge(w, n, "Type", n.Type); !ok {
+			return false
+		}
+		if n.Values, ok = walkList(w, n, "Values", n.Values); !ok {
+			return false
+		}
+		if n.Comment, ok = walkEdge(w, n, "Comment", n.Comment); !ok {
+			return false
+		}
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSchemaReflect cross-checks the schema and the list of optional edges
+// against the node types of the go/ast in use, catching fields added by
+// newer Go versions.
+func TestSchemaReflect(t *testing.T) {
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	ignored := map[string]bool{"File.Imports": true, "File.Unresolved": true, "File.Comments": true}
+	optional := make(map[string]bool)
+
+	for name, typ := range nodeTypes {
+		var want []EdgeInfo
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			ft, kind := f.Type, EdgeSingle
+			if ft.Kind() == reflect.Slice {
+				ft, kind = ft.Elem(), EdgeSlice
+			}
+			key := name + "." + f.Name
+			if !ft.Implements(nodeType) || ignored[key] {
+				continue
+			}
+			if optionalEdges[key] {
+				if kind == EdgeSlice {
+					t.Errorf("%s is listed as optional but is a slice", key)
+				}
+				kind = EdgeOptional
+				optional[key] = true
+			}
+			want = append(want, EdgeInfo{Name: f.Name, Kind: kind, Type: strings.ReplaceAll(f.Type.String(), "ast.", "")})
+		}
+
+		got := schema[name]
+		if len(got) != len(want) {
+			t.Errorf("%s: schema has %d edges, reflection finds %d: %v", name, len(got), len(want), want)
+			continue
+		}
+		for i, e := range got {
+			if w := want[i]; e != w {
+				t.Errorf("%s: edge %d is %+v, reflection finds %+v", name, i, e, w)
+			}
+		}
+	}
+	for key := range optionalEdges {
+		if !optional[key] {
+			t.Errorf("%s is listed as optional but isn't an edge", key)
+		}
+	}
+}
+
+// TestSchemaWalk checks that Walk visits the children described by the
+// schema.
+func TestSchemaWalk(t *testing.T) {
+	for name := range schema {
+		node, children := schemaNode(name, true)
+
+		seen := make(map[ast.Node]bool)
+		Walk(node, func(n ast.Node) (ast.Node, bool) {
+			seen[n] = true
+			return n, true
+		})
+
+		for i, child := range children {
+			edge := schema[name][i]
+			if !seen[child] && RemovalBehavior(name, edge.Name) != NotWalked {
+				t.Errorf("%s: %s not walked", name, edge.Name)
+			}
+		}
+	}
+}
+
+// schemaNode returns a node of the named type with its single edges set,
+// along with one child for each of its edges. If all is set, optional and
+// slice edges are set too.
+func schemaNode(name string, all bool) (ast.Node, []ast.Node) {
+	v := reflect.New(nodeTypes[name])
+	var children []ast.Node
+	for _, e := range schema[name] {
+		if !all && e.Kind != EdgeSingle {
+			continue
+		}
+		child := schemaLeaf(strings.TrimPrefix(e.Type, "[]"))
+		children = append(children, child)
+		f := v.Elem().FieldByName(e.Name)
+		if e.Kind == EdgeSlice {
+			s := reflect.MakeSlice(f.Type(), 1, 1)
+			s.Index(0).Set(reflect.ValueOf(child))
+			f.Set(s)
+		} else {
+			f.Set(reflect.ValueOf(child))
+		}
+	}
+	return v.Interface().(ast.Node), children
+}
+
+// schemaLeaf returns a small node that can be stored in a field of type typ.
+func schemaLeaf(typ string) ast.Node {
+	switch typ {
+	case "Expr", "Node":
+		return ast.NewIdent("x")
+	case "Stmt":
+		return &ast.EmptyStmt{}
+	case "Decl":
+		return &ast.BadDecl{}
+	case "Spec":
+		return &ast.ImportSpec{Path: &ast.BasicLit{}}
+	}
+	n, _ := schemaNode(strings.TrimPrefix(typ, "*"), false)
+	return n
+}
+
+func TestSchemaCopy(t *testing.T) {
+	s := Schema()
+	s["IfStmt"][0].Name = "changed"
+	delete(s, "File")
+	if schema["IfStmt"][0].Name != "Init" || Schema()["File"] == nil {
+		t.Error("Schema doesn't return a copy")
+	}
+}
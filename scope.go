@@ -0,0 +1,375 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// DeclSite describes the declaration of a name found by Cursor.Lookup.
+type DeclSite struct {
+	// Name is the declared name.
+	Name string
+
+	// Kind tells what the name denotes: ast.Pkg for imports, ast.Con,
+	// ast.Typ, ast.Var or ast.Fun. Parameters, results, receivers and
+	// the variables of type switches are ast.Var, type parameters ast.Typ.
+	Kind ast.ObjKind
+
+	// Ident is the identifier declaring the name, or nil for an import
+	// without a name.
+	Ident *ast.Ident
+
+	// Node is the node declaring the name: an ImportSpec, ValueSpec,
+	// TypeSpec, FuncDecl, Field, AssignStmt, RangeStmt or the
+	// TypeSwitchStmt declaring the variable of its clauses.
+	Node ast.Node
+
+	// Scope is the node the declaration is local to: the File for
+	// imports and package level declarations, or the FuncDecl, FuncLit,
+	// TypeSpec, block, clause or statement whose scope it belongs to.
+	Scope ast.Node
+}
+
+// Lookup returns the declaration the name refers to at Node, going by the
+// lexical scopes of its ancestors, like a careful reader of the source
+// would: the imports and package level declarations of the file, the type
+// parameters, receivers, parameters and results of functions, the short
+// variable declarations and var, const and type declarations of blocks and
+// clauses before Node, the variables declared in the headers of if, for,
+// range, switch and select statements, and the variable of a type switch
+// in its clauses. Labels are a namespace of their own and aren't included.
+//
+// Scopes are computed from the ancestors when Lookup is called, so they
+// reflect the rewritten tree up to Node and cost nothing otherwise.
+// Package level declarations are only known for the files of the walk:
+// walking a lone file, those of the other files of its package are
+// missing. Names brought in by dot imports and the predeclared names, like
+// int or len, are never found.
+func (c *Cursor) Lookup(name string) (DeclSite, bool) {
+	if name == "_" {
+		return DeclSite{}, false
+	}
+	path := c.ancestors()
+	if node := c.Node(); node != nil {
+		path = append(path[:len(path):len(path)], node)
+	}
+	for i := len(path) - 2; i >= 0; i-- {
+		for _, site := range scopeDecls(path, i) {
+			if site.Name == name {
+				return site, true
+			}
+		}
+	}
+	return DeclSite{}, false
+}
+
+// InScope reports whether Lookup finds a declaration of name at Node, that
+// is whether name used at Node refers to something declared in the walked
+// tree rather than to a predeclared name or to an unimported package.
+func (c *Cursor) InScope(name string) bool {
+	_, ok := c.Lookup(name)
+	return ok
+}
+
+// scopeDecls returns the declarations path[i] makes visible to path[i+1],
+// in the order they're declared.
+func scopeDecls(path []ast.Node, i int) []DeclSite {
+	var sites []DeclSite
+	add := func(kind ast.ObjKind, id *ast.Ident, node, scope ast.Node) {
+		if id != nil && id.Name != "_" {
+			sites = append(sites, DeclSite{Name: id.Name, Kind: kind, Ident: id, Node: node, Scope: scope})
+		}
+	}
+	addFields := func(kind ast.ObjKind, fl *ast.FieldList, scope ast.Node) {
+		if fl == nil {
+			return
+		}
+		for _, f := range fl.List {
+			for _, id := range f.Names {
+				add(kind, id, f, scope)
+			}
+		}
+	}
+	addStmt := func(s ast.Stmt, scope ast.Node) {
+		for _, site := range stmtDecls(s) {
+			site.Scope = scope
+			sites = append(sites, site)
+		}
+	}
+
+	parent, child := path[i], path[i+1]
+	switch n := parent.(type) {
+	case *ast.Package:
+		names := make([]string, 0, len(n.Files))
+		for name := range n.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, site := range packageDecls(n.Files[name]) {
+				site.Scope = n
+				sites = append(sites, site)
+			}
+		}
+
+	case *ast.File:
+		for _, imp := range n.Imports {
+			name := importName(imp)
+			if name == "." || name == "_" {
+				continue
+			}
+			sites = append(sites, DeclSite{Name: name, Kind: ast.Pkg, Ident: imp.Name, Node: imp, Scope: n})
+		}
+		if i == 0 || !isPackage(path[i-1]) {
+			sites = append(sites, packageDecls(n)...)
+		}
+
+	case *ast.FuncDecl:
+		if child != n.Body && child != n.Type && child != n.Recv {
+			break
+		}
+		if _, params, _, ok := ReceiverType(n); ok {
+			for _, id := range params {
+				add(ast.Typ, id, n.Recv, n)
+			}
+		}
+		addFields(ast.Typ, n.Type.TypeParams, n)
+		if child == n.Body {
+			addFields(ast.Var, n.Recv, n)
+			addFields(ast.Var, n.Type.Params, n)
+			addFields(ast.Var, n.Type.Results, n)
+		}
+
+	case *ast.FuncLit:
+		if child == n.Body {
+			addFields(ast.Var, n.Type.Params, n)
+			addFields(ast.Var, n.Type.Results, n)
+		}
+
+	case *ast.TypeSpec:
+		if child == n.Type || child == n.TypeParams {
+			add(ast.Typ, n.Name, n, n)
+			addFields(ast.Typ, n.TypeParams, n)
+		}
+
+	case *ast.GenDecl:
+		// the scope of a constant or variable begins after its spec, that
+		// of a type at its name
+		for _, spec := range n.Specs {
+			if spec == child && n.Tok != token.TYPE {
+				break
+			}
+			for _, site := range specDecls(n.Tok, spec) {
+				site.Scope = n
+				sites = append(sites, site)
+			}
+			if spec == child {
+				break
+			}
+		}
+
+	case *ast.BlockStmt:
+		for _, s := range n.List {
+			if s == child {
+				break
+			}
+			addStmt(s, n)
+		}
+		// the body of a function shares its scope with the parameters,
+		// which short variable declarations assign rather than redeclare
+		if i > 0 {
+			var typ *ast.FuncType
+			switch fn := path[i-1].(type) {
+			case *ast.FuncDecl:
+				if fn.Body == n {
+					typ = fn.Type
+					if fn.Recv != nil {
+						sites = dropFields(sites, fn.Recv)
+					}
+				}
+			case *ast.FuncLit:
+				if fn.Body == n {
+					typ = fn.Type
+				}
+			}
+			if typ != nil {
+				sites = dropFields(dropFields(sites, typ.Params), typ.Results)
+			}
+		}
+
+	case *ast.CaseClause:
+		if !inList(n.Body, child) {
+			break
+		}
+		if i >= 2 {
+			if ts, ok := path[i-2].(*ast.TypeSwitchStmt); ok {
+				if as, ok := ts.Assign.(*ast.AssignStmt); ok && as.Tok == token.DEFINE && len(as.Lhs) == 1 {
+					id, _ := as.Lhs[0].(*ast.Ident)
+					add(ast.Var, id, ts, n)
+				}
+			}
+		}
+		for _, s := range n.Body {
+			if s == child {
+				break
+			}
+			addStmt(s, n)
+		}
+
+	case *ast.CommClause:
+		if !inList(n.Body, child) {
+			break
+		}
+		if n.Comm != nil {
+			addStmt(n.Comm, n)
+		}
+		for _, s := range n.Body {
+			if s == child {
+				break
+			}
+			addStmt(s, n)
+		}
+
+	case *ast.IfStmt:
+		if child != n.Init && n.Init != nil {
+			addStmt(n.Init, n)
+		}
+
+	case *ast.SwitchStmt:
+		if child != n.Init && n.Init != nil {
+			addStmt(n.Init, n)
+		}
+
+	case *ast.TypeSwitchStmt:
+		if child != n.Init && n.Init != nil {
+			addStmt(n.Init, n)
+		}
+
+	case *ast.ForStmt:
+		if child != n.Init && n.Init != nil {
+			addStmt(n.Init, n)
+		}
+
+	case *ast.RangeStmt:
+		if child == n.Body && n.Tok == token.DEFINE {
+			for _, e := range []ast.Expr{n.Key, n.Value} {
+				id, _ := e.(*ast.Ident)
+				add(ast.Var, id, n, n)
+			}
+		}
+	}
+	return sites
+}
+
+// dropFields returns sites without the names declared by the fields of fl.
+func dropFields(sites []DeclSite, fl *ast.FieldList) []DeclSite {
+	if fl == nil {
+		return sites
+	}
+	out := sites[:0]
+	for _, site := range sites {
+		declared := false
+		for _, f := range fl.List {
+			for _, id := range f.Names {
+				declared = declared || id.Name == site.Name
+			}
+		}
+		if !declared {
+			out = append(out, site)
+		}
+	}
+	return out
+}
+
+// isPackage reports whether n is an *ast.Package.
+func isPackage(n ast.Node) bool {
+	_, ok := n.(*ast.Package)
+	return ok
+}
+
+// inList reports whether s is one of list.
+func inList(list []ast.Stmt, s ast.Node) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// packageDecls returns the package level declarations of f, without their
+// scope, which is the file or its package.
+func packageDecls(f *ast.File) []DeclSite {
+	var sites []DeclSite
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name != "init" && d.Name.Name != "_" {
+				sites = append(sites, DeclSite{Name: d.Name.Name, Kind: ast.Fun, Ident: d.Name, Node: d, Scope: f})
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				for _, site := range specDecls(d.Tok, spec) {
+					site.Scope = f
+					sites = append(sites, site)
+				}
+			}
+		}
+	}
+	return sites
+}
+
+// specDecls returns the names declared by spec of a declaration of tok,
+// without their scope.
+func specDecls(tok token.Token, spec ast.Spec) []DeclSite {
+	var sites []DeclSite
+	switch spec := spec.(type) {
+	case *ast.ValueSpec:
+		kind := ast.Var
+		if tok == token.CONST {
+			kind = ast.Con
+		}
+		for _, id := range spec.Names {
+			if id.Name != "_" {
+				sites = append(sites, DeclSite{Name: id.Name, Kind: kind, Ident: id, Node: spec})
+			}
+		}
+	case *ast.TypeSpec:
+		if spec.Name.Name != "_" {
+			sites = append(sites, DeclSite{Name: spec.Name.Name, Kind: ast.Typ, Ident: spec.Name, Node: spec})
+		}
+	}
+	return sites
+}
+
+// stmtDecls returns the names declared by s for the statements following
+// it, without their scope.
+func stmtDecls(s ast.Stmt) []DeclSite {
+	for {
+		labeled, ok := s.(*ast.LabeledStmt)
+		if !ok {
+			break
+		}
+		s = labeled.Stmt
+	}
+	var sites []DeclSite
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		if s.Tok != token.DEFINE {
+			break
+		}
+		for _, e := range s.Lhs {
+			if id, ok := e.(*ast.Ident); ok && id.Name != "_" {
+				sites = append(sites, DeclSite{Name: id.Name, Kind: ast.Var, Ident: id, Node: s})
+			}
+		}
+	case *ast.DeclStmt:
+		if gd, ok := s.Decl.(*ast.GenDecl); ok {
+			for _, spec := range gd.Specs {
+				sites = append(sites, specDecls(gd.Tok, spec)...)
+			}
+		}
+	}
+	return sites
+}
@@ -0,0 +1,212 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"testing"
+)
+
+func TestCursorLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		lookup string
+
+		// want holds what lookup resolves to at every call of check, as
+		// the kind and line of the declaration
+		want []string
+	}{
+		{
+			name: "imports and package level",
+			src: `package p
+
+import (
+	"fmt"
+	str "strings"
+)
+
+const limit = 3
+
+func f() {
+	check()
+}
+
+var fmt2 = fmt.Sprint
+`,
+			lookup: "str",
+			want:   []string{"package@5"},
+		},
+		{
+			name: "dot imports and predeclared names",
+			src: `package p
+
+import . "strings"
+
+func f() {
+	check()
+}
+`,
+			lookup: "Builder",
+			want:   []string{"none"},
+		},
+		{
+			name: "closures",
+			src: `package p
+
+var x = 1
+
+func f(x int) {
+	g := func(x string) {
+		check()
+	}
+	check()
+	_ = func() {
+		check()
+	}
+}
+
+func h() {
+	check()
+}
+`,
+			lookup: "x",
+			want:   []string{"var@6", "var@5", "var@5", "var@3"},
+		},
+		{
+			name: "short variable declarations",
+			src: `package p
+
+func f(err error) {
+	check()
+	n, err := g()
+	check()
+	{
+		err := h(err)
+		check()
+	}
+	check()
+}
+`,
+			lookup: "err",
+			want:   []string{"var@3", "var@3", "var@8", "var@3"},
+		},
+		{
+			name: "type switches",
+			src: `package p
+
+func f(v any) {
+	switch v := v.(type) {
+	case int:
+		check()
+	default:
+		check()
+	}
+	check()
+}
+`,
+			lookup: "v",
+			want:   []string{"var@4", "var@4", "var@3"},
+		},
+		{
+			name: "range statements",
+			src: `package p
+
+func f(m map[string]int) {
+	for k := range m {
+		check()
+		for k, v := range m {
+			check()
+		}
+	}
+	check()
+}
+`,
+			lookup: "k",
+			want:   []string{"var@4", "var@6", "none"},
+		},
+		{
+			name: "statement headers",
+			src: `package p
+
+func f() {
+	if err := g(); err != nil {
+		check()
+	} else {
+		check()
+	}
+	check()
+	select {
+	case err := <-errs:
+		check()
+	}
+}
+`,
+			lookup: "err",
+			want:   []string{"var@4", "var@4", "none", "var@11"},
+		},
+		{
+			name: "local declarations and type parameters",
+			src: `package p
+
+func f[T any](x T) {
+	check()
+	type T int
+	check()
+}
+
+type S[T any] struct{ v T }
+
+func (s S[T]) m() {
+	check()
+}
+`,
+			lookup: "T",
+			want:   []string{"type@3", "type@5", "type@11"},
+		},
+		{
+			name: "labels",
+			src: `package p
+
+func f() {
+L:
+	for {
+		check()
+		break L
+	}
+}
+`,
+			lookup: "L",
+			want:   []string{"none"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fset, file := parse(t, tc.src)
+			var got []string
+			var w *Walker
+			w = New(func(n ast.Node) (ast.Node, bool) {
+				if call, ok := n.(*ast.CallExpr); ok && isIdent(call.Fun, "check") {
+					site, ok := w.Cursor().Lookup(tc.lookup)
+					if !ok {
+						got = append(got, "none")
+						return n, true
+					}
+					if w.Cursor().InScope(tc.lookup) != ok {
+						t.Error("InScope disagrees with Lookup")
+					}
+					pos := site.Node.Pos()
+					if site.Ident != nil {
+						pos = site.Ident.Pos()
+					}
+					got = append(got, fmt.Sprintf("%s@%d", site.Kind, fset.Position(pos).Line))
+				}
+				return n, true
+			})
+			w.Walk(file)
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
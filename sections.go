@@ -0,0 +1,618 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// sectionComment matches section comments like // --- load config ---.
+var sectionComment = regexp.MustCompile(`^//\s*---\s*(.*?)\s*---\s*$`)
+
+// SplitBySections splits the function funcName of file, parsed with fset, at
+// section comments, like // --- load config ---, on their own line in its
+// body. The
+// statements from each section comment up to the next one or the end of the
+// body are moved into a helper function, named after the function and the
+// section (fLoadConfig), which is declared at the end of the file and called
+// in place of the statements. Statements before the first section comment
+// and a final return statement stay.
+//
+// The analysis is syntactic. Local variables a section uses become
+// parameters of its helper, and variables it declares or assigns that are
+// used after it become results. Their types must be spelled out by the
+// signature or a var declaration, or be obvious from a literal, composite
+// literal, make or new. Sections returning from the function, deferring,
+// or branching out of the section are an error, as are variables of
+// unknown type; the file is left unchanged then. The statements of the
+// helpers keep their lines and comments, which are moved, along with them,
+// to a file added to fset. It returns the names of the helpers.
+func SplitBySections(fset *token.FileSet, file *ast.File, funcName string) ([]string, error) {
+	tf := fset.File(file.Package)
+	if tf == nil {
+		return nil, fmt.Errorf("astrewrite: file not in FileSet")
+	}
+	var fd *ast.FuncDecl
+	for _, d := range file.Decls {
+		if f, ok := d.(*ast.FuncDecl); ok && f.Recv == nil && f.Name.Name == funcName && f.Body != nil {
+			fd = f
+			break
+		}
+	}
+	if fd == nil {
+		return nil, fmt.Errorf("astrewrite: function %s not found", funcName)
+	}
+
+	// find the sections
+	type section struct {
+		name    string
+		comment *ast.CommentGroup
+		start   int // index of the first statement
+	}
+	var sections []section
+	list := fd.Body.List
+	for _, cg := range file.Comments {
+		if cg.Pos() < fd.Body.Lbrace || cg.End() > fd.Body.Rbrace || len(cg.List) != 1 {
+			continue
+		}
+		m := sectionComment.FindStringSubmatch(cg.List[0].Text)
+		if m == nil {
+			continue
+		}
+		start := len(list)
+		for i, s := range list {
+			if s.Pos() > cg.End() {
+				start = i
+				break
+			}
+			if s.End() > cg.Pos() {
+				return nil, fmt.Errorf("astrewrite: section comment %q isn't between top-level statements of %s", m[1], funcName)
+			}
+		}
+		sections = append(sections, section{name: m[1], comment: cg, start: start})
+	}
+	if len(sections) == 0 {
+		return nil, nil
+	}
+
+	// known types of the local variables in scope at the top level
+	typesOf := make(map[string]ast.Expr)
+	for _, fl := range []*ast.FieldList{fd.Type.Params, fd.Type.Results} {
+		if fl == nil {
+			continue
+		}
+		for _, f := range fl.List {
+			for _, name := range f.Names {
+				typesOf[name.Name] = f.Type
+			}
+		}
+	}
+	declared := func(stmts []ast.Stmt) []string {
+		var names []string
+		for _, s := range stmts {
+			for _, d := range topLevelDecls(s) {
+				if d.typ != nil {
+					typesOf[d.name] = d.typ
+				} else if _, ok := typesOf[d.name]; !ok {
+					typesOf[d.name] = nil
+				}
+				names = append(names, d.name)
+			}
+		}
+		return names
+	}
+	declared(list[:sections[0].start])
+
+	names := NewNameGen(file)
+	var (
+		helpers     []*ast.FuncDecl
+		moved       [][]ast.Stmt // the statements of the helpers
+		calls       []ast.Stmt
+		helperNames []string
+	)
+	for i, sec := range sections {
+		end := len(list)
+		if i+1 < len(sections) {
+			end = sections[i+1].start
+		}
+		stmts := list[sec.start:end]
+		var trailing ast.Stmt
+		if ret, ok := list[len(list)-1].(*ast.ReturnStmt); ok && end == len(list) && len(stmts) > 0 {
+			// the final return stays in place
+			trailing, end = ret, end-1
+			stmts = stmts[:len(stmts)-1]
+		}
+		if len(stmts) == 0 {
+			calls = append(calls, trailing)
+			helpers = append(helpers, nil)
+			moved = append(moved, nil)
+			continue
+		}
+		if what := leavesSection(stmts); what != "" {
+			return nil, fmt.Errorf("astrewrite: section %q of %s contains %s", sec.name, funcName, what)
+		}
+
+		local := make(map[string]bool)
+		for name := range typesOf {
+			local[name] = true
+		}
+		var params []string
+		reads := readVars(stmts)
+		for _, name := range FreeVars(&ast.BlockStmt{List: stmts}) {
+			if local[name] && reads[name] {
+				params = append(params, name)
+			}
+		}
+		inner := declared(stmts)
+		usedAfter := make(map[string]bool)
+		for _, name := range FreeVars(&ast.BlockStmt{List: list[end:]}) {
+			usedAfter[name] = true
+		}
+		var results []string
+		define := false
+		seen := make(map[string]bool)
+		for _, name := range append(inner, assignedVars(stmts)...) {
+			if seen[name] || !usedAfter[name] || !local[name] && !contains(inner, name) {
+				continue
+			}
+			seen[name] = true
+			results = append(results, name)
+			if contains(inner, name) && !local[name] {
+				define = true
+			}
+		}
+
+		field := func(name string) (*ast.Field, error) {
+			typ := typesOf[name]
+			if typ == nil {
+				return nil, fmt.Errorf("astrewrite: can't tell the type of %s in section %q of %s", name, sec.name, funcName)
+			}
+			return &ast.Field{Names: []*ast.Ident{ast.NewIdent(name)}, Type: clearedClone(typ)}, nil
+		}
+		ftype := &ast.FuncType{Params: &ast.FieldList{}}
+		for _, name := range params {
+			f, err := field(name)
+			if err != nil {
+				return nil, err
+			}
+			ftype.Params.List = append(ftype.Params.List, f)
+		}
+		if len(results) > 0 {
+			ftype.Results = &ast.FieldList{}
+			for _, name := range results {
+				f, err := field(name)
+				if err != nil {
+					return nil, err
+				}
+				f.Names = nil
+				ftype.Results.List = append(ftype.Results.List, f)
+			}
+		}
+
+		name := names.Name(funcName + sectionName(sec.name, i))
+		helperNames = append(helperNames, name)
+		var body []ast.Stmt
+		for _, r := range results {
+			if local[r] && !contains(params, r) {
+				// assigned, but not read
+				f, err := field(r)
+				if err != nil {
+					return nil, err
+				}
+				body = append(body, &ast.DeclStmt{Decl: &ast.GenDecl{
+					Tok:   token.VAR,
+					Specs: []ast.Spec{&ast.ValueSpec{Names: f.Names, Type: f.Type}},
+				}})
+			}
+		}
+		body = append(body, stmts...)
+		if len(results) > 0 {
+			body = append(body, &ast.ReturnStmt{Results: idents(results)})
+		}
+		helpers = append(helpers, &ast.FuncDecl{
+			Name: ast.NewIdent(name),
+			Type: ftype,
+			Body: &ast.BlockStmt{List: body},
+		})
+		moved = append(moved, stmts)
+
+		pos := stmts[0].Pos()
+		call := &ast.CallExpr{Fun: &ast.Ident{NamePos: pos, Name: name}, Lparen: pos, Rparen: pos}
+		for _, p := range params {
+			call.Args = append(call.Args, &ast.Ident{NamePos: pos, Name: p})
+		}
+		var stmt ast.Stmt = &ast.ExprStmt{X: call}
+		if len(results) > 0 {
+			lhs := idents(results)
+			tok := token.ASSIGN
+			if define {
+				tok = token.DEFINE
+			}
+			for _, l := range lhs {
+				l.(*ast.Ident).NamePos = pos
+			}
+			stmt = &ast.AssignStmt{Lhs: lhs, TokPos: pos, Tok: tok, Rhs: []ast.Expr{call}}
+		}
+		calls = append(calls, stmt)
+		if trailing != nil {
+			calls = append(calls, trailing)
+			helpers = append(helpers, nil)
+			moved = append(moved, nil)
+		}
+	}
+
+	// everything checked out, rewrite the file
+	newList := append([]ast.Stmt(nil), list[:sections[0].start]...)
+	var decls []ast.Decl
+	for i, stmt := range calls {
+		if stmt != nil {
+			newList = append(newList, stmt)
+		}
+		if helpers[i] != nil {
+			decls = append(decls, helpers[i])
+		}
+	}
+	moveSections(fset, tf, file, helpers, moved)
+	if n := len(calls); n > 1 && helpers[n-2] != nil {
+		// a final return follows the last call rather than the lines of
+		// the statements moved to its helper
+		if ret, ok := calls[n-1].(*ast.ReturnStmt); ok && !commentsIn(file, calls[n-2].End(), ret.Pos()) {
+			from, to := ret.Pos(), calls[n-2].Pos()
+			mapPositions(ret, func(p token.Pos) token.Pos {
+				if p == from {
+					return to
+				}
+				return p
+			})
+		}
+	}
+	fd.Body.List = newList
+	file.Decls = append(file.Decls, decls...)
+	return helperNames, nil
+}
+
+// moveSections moves the statements in moved, along with their lines and the
+// comments on them, to a file added to fset, where they make up the bodies
+// of the helpers, which are laid out one after another. The file starts
+// with the lines of tf, the file holding them so far, so that the printer,
+// which compares the offsets and lines of positions, puts the helpers and
+// their comments after its end.
+func moveSections(fset *token.FileSet, tf *token.File, file *ast.File, helpers []*ast.FuncDecl, moved [][]ast.Stmt) {
+	type segment struct {
+		start, end int // offsets in tf
+		at         int // offset in the new file
+	}
+	lineAfter := func(pos token.Pos) int {
+		if line := tf.Line(pos); line < tf.LineCount() {
+			return tf.Offset(tf.LineStart(line + 1))
+		}
+		return tf.Size()
+	}
+
+	// The lines added are a byte long, except for those of the statements.
+	lines := append([]int(nil), tf.Lines()...)
+	off := tf.Size()
+	newLine := func() int {
+		lines = append(lines, off)
+		off++
+		return off - 1
+	}
+	newLine() // the blank line before the helpers
+	segs := make([]segment, len(helpers))
+	heads := make([]int, len(helpers))
+	rbraces := make([]int, len(helpers))
+	for i, stmts := range moved {
+		if stmts == nil {
+			continue
+		}
+		heads[i] = newLine()
+		seg := segment{
+			start: tf.Offset(tf.LineStart(tf.Line(stmts[0].Pos()))),
+			end:   lineAfter(stmts[len(stmts)-1].End() - 1),
+			at:    off,
+		}
+		for _, l := range tf.Lines() {
+			if seg.start <= l && l < seg.end {
+				lines = append(lines, l-seg.start+seg.at)
+			}
+		}
+		off += seg.end - seg.start
+		segs[i] = seg
+		rbraces[i] = newLine()
+		newLine() // the blank line between helpers
+	}
+
+	nf := fset.AddFile(tf.Name(), -1, off)
+	nf.SetLines(lines)
+	for i, h := range helpers {
+		if h == nil {
+			continue
+		}
+		seg := segs[i]
+		start, end := tf.Pos(seg.start), tf.Pos(seg.end)
+		move := func(p token.Pos) token.Pos {
+			if start <= p && p < end {
+				return nf.Pos(int(p-start) + seg.at)
+			}
+			return p
+		}
+		for _, s := range moved[i] {
+			mapPositions(s, move)
+		}
+		for _, cg := range file.Comments {
+			if start <= cg.Pos() && cg.Pos() < end {
+				mapPositions(cg, move)
+			}
+		}
+		head := nf.Pos(heads[i])
+		h.Type.Func, h.Name.NamePos, h.Body.Lbrace = head, head, head
+		h.Body.Rbrace = nf.Pos(rbraces[i])
+	}
+	sort.Slice(file.Comments, func(i, j int) bool {
+		return file.Comments[i].Pos() < file.Comments[j].Pos()
+	})
+}
+
+// readVars returns the names of the identifiers in stmts that aren't only
+// assigned to.
+func readVars(stmts []ast.Stmt) map[string]bool {
+	assigned := make(map[*ast.Ident]bool)
+	reads := make(map[string]bool)
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if n.Tok == token.ASSIGN || n.Tok == token.DEFINE {
+					for _, l := range n.Lhs {
+						if id, ok := l.(*ast.Ident); ok {
+							assigned[id] = true
+						}
+					}
+				}
+			case *ast.Ident:
+				if !assigned[n] {
+					reads[n.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	return reads
+}
+
+// localDecl is a variable declared by a statement along with its type, if
+// it's known.
+type localDecl struct {
+	name string
+	typ  ast.Expr
+}
+
+// topLevelDecls returns the variables declared by s in the scope s is in.
+func topLevelDecls(s ast.Stmt) []localDecl {
+	var decls []localDecl
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		if s.Tok != token.DEFINE {
+			break
+		}
+		for i, l := range s.Lhs {
+			id, ok := l.(*ast.Ident)
+			if !ok || id.Name == "_" {
+				continue
+			}
+			var typ ast.Expr
+			if len(s.Lhs) == len(s.Rhs) {
+				typ = literalType(s.Rhs[i])
+			}
+			decls = append(decls, localDecl{id.Name, typ})
+		}
+	case *ast.DeclStmt:
+		gd, ok := s.Decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			break
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if name.Name == "_" {
+					continue
+				}
+				typ := vs.Type
+				if typ == nil && len(vs.Names) == len(vs.Values) {
+					typ = literalType(vs.Values[i])
+				}
+				decls = append(decls, localDecl{name.Name, typ})
+			}
+		}
+	}
+	return decls
+}
+
+// literalType returns the type of e if it's obvious from the syntax, or nil.
+func literalType(e ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			return ast.NewIdent("int")
+		case token.FLOAT:
+			return ast.NewIdent("float64")
+		case token.IMAG:
+			return ast.NewIdent("complex128")
+		case token.CHAR:
+			return ast.NewIdent("rune")
+		case token.STRING:
+			return ast.NewIdent("string")
+		}
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" {
+			return ast.NewIdent("bool")
+		}
+	case *ast.CompositeLit:
+		return e.Type
+	case *ast.UnaryExpr:
+		if lit, ok := e.X.(*ast.CompositeLit); ok && e.Op == token.AND && lit.Type != nil {
+			return &ast.StarExpr{X: lit.Type}
+		}
+	case *ast.CallExpr:
+		if id, ok := e.Fun.(*ast.Ident); ok && len(e.Args) > 0 {
+			switch id.Name {
+			case "make":
+				return e.Args[0]
+			case "new":
+				return &ast.StarExpr{X: e.Args[0]}
+			}
+		}
+	}
+	return nil
+}
+
+// assignedVars returns the names of the identifiers assigned to in stmts.
+func assignedVars(stmts []ast.Stmt) []string {
+	var names []string
+	add := func(e ast.Expr) {
+		if id, ok := e.(*ast.Ident); ok && id.Name != "_" {
+			names = append(names, id.Name)
+		}
+	}
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.AssignStmt:
+				if n.Tok != token.DEFINE {
+					for _, l := range n.Lhs {
+						add(l)
+					}
+				}
+			case *ast.IncDecStmt:
+				add(n.X)
+			case *ast.RangeStmt:
+				if n.Tok == token.ASSIGN {
+					add(n.Key)
+					add(n.Value)
+				}
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// leavesSection describes the first statement in stmts that would leave
+// them other than by falling off the end, or returns "".
+func leavesSection(stmts []ast.Stmt) string {
+	labels := make(map[string]bool)
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			if l, ok := n.(*ast.LabeledStmt); ok {
+				labels[l.Label.Name] = true
+			}
+			return true
+		})
+	}
+
+	what := ""
+	var visit func(n ast.Node, loop, breakable bool) bool
+	visit = func(n ast.Node, loop, breakable bool) bool {
+		if what != "" {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			what = "a return statement"
+		case *ast.DeferStmt:
+			what = "a defer statement"
+		case *ast.BranchStmt:
+			switch {
+			case n.Label != nil && !labels[n.Label.Name]:
+				what = n.Tok.String() + " " + n.Label.Name
+			case n.Label != nil:
+			case n.Tok == token.BREAK && !breakable, n.Tok == token.CONTINUE && !loop:
+				what = "an unlabeled " + n.Tok.String()
+			}
+		case *ast.ForStmt, *ast.RangeStmt:
+			ast.Inspect(n, func(c ast.Node) bool {
+				return c == n || visit(c, true, true)
+			})
+			return false
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			ast.Inspect(n, func(c ast.Node) bool {
+				return c == n || visit(c, loop, true)
+			})
+			return false
+		}
+		return true
+	}
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool { return visit(n, false, false) })
+	}
+	return what
+}
+
+// sectionName turns the name of the i-th section into a suffix for the
+// name of its helper.
+func sectionName(name string, i int) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range name {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			if upper {
+				sb.WriteString(strings.ToUpper(string(r)))
+			} else {
+				sb.WriteRune(r)
+			}
+			upper = false
+		default:
+			upper = true
+		}
+	}
+	if sb.Len() == 0 {
+		return fmt.Sprintf("Section%d", i+1)
+	}
+	return sb.String()
+}
+
+// dropComments removes the comments in [pos, end) from file.
+func dropComments(file *ast.File, pos, end token.Pos) {
+	out := file.Comments[:0]
+	for _, cg := range file.Comments {
+		if cg.Pos() < pos || cg.Pos() >= end {
+			out = append(out, cg)
+		}
+	}
+	file.Comments = out
+}
+
+// clearedClone returns a copy of e without positions.
+func clearedClone(e ast.Expr) ast.Expr {
+	c := Clone(e).(ast.Expr)
+	clearPositions(c)
+	return c
+}
+
+// idents returns identifiers with the given names.
+func idents(names []string) []ast.Expr {
+	var ids []ast.Expr
+	for _, name := range names {
+		ids = append(ids, ast.NewIdent(name))
+	}
+	return ids
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
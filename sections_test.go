@@ -0,0 +1,92 @@
+package astrewrite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitBySections(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func run(path string, verbose bool) error {
+	var n int
+
+	// --- load config ---
+	data := readFile(path)
+	cfg := &Config{}
+	// parse the data
+	parse(data, cfg)
+	n = len(data)
+
+	// --- report ---
+	for _, s := range cfg.Items {
+		if s == "" {
+			continue
+		}
+		log(s, verbose) // one line each
+	}
+	return check(cfg, n)
+}
+
+// after is unrelated.
+func after() {}
+`)
+
+	names, err := SplitBySections(fset, file, "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"runLoadConfig", "runReport"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got helpers %v, want %v", names, want)
+	}
+	// the comments in the sections move along with their statements
+	checkSource(t, fset, file, `package p
+
+func run(path string, verbose bool) error {
+	var n int
+
+	// --- load config ---
+	cfg, n := runLoadConfig(path)
+
+	// --- report ---
+	runReport(cfg, verbose)
+	return check(cfg, n)
+}
+
+// after is unrelated.
+func after() {}
+
+func runLoadConfig(path string) (*Config, int) {
+	var n int
+	data := readFile(path)
+	cfg := &Config{}
+	// parse the data
+	parse(data, cfg)
+	n = len(data)
+	return cfg, n
+}
+
+func runReport(cfg *Config, verbose bool) {
+	for _, s := range cfg.Items {
+		if s == "" {
+			continue
+		}
+		log(s, verbose) // one line each
+	}
+}
+`)
+}
+
+func TestSplitBySectionsErrors(t *testing.T) {
+	for _, body := range []string{
+		"// --- a ---\nif x { return }\nf()",
+		"for {\n// --- a ---\nbreak\n}",
+		"y := g()\n// --- a ---\nz := y\nf(z)",
+		"// --- a ---\ndefer f()\ng()",
+	} {
+		fset, file := parse(t, "package p\n\nfunc f(x bool) {\n"+body+"\n}\n")
+		if _, err := SplitBySections(fset, file, "f"); err == nil {
+			t.Errorf("%q: no error", body)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// CasePosition tells where AddSelectCase adds a case.
+type CasePosition int
+
+const (
+	// CaseFirst adds the case before all others.
+	CaseFirst CasePosition = iota
+	// CaseLast adds the case after all others.
+	CaseLast
+	// CaseBeforeDefault adds the case before the default case, or last if
+	// there's none.
+	CaseBeforeDefault
+)
+
+// AddSelectCase adds the case comm with the statements body to sel, unless
+// sel already has a case with an equal communication, and reports whether
+// it did. A nil comm adds a default case, which is refused if sel has one.
+// All positions of the new case are set to the end of the case before it,
+// or the start of the first case, so that it prints in place.
+func AddSelectCase(sel *ast.SelectStmt, comm ast.Stmt, body []ast.Stmt, position CasePosition) bool {
+	list := sel.Body.List
+	i := len(list)
+	for j, s := range list {
+		cc := s.(*ast.CommClause)
+		if Equal(cc.Comm, comm) {
+			return false
+		}
+		if cc.Comm == nil && position == CaseBeforeDefault {
+			i = j
+		}
+	}
+	if position == CaseFirst {
+		i = 0
+	}
+
+	pos := sel.Body.Lbrace
+	switch {
+	case i > 0:
+		pos = list[i-1].End()
+	case len(list) > 0:
+		pos = list[0].Pos()
+	}
+	if !isNil(comm) {
+		placeAt(comm, pos)
+	}
+	for _, s := range body {
+		placeAt(s, pos)
+	}
+	cc := &ast.CommClause{Case: pos, Comm: comm, Colon: pos, Body: body}
+	sel.Body.List = append(list[:i:i], append([]ast.Stmt{cc}, list[i:]...)...)
+	return true
+}
+
+// ForEachSelect calls fn for the select statements below root, outer ones
+// first. Returning false skips the selects nested in the one fn was called
+// with.
+func ForEachSelect(root ast.Node, fn func(*ast.SelectStmt) bool) {
+	ast.Inspect(root, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectStmt); ok {
+			return fn(sel)
+		}
+		return true
+	})
+}
+
+// RecvKind tells where a receive is used.
+type RecvKind int
+
+const (
+	// RecvExpr is a receive used as an expression, like <-ch as a
+	// statement or f(<-ch).
+	RecvExpr RecvKind = iota
+	// RecvAssign is the single value of an assignment or variable
+	// declaration, like v := <-ch or v, ok = <-ch.
+	RecvAssign
+	// RecvLoop is a receive in the header of a for statement, like
+	// for v := <-ch; v != 0; v = <-ch.
+	RecvLoop
+)
+
+// RecvContext describes where a receive is used.
+type RecvContext struct {
+	Kind RecvKind
+
+	// Node is the node using the receive: the assignment or value spec for
+	// RecvAssign, the for statement for RecvLoop and the parent of the
+	// receive, ignoring parentheses, for RecvExpr.
+	Node ast.Node
+
+	// Select is set if the receive is the communication of a select case.
+	Select bool
+}
+
+// RewriteReceives calls rw for the receive operations below root, which can
+// rewrite them like a WalkFunc and edit ctx.Node to match, like adding a
+// second variable to a receiving assignment. Receives in function literals
+// are included.
+func RewriteReceives(root ast.Node, rw func(recv *ast.UnaryExpr, ctx RecvContext) (ast.Node, bool)) ast.Node {
+	var w *Walker
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		recv, ok := n.(*ast.UnaryExpr)
+		if !ok || recv.Op != token.ARROW {
+			return n, true
+		}
+		return rw(recv, recvContext(recv, w.Cursor().w.stack))
+	})
+	rewritten, _ := w.Walk(root)
+	return rewritten
+}
+
+// recvContext returns the context of recv, whose ancestors are stack.
+func recvContext(recv *ast.UnaryExpr, stack []ast.Node) RecvContext {
+	i := len(stack) - 1
+	for i >= 0 {
+		if _, ok := stack[i].(*ast.ParenExpr); !ok {
+			break
+		}
+		i--
+	}
+	if i < 0 {
+		return RecvContext{Kind: RecvExpr}
+	}
+	ctx := RecvContext{Kind: RecvExpr, Node: stack[i]}
+	switch p := stack[i].(type) {
+	case *ast.AssignStmt:
+		if len(p.Rhs) == 1 {
+			ctx.Kind = RecvAssign
+		}
+	case *ast.ValueSpec:
+		if len(p.Values) == 1 {
+			ctx.Kind = RecvAssign
+		}
+	}
+	if s, ok := stack[i].(ast.Stmt); ok && i > 0 {
+		if cc, ok := stack[i-1].(*ast.CommClause); ok && cc.Comm == s {
+			ctx.Select = true
+		}
+	}
+
+	// the header of a for statement is the nearest statement or its
+	// parent
+	for j := i; j >= 0; j-- {
+		switch s := stack[j].(type) {
+		case *ast.FuncLit:
+			return ctx
+		case *ast.ForStmt:
+			return RecvContext{Kind: RecvLoop, Node: s}
+		case ast.Stmt:
+			if j > 0 {
+				if loop, ok := stack[j-1].(*ast.ForStmt); ok && (loop.Init == s || loop.Post == s) {
+					return RecvContext{Kind: RecvLoop, Node: loop}
+				}
+			}
+			return ctx
+		}
+	}
+	return ctx
+}
@@ -0,0 +1,162 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+)
+
+func TestAddSelectCase(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "context"
+
+func f(ctx context.Context, in <-chan int, out chan<- int) error {
+	for {
+		select {
+		case v := <-in:
+			out <- v
+		default:
+			// nothing to do
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- 0:
+		}
+		select {
+		case <-in:
+		}
+	}
+}
+`)
+
+	added := 0
+	ForEachSelect(file, func(sel *ast.SelectStmt) bool {
+		comm, err := parseExpr("<-ctx.Done()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret, err := parseExpr("ctx.Err()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{ret}}}
+		if AddSelectCase(sel, &ast.ExprStmt{X: comm}, body, CaseBeforeDefault) {
+			added++
+		}
+		return true
+	})
+	if added != 2 {
+		t.Errorf("added %d cases, want 2", added)
+	}
+
+	checkSource(t, fset, file, `package p
+
+import "context"
+
+func f(ctx context.Context, in <-chan int, out chan<- int) error {
+	for {
+		select {
+		case v := <-in:
+			out <- v
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// nothing to do
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- 0:
+		}
+		select {
+		case <-in:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+`)
+
+	// a second default is refused, the first case goes in front
+	sel := findFunc(file, "f").Body.List[0].(*ast.ForStmt).Body.List[0].(*ast.SelectStmt)
+	if AddSelectCase(sel, nil, nil, CaseLast) {
+		t.Error("added a second default case")
+	}
+	if !AddSelectCase(sel, &ast.SendStmt{Chan: ast.NewIdent("out"), Value: ast.NewIdent("v")}, nil, CaseFirst) {
+		t.Error("didn't add the send case")
+	}
+	if cc := sel.Body.List[0].(*ast.CommClause); !Equal(cc.Comm, &ast.SendStmt{Chan: ast.NewIdent("out"), Value: ast.NewIdent("v")}) {
+		t.Errorf("got first case %s", render(t, fset, cc))
+	}
+}
+
+func TestRewriteReceives(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(ch chan int) {
+	v := <-ch
+	println(v, (<-ch))
+	var w = <-ch
+	for x := <-ch; x != 0; x = <-ch {
+		println(x)
+	}
+	select {
+	case y := <-ch:
+		println(y)
+	case <-ch:
+	}
+}
+`)
+
+	type recv struct {
+		kind RecvKind
+		node string
+		sel  bool
+	}
+	var got []recv
+	RewriteReceives(file, func(r *ast.UnaryExpr, ctx RecvContext) (ast.Node, bool) {
+		got = append(got, recv{ctx.Kind, render(t, fset, ctx.Node), ctx.Select})
+		// turn single value receives into two value ones
+		if as, ok := ctx.Node.(*ast.AssignStmt); ok && ctx.Kind == RecvAssign && as.Tok == token.DEFINE && len(as.Lhs) == 1 {
+			as.Lhs = append(as.Lhs, &ast.Ident{NamePos: as.TokPos, Name: "ok"})
+		}
+		return r, true
+	})
+
+	want := []recv{
+		{RecvAssign, "v := <-ch", false},
+		{RecvExpr, "println(v, (<-ch))", false},
+		{RecvAssign, "w = <-ch", false},
+		{RecvLoop, "for x := <-ch; x != 0; x = <-ch {\n\tprintln(x)\n}", false},
+		{RecvLoop, "for x := <-ch; x != 0; x = <-ch {\n\tprintln(x)\n}", false},
+		{RecvAssign, "y := <-ch", true},
+		{RecvExpr, "<-ch", true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d receives, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("receive %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	checkSource(t, fset, file, `package p
+
+func f(ch chan int) {
+	v, ok := <-ch
+	println(v, (<-ch))
+	var w = <-ch
+	for x := <-ch; x != 0; x = <-ch {
+		println(x)
+	}
+	select {
+	case y, ok := <-ch:
+		println(y)
+	case <-ch:
+	}
+}
+`)
+}
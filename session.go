@@ -0,0 +1,295 @@
+package astrewrite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest records a run of a Driver as the edits it made to every file,
+// along with hashes of the inputs and outputs, so that the run can be
+// audited and replayed, see Replay. Hashes are hex encoded SHA-256 sums.
+type Manifest struct {
+	// Rule names the walk function of the run, including its version.
+	Rule string `json:"rule"`
+
+	// Files holds the walked files, sorted by path.
+	Files []ManifestFile `json:"files"`
+}
+
+// ManifestFile records the edits made to a file.
+type ManifestFile struct {
+	// Path is the slash separated path of the file relative to the path
+	// given to Run it was found under, or its base name if it was given
+	// directly. When Run is given several paths, Path is instead relative to
+	// the directory holding all of them, as in "svcA/main.go" for the paths
+	// svcA and svcB, so that same-named files under different paths are
+	// kept apart.
+	Path string `json:"path"`
+
+	Input string `json:"input"`
+
+	// Edits holds the edits in the order they apply, which is the order
+	// of their offsets.
+	Edits []ManifestEdit `json:"edits"`
+
+	Output string `json:"output"`
+}
+
+// ManifestEdit replaces the byte range [Offset, End) of the input of a file
+// with Text.
+type ManifestEdit struct {
+	Rule   string `json:"rule"`
+	Line   int    `json:"line"`
+	Offset int    `json:"offset"`
+	End    int    `json:"end"`
+	Text   string `json:"text"`
+	Hash   string `json:"hash"`
+}
+
+// RecordSession makes Run write a manifest of the run as JSON to w once all
+// files are done, and set DriverReport.Manifest. rule names the walk
+// function and its version. The edits are the line ranges that differ
+// between the input and output of a file, so the manifest covers every
+// change regardless of how the walk function made it. Running the same rule
+// on the same inputs must produce a byte identical manifest; a difference
+// points at non-determinism in the rule.
+func RecordSession(rule string, w io.Writer) DriverOption {
+	return func(d *Driver) {
+		d.session = &session{rule: rule, w: w}
+	}
+}
+
+// session holds the state of RecordSession.
+type session struct {
+	rule     string
+	w        io.Writer
+	roots    []string
+	base     string
+	manifest *Manifest
+}
+
+// start begins recording a run over paths.
+func (s *session) start(paths []string) {
+	s.roots = paths
+	s.base = ""
+	if len(paths) > 1 {
+		s.base = commonDir(paths)
+	}
+	s.manifest = &Manifest{Rule: s.rule, Files: []ManifestFile{}}
+}
+
+// record adds the file at path with the given input and output.
+func (s *session) record(path string, in, out []byte) {
+	mf := ManifestFile{Path: s.relPath(path), Input: hash(in), Edits: []ManifestEdit{}, Output: hash(out)}
+	for _, e := range lineEdits(in, out) {
+		e.Rule = s.rule
+		mf.Edits = append(mf.Edits, e)
+	}
+	s.manifest.Files = append(s.manifest.Files, mf)
+}
+
+// finish writes the manifest.
+func (s *session) finish() error {
+	sort.SliceStable(s.manifest.Files, func(i, j int) bool {
+		return s.manifest.Files[i].Path < s.manifest.Files[j].Path
+	})
+	b, err := json.MarshalIndent(s.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// relPath returns path relative to the root it was found under, or to the
+// directory holding all roots if there are several, see ManifestFile.Path.
+func (s *session) relPath(path string) string {
+	if s.base != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(s.base, abs); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+		return filepath.ToSlash(path)
+	}
+	for _, root := range s.roots {
+		if path == root {
+			return filepath.Base(path)
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// commonDir returns the absolute directory holding all of paths, or "" if
+// there's none, as with paths on different volumes.
+func commonDir(paths []string) string {
+	var dir string
+	for i, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return ""
+		}
+		d := filepath.Dir(abs)
+		if i == 0 {
+			dir = d
+			continue
+		}
+		for {
+			if rel, err := filepath.Rel(dir, d); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return ""
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// maxDiffCells bounds the size of the table lineEdits computes, beyond
+// which the differing lines are replaced as a single edit.
+const maxDiffCells = 1 << 22
+
+// lineEdits returns the edits turning in into out, one for every run of
+// differing lines.
+func lineEdits(in, out []byte) []ManifestEdit {
+	a := bytes.SplitAfter(in, []byte("\n"))
+	b := bytes.SplitAfter(out, []byte("\n"))
+
+	// common prefix and suffix
+	pre := 0
+	for pre < len(a) && pre < len(b) && bytes.Equal(a[pre], b[pre]) {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && bytes.Equal(a[len(a)-1-suf], b[len(b)-1-suf]) {
+		suf++
+	}
+	a, b = a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	offset := 0
+	for _, l := range bytes.SplitAfter(in, []byte("\n"))[:pre] {
+		offset += len(l)
+	}
+
+	// matched[i] is the index of the line of b matching a[i], or -1
+	matched := make([]int, len(a))
+	for i := range matched {
+		matched[i] = -1
+	}
+	if len(a)*len(b) <= maxDiffCells {
+		lcs := make([][]int32, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				switch {
+				case bytes.Equal(a[i], b[j]):
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				case lcs[i+1][j] >= lcs[i][j+1]:
+					lcs[i][j] = lcs[i+1][j]
+				default:
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		for i, j := 0, 0; i < len(a) && j < len(b); {
+			switch {
+			case bytes.Equal(a[i], b[j]):
+				matched[i] = j
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+
+	var edits []ManifestEdit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && matched[i] == j {
+			offset += len(a[i])
+			i++
+			j++
+			continue
+		}
+		e := ManifestEdit{Line: pre + i + 1, Offset: offset}
+		for i < len(a) && matched[i] < 0 {
+			offset += len(a[i])
+			i++
+		}
+		next := len(b)
+		if i < len(a) {
+			next = matched[i]
+		}
+		var text []byte
+		for ; j < next; j++ {
+			text = append(text, b[j]...)
+		}
+		e.End, e.Text, e.Hash = offset, string(text), hash(text)
+		edits = append(edits, e)
+	}
+	return edits
+}
+
+// Replay applies the edits of m to inputs, which holds the contents of the
+// files of m by path, and returns the outputs by path. It fails if an
+// input, the text of an edit or an output doesn't match its hash, or if
+// inputs and m don't hold the same files.
+func Replay(m *Manifest, inputs map[string][]byte) (map[string][]byte, error) {
+	if len(inputs) != len(m.Files) {
+		return nil, fmt.Errorf("astrewrite: replay: got %d inputs for %d files", len(inputs), len(m.Files))
+	}
+	outputs := make(map[string][]byte, len(m.Files))
+	for _, f := range m.Files {
+		in, ok := inputs[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("astrewrite: replay: no input for %s", f.Path)
+		}
+		if h := hash(in); h != f.Input {
+			return nil, fmt.Errorf("astrewrite: replay: %s: input hash %s, manifest has %s", f.Path, h, f.Input)
+		}
+
+		var out []byte
+		last := 0
+		for _, e := range f.Edits {
+			if e.Offset < last || e.End < e.Offset || e.End > len(in) {
+				return nil, fmt.Errorf("astrewrite: replay: %s: edit at line %d out of order or range", f.Path, e.Line)
+			}
+			if h := hash([]byte(e.Text)); h != e.Hash {
+				return nil, fmt.Errorf("astrewrite: replay: %s: text of edit at line %d has hash %s, manifest has %s", f.Path, e.Line, h, e.Hash)
+			}
+			out = append(out, in[last:e.Offset]...)
+			out = append(out, e.Text...)
+			last = e.End
+		}
+		out = append(out, in[last:]...)
+
+		if h := hash(out); h != f.Output {
+			return nil, fmt.Errorf("astrewrite: replay: %s: output hash %s, manifest has %s", f.Path, h, f.Output)
+		}
+		outputs[f.Path] = out
+	}
+	return outputs, nil
+}
@@ -0,0 +1,161 @@
+package astrewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordSession(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package p
+
+func f() {
+	g()
+}
+
+func g() {}
+`,
+		"sub/b.go": `package p
+
+// f is called here.
+func h() { f() }
+`,
+		"c.go": `package p
+
+var unchanged = 1
+`,
+	}
+	rename := func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "f" {
+			id.Name = "run"
+		}
+		return n, true
+	}
+
+	run := func() ([]byte, string) {
+		dir := writeFiles(t, files)
+		var buf bytes.Buffer
+		report, err := NewDriver(rename, RecordSession("rename@v1", &buf)).Run(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Manifest == nil || len(report.Manifest.Files) != 3 {
+			t.Fatalf("got manifest %+v", report.Manifest)
+		}
+		return buf.Bytes(), dir
+	}
+
+	// the same session in another directory records the same manifest
+	m1, dir := run()
+	m2, _ := run()
+	if !bytes.Equal(m1, m2) {
+		t.Errorf("manifests differ:\n%s\n%s", m1, m2)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(m1, &m); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	if got := strings.Join(paths, " "); got != "a.go c.go sub/b.go" {
+		t.Errorf("got paths %s", got)
+	}
+	if n := len(m.Files[0].Edits); n != 1 || m.Files[0].Edits[0].Line != 3 || m.Files[0].Edits[0].Rule != "rename@v1" {
+		t.Errorf("got edits %+v for a.go", m.Files[0].Edits)
+	}
+	if len(m.Files[1].Edits) != 0 || m.Files[1].Input != m.Files[1].Output {
+		t.Errorf("got edits %+v for the unchanged c.go", m.Files[1].Edits)
+	}
+
+	inputs := make(map[string][]byte)
+	for path, src := range files {
+		inputs[path] = []byte(src)
+	}
+	outputs, err := Replay(&m, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path := range files {
+		if want := readFile(t, dir, path); string(outputs[path]) != want {
+			t.Errorf("%s: replayed:\n%s\nwant:\n%s", path, outputs[path], want)
+		}
+	}
+
+	// a tampered input and a tampered edit fail
+	inputs["sub/b.go"] = []byte(strings.Replace(files["sub/b.go"], "here", "there", 1))
+	if _, err := Replay(&m, inputs); err == nil || !strings.Contains(err.Error(), "sub/b.go: input hash") {
+		t.Errorf("got error %v for a tampered input", err)
+	}
+	inputs["sub/b.go"] = []byte(files["sub/b.go"])
+	m.Files[0].Edits[0].Text = "\trun2()\n"
+	if _, err := Replay(&m, inputs); err == nil || !strings.Contains(err.Error(), "a.go: text of edit") {
+		t.Errorf("got error %v for a tampered edit", err)
+	}
+}
+
+func TestRecordSessionRoots(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a/x.go":         "package a\n\nfunc f() {}\n",
+		"b/x.go":         "package b\n\nfunc f() { f() }\n",
+		"svcA/main.go":   "package main\n\nfunc main() { f() }\n",
+		"svcB/main.go":   "package main\n\nfunc main() {}\n",
+		"svcB/f/main.go": "package f\n\nfunc f() {}\n",
+	})
+	rename := func(n ast.Node) (ast.Node, bool) {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "f" {
+			id.Name = "run"
+		}
+		return n, true
+	}
+	for _, tt := range []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"a/x.go", "b/x.go"}, "a/x.go b/x.go"},
+		{[]string{"svcB", "svcA"}, "svcA/main.go svcB/f/main.go svcB/main.go"},
+	} {
+		var paths []string
+		for _, p := range tt.paths {
+			paths = append(paths, filepath.Join(dir, p))
+		}
+		var buf bytes.Buffer
+		report, err := NewDriver(rename, RecordSession("rename@v1", &buf), WithConcurrency(4)).Run(paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range report.Manifest.Files {
+			got = append(got, f.Path)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Run(%v): got paths %v, want %s", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestLineEdits(t *testing.T) {
+	in := "a\nb\nc\nd\ne\n"
+	out := "a\nx\nc\nd\ny\nz\ne\nf"
+	edits := lineEdits([]byte(in), []byte(out))
+	if len(edits) != 3 {
+		t.Fatalf("got %d edits, want 3: %+v", len(edits), edits)
+	}
+	var got []byte
+	last := 0
+	for _, e := range edits {
+		got = append(got, in[last:e.Offset]...)
+		got = append(got, e.Text...)
+		last = e.End
+	}
+	got = append(got, in[last:]...)
+	if string(got) != out {
+		t.Errorf("edits produce %q, want %q", got, out)
+	}
+}
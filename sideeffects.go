@@ -0,0 +1,65 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// pureBuiltins are the builtin functions without side effects. Without type
+// information a shadowed builtin can't be told apart, which is accepted.
+var pureBuiltins = map[string]bool{
+	"len":     true,
+	"cap":     true,
+	"complex": true,
+	"real":    true,
+	"imag":    true,
+	"min":     true,
+	"max":     true,
+}
+
+// HasSideEffects reports whether evaluating e may have side effects, so it
+// must be evaluated exactly once and in its original order. It errs on the
+// safe side: every call other than a pure builtin counts, as do receive
+// operations. Conversions look like calls and are reported too.
+func HasSideEffects(e ast.Expr) bool {
+	return hasSideEffects(e, nil)
+}
+
+// hasSideEffects is HasSideEffects, additionally treating calls of the
+// functions in pure as free of side effects. Functions are named like they
+// are called, e.g. "strings.ToUpper".
+func hasSideEffects(e ast.Expr, pure map[string]bool) bool {
+	impure := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			// creating a closure doesn't run it
+			return false
+		case *ast.CallExpr:
+			name := calleeName(n)
+			if !pureBuiltins[name] && !pure[name] {
+				impure = true
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				impure = true
+			}
+		}
+		return !impure
+	})
+	return impure
+}
+
+// calleeName returns the name of the function called by call if it's an
+// identifier or a selector on an identifier like pkg.Func, or "".
+func calleeName(call *ast.CallExpr) string {
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		if x, ok := fun.X.(*ast.Ident); ok {
+			return x.Name + "." + fun.Sel.Name
+		}
+	}
+	return ""
+}
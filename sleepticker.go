@@ -0,0 +1,197 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+)
+
+// SleepToTicker rewrites the polling loops in the function bodies of node
+// that have exactly the shape
+//
+//	for {
+//		if cond {
+//			break
+//		}
+//		time.Sleep(d)
+//	}
+//
+// into loops waiting for a ticker, which is stopped when the function
+// returns:
+//
+//	ticker := time.NewTicker(d)
+//	defer ticker.Stop()
+//	for {
+//		if cond {
+//			break
+//		}
+//		<-ticker.C
+//	}
+//
+// time.NewTicker panics unless d is positive, while time.Sleep returns right
+// away, so d must be a positive constant made of literals and the units of
+// package time, like 10 * time.Millisecond. Only loops directly in a
+// function body are rewritten, so that the deferred Stop runs once the loop
+// is done rather than piling up in an outer loop. It returns the number of
+// rewritten loops.
+func SleepToTicker(node ast.Node) int {
+	n := 0
+	var decl *ast.FuncDecl
+	ast.Inspect(node, func(x ast.Node) bool {
+		var body *ast.BlockStmt
+		var scope ast.Node
+		switch fn := x.(type) {
+		case *ast.FuncDecl:
+			decl = fn
+			body, scope = fn.Body, fn
+		case *ast.FuncLit:
+			// avoid the names of the enclosing function as well
+			body, scope = fn.Body, fn
+			if decl != nil && decl.Pos() <= fn.Pos() && fn.End() <= decl.End() {
+				scope = decl
+			}
+		}
+		if body == nil {
+			return true
+		}
+
+		var gen *NameGen
+		var list []ast.Stmt
+		for _, s := range body.List {
+			loop, d := pollingLoop(s)
+			if loop == nil {
+				list = append(list, s)
+				continue
+			}
+			if gen == nil {
+				gen = NewNameGen(scope)
+			}
+			list = append(list, tickerLoop(loop, d, gen.Name("ticker"))...)
+			n++
+		}
+		body.List = list
+		return true
+	})
+	return n
+}
+
+// pollingLoop returns s and the duration it sleeps if s is a polling loop.
+func pollingLoop(s ast.Stmt) (*ast.ForStmt, ast.Expr) {
+	loop, ok := s.(*ast.ForStmt)
+	if !ok || loop.Init != nil || loop.Cond != nil || loop.Post != nil || len(loop.Body.List) != 2 {
+		return nil, nil
+	}
+	check, ok := loop.Body.List[0].(*ast.IfStmt)
+	if !ok || check.Init != nil || check.Else != nil || len(check.Body.List) != 1 {
+		return nil, nil
+	}
+	br, ok := check.Body.List[0].(*ast.BranchStmt)
+	if !ok || br.Tok != token.BREAK || br.Label != nil {
+		return nil, nil
+	}
+	sleep, ok := loop.Body.List[1].(*ast.ExprStmt)
+	if !ok {
+		return nil, nil
+	}
+	call, ok := sleep.X.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 || call.Ellipsis.IsValid() || !isQualified(call.Fun, "time", "Sleep") {
+		return nil, nil
+	}
+	if x := call.Fun.(*ast.SelectorExpr).X.(*ast.Ident); x.Obj != nil {
+		return nil, nil
+	}
+	if d, ok := constDuration(call.Args[0]); !ok || constant.Sign(d) <= 0 {
+		return nil, nil
+	}
+	return loop, call.Args[0]
+}
+
+// timeUnits are the durations declared by package time.
+var timeUnits = map[string]int64{
+	"Nanosecond":  1,
+	"Microsecond": 1e3,
+	"Millisecond": 1e6,
+	"Second":      1e9,
+	"Minute":      60e9,
+	"Hour":        3600e9,
+}
+
+// constDuration returns the value of e if it's a constant expression of
+// literals and units of package time.
+func constDuration(e ast.Expr) (constant.Value, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		v := constant.MakeFromLiteral(e.Value, e.Kind, 0)
+		return v, v.Kind() == constant.Int || v.Kind() == constant.Float
+	case *ast.SelectorExpr:
+		x, ok := e.X.(*ast.Ident)
+		ns, unit := timeUnits[e.Sel.Name]
+		if !ok || x.Name != "time" || x.Obj != nil || !unit {
+			return nil, false
+		}
+		return constant.MakeInt64(ns), true
+	case *ast.ParenExpr:
+		return constDuration(e.X)
+	case *ast.UnaryExpr:
+		x, ok := constDuration(e.X)
+		if !ok || (e.Op != token.SUB && e.Op != token.ADD) {
+			return nil, false
+		}
+		return constant.UnaryOp(e.Op, x, 0), true
+	case *ast.BinaryExpr:
+		x, okx := constDuration(e.X)
+		y, oky := constDuration(e.Y)
+		if !okx || !oky {
+			return nil, false
+		}
+		switch e.Op {
+		case token.ADD, token.SUB, token.MUL:
+			return constant.BinaryOp(x, e.Op, y), true
+		case token.QUO:
+			if constant.Sign(y) == 0 {
+				return nil, false
+			}
+			op := token.QUO
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				op = token.QUO_ASSIGN // integer division
+			}
+			return constant.BinaryOp(x, op, y), true
+		}
+	}
+	return nil, false
+}
+
+// tickerLoop returns the statements replacing the polling loop sleeping d,
+// using a ticker named name.
+func tickerLoop(loop *ast.ForStmt, d ast.Expr, name string) []ast.Stmt {
+	pos := loop.For
+	stampPositions(d, pos)
+	ident := func() *ast.Ident { return &ast.Ident{NamePos: pos, Name: name} }
+	newTicker := &ast.AssignStmt{
+		Lhs:    []ast.Expr{ident()},
+		TokPos: pos,
+		Tok:    token.DEFINE,
+		Rhs: []ast.Expr{&ast.CallExpr{
+			Fun:    &ast.SelectorExpr{X: &ast.Ident{NamePos: pos, Name: "time"}, Sel: &ast.Ident{NamePos: pos, Name: "NewTicker"}},
+			Lparen: pos,
+			Args:   []ast.Expr{d},
+			Rparen: pos,
+		}},
+	}
+	stop := &ast.DeferStmt{
+		Defer: pos,
+		Call: &ast.CallExpr{
+			Fun:    &ast.SelectorExpr{X: ident(), Sel: &ast.Ident{NamePos: pos, Name: "Stop"}},
+			Lparen: pos,
+			Rparen: pos,
+		},
+	}
+
+	at := loop.Body.List[1].Pos()
+	loop.Body.List[1] = &ast.ExprStmt{X: &ast.UnaryExpr{
+		OpPos: at,
+		Op:    token.ARROW,
+		X:     &ast.SelectorExpr{X: &ast.Ident{NamePos: at, Name: name}, Sel: &ast.Ident{NamePos: at, Name: "C"}},
+	}}
+	return []ast.Stmt{newTicker, stop, loop}
+}
@@ -0,0 +1,122 @@
+package astrewrite
+
+import "testing"
+
+func TestSleepToTicker(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "time"
+
+func wait(ready func() bool) {
+	for {
+		if ready() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	go func() {
+		for {
+			if ready() {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+}
+
+func busy(work func() bool, d time.Duration) {
+	for i := 0; i < 3; i++ {
+		time.Sleep(d)
+	}
+	for {
+		if !work() {
+			break
+		}
+		work()
+		time.Sleep(d)
+	}
+	for {
+		if work() {
+			break
+		}
+		time.Sleep(next())
+	}
+	for {
+		if work() {
+			break
+		}
+		time.Sleep(d)
+	}
+	for {
+		if work() {
+			break
+		}
+		time.Sleep(time.Second - 2*time.Second)
+	}
+}
+
+func next() time.Duration { return time.Second }
+`)
+
+	if n := SleepToTicker(file); n != 2 {
+		t.Errorf("rewrote %d loops, want 2", n)
+	}
+	checkSource(t, fset, file, `package p
+
+import "time"
+
+func wait(ready func() bool) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if ready() {
+			break
+		}
+		<-ticker.C
+	}
+	go func() {
+		ticker1 := time.NewTicker(time.Second)
+		defer ticker1.Stop()
+		for {
+			if ready() {
+				break
+			}
+			<-ticker1.C
+		}
+	}()
+}
+
+func busy(work func() bool, d time.Duration) {
+	for i := 0; i < 3; i++ {
+		time.Sleep(d)
+	}
+	for {
+		if !work() {
+			break
+		}
+		work()
+		time.Sleep(d)
+	}
+	for {
+		if work() {
+			break
+		}
+		time.Sleep(next())
+	}
+	for {
+		if work() {
+			break
+		}
+		time.Sleep(d)
+	}
+	for {
+		if work() {
+			break
+		}
+		time.Sleep(time.Second - 2*time.Second)
+	}
+}
+
+func next() time.Duration { return time.Second }
+`)
+}
@@ -0,0 +1,197 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// UseSlicesContains replaces the linear searches below node by calls of
+// slices.Contains. Two forms are recognized, setting a flag
+//
+//	found := false
+//	for _, x := range s {
+//		if x == v {
+//			found = true
+//			break
+//		}
+//	}
+//
+// which becomes found := slices.Contains(s, v), and returning a result
+//
+//	for _, x := range s {
+//		if x == v {
+//			return true
+//		}
+//	}
+//	return false
+//
+// which becomes return slices.Contains(s, v). The flag may also be reset
+// with = or declared with var right before the loop, and the comparison may
+// be written the other way around. Loops doing anything else are left
+// alone, as are searches for values with side effects, which the loop
+// evaluates once per element. Without type information the ranged
+// expression is taken to be a slice; callers ranging over strings, arrays
+// or maps have to filter those themselves.
+//
+// If node is a file, the import of slices is added to it if needed and an
+// existing alias of it is used; otherwise adding it is up to the caller. It
+// returns the number of replaced loops.
+func UseSlicesContains(node ast.Node) int {
+	file, _ := node.(*ast.File)
+	pkg, imported := importedAs(file, "slices")
+	if !imported && mentions(node, pkg) {
+		// the name is taken by something else
+		return 0
+	}
+
+	n := 0
+	forEachStmtList(node, func(list []ast.Stmt) []ast.Stmt {
+		var rewritten []ast.Stmt
+		for i := 0; i < len(list); i++ {
+			loop, ok := list[i].(*ast.RangeStmt)
+			if !ok {
+				rewritten = append(rewritten, list[i])
+				continue
+			}
+			v, result := linearSearch(loop)
+			switch {
+			case v == nil:
+			case result == nil && i+1 < len(list) && isReturnOf(list[i+1], "false"):
+				rewritten = append(rewritten, &ast.ReturnStmt{
+					Return:  loop.For,
+					Results: []ast.Expr{containsCall(pkg, loop, v, loop.For)},
+				})
+				i++
+				n++
+				continue
+			case result != nil && len(rewritten) > 0 && resetsFlag(rewritten[len(rewritten)-1], result.Name):
+				// replaces the reset, so it takes its place
+				reset := rewritten[len(rewritten)-1]
+				pos, tok := reset.Pos(), token.DEFINE
+				if as, ok := reset.(*ast.AssignStmt); ok {
+					tok = as.Tok
+				}
+				rewritten[len(rewritten)-1] = &ast.AssignStmt{
+					Lhs:    []ast.Expr{&ast.Ident{NamePos: pos, Name: result.Name}},
+					TokPos: pos,
+					Tok:    tok,
+					Rhs:    []ast.Expr{containsCall(pkg, loop, v, pos)},
+				}
+				n++
+				continue
+			}
+			rewritten = append(rewritten, loop)
+		}
+		return rewritten
+	})
+
+	if n > 0 && file != nil && !imported {
+		AddImport(file, "slices")
+	}
+	return n
+}
+
+// linearSearch returns the value loop searches for if it's a linear search,
+// along with the flag it sets, which is nil if it returns true instead.
+func linearSearch(loop *ast.RangeStmt) (v ast.Expr, flag *ast.Ident) {
+	if loop.Tok != token.DEFINE || len(loop.Body.List) != 1 {
+		return nil, nil
+	}
+	if key, ok := loop.Key.(*ast.Ident); loop.Key != nil && (!ok || key.Name != "_") {
+		return nil, nil
+	}
+	x, ok := loop.Value.(*ast.Ident)
+	if !ok || x.Name == "_" {
+		return nil, nil
+	}
+	ifs, ok := loop.Body.List[0].(*ast.IfStmt)
+	if !ok || ifs.Init != nil || ifs.Else != nil {
+		return nil, nil
+	}
+	cond, ok := ifs.Cond.(*ast.BinaryExpr)
+	if !ok || cond.Op != token.EQL {
+		return nil, nil
+	}
+	switch {
+	case isIdent(cond.X, x.Name):
+		v = cond.Y
+	case isIdent(cond.Y, x.Name):
+		v = cond.X
+	default:
+		return nil, nil
+	}
+	if mentions(v, x.Name) || HasSideEffects(v) {
+		return nil, nil
+	}
+
+	body := ifs.Body.List
+	switch len(body) {
+	case 1:
+		if !isReturnOf(body[0], "true") {
+			return nil, nil
+		}
+		return v, nil
+	case 2:
+		as, ok := body[0].(*ast.AssignStmt)
+		if !ok || as.Tok != token.ASSIGN || len(as.Lhs) != 1 || len(as.Rhs) != 1 || !isIdent(as.Rhs[0], "true") {
+			return nil, nil
+		}
+		flag, ok := as.Lhs[0].(*ast.Ident)
+		if !ok || flag.Name == "_" || mentions(loop.X, flag.Name) || mentions(v, flag.Name) {
+			return nil, nil
+		}
+		if br, ok := body[1].(*ast.BranchStmt); !ok || br.Tok != token.BREAK || br.Label != nil {
+			return nil, nil
+		}
+		return v, flag
+	}
+	return nil, nil
+}
+
+// resetsFlag reports whether s sets the flag named name to false, or
+// declares it without a value.
+func resetsFlag(s ast.Stmt, name string) bool {
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		return len(s.Lhs) == 1 && len(s.Rhs) == 1 && isIdent(s.Lhs[0], name) && isIdent(s.Rhs[0], "false")
+	case *ast.DeclStmt:
+		gd, ok := s.Decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR || len(gd.Specs) != 1 {
+			return false
+		}
+		vs := gd.Specs[0].(*ast.ValueSpec)
+		if len(vs.Names) != 1 || vs.Names[0].Name != name {
+			return false
+		}
+		if len(vs.Values) == 0 {
+			return isIdent(vs.Type, "bool")
+		}
+		return vs.Type == nil && isIdent(vs.Values[0], "false")
+	}
+	return false
+}
+
+// isReturnOf reports whether s returns the single identifier name.
+func isReturnOf(s ast.Stmt, name string) bool {
+	ret, ok := s.(*ast.ReturnStmt)
+	return ok && len(ret.Results) == 1 && isIdent(ret.Results[0], name)
+}
+
+// isIdent reports whether e is the identifier name.
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// containsCall returns the call of pkg.Contains replacing loop, which
+// searches for v, placed at pos.
+func containsCall(pkg string, loop *ast.RangeStmt, v ast.Expr, pos token.Pos) *ast.CallExpr {
+	stampPositions(loop.X, pos)
+	stampPositions(v, pos)
+	return &ast.CallExpr{
+		Fun:    &ast.SelectorExpr{X: &ast.Ident{NamePos: pos, Name: pkg}, Sel: &ast.Ident{NamePos: pos, Name: "Contains"}},
+		Lparen: pos,
+		Args:   []ast.Expr{loop.X, v},
+		Rparen: pos,
+	}
+}
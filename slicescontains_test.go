@@ -0,0 +1,96 @@
+package astrewrite
+
+import "testing"
+
+func TestUseSlicesContains(t *testing.T) {
+	fset, file := parse(t, `package p
+
+import "fmt"
+
+func has(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func check(ids []int, id int) {
+	found := false
+	for _, x := range ids {
+		if id == x {
+			found = true
+			break
+		}
+	}
+	var again bool
+	for _, x := range ids {
+		if x == id+1 {
+			again = true
+			break
+		}
+	}
+	fmt.Println(found, again)
+}
+
+func noisy(ids []int, id int) bool {
+	found := false
+	for _, x := range ids {
+		if x == id {
+			fmt.Println("found", x)
+			found = true
+			break
+		}
+	}
+	for _, x := range ids {
+		if x == next() {
+			return true
+		}
+	}
+	return found
+}
+`)
+
+	if n := UseSlicesContains(file); n != 3 {
+		t.Errorf("replaced %d loops, want 3", n)
+	}
+	// the replaced loops leave blank lines behind
+	checkSource(t, fset, file, `package p
+
+import (
+	"fmt"
+	"slices"
+)
+
+func has(names []string, name string) bool {
+	return slices.Contains(names, name)
+
+}
+
+func check(ids []int, id int) {
+	found := slices.Contains(ids, id)
+
+	again := slices.Contains(ids, id+1)
+
+	fmt.Println(found, again)
+}
+
+func noisy(ids []int, id int) bool {
+	found := false
+	for _, x := range ids {
+		if x == id {
+			fmt.Println("found", x)
+			found = true
+			break
+		}
+	}
+	for _, x := range ids {
+		if x == next() {
+			return true
+		}
+	}
+	return found
+}
+`)
+}
@@ -0,0 +1,163 @@
+package astrewrite
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// SnippetKind tells what kind of source a Snippet holds.
+type SnippetKind int
+
+const (
+	// FileSnippet is a complete source file.
+	FileSnippet SnippetKind = iota
+	// DeclSnippet is a list of declarations.
+	DeclSnippet
+	// StmtSnippet is a list of statements.
+	StmtSnippet
+	// ExprSnippet is an expression.
+	ExprSnippet
+)
+
+// Snippet is a fragment of Go source parsed into an AST.
+type Snippet struct {
+	Kind SnippetKind
+	Fset *token.FileSet
+
+	// File is the parsed file. All fragments but files are wrapped in a
+	// file with the package clause "package p"; statements are wrapped in
+	// the body of func _() and expressions are the value of var _.
+	File *ast.File
+
+	// Node is the root of the fragment: the file for files and
+	// declarations, the body of the wrapper function for statements and
+	// the expression for expressions. Rewriting the fragment means
+	// rewriting Node and storing the result back in Node.
+	Node ast.Node
+}
+
+// ParseSnippet parses src as a source file if it starts with a package
+// clause, and otherwise as the first of an expression, a list of
+// declarations or a list of statements that it's valid as.
+func ParseSnippet(src string) (*Snippet, error) {
+	if strings.HasPrefix(stripComments(src), "package") {
+		return ParseSnippetKind(src, FileSnippet)
+	}
+	if _, err := parser.ParseExpr(src); err == nil {
+		return ParseSnippetKind(src, ExprSnippet)
+	}
+	if s, err := ParseSnippetKind(src, DeclSnippet); err == nil {
+		return s, nil
+	}
+	s, err := ParseSnippetKind(src, StmtSnippet)
+	if err != nil {
+		return nil, fmt.Errorf("astrewrite: snippet is neither a file, an expression, declarations nor statements: %v", err)
+	}
+	return s, nil
+}
+
+// ParseSnippetKind parses src as a snippet of the given kind.
+func ParseSnippetKind(src string, kind SnippetKind) (*Snippet, error) {
+	wrapped := src
+	switch kind {
+	case DeclSnippet:
+		wrapped = "package p\n\n" + src + "\n"
+	case StmtSnippet:
+		wrapped = "package p\n\nfunc _() {\n" + src + "\n}\n"
+	case ExprSnippet:
+		wrapped = "package p\n\nvar _ = " + src + "\n"
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "snippet.go", wrapped, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snippet{Kind: kind, Fset: fset, File: file, Node: file}
+	switch kind {
+	case StmtSnippet:
+		s.Node = file.Decls[0].(*ast.FuncDecl).Body
+	case ExprSnippet:
+		// var _ = a, b parses, but isn't an expression
+		spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+		if len(file.Decls) != 1 || len(spec.Values) != 1 {
+			return nil, fmt.Errorf("astrewrite: snippet is not an expression")
+		}
+		s.Node = spec.Values[0]
+	}
+	return s, nil
+}
+
+// stripComments returns src without leading space and comments, which may
+// precede the package clause of a file.
+func stripComments(src string) string {
+	for {
+		src = strings.TrimSpace(src)
+		switch {
+		case strings.HasPrefix(src, "//"):
+			if i := strings.IndexByte(src, '\n'); i >= 0 {
+				src = src[i+1:]
+				continue
+			}
+			return ""
+		case strings.HasPrefix(src, "/*"):
+			if i := strings.Index(src, "*/"); i >= 0 {
+				src = src[i+2:]
+				continue
+			}
+			return ""
+		}
+		return src
+	}
+}
+
+// Source returns the formatted source of the fragment as rewritten, without
+// the wrappers added by ParseSnippet. A removed Node results in an empty
+// string.
+func (s *Snippet) Source() (string, error) {
+	if isNil(s.Node) {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	switch s.Kind {
+	case FileSnippet:
+		if err := format.Node(&buf, s.Fset, s.Node); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+
+	case ExprSnippet:
+		if err := format.Node(&buf, s.Fset, s.Node); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+
+	case DeclSnippet:
+		if err := format.Node(&buf, s.Fset, s.Node); err != nil {
+			return "", err
+		}
+		out := buf.String()
+		out = strings.TrimPrefix(out[strings.IndexByte(out, '\n')+1:], "\n")
+		return out, nil
+	}
+
+	fd := s.File.Decls[0].(*ast.FuncDecl)
+	fd.Body = s.Node.(*ast.BlockStmt)
+	if err := format.Node(&buf, s.Fset, s.File); err != nil {
+		return "", err
+	}
+	out := buf.String()
+	out = out[strings.Index(out, "func _() {\n")+len("func _() {\n"):]
+	out = strings.TrimSuffix(out, "}\n")
+	lines := strings.SplitAfter(out, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, "\t")
+	}
+	return strings.Join(lines, ""), nil
+}
@@ -0,0 +1,114 @@
+package astrewrite
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// StringValue returns the value of the string literal lit.
+func StringValue(lit *ast.BasicLit) (string, error) {
+	if lit.Kind != token.STRING {
+		return "", errors.New("astrewrite: not a string literal: " + lit.Value)
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", errors.New("astrewrite: invalid string literal " + lit.Value + ": " + err.Error())
+	}
+	return s, nil
+}
+
+// SetStringValue turns lit into a string literal with the value s. The
+// literal is raw if it was raw before or preferRaw is set, and s can be
+// written as a raw string, which rules out backquotes and carriage returns.
+// Otherwise it's an interpreted string literal.
+func SetStringValue(lit *ast.BasicLit, s string, preferRaw bool) {
+	wasRaw := lit.Kind == token.STRING && strings.HasPrefix(lit.Value, "`")
+	lit.Kind = token.STRING
+	if (wasRaw || preferRaw) && canRaw(s) {
+		lit.Value = "`" + s + "`"
+		return
+	}
+	lit.Value = strconv.Quote(s)
+}
+
+// canRaw reports whether s can be written as a raw string literal. Unlike
+// strconv.CanBackquote it allows newlines.
+func canRaw(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r == '`' || r == '\r' || r == '\uFEFF' || (r < ' ' && r != '\t' && r != '\n') || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// StringOption configures RewriteStrings.
+type StringOption func(*stringConfig)
+
+type stringConfig struct {
+	imports, tags bool
+}
+
+// IncludeImportPaths makes RewriteStrings rewrite the paths of imports.
+func IncludeImportPaths() StringOption {
+	return func(c *stringConfig) {
+		c.imports = true
+	}
+}
+
+// IncludeStructTags makes RewriteStrings rewrite struct tags.
+func IncludeStructTags() StringOption {
+	return func(c *stringConfig) {
+		c.tags = true
+	}
+}
+
+// RewriteStrings calls fn with the value of each string literal below root
+// and sets the value fn returns if it returns true, keeping the quoting
+// where possible as with SetStringValue. Import paths and struct tags are
+// left alone unless included by options. It returns the number of changed
+// literals.
+func RewriteStrings(root ast.Node, fn func(value string, lit *ast.BasicLit) (string, bool), opts ...StringOption) int {
+	var c stringConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	excluded := make(map[*ast.BasicLit]bool)
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ImportSpec:
+			excluded[n.Path] = !c.imports
+		case *ast.Field:
+			if n.Tag != nil {
+				excluded[n.Tag] = !c.tags
+			}
+		}
+		return true
+	})
+
+	count := 0
+	Walk(root, func(n ast.Node) (ast.Node, bool) {
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING || excluded[lit] {
+			return n, true
+		}
+		value, err := StringValue(lit)
+		if err != nil {
+			return n, true
+		}
+		if s, ok := fn(value, lit); ok {
+			SetStringValue(lit, s, false)
+			count++
+		}
+		return n, true
+	})
+	return count
+}
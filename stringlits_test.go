@@ -0,0 +1,85 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestSetStringValue(t *testing.T) {
+	tests := []struct {
+		old       string
+		value     string
+		preferRaw bool
+		want      string
+	}{
+		{"`a`", "b\nc", false, "`b\nc`"},
+		// raw strings can't hold backquotes
+		{"`a`", "it's \"`x`\"", false, "\"it's \\\"`x`\\\"\""},
+		{"`a`", "a\r\n", false, `"a\r\n"`},
+		{`"a"`, "b\nc", false, `"b\nc"`},
+		{`"a"`, `C:\dir`, true, "`C:\\dir`"},
+		{`"a"`, "\x00", true, `"\x00"`},
+	}
+	for _, tt := range tests {
+		lit := &ast.BasicLit{Kind: token.STRING, Value: tt.old}
+		SetStringValue(lit, tt.value, tt.preferRaw)
+		if lit.Value != tt.want {
+			t.Errorf("%s set to %q: got %s, want %s", tt.old, tt.value, lit.Value, tt.want)
+		}
+		if got, err := StringValue(lit); err != nil || got != tt.value {
+			t.Errorf("%s: got value %q, %v, want %q", lit.Value, got, err, tt.value)
+		}
+	}
+
+	if _, err := StringValue(&ast.BasicLit{Kind: token.INT, Value: "1"}); err == nil {
+		t.Error("got the string value of an integer literal")
+	}
+}
+
+func TestRewriteStrings(t *testing.T) {
+	src := `package p
+
+import "example.com/old/errs"
+
+type T struct {
+	URL string ` + "`json:\"url\"`" + `
+}
+
+var (
+	base = "http://example.com/api"
+	raw  = ` + "`http://example.com/\ndocs`" + `
+	n   = 'x'
+	err = errs.New("failed")
+)
+`
+	rewrite := func(value string, lit *ast.BasicLit) (string, bool) {
+		if !strings.Contains(value, "example.com") && !strings.Contains(value, "url") {
+			return "", false
+		}
+		value = strings.Replace(value, "example.com", "example.org", 1)
+		return strings.Replace(value, "url", "link", 1), true
+	}
+
+	fset, file := parse(t, src)
+	if n := RewriteStrings(file, rewrite); n != 2 {
+		t.Errorf("rewrote %d strings, want 2", n)
+	}
+	checkSource(t, fset, file, strings.NewReplacer(
+		"http://example.com/api", "http://example.org/api",
+		"http://example.com/\n", "http://example.org/\n",
+	).Replace(src))
+
+	fset, file = parse(t, src)
+	if n := RewriteStrings(file, rewrite, IncludeImportPaths(), IncludeStructTags()); n != 4 {
+		t.Errorf("rewrote %d strings, want 4", n)
+	}
+	checkSource(t, fset, file, strings.NewReplacer(
+		"example.com", "example.org",
+		`json:"url"`, `json:"link"`,
+	).Replace(src))
+	if path := importPath(file.Imports[0]); path != "example.org/old/errs" {
+		t.Errorf("got import path %s", path)
+	}
+}
@@ -0,0 +1,163 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// UseStringsBuilder rewrites the loops in fn building a string by
+// concatenation to use a strings.Builder, like
+//
+//	s := ""
+//	for _, w := range words {
+//		s += w
+//	}
+//
+// into
+//
+//	var sBuilder strings.Builder
+//	for _, w := range words {
+//		sBuilder.WriteString(w)
+//	}
+//	s := sBuilder.String()
+//
+// The string must be declared empty right before the loop, and the loop
+// must only append to it with +=, anywhere in its body; loops reading it,
+// taking its address, using it in a function literal or containing a goto
+// are left alone, as are strings assigned rather than declared before the
+// loop, which may be read elsewhere while the loop runs. Adding the import
+// of strings is up to the caller. It returns the number of rewritten loops.
+func UseStringsBuilder(fn *ast.FuncDecl) int {
+	if fn.Body == nil || shadows(fn, "strings") {
+		return 0
+	}
+	names := NewNameGen(fn)
+	n := 0
+	forEachStmtList(fn.Body, func(list []ast.Stmt) []ast.Stmt {
+		var rewritten []ast.Stmt
+		for _, s := range list {
+			switch s.(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+			default:
+				rewritten = append(rewritten, s)
+				continue
+			}
+			if len(rewritten) == 0 {
+				rewritten = append(rewritten, s)
+				continue
+			}
+			str := emptyStringDecl(rewritten[len(rewritten)-1])
+			if str == nil || !onlyConcatenates(s, str.Name) {
+				rewritten = append(rewritten, s)
+				continue
+			}
+
+			decl := rewritten[len(rewritten)-1]
+			pos := decl.Pos()
+			builder := names.Name(str.Name + "Builder")
+			rewritten[len(rewritten)-1] = &ast.DeclStmt{Decl: &ast.GenDecl{
+				TokPos: pos,
+				Tok:    token.VAR,
+				Specs: []ast.Spec{&ast.ValueSpec{
+					Names: []*ast.Ident{{NamePos: pos, Name: builder}},
+					Type:  qualified("strings", "Builder", pos),
+				}},
+			}}
+			Walk(s, func(n ast.Node) (ast.Node, bool) {
+				as, ok := n.(*ast.AssignStmt)
+				if !ok || as.Tok != token.ADD_ASSIGN || !isIdent(as.Lhs[0], str.Name) {
+					return n, true
+				}
+				pos := as.Pos()
+				return &ast.ExprStmt{X: &ast.CallExpr{
+					Fun:    &ast.SelectorExpr{X: &ast.Ident{NamePos: pos, Name: builder}, Sel: &ast.Ident{NamePos: pos, Name: "WriteString"}},
+					Lparen: pos,
+					Args:   as.Rhs,
+					Rparen: as.End(),
+				}}, false
+			})
+
+			end := s.End()
+			rewritten = append(rewritten, s, &ast.AssignStmt{
+				Lhs:    []ast.Expr{&ast.Ident{NamePos: end, Name: str.Name}},
+				TokPos: end,
+				Tok:    token.DEFINE,
+				Rhs: []ast.Expr{&ast.CallExpr{
+					Fun:    &ast.SelectorExpr{X: &ast.Ident{NamePos: end, Name: builder}, Sel: &ast.Ident{NamePos: end, Name: "String"}},
+					Lparen: end,
+					Rparen: end,
+				}},
+			})
+			n++
+		}
+		return rewritten
+	})
+	return n
+}
+
+// emptyStringDecl returns the variable s declares if it declares a single
+// empty string, with s := "", var s string or var s = "".
+func emptyStringDecl(s ast.Stmt) *ast.Ident {
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		if s.Tok == token.DEFINE && len(s.Lhs) == 1 && len(s.Rhs) == 1 && emptyString(s.Rhs[0]) {
+			id, _ := s.Lhs[0].(*ast.Ident)
+			return id
+		}
+	case *ast.DeclStmt:
+		gd, ok := s.Decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR || len(gd.Specs) != 1 {
+			return nil
+		}
+		vs := gd.Specs[0].(*ast.ValueSpec)
+		if len(vs.Names) != 1 {
+			return nil
+		}
+		switch {
+		case len(vs.Values) == 0 && isIdent(vs.Type, "string"),
+			len(vs.Values) == 1 && vs.Type == nil && emptyString(vs.Values[0]):
+			return vs.Names[0]
+		}
+	}
+	return nil
+}
+
+// emptyString reports whether e is an empty string literal.
+func emptyString(e ast.Expr) bool {
+	lit, ok := e.(*ast.BasicLit)
+	return ok && lit.Kind == token.STRING && (lit.Value == `""` || lit.Value == "``")
+}
+
+// onlyConcatenates reports whether name appears in loop only on the left of
+// assignments of the form name += x, outside of function literals, and loop
+// contains no goto, which could jump past the end of the loop.
+func onlyConcatenates(loop ast.Stmt, name string) bool {
+	appends := false
+	ok := true
+	ast.Inspect(loop, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BranchStmt:
+			if n.Tok == token.GOTO {
+				ok = false
+			}
+		case *ast.FuncLit:
+			if mentions(n, name) {
+				ok = false
+			}
+		case *ast.AssignStmt:
+			if n.Tok == token.ADD_ASSIGN && isIdent(n.Lhs[0], name) {
+				if mentions(n.Rhs[0], name) {
+					ok = false
+				}
+				appends = true
+				return false
+			}
+		case *ast.Ident:
+			if n.Name == name {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok && appends
+}
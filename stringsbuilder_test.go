@@ -0,0 +1,101 @@
+package astrewrite
+
+import "testing"
+
+func TestUseStringsBuilder(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func join(words []string, sep string) string {
+	s := ""
+	for i, w := range words {
+		if i > 0 {
+			s += sep
+		}
+		s += w
+	}
+	return s
+}
+
+func lines(n int) string {
+	var out string
+	for i := 0; i < n; i++ {
+		out += "line\n"
+	}
+	return out
+}
+`)
+	n := UseStringsBuilder(findFunc(file, "join")) + UseStringsBuilder(findFunc(file, "lines"))
+	if n != 2 {
+		t.Errorf("rewrote %d loops, want 2", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func join(words []string, sep string) string {
+	var sBuilder strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			sBuilder.WriteString(sep)
+		}
+		sBuilder.WriteString(w)
+	}
+	s := sBuilder.String()
+	return s
+}
+
+func lines(n int) string {
+	var outBuilder strings.Builder
+	for i := 0; i < n; i++ {
+		outBuilder.WriteString("line\n")
+	}
+	out := outBuilder.String()
+	return out
+}
+`)
+}
+
+func TestUseStringsBuilderReads(t *testing.T) {
+	src := `package p
+
+func reads(words []string) string {
+	s := ""
+	for _, w := range words {
+		if len(s) > 80 {
+			break
+		}
+		s += w
+	}
+	return s
+}
+
+func self(words []string) string {
+	s := ""
+	for _, w := range words {
+		s += w + s
+	}
+	return s
+}
+
+func closure(words []string) string {
+	s := ""
+	for _, w := range words {
+		defer func() { s += w }()
+	}
+	return s
+}
+
+func assigned(words []string) (s string) {
+	s = ""
+	for _, w := range words {
+		s += w
+	}
+	return
+}
+`
+	fset, file := parse(t, src)
+	for _, name := range []string{"reads", "self", "closure", "assigned"} {
+		if n := UseStringsBuilder(findFunc(file, name)); n != 0 {
+			t.Errorf("%s: rewrote %d loops, want 0", name, n)
+		}
+	}
+	checkSource(t, fset, file, src)
+}
@@ -0,0 +1,625 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// DebugConfig configures StripDebug.
+type DebugConfig struct {
+	// Guards are the names of the package-level boolean constants
+	// guarding debug code, like debug in if debug { ... }.
+	Guards []string
+
+	// Funcs are the names of the functions whose calls are debug code,
+	// written like they are called, e.g. "debugf" or "log.Printf".
+	Funcs []string
+}
+
+// DebugReport describes what StripDebug did.
+type DebugReport struct {
+	// Branches is the number of if statements and else if branches
+	// decided by a guard.
+	Branches int
+
+	// Calls is the number of statements removed for calling one of the
+	// debug functions.
+	Calls int
+
+	// Locals holds the names of the local variables that were only used
+	// by debug code and have been removed.
+	Locals []string
+
+	// Imports holds the paths of the imports that were only used by debug
+	// code and have been removed.
+	Imports []string
+
+	// Guards holds the names of the guard constants that are no longer
+	// referenced and have been removed.
+	Guards []string
+}
+
+// StripDebug removes the debug code of a package given by its files, which
+// must have been parsed with object resolution.
+//
+// The guard constants named by cfg are set to false wherever they are
+// declared in files, and the conditions of if statements are simplified
+// accordingly, dropping the branches that can't run anymore and keeping the
+// body of those that always run. Statements calling one of the debug
+// functions are removed, along with their arguments. Local variables that
+// end up unused are removed if their initial values have no side effects and
+// assigned to _ otherwise, imports that end up unused are removed, and so
+// are guards no longer referenced, unless they're declared along with
+// constants using iota, whose values would change; see MaterializeIota. A
+// variable that is assigned to but not read otherwise counts as used.
+func StripDebug(files []*ast.File, cfg DebugConfig) DebugReport {
+	s := &debugStripper{
+		funcs:  make(map[string]bool),
+		guards: make(map[string]*ast.ValueSpec),
+	}
+	for _, name := range cfg.Funcs {
+		s.funcs[name] = true
+	}
+	for _, f := range files {
+		s.setGuards(f, cfg.Guards)
+	}
+
+	used := make([]map[string]bool, len(files))
+	for i, f := range files {
+		used[i] = usedQualifiers(f)
+		s.file = f
+		s.pruneBranches(f)
+		s.removeCalls(f)
+		s.removeUnusedLocals(f)
+	}
+	for i, f := range files {
+		s.file = f
+		s.removeUnusedImports(f, used[i])
+	}
+	s.removeUnusedGuards(files)
+	for _, f := range files {
+		s.file = f
+		s.closeGaps(f)
+	}
+	return s.report
+}
+
+type debugStripper struct {
+	funcs  map[string]bool
+	guards map[string]*ast.ValueSpec
+	report DebugReport
+
+	// file is the file being rewritten
+	file *ast.File
+
+	// removed holds the ranges of the removed code, see closeGaps
+	removed []span
+}
+
+// setGuards sets the guards among names declared in f to false.
+func (s *debugStripper) setGuards(f *ast.File, names []string) {
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, id := range vs.Names {
+				if !contains(names, id.Name) || i >= len(vs.Values) {
+					continue
+				}
+				vs.Values[i] = &ast.Ident{NamePos: vs.Values[i].Pos(), Name: "false"}
+				s.guards[id.Name] = vs
+			}
+		}
+	}
+}
+
+// isGuard reports whether id refers to a guard.
+func (s *debugStripper) isGuard(id *ast.Ident) bool {
+	spec, ok := s.guards[id.Name]
+	return ok && (id.Obj == nil || id.Obj.Decl == spec)
+}
+
+// boolValue returns the value of e if it's true, false or a guard.
+func (s *debugStripper) boolValue(e ast.Expr) (value, ok bool) {
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return false, false
+	}
+	if s.isGuard(id) {
+		return false, true
+	}
+	if id.Obj == nil && (id.Name == "true" || id.Name == "false") {
+		return id.Name == "true", true
+	}
+	return false, false
+}
+
+// fold simplifies the boolean expression e using the values of the guards
+// and the literals true and false in it. Operands with side effects are
+// kept.
+func (s *debugStripper) fold(e ast.Expr) ast.Expr {
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		x.X = s.fold(x.X)
+		if _, ok := s.boolValue(x.X); ok {
+			return x.X
+		}
+	case *ast.UnaryExpr:
+		if x.Op != token.NOT {
+			break
+		}
+		x.X = s.fold(x.X)
+		if v, ok := s.boolValue(x.X); ok {
+			return &ast.Ident{NamePos: x.OpPos, Name: strconv.FormatBool(!v)}
+		}
+	case *ast.BinaryExpr:
+		if x.Op != token.LAND && x.Op != token.LOR {
+			break
+		}
+		x.X, x.Y = s.fold(x.X), s.fold(x.Y)
+		// decisive is the value deciding the result on its own
+		decisive := x.Op == token.LOR
+		if v, ok := s.boolValue(x.X); ok {
+			if v == decisive {
+				return x.X
+			}
+			return x.Y
+		}
+		if v, ok := s.boolValue(x.Y); ok {
+			if v != decisive {
+				return x.X
+			}
+			if !HasSideEffects(x.X) {
+				return x.Y
+			}
+		}
+	}
+	return e
+}
+
+// pruneBranches decides the if statements below root whose conditions fold
+// to a constant.
+func (s *debugStripper) pruneBranches(root ast.Node) {
+	for changed := true; changed; {
+		changed = false
+		Walk(root, func(n ast.Node) (ast.Node, bool) {
+			switch n := n.(type) {
+			case *ast.IfStmt:
+				n.Cond = s.fold(n.Cond)
+				elif, ok := n.Else.(*ast.IfStmt)
+				if !ok || elif.Init != nil {
+					break
+				}
+				elif.Cond = s.fold(elif.Cond)
+				if v, ok := s.boolValue(elif.Cond); ok {
+					s.report.Branches++
+					changed = true
+					if v {
+						s.drop(elif.Body.End(), elif.End())
+						n.Else = elif.Body
+					} else {
+						s.drop(elif.Pos(), elif.Body.End())
+						n.Else = elif.Else
+					}
+				}
+			case *ast.ForStmt:
+				if n.Cond != nil {
+					n.Cond = s.fold(n.Cond)
+				}
+			case *ast.BlockStmt:
+				n.List = s.pruneList(n.List, &changed)
+			case *ast.CaseClause:
+				n.Body = s.pruneList(n.Body, &changed)
+			case *ast.CommClause:
+				n.Body = s.pruneList(n.Body, &changed)
+			}
+			return n, true
+		})
+	}
+}
+
+// pruneList replaces the if statements in list whose conditions fold to a
+// constant by the branch that runs, if any.
+func (s *debugStripper) pruneList(list []ast.Stmt, changed *bool) []ast.Stmt {
+	var out []ast.Stmt
+	for _, stmt := range list {
+		ifs, ok := stmt.(*ast.IfStmt)
+		if !ok {
+			out = append(out, stmt)
+			continue
+		}
+		ifs.Cond = s.fold(ifs.Cond)
+		v, ok := s.boolValue(ifs.Cond)
+		if !ok {
+			out = append(out, stmt)
+			continue
+		}
+		s.report.Branches++
+		*changed = true
+
+		var kept ast.Stmt
+		switch {
+		case v:
+			kept = ifs.Body
+			s.vacate(ifs.Pos(), ifs.Body.Lbrace)
+			s.drop(ifs.Body.End(), ifs.End())
+		case ifs.Else != nil:
+			kept = ifs.Else
+			s.drop(ifs.Pos(), ifs.Else.Pos())
+		default:
+			s.drop(ifs.Pos(), ifs.End())
+		}
+
+		switch b, isBlock := kept.(*ast.BlockStmt); {
+		case ifs.Init != nil:
+			// keep the scope of the init statement
+			block := &ast.BlockStmt{Lbrace: ifs.If, List: []ast.Stmt{ifs.Init}, Rbrace: ifs.End() - 1}
+			if kept != nil {
+				block.List = append(block.List, kept)
+			}
+			out = append(out, block)
+		case isBlock && !declares(b.List):
+			s.vacate(b.Lbrace, b.Lbrace+1)
+			s.vacate(b.Rbrace, b.End())
+			out = append(out, b.List...)
+		case kept != nil:
+			out = append(out, kept)
+		}
+	}
+	return out
+}
+
+// declares reports whether stmts declare names, which would clash with the
+// enclosing scope if the statements were moved there.
+func declares(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.DeclStmt, *ast.LabeledStmt:
+			return true
+		case *ast.AssignStmt:
+			if stmt.Tok == token.DEFINE {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeCalls removes the statements calling a debug function, relying on
+// the walker to remove the statement of a removed call.
+func (s *debugStripper) removeCalls(f *ast.File) {
+	calls := make(map[*ast.CallExpr]bool)
+	Walk(f, func(n ast.Node) (ast.Node, bool) {
+		var call *ast.CallExpr
+		switch n := n.(type) {
+		case *ast.ExprStmt:
+			call, _ = n.X.(*ast.CallExpr)
+		case *ast.GoStmt:
+			call = n.Call
+		case *ast.DeferStmt:
+			call = n.Call
+		case *ast.CallExpr:
+			if calls[n] {
+				return Remove, false
+			}
+		}
+		if call != nil && s.funcs[calleeName(call)] {
+			s.report.Calls++
+			s.drop(n.Pos(), n.End())
+			calls[call] = true
+		}
+		return n, true
+	})
+}
+
+// removeUnusedLocals removes the local variables of f that aren't
+// referenced, until there are none left.
+func (s *debugStripper) removeUnusedLocals(f *ast.File) {
+	for changed := true; changed; {
+		changed = false
+		refs := make(map[*ast.Object]int)
+		ast.Inspect(f, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Obj != nil && id.Obj.Kind == ast.Var {
+				refs[id.Obj]++
+			}
+			return true
+		})
+		// blank replaces the unused variables declared by decl in names
+		// with _ and reports whether any are left.
+		blank := func(names []*ast.Ident, decl interface{}) (removed, left bool) {
+			for i, id := range names {
+				if id.Obj == nil || id.Obj.Decl != decl {
+					continue
+				}
+				// the declaration is the only reference
+				if refs[id.Obj] == 1 {
+					s.report.Locals = append(s.report.Locals, id.Name)
+					names[i] = &ast.Ident{NamePos: id.NamePos, Name: "_"}
+					removed = true
+				} else {
+					left = true
+				}
+			}
+			return removed, left
+		}
+
+		Walk(f, func(n ast.Node) (ast.Node, bool) {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if n.Tok != token.DEFINE {
+					break
+				}
+				var names []*ast.Ident
+				for _, l := range n.Lhs {
+					id, _ := l.(*ast.Ident)
+					names = append(names, id)
+				}
+				removed, left := blank(names, n)
+				if !removed {
+					break
+				}
+				changed = true
+				for i, id := range names {
+					n.Lhs[i] = id
+				}
+				if !left {
+					if !anySideEffects(n.Rhs) {
+						s.drop(n.Pos(), n.End())
+						return Remove, false
+					}
+					n.Tok = token.ASSIGN
+				}
+			case *ast.DeclStmt:
+				gd, ok := n.Decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.VAR {
+					break
+				}
+				specs := gd.Specs[:0]
+				for _, spec := range gd.Specs {
+					vs := spec.(*ast.ValueSpec)
+					removed, left := blank(vs.Names, vs)
+					if removed {
+						changed = true
+					}
+					if removed && !left && !anySideEffects(vs.Values) {
+						continue
+					}
+					specs = append(specs, vs)
+				}
+				if gd.Specs = specs; len(specs) == 0 {
+					s.drop(n.Pos(), n.End())
+					return Remove, false
+				}
+			}
+			return n, true
+		})
+	}
+}
+
+// anySideEffects reports whether any of exprs has side effects.
+func anySideEffects(exprs []ast.Expr) bool {
+	for _, e := range exprs {
+		if HasSideEffects(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeUnusedImports removes the imports of f whose names were among the
+// qualifiers used before but aren't anymore. Comparing to the qualifiers
+// used before guards against imports whose name was guessed wrong.
+func (s *debugStripper) removeUnusedImports(f *ast.File, usedBefore map[string]bool) {
+	used := usedQualifiers(f)
+	unused := func(spec *ast.ImportSpec) bool {
+		name := importName(spec)
+		return usedBefore[name] && !used[name]
+	}
+
+	decls := f.Decls[:0]
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			decls = append(decls, d)
+			continue
+		}
+		pos, end := gd.Pos(), gd.End()
+		specs := gd.Specs[:0]
+		for _, spec := range gd.Specs {
+			if imp := spec.(*ast.ImportSpec); unused(imp) {
+				s.report.Imports = append(s.report.Imports, importPath(imp))
+				s.drop(imp.Pos(), imp.End())
+				s.dropGroups(imp.Doc, imp.Comment)
+				continue
+			}
+			specs = append(specs, spec)
+		}
+		if gd.Specs = specs; len(specs) == 1 && gd.Lparen.IsValid() && !hasComments(f, gd) {
+			// a single import needs no parentheses
+			gd.Lparen, gd.Rparen = token.NoPos, token.NoPos
+		}
+		if len(specs) > 0 {
+			decls = append(decls, gd)
+		} else {
+			s.drop(pos, end)
+			s.dropGroups(gd.Doc)
+		}
+	}
+	f.Decls = decls
+
+	imports := f.Imports[:0]
+	for _, imp := range f.Imports {
+		if !unused(imp) {
+			imports = append(imports, imp)
+		}
+	}
+	f.Imports = imports
+}
+
+// removeUnusedGuards removes the declarations of guards that aren't
+// referenced in files anymore.
+func (s *debugStripper) removeUnusedGuards(files []*ast.File) {
+	refs := make(map[string]bool)
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				ast.Inspect(n.X, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok && s.isGuard(id) {
+						refs[id.Name] = true
+					}
+					return true
+				})
+				return false
+			case *ast.ValueSpec:
+				// skip the names of the declaration
+				for _, v := range n.Values {
+					ast.Inspect(v, func(n ast.Node) bool {
+						if id, ok := n.(*ast.Ident); ok && s.isGuard(id) {
+							refs[id.Name] = true
+						}
+						return true
+					})
+				}
+				return false
+			case *ast.Ident:
+				if s.isGuard(n) {
+					refs[n.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	for _, f := range files {
+		s.file = f
+		decls := f.Decls[:0]
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST || UsesIota(gd) {
+				decls = append(decls, d)
+				continue
+			}
+			pos, end := gd.Pos(), gd.End()
+			specs := gd.Specs[:0]
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Names) == 1 && s.guards[vs.Names[0].Name] == vs && !refs[vs.Names[0].Name] {
+					s.report.Guards = append(s.report.Guards, vs.Names[0].Name)
+					s.drop(vs.Pos(), vs.End())
+					s.dropGroups(vs.Doc, vs.Comment)
+					continue
+				}
+				specs = append(specs, vs)
+			}
+			if gd.Specs = specs; len(specs) > 0 {
+				decls = append(decls, gd)
+			} else {
+				s.drop(pos, end)
+				s.dropGroups(gd.Doc)
+			}
+		}
+		f.Decls = decls
+	}
+}
+
+// drop removes the comments in [pos, end) from the file being rewritten,
+// whose code has been removed.
+func (s *debugStripper) drop(pos, end token.Pos) {
+	dropComments(s.file, pos, end)
+	s.vacate(pos, end)
+}
+
+// vacate records that the code in [pos, end) has been removed.
+func (s *debugStripper) vacate(pos, end token.Pos) {
+	s.removed = append(s.removed, span{pos, end})
+}
+
+// closeGaps moves the statements of f following removed code up to where the
+// removed code started, so that the printer leaves no blank lines in its
+// place. So does the closing brace of a block whose last statements were
+// removed, which vacates its own line for what follows the block.
+func (s *debugStripper) closeGaps(f *ast.File) {
+	// inner lists first, since moving a brace up vacates its line
+	var nodes []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	for i := len(nodes) - 1; i >= 0; i-- {
+		switch n := nodes[i].(type) {
+		case *ast.BlockStmt:
+			prev := s.closeListGaps(n.Lbrace+1, n.List)
+			if to := s.gapStart(prev, n.Rbrace); to.IsValid() {
+				s.vacate(n.Rbrace, n.Rbrace+1)
+				n.Rbrace = to
+			}
+		case *ast.CaseClause:
+			s.closeListGaps(n.Colon+1, n.Body)
+		case *ast.CommClause:
+			s.closeListGaps(n.Colon+1, n.Body)
+		}
+	}
+}
+
+// closeListGaps moves up the statements of list that follow removed code,
+// starting at pos, and returns the end of the last one.
+func (s *debugStripper) closeListGaps(pos token.Pos, list []ast.Stmt) token.Pos {
+	for _, stmt := range list {
+		if to := s.gapStart(pos, stmt.Pos()); to.IsValid() {
+			from := stmt.Pos()
+			mapPositions(stmt, func(p token.Pos) token.Pos {
+				if p == from {
+					return to
+				}
+				return p
+			})
+		}
+		pos = stmt.End()
+	}
+	return pos
+}
+
+// gapStart returns where the earliest removed code in [pos, end) starts that
+// isn't followed by comments before end, or token.NoPos if there's none.
+// Removed code that began before pos, in a block that has since been moved
+// up, counts from pos.
+func (s *debugStripper) gapStart(pos, end token.Pos) token.Pos {
+	start := token.NoPos
+	for _, r := range s.removed {
+		from := r.pos
+		if from < pos {
+			from = pos
+		}
+		if from < r.end && from < end && (!start.IsValid() || from < start) && !commentsIn(s.file, from, end) {
+			start = from
+		}
+	}
+	return start
+}
+
+// commentsIn reports whether f has comments starting in [pos, end).
+func commentsIn(f *ast.File, pos, end token.Pos) bool {
+	for _, cg := range f.Comments {
+		if pos <= cg.Pos() && cg.Pos() < end {
+			return true
+		}
+	}
+	return false
+}
+
+// dropGroups removes the given comment groups from the file being rewritten.
+func (s *debugStripper) dropGroups(groups ...*ast.CommentGroup) {
+	for _, cg := range groups {
+		if cg != nil {
+			s.drop(cg.Pos(), cg.End())
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+func TestStripDebug(t *testing.T) {
+	srcs := []string{`package p
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// debug enables tracing.
+const debug = false
+
+func Sum(xs []int) int {
+	start := len(xs)
+	total := 0
+	for _, x := range xs {
+		total += x
+		if debug {
+			// trace every step
+			fmt.Println("adding", x)
+		}
+	}
+	debugf("sum of %d values", start)
+	if !debug {
+		total++
+	}
+	return total
+}
+
+func Join(xs []string) string {
+	defer debugf("joined")
+	if debug || len(xs) == 0 {
+		return ""
+	}
+	return strings.Join(xs, ",")
+}
+
+func debugf(format string, args ...interface{}) {
+	if debug {
+		log.Printf(format, args...)
+	}
+}
+`, `package p
+
+import "fmt"
+
+func Check(err error) string {
+	prefix := "debug: "
+	var verbose = fmt.Sprint(err)
+	if debug && err != nil {
+		return prefix + verbose
+	} else if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return ""
+}
+`}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, src := range srcs {
+		f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	if err := typeCheck(fset, files); err != nil {
+		t.Fatalf("fixture doesn't compile: %v", err)
+	}
+
+	report := StripDebug(files, DebugConfig{Guards: []string{"debug"}, Funcs: []string{"debugf"}})
+	want := DebugReport{
+		Branches: 4,
+		Calls:    2,
+		Locals:   []string{"start", "prefix", "verbose"},
+		Imports:  []string{"fmt", "log"},
+		Guards:   []string{"debug"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("got report %+v, want %+v", report, want)
+	}
+
+	// the code following removed statements moves up in their place
+	checkSource(t, fset, files[0], `package p
+
+import "strings"
+
+func Sum(xs []int) int {
+	total := 0
+	for _, x := range xs {
+		total += x
+	}
+	total++
+	return total
+}
+
+func Join(xs []string) string {
+	if len(xs) == 0 {
+		return ""
+	}
+	return strings.Join(xs, ",")
+}
+
+func debugf(format string, args ...interface{}) {
+}
+`)
+	checkSource(t, fset, files[1], `package p
+
+import "fmt"
+
+func Check(err error) string {
+	var _ = fmt.Sprint(err)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return ""
+}
+`)
+
+	// reparse the printed files to check that they compile
+	var printed []*ast.File
+	fset2 := token.NewFileSet()
+	for _, f := range files {
+		p, err := parser.ParseFile(fset2, "", render(t, fset, f), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		printed = append(printed, p)
+	}
+	if err := typeCheck(fset2, printed); err != nil {
+		t.Errorf("stripped package doesn't compile: %v", err)
+	}
+}
+
+func typeCheck(fset *token.FileSet, files []*ast.File) error {
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err := conf.Check("p", fset, files, nil)
+	return err
+}
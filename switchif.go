@@ -0,0 +1,247 @@
+package astrewrite
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+)
+
+// SwitchToIfElse converts an expression switch into an equivalent chain of
+// if/else if statements. Cases listing several values become conditions
+// joined with ||, and the default clause becomes the final else. The init
+// statement is kept as the init of the first if. A tag with side effects is
+// evaluated once into a temporary, which requires wrapping the result in a
+// block if the switch already has an init statement.
+//
+// It fails for switches using fallthrough or breaking out of the switch, and
+// for switches without any clause.
+func SwitchToIfElse(sw *ast.SwitchStmt) (ast.Stmt, error) {
+	var (
+		cases []*ast.CaseClause
+		def   *ast.CaseClause
+	)
+	for _, s := range sw.Body.List {
+		cc := s.(*ast.CaseClause)
+		if n := len(cc.Body); n > 0 {
+			if br, ok := cc.Body[n-1].(*ast.BranchStmt); ok && br.Tok == token.FALLTHROUGH {
+				return nil, errors.New("astrewrite: can't convert switch using fallthrough")
+			}
+		}
+		if hasBreak(cc.Body) {
+			return nil, errors.New("astrewrite: can't convert switch with break statements")
+		}
+		if cc.List == nil {
+			def = cc
+		} else {
+			cases = append(cases, cc)
+		}
+	}
+	if len(cases) == 0 && def == nil {
+		return nil, errors.New("astrewrite: can't convert empty switch")
+	}
+
+	if len(cases) == 0 {
+		// only a default clause, which always runs
+		block := clauseBlock(sw, def)
+		block.Lbrace = sw.Switch
+		var pre []ast.Stmt
+		if sw.Init != nil {
+			pre = append(pre, sw.Init)
+		}
+		if sw.Tag != nil && HasSideEffects(sw.Tag) {
+			pre = append(pre, &ast.AssignStmt{
+				Lhs:    []ast.Expr{ast.NewIdent("_")},
+				TokPos: sw.Tag.Pos(),
+				Tok:    token.ASSIGN,
+				Rhs:    []ast.Expr{sw.Tag},
+			})
+		}
+		block.List = append(pre, block.List...)
+		return block, nil
+	}
+
+	init, tag := sw.Init, sw.Tag
+	var hoisted ast.Stmt
+	if tag != nil && HasSideEffects(tag) {
+		name := ast.NewIdent(unusedName(sw, "tag"))
+		hoisted = &ast.AssignStmt{
+			Lhs:    []ast.Expr{name},
+			TokPos: tag.Pos(),
+			Tok:    token.DEFINE,
+			Rhs:    []ast.Expr{tag},
+		}
+		tag = name
+		if init == nil {
+			init, hoisted = hoisted, nil
+		}
+	}
+	if hoisted != nil {
+		// the tag may refer to variables declared by init
+		hoisted = &ast.BlockStmt{Lbrace: sw.Switch, List: []ast.Stmt{init, hoisted}, Rbrace: sw.End()}
+		init = nil
+	}
+
+	var chain ast.Stmt
+	if def != nil {
+		chain = clauseBlock(sw, def)
+	}
+	for i := len(cases) - 1; i >= 0; i-- {
+		cc := cases[i]
+		var cond ast.Expr
+		for _, v := range cc.List {
+			c := v
+			if tag != nil {
+				c = &ast.BinaryExpr{
+					X:  parenthesize(Clone(tag).(ast.Expr), token.EQL),
+					Op: token.EQL,
+					Y:  parenthesize(v, token.EQL),
+				}
+			}
+			if cond == nil {
+				cond = c
+			} else {
+				cond = &ast.BinaryExpr{X: cond, Op: token.LOR, Y: c}
+			}
+		}
+
+		pos := cc.Case
+		if i == 0 {
+			pos = sw.Switch
+		}
+		stampPositions(cond, pos)
+		chain = &ast.IfStmt{If: pos, Cond: cond, Body: clauseBlock(sw, cc), Else: chain}
+	}
+
+	ifStmt := chain.(*ast.IfStmt)
+	ifStmt.Init = init
+
+	if block, ok := hoisted.(*ast.BlockStmt); ok {
+		block.List = append(block.List, ifStmt)
+		return block, nil
+	}
+	return ifStmt, nil
+}
+
+// clauseBlock returns the body of cc as a block ending where the next clause
+// of sw starts.
+func clauseBlock(sw *ast.SwitchStmt, cc *ast.CaseClause) *ast.BlockStmt {
+	rbrace := sw.Body.Rbrace
+	for i, s := range sw.Body.List {
+		if s == ast.Stmt(cc) && i+1 < len(sw.Body.List) {
+			rbrace = sw.Body.List[i+1].Pos()
+		}
+	}
+	return &ast.BlockStmt{Lbrace: cc.Colon, List: cc.Body, Rbrace: rbrace}
+}
+
+// IfElseToSwitch converts a chain of if/else if statements comparing the
+// same expression against constants into an expression switch, the final
+// else becoming the default clause. Only the first if may have an init
+// statement. Constants are recognized syntactically: literals, possibly
+// negated, and (qualified) identifiers. Since the switch evaluates the
+// compared expression only once, chains comparing an expression with side
+// effects are not converted. It reports whether ifStmt was converted.
+func IfElseToSwitch(ifStmt *ast.IfStmt) (*ast.SwitchStmt, bool) {
+	var (
+		tag     ast.Expr
+		clauses []ast.Stmt
+		rbrace  token.Pos
+	)
+	for s := ast.Stmt(ifStmt); s != nil; {
+		switch st := s.(type) {
+		case *ast.BlockStmt:
+			clauses = append(clauses, &ast.CaseClause{Case: st.Lbrace, Colon: st.Lbrace, Body: st.List})
+			rbrace = st.Rbrace
+			s = nil
+
+		case *ast.IfStmt:
+			if st != ifStmt && st.Init != nil {
+				return nil, false
+			}
+			var values []ast.Expr
+			if tag, values = switchValues(tag, st.Cond); values == nil {
+				return nil, false
+			}
+			for _, v := range values {
+				stampPositions(v, st.If)
+			}
+			clauses = append(clauses, &ast.CaseClause{Case: st.If, List: values, Colon: st.Body.Lbrace, Body: st.Body.List})
+			rbrace = st.Body.Rbrace
+			s = st.Else
+
+		default:
+			return nil, false
+		}
+	}
+
+	if HasSideEffects(tag) {
+		return nil, false
+	}
+	stampPositions(tag, ifStmt.If)
+	return &ast.SwitchStmt{
+		Switch: ifStmt.If,
+		Init:   ifStmt.Init,
+		Tag:    tag,
+		Body:   &ast.BlockStmt{Lbrace: ifStmt.Body.Lbrace, List: clauses, Rbrace: rbrace},
+	}, true
+}
+
+// switchValues splits cond, a ||-chain of comparisons of tag against
+// constants, into the constants. If tag is nil, it's taken from the first
+// comparison. It returns nil values if cond doesn't have that shape.
+func switchValues(tag, cond ast.Expr) (ast.Expr, []ast.Expr) {
+	cond = ast.Unparen(cond)
+	b, ok := cond.(*ast.BinaryExpr)
+	if !ok {
+		return tag, nil
+	}
+
+	switch b.Op {
+	case token.LOR:
+		var x, y []ast.Expr
+		if tag, x = switchValues(tag, b.X); x == nil {
+			return tag, nil
+		}
+		if tag, y = switchValues(tag, b.Y); y == nil {
+			return tag, nil
+		}
+		return tag, append(x, y...)
+
+	case token.EQL:
+		x, y := ast.Unparen(b.X), ast.Unparen(b.Y)
+		if tag == nil {
+			if isLiteral(x) && !isLiteral(y) {
+				x, y = y, x
+			}
+			tag = x
+		}
+		switch {
+		case Equal(tag, x) && isConstant(y):
+			return tag, []ast.Expr{y}
+		case Equal(tag, y) && isConstant(x):
+			return tag, []ast.Expr{x}
+		}
+	}
+	return tag, nil
+}
+
+func isLiteral(e ast.Expr) bool {
+	if u, ok := e.(*ast.UnaryExpr); ok && (u.Op == token.SUB || u.Op == token.ADD) {
+		e = u.X
+	}
+	_, ok := e.(*ast.BasicLit)
+	return ok
+}
+
+// isConstant reports whether e looks like a constant: a literal, possibly
+// negated, or a (qualified) identifier.
+func isConstant(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		_, ok := e.X.(*ast.Ident)
+		return ok
+	}
+	return isLiteral(e)
+}
@@ -0,0 +1,143 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"testing"
+)
+
+func TestSwitchToIfElse(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(x int) {
+	switch y := x * 2; y {
+	case 1, 2:
+		println("small")
+	case 3:
+		println("three")
+	default:
+		println("other")
+	}
+}
+`)
+
+	body := findFunc(file, "f").Body
+	s, err := SwitchToIfElse(body.List[0].(*ast.SwitchStmt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.List[0] = s
+
+	checkSource(t, fset, file, `package p
+
+func f(x int) {
+	if y := x * 2; y == 1 || y == 2 {
+		println("small")
+	} else if y == 3 {
+		println("three")
+	} else {
+		println("other")
+	}
+}
+`)
+}
+
+func TestSwitchToIfElseHoist(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(tag int) {
+	switch next() {
+	case tag:
+		println("tag")
+	}
+	switch x := 1; next() + x {
+	case 1:
+		println("one")
+	}
+}
+`)
+
+	body := findFunc(file, "f").Body
+	for i, s := range body.List {
+		s, err := SwitchToIfElse(s.(*ast.SwitchStmt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body.List[i] = s
+	}
+
+	checkSource(t, fset, file, `package p
+
+func f(tag int) {
+	if tag1 := next(); tag1 == tag {
+		println("tag")
+	}
+	{
+		x := 1
+		tag := next() + x
+		if tag == 1 {
+			println("one")
+		}
+	}
+}
+`)
+}
+
+func TestSwitchToIfElseRefused(t *testing.T) {
+	for _, src := range []string{
+		`switch x { case 1: fallthrough; case 2: }`,
+		`switch x { case 1: if y { break } }`,
+		`switch x {}`,
+	} {
+		_, file := parse(t, "package p; func f() {"+src+"}")
+		sw := findFunc(file, "f").Body.List[0].(*ast.SwitchStmt)
+		if _, err := SwitchToIfElse(sw); err == nil {
+			t.Errorf("converted %s", src)
+		}
+	}
+}
+
+func TestSwitchIfElseRoundTrip(t *testing.T) {
+	for n := 2; n <= 5; n++ {
+		var src strings.Builder
+		src.WriteString("package p\n\nfunc f(x int) {\n\tswitch x {\n")
+		for i := 1; i < n; i++ {
+			fmt.Fprintf(&src, "\tcase %d, -%d:\n\t\tprintln(%d)\n", i, i, i)
+		}
+		src.WriteString("\tdefault:\n\t\tprintln(0)\n\t}\n}\n")
+
+		fset, file := parse(t, src.String())
+		body := findFunc(file, "f").Body
+		s, err := SwitchToIfElse(body.List[0].(*ast.SwitchStmt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(render(t, fset, s), "if "); got != n-1 {
+			t.Errorf("%d branches: got %d ifs, want %d", n, got, n-1)
+		}
+
+		sw, ok := IfElseToSwitch(s.(*ast.IfStmt))
+		if !ok {
+			t.Fatalf("%d branches: if/else chain not converted", n)
+		}
+		body.List[0] = sw
+		checkSource(t, fset, file, src.String())
+	}
+}
+
+func TestIfElseToSwitchRefused(t *testing.T) {
+	for _, src := range []string{
+		`if x == 1 {} else if y == 2 {}`,
+		`if x == 1 {} else if x < 2 {}`,
+		`if x == 1 {} else if z := 2; x == z {}`,
+		`if next() == 1 {} else if next() == 2 {}`,
+		`if x == y + 1 {}`,
+	} {
+		_, file := parse(t, "package p; func f() {"+src+"}")
+		ifStmt := findFunc(file, "f").Body.List[0].(*ast.IfStmt)
+		if _, ok := IfElseToSwitch(ifStmt); ok {
+			t.Errorf("converted %s", src)
+		}
+	}
+}
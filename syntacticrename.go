@@ -0,0 +1,215 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// SyntacticRenameReport describes what SyntacticRename did and, as
+// importantly, what it left for a human to finish.
+type SyntacticRenameReport struct {
+	// Renamed holds the renamed identifiers, declaration included, in the
+	// order of the files and of their positions.
+	Renamed []*ast.Ident
+
+	// Shadowed holds the occurrences of the old name left alone because
+	// they refer to a local declaration or an import of that name, or
+	// declare one.
+	Shadowed []*ast.Ident
+
+	// Refused holds the files left alone because the new name is
+	// declared or imported at their top level. If it's declared at
+	// package level, which is shared by all files, every file is refused.
+	Refused []*ast.File
+
+	// Diagnostics holds the occurrences of the old name that can't be
+	// told apart without type information, or can't be renamed, in the
+	// order of the files and of their positions.
+	Diagnostics []RenameDiagnostic
+}
+
+// RenameDiagnostic describes an occurrence of a name SyntacticRename left
+// alone.
+type RenameDiagnostic struct {
+	Ident  *ast.Ident
+	Reason string
+}
+
+// SyntacticRename renames the package level declaration of old in files,
+// the files of a package, to new, along with all the unqualified uses
+// referring to it, going by syntax only, for when type information can't
+// be loaded. Scopes are worked out like Cursor.Lookup does: uses of old
+// inside functions that declare a variable, parameter or type of that name
+// refer to it rather than to the package level declaration and are left
+// alone, like uses in files importing a package as old.
+//
+// Selectors x.old are reported as diagnostics rather than renamed, since
+// whether they select a field, a method or a member of a package named by
+// x takes types to know, and so are the keys of composite literals, which
+// name fields or are map keys. Uses that a local declaration of new would
+// capture are reported too. Field and method names, labels and the names
+// of other packages' members are never renamed.
+func SyntacticRename(files []*ast.File, old, new string) SyntacticRenameReport {
+	var report SyntacticRenameReport
+	refused := make(map[*ast.File]bool)
+	for _, f := range files {
+		for _, site := range packageDecls(f) {
+			if site.Name == new {
+				report.Refused = files
+				return report
+			}
+		}
+		for _, imp := range f.Imports {
+			if importName(imp) == new {
+				refused[f] = true
+			}
+		}
+	}
+	for _, f := range files {
+		if refused[f] {
+			report.Refused = append(report.Refused, f)
+		}
+	}
+
+	pkg := &ast.Package{Files: make(map[string]*ast.File)}
+	topLevel := make(map[ast.Node]bool)
+	for i, f := range files {
+		pkg.Files[fmt.Sprintf("%08d", i)] = f
+		for _, d := range f.Decls {
+			if gd, ok := d.(*ast.GenDecl); ok {
+				topLevel[gd] = true
+			}
+		}
+	}
+	// looked up from within their declaration, package level constants,
+	// variables and types are scoped to its GenDecl
+	isPackageScope := func(scope ast.Node) bool {
+		switch scope.(type) {
+		case *ast.Package, *ast.File:
+			return true
+		}
+		return topLevel[scope]
+	}
+	var w *Walker
+	w = New(func(n ast.Node) (ast.Node, bool) {
+		id, ok := n.(*ast.Ident)
+		if !ok || id.Name != old {
+			return n, true
+		}
+		c := w.Cursor()
+		path := c.ancestors()
+		if len(path) < 2 || refused[path[1].(*ast.File)] {
+			return n, true
+		}
+		if reason := ambiguousUse(path, id); reason != "" {
+			report.Diagnostics = append(report.Diagnostics, RenameDiagnostic{Ident: id, Reason: reason})
+			return n, true
+		}
+		if !isReference(path, id) {
+			return n, true
+		}
+
+		site, ok := c.Lookup(old)
+		if !ok {
+			return n, true
+		}
+		if site.Kind == ast.Pkg || !isPackageScope(site.Scope) || declaresLocal(path, id) {
+			report.Shadowed = append(report.Shadowed, id)
+			return n, true
+		}
+		if site, ok := c.Lookup(new); ok && !isPackageScope(site.Scope) {
+			report.Diagnostics = append(report.Diagnostics, RenameDiagnostic{Ident: id, Reason: fmt.Sprintf("would refer to the local %s", new)})
+			return n, true
+		}
+		report.Renamed = append(report.Renamed, id)
+		return n, true
+	})
+	w.Walk(pkg)
+
+	// renamed once the walk is done, so that scopes are looked up in the
+	// original tree
+	for _, id := range report.Renamed {
+		id.Name = new
+	}
+	return report
+}
+
+// ambiguousUse returns why the identifier id, whose ancestors are path,
+// can't be renamed without type information, or an empty string.
+func ambiguousUse(path []ast.Node, id *ast.Ident) string {
+	switch p := path[len(path)-1].(type) {
+	case *ast.SelectorExpr:
+		if p.Sel == id {
+			return "selector, field, method or member of a package"
+		}
+	case *ast.KeyValueExpr:
+		if _, ok := path[len(path)-2].(*ast.CompositeLit); ok && p.Key == id {
+			return "composite literal key, field name or map key"
+		}
+	}
+	return ""
+}
+
+// isReference reports whether the identifier id, whose ancestors are path,
+// can refer to a package level declaration or be one, rather than be a
+// label, an import name, or the name of a field or method.
+func isReference(path []ast.Node, id *ast.Ident) bool {
+	switch p := path[len(path)-1].(type) {
+	case *ast.LabeledStmt, *ast.BranchStmt, *ast.ImportSpec:
+		return false
+	case *ast.FuncDecl:
+		return p.Name != id || p.Recv == nil
+	case *ast.Field:
+		for _, name := range p.Names {
+			if name == id {
+				switch path[len(path)-3].(type) {
+				case *ast.StructType, *ast.InterfaceType:
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// declaresLocal reports whether the identifier id, whose ancestors are path,
+// declares a local name: a parameter, result or receiver, a variable, or a
+// constant or type declared in a function.
+func declaresLocal(path []ast.Node, id *ast.Ident) bool {
+	inFunc := false
+	for _, n := range path {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			inFunc = true
+		}
+	}
+	switch p := path[len(path)-1].(type) {
+	case *ast.Field:
+		for _, name := range p.Names {
+			if name == id {
+				return true
+			}
+		}
+	case *ast.AssignStmt:
+		if p.Tok != token.DEFINE {
+			return false
+		}
+		for _, e := range p.Lhs {
+			if e == id {
+				return true
+			}
+		}
+	case *ast.RangeStmt:
+		return p.Tok == token.DEFINE && (p.Key == id || p.Value == id)
+	case *ast.ValueSpec:
+		for _, name := range p.Names {
+			if name == id {
+				return inFunc
+			}
+		}
+	case *ast.TypeSpec:
+		return p.Name == id && inFunc
+	}
+	return false
+}
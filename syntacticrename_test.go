@@ -0,0 +1,146 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// parseFiles parses the sources of a package into fset.
+func parseFiles(t *testing.T, fset *token.FileSet, srcs ...string) []*ast.File {
+	t.Helper()
+	var files []*ast.File
+	for _, src := range srcs {
+		f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func TestSyntacticRename(t *testing.T) {
+	fset := token.NewFileSet()
+	files := parseFiles(t, fset, `package p
+
+type limit int
+
+var defaultLimit limit = 10
+
+func check(n int) bool {
+	return limit(n) < defaultLimit
+}
+
+func shadowed(limit int) int {
+	return limit * 2
+}
+
+func local() {
+	if true {
+		limit := 3
+		_ = limit
+	}
+	var _ limit
+}
+`, `package p
+
+type config struct {
+	limit limit
+}
+
+func (c config) limit() limit {
+	return c.limit
+}
+
+func newConfig() config {
+	return config{limit: limit(1)}
+}
+`)
+
+	report := SyntacticRename(files, "limit", "quota")
+
+	checkSource(t, fset, files[0], `package p
+
+type quota int
+
+var defaultLimit quota = 10
+
+func check(n int) bool {
+	return quota(n) < defaultLimit
+}
+
+func shadowed(limit int) int {
+	return limit * 2
+}
+
+func local() {
+	if true {
+		limit := 3
+		_ = limit
+	}
+	var _ quota
+}
+`)
+	checkSource(t, fset, files[1], `package p
+
+type config struct {
+	limit quota
+}
+
+func (c config) limit() quota {
+	return c.limit
+}
+
+func newConfig() config {
+	return config{limit: quota(1)}
+}
+`)
+
+	if len(report.Renamed) != 7 {
+		t.Errorf("renamed %d identifiers, want 7", len(report.Renamed))
+	}
+	if len(report.Shadowed) != 4 {
+		t.Errorf("got %d shadowed identifiers, want 4", len(report.Shadowed))
+	}
+	var reasons []string
+	for _, d := range report.Diagnostics {
+		reasons = append(reasons, fset.Position(d.Ident.Pos()).String()+" "+d.Reason)
+	}
+	if len(reasons) != 2 {
+		t.Errorf("got diagnostics %q, want c.limit and the key of config{limit: ...}", reasons)
+	}
+	if len(report.Refused) != 0 {
+		t.Errorf("refused %d files", len(report.Refused))
+	}
+}
+
+func TestSyntacticRenameRefused(t *testing.T) {
+	fset := token.NewFileSet()
+	files := parseFiles(t, fset, `package p
+
+func limit() {}
+`, `package p
+
+const quota = 1
+`)
+	report := SyntacticRename(files, "limit", "quota")
+	if len(report.Refused) != 2 || len(report.Renamed) != 0 {
+		t.Errorf("got report %+v, want both files refused", report)
+	}
+
+	files = parseFiles(t, fset, `package p
+
+func limit() {}
+`, `package p
+
+import quota "example.com/quota"
+
+func f() { limit(); quota.Set() }
+`)
+	report = SyntacticRename(files, "limit", "quota")
+	if len(report.Refused) != 1 || report.Refused[0] != files[1] || len(report.Renamed) != 1 {
+		t.Errorf("got report %+v, want the second file refused", report)
+	}
+}
@@ -0,0 +1,81 @@
+package astrewrite
+
+import "go/ast"
+
+// AddExplicitTypeArgs adds type arguments to the calls below node whose
+// function is named by an identifier or a selector, like Map(xs, f) into
+// Map[int, string](xs, f). resolve returns the type arguments of a call, as
+// inferred by the type checker, and false for calls that aren't generic or
+// are left alone. Calls of indexed functions are skipped, as they either
+// have type arguments already or call an element of a map or slice. It
+// returns the number of rewritten calls.
+func AddExplicitTypeArgs(node ast.Node, resolve func(call *ast.CallExpr) ([]ast.Expr, bool)) int {
+	n := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch call.Fun.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+		default:
+			return true
+		}
+		args, ok := resolve(call)
+		if !ok || len(args) == 0 {
+			return true
+		}
+
+		pos := call.Fun.End()
+		for _, arg := range args {
+			stampPositions(arg, pos)
+		}
+		if len(args) == 1 {
+			call.Fun = &ast.IndexExpr{X: call.Fun, Lbrack: pos, Index: args[0], Rbrack: pos}
+		} else {
+			call.Fun = &ast.IndexListExpr{X: call.Fun, Lbrack: pos, Indices: args, Rbrack: pos}
+		}
+		n++
+		return true
+	})
+	return n
+}
+
+// RemoveRedundantTypeArgs drops the type arguments of the calls below node
+// that inferable reports the type checker can infer, like
+// Map[int, string](xs, f) into Map(xs, f). Only the function of a call is
+// touched, so instantiations in type positions, like var x List[int], keep
+// their arguments; conversions to instantiated types are calls as well, for
+// which inferable has to report false. Index expressions whose operand isn't
+// an identifier or selector are skipped, as are calls whose function isn't
+// indexed. It returns the number of rewritten calls.
+func RemoveRedundantTypeArgs(node ast.Node, inferable func(call *ast.CallExpr) bool) int {
+	n := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		var fun ast.Expr
+		switch f := call.Fun.(type) {
+		case *ast.IndexExpr:
+			fun = f.X
+		case *ast.IndexListExpr:
+			fun = f.X
+		default:
+			return true
+		}
+		switch fun.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+		default:
+			return true
+		}
+		if !inferable(call) {
+			return true
+		}
+		call.Fun = fun
+		n++
+		return true
+	})
+	return n
+}
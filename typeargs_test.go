@@ -0,0 +1,100 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/types"
+	"testing"
+)
+
+func TestAddExplicitTypeArgs(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func Map[T, U any](xs []T, f func(T) U) []U { return nil }
+
+func First[T any](xs []T) T { return xs[0] }
+
+func f(xs []int, fs map[string]func()) {
+	ys := Map(xs, func(x int) string { return "" })
+	_ = First(ys)
+	_ = First[int](xs)
+	fs["a"]()
+	println(len(ys))
+}
+`)
+	info := &types.Info{Instances: make(map[*ast.Ident]types.Instance)}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	// the type arguments inferred by the type checker
+	resolve := func(call *ast.CallExpr) ([]ast.Expr, bool) {
+		id, ok := call.Fun.(*ast.Ident)
+		if !ok {
+			return nil, false
+		}
+		inst, ok := info.Instances[id]
+		if !ok {
+			return nil, false
+		}
+		var args []ast.Expr
+		for i := 0; i < inst.TypeArgs.Len(); i++ {
+			args = append(args, ast.NewIdent(inst.TypeArgs.At(i).String()))
+		}
+		return args, true
+	}
+	if n := AddExplicitTypeArgs(file, resolve); n != 2 {
+		t.Errorf("rewrote %d calls, want 2", n)
+	}
+
+	checkSource(t, fset, findFunc(file, "f"), `func f(xs []int, fs map[string]func()) {
+	ys := Map[int, string](xs, func(x int) string { return "" })
+	_ = First[string](ys)
+	_ = First[int](xs)
+	fs["a"]()
+	println(len(ys))
+}`)
+}
+
+func TestRemoveRedundantTypeArgs(t *testing.T) {
+	fset, file := parse(t, `package p
+
+type List[T any] []T
+
+func Map[T, U any](xs []T, f func(T) U) []U { return nil }
+
+func Zero[T any]() T { var z T; return z }
+
+func f(xs []int, fs []func(int)) {
+	var l List[int]
+	ys := Map[int, string](xs, func(x int) string { return "" })
+	z := Zero[int]()
+	_ = List[int](xs)
+	fs[0](1)
+	_, _, _ = l, ys, z
+}
+`)
+
+	// inference needs the type parameters to appear in the parameters
+	inferable := func(call *ast.CallExpr) bool {
+		var id *ast.Ident
+		switch f := call.Fun.(type) {
+		case *ast.IndexExpr:
+			id, _ = f.X.(*ast.Ident)
+		case *ast.IndexListExpr:
+			id, _ = f.X.(*ast.Ident)
+		}
+		return id != nil && id.Name == "Map"
+	}
+	if n := RemoveRedundantTypeArgs(file, inferable); n != 1 {
+		t.Errorf("rewrote %d calls, want 1", n)
+	}
+
+	checkSource(t, fset, findFunc(file, "f"), `func f(xs []int, fs []func(int)) {
+	var l List[int]
+	ys := Map(xs, func(x int) string { return "" })
+	z := Zero[int]()
+	_ = List[int](xs)
+	fs[0](1)
+	_, _, _ = l, ys, z
+}`)
+}
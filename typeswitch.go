@@ -0,0 +1,81 @@
+package astrewrite
+
+import "go/ast"
+
+// DedupTypeSwitchArms merges the adjacent case clauses of the type switches
+// below node whose bodies are equal into a single clause listing their
+// types, like
+//
+//	switch v := x.(type) {
+//	case int:
+//		return true
+//	case int64:
+//		return true
+//	}
+//
+// into a switch with the clause case int, int64. Bodies mentioning the
+// variable bound by the switch are left alone, even if they're equal: in a
+// clause listing several types the variable has the type of the switched
+// expression rather than that of the case, which changes what the body
+// does or makes it invalid. Clauses separated by others aren't merged
+// either, since the types in between might match some values of both,
+// like interface types do. The default clause is never merged. Merged
+// clauses keep the body of the last of them, and the comments of the other
+// bodies are dropped; comments that no node holds are only dropped when
+// node is a file. It returns the number of clauses merged into others.
+func DedupTypeSwitchArms(node ast.Node) int {
+	n := 0
+	file, _ := node.(*ast.File)
+	ast.Inspect(node, func(node ast.Node) bool {
+		ts, ok := node.(*ast.TypeSwitchStmt)
+		if !ok {
+			return true
+		}
+		bound := ""
+		if as, ok := ts.Assign.(*ast.AssignStmt); ok && len(as.Lhs) == 1 {
+			if id, ok := as.Lhs[0].(*ast.Ident); ok && id.Name != "_" {
+				bound = id.Name
+			}
+		}
+
+		list := ts.Body.List[:0]
+		var prev *ast.CaseClause
+		for _, s := range ts.Body.List {
+			cc := s.(*ast.CaseClause)
+			if prev != nil && mergeableArms(prev, cc, bound) {
+				last := prev.List[len(prev.List)-1]
+				for _, typ := range cc.List {
+					stampPositions(typ, last.Pos())
+					prev.List = append(prev.List, typ)
+				}
+				// the bodies are equal, so prev takes that of cc, which
+				// ends where cc did and leaves no gap before what follows
+				nukeComments(&ast.BlockStmt{List: prev.Body})
+				if file != nil {
+					dropComments(file, prev.Colon, cc.Colon)
+				}
+				prev.Colon, prev.Body = cc.Colon, cc.Body
+				n++
+				continue
+			}
+			list = append(list, cc)
+			prev = cc
+		}
+		ts.Body.List = list
+		return true
+	})
+	return n
+}
+
+// mergeableArms reports whether the clause b of a type switch binding the
+// variable bound can be merged into the clause a preceding it.
+func mergeableArms(a, b *ast.CaseClause, bound string) bool {
+	if a.List == nil || b.List == nil {
+		return false
+	}
+	x, y := &ast.BlockStmt{List: a.Body}, &ast.BlockStmt{List: b.Body}
+	if bound != "" && (mentions(x, bound) || mentions(y, bound)) {
+		return false
+	}
+	return Equal(x, y)
+}
@@ -0,0 +1,109 @@
+package astrewrite
+
+import "testing"
+
+func TestDedupTypeSwitchArms(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func kind(x any) string {
+	switch v := x.(type) {
+	case int:
+		return "number"
+	case int64:
+		return "number"
+	case uint8:
+		return "number"
+	case string:
+		return "text: " + v
+	case []byte:
+		return "text: " + string(v)
+	case error:
+		return "other"
+	case fmt.Stringer:
+		return "text"
+	case bool:
+		return "other"
+	}
+	return ""
+}
+
+func size(x any) int {
+	switch x.(type) {
+	case bool:
+		// a byte
+		return 1
+	// and so is this
+	case int8:
+		return 1
+	case uint8:
+		// a byte
+		return 1
+	}
+	return 0
+}
+`)
+	if n := DedupTypeSwitchArms(file); n != 4 {
+		t.Errorf("merged %d clauses, want 4", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func kind(x any) string {
+	switch v := x.(type) {
+	case int, int64, uint8:
+		return "number"
+	case string:
+		return "text: " + v
+	case []byte:
+		return "text: " + string(v)
+	case error:
+		return "other"
+	case fmt.Stringer:
+		return "text"
+	case bool:
+		return "other"
+	}
+	return ""
+}
+
+func size(x any) int {
+	switch x.(type) {
+	case bool, int8, uint8:
+		// a byte
+		return 1
+	}
+	return 0
+}
+`)
+}
+
+func TestDedupTypeSwitchArmsBound(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func double(x any) any {
+	switch v := x.(type) {
+	case int:
+		return v * 2
+	case float64:
+		return v * 2
+	default:
+		return nil
+	}
+}
+`)
+	if n := DedupTypeSwitchArms(file); n != 0 {
+		t.Errorf("merged %d clauses, want 0", n)
+	}
+	checkSource(t, fset, file, `package p
+
+func double(x any) any {
+	switch v := x.(type) {
+	case int:
+		return v * 2
+	case float64:
+		return v * 2
+	default:
+		return nil
+	}
+}
+`)
+}
@@ -0,0 +1,57 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// UnionMembers returns the terms of the union e, like int and ~string for
+// int | ~string, in source order. Any other expression is returned as the
+// only term.
+//
+// Walk treats the terms of a union type element as a list: removing a term
+// shrinks the union, and only removing all of them removes the element.
+func UnionMembers(e ast.Expr) []ast.Expr {
+	if b, ok := e.(*ast.BinaryExpr); ok && b.Op == token.OR {
+		return append(UnionMembers(b.X), UnionMembers(b.Y)...)
+	}
+	return []ast.Expr{e}
+}
+
+// markUnion records the binary expressions forming the union e.
+func (w *walker) markUnion(e ast.Expr) {
+	b, ok := e.(*ast.BinaryExpr)
+	if !ok || b.Op != token.OR {
+		return
+	}
+	if w.unions == nil {
+		w.unions = make(map[*ast.BinaryExpr]bool)
+	}
+	w.unions[b] = true
+	w.markUnion(b.X)
+	w.markUnion(b.Y)
+}
+
+// shrinkUnion drops the removed terms of the union e and returns the
+// remaining union, or nil if no terms are left.
+func shrinkUnion(e ast.Expr) ast.Expr {
+	b, ok := e.(*ast.BinaryExpr)
+	if !ok || b.Op != token.OR {
+		return e
+	}
+	x, y := b.X, b.Y
+	if x != nil {
+		x = shrinkUnion(x)
+	}
+	if y != nil {
+		y = shrinkUnion(y)
+	}
+	switch {
+	case x == nil:
+		return y
+	case y == nil:
+		return x
+	}
+	b.X, b.Y = x, y
+	return b
+}
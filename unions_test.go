@@ -0,0 +1,80 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestUnionMembers(t *testing.T) {
+	_, file := parse(t, `package p
+
+type C interface{ int | ~string | float64 }
+`)
+	iface := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.InterfaceType)
+
+	members := UnionMembers(iface.Methods.List[0].Type)
+	if len(members) != 3 {
+		t.Fatalf("got %d members, want 3", len(members))
+	}
+	if id, ok := members[2].(*ast.Ident); !ok || id.Name != "float64" {
+		t.Errorf("got last member %#v", members[2])
+	}
+}
+
+func TestWalkUnion(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(ast.Node) bool
+		want   string
+	}{
+		{
+			name: "member",
+			remove: func(n ast.Node) bool {
+				u, ok := n.(*ast.UnaryExpr)
+				return ok && u.X.(*ast.Ident).Name == "int64"
+			},
+			want: "interface {\n\t~int\n\tfmt.Stringer\n}",
+		},
+		{
+			name: "tilde operand",
+			remove: func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				return ok && id.Name == "int"
+			},
+			want: "interface {\n\t~int64\n\tfmt.Stringer\n}",
+		},
+		{
+			name: "all members",
+			remove: func(n ast.Node) bool {
+				_, ok := n.(*ast.UnaryExpr)
+				return ok
+			},
+			want: "interface{ fmt.Stringer }",
+		},
+		{
+			name: "embedded interface",
+			remove: func(n ast.Node) bool {
+				_, ok := n.(*ast.SelectorExpr)
+				return ok
+			},
+			want: "interface{ ~int | ~int64 }",
+		},
+	}
+
+	for _, tt := range tests {
+		fset, file := parse(t, `package p
+
+type C interface{ ~int | ~int64; fmt.Stringer }
+`)
+		Walk(file, func(n ast.Node) (ast.Node, bool) {
+			if tt.remove(n) {
+				return nil, false
+			}
+			return n, true
+		})
+		spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+		if got := render(t, fset, spec.Type); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"reflect"
+)
+
+// WalkCursor walks the tree rooted at node in depth-first order, calling fn
+// with a Cursor for every node, and returns the rewritten tree. Unlike with
+// Walk, fn can edit the tree around the current node as well: besides
+// replacing it with Cursor.Replace and deleting it with Cursor.Delete, it
+// can insert siblings with Cursor.InsertBefore and Cursor.InsertAfter, when
+// the node is held by a slice, like the statements of a block. If fn
+// returns false, the children of the node aren't walked.
+//
+// Inserted and replacing nodes aren't walked, nor are the children of
+// deleted and replaced nodes. Deleted nodes lose their comments, and
+// deleting a node its parent can't do without deletes the parent, as
+// described by RemovalBehavior. Unlike with ApplyCompat, fn isn't called
+// for unset optional children.
+func WalkCursor(node ast.Node, fn func(c *Cursor) bool) ast.Node {
+	parent := &struct{ ast.Node }{node}
+	a := &application{
+		pre: func(c *Cursor) bool {
+			return c.node == nil || fn(c)
+		},
+		cascade: true,
+	}
+	a.apply(parent, "Node", nil, node)
+	return parent.Node
+}
+
+// deleteField deletes Node from the field of Parent holding it, clearing
+// the field, or deleting Parent along with it if it can't do without.
+func (c *Cursor) deleteField() {
+	kind := reflect.TypeOf(c.parent).Elem().Name()
+	if RemovalBehavior(kind, c.name) == PropagateRemoval {
+		c.propagate = true
+		return
+	}
+	f := c.field()
+	f.Set(reflect.Zero(f.Type()))
+}
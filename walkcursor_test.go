@@ -0,0 +1,94 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"testing"
+)
+
+func TestWalkCursor(t *testing.T) {
+	fset, file := parse(t, `package p
+
+func f(x int) int {
+	if x > 0 {
+		return x
+	}
+	debug(x)
+	cleanup()
+	return 0
+}
+`)
+
+	logCall := func(name string) ast.Stmt {
+		return &ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: ast.NewIdent("log"), Sel: ast.NewIdent("Print")},
+			Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"` + name + `"`}},
+		}}
+	}
+	var returns int
+	file = WalkCursor(file, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.ReturnStmt:
+			returns++
+			c.InsertBefore(logCall("return"))
+		case *ast.ExprStmt:
+			// the inserted copy isn't walked, so it keeps calling debug
+			if call, ok := n.X.(*ast.CallExpr); ok && isIdent(call.Fun, "debug") {
+				c.InsertAfter(&ast.ExprStmt{X: Clone(call).(ast.Expr)})
+			}
+		case *ast.Ident:
+			switch n.Name {
+			case "cleanup":
+				// the call and its statement go along with the identifier
+				c.Delete()
+			case "debug":
+				c.Replace(ast.NewIdent("trace"))
+			}
+		}
+		return true
+	}).(*ast.File)
+
+	if returns != 2 {
+		t.Errorf("got %d returns walked, want 2", returns)
+	}
+	checkSource(t, fset, file, `package p
+
+func f(x int) int {
+	if x > 0 {
+		log.Print("return")
+		return x
+	}
+	trace(x)
+	debug(x)
+	log.Print("return")
+
+	return 0
+}
+`)
+}
+
+func TestWalkCursorIndex(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() {
+	a()
+	b()
+	c()
+}
+`)
+	var got []int
+	WalkCursor(file, func(c *Cursor) bool {
+		if _, ok := c.Node().(*ast.ExprStmt); ok {
+			got = append(got, c.Index())
+			if _, ok := c.Parent().(*ast.BlockStmt); !ok {
+				t.Errorf("got parent %T, want *ast.BlockStmt", c.Parent())
+			}
+			c.InsertBefore(&ast.EmptyStmt{Implicit: true})
+			return false
+		}
+		return true
+	})
+	if len(got) != 3 || got[0] != 0 || got[1] != 2 || got[2] != 4 {
+		t.Errorf("got indices %v, want [0 2 4]", got)
+	}
+}
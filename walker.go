@@ -0,0 +1,202 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// Walker rewrites ASTs like Walk, with additional behavior enabled by
+// options. A Walker can be used for any number of walks, but not for
+// several at the same time.
+type Walker struct {
+	fn WalkFunc
+
+	retainRemoved bool
+	cloneRemoved  bool
+	nilUnchanged  bool
+	coverage      bool
+	wrapExprs     bool
+
+	annotationPrefix string
+
+	// active is the state of the walk in progress
+	active *walker
+}
+
+// Option configures a Walker.
+type Option func(*Walker)
+
+// New returns a Walker calling fn for every node.
+func New(fn WalkFunc, opts ...Option) *Walker {
+	w := &Walker{fn: fn}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Walk walks node like the package level Walk and returns the rewritten node
+// along with a report of the walk.
+func (w *Walker) Walk(node ast.Node) (ast.Node, *Report) {
+	s := &walker{Walker: w, report: &Report{}}
+	if w.coverage {
+		s.shown = make(map[ast.Node]bool)
+		s.skipped = make(map[ast.Node]bool)
+	}
+	if f, ok := node.(*ast.File); ok && w.annotationPrefix != "" {
+		s.ann = parseAnnotations(f, w.annotationPrefix)
+	}
+	w.active = s
+	defer func() { w.active = nil }()
+	rewritten := s.walk(node)
+	if w.coverage {
+		s.checkCoverage(rewritten)
+	}
+	return rewritten, s.report
+}
+
+// Report describes what happened during a walk.
+type Report struct {
+	// Removed holds the nodes removed by the walk function, in the
+	// order they were removed, if enabled with WithRemoved.
+	Removed []Removed
+
+	// Unvisited holds the roots of the subtrees of the resulting tree
+	// that were never passed to the walk function, if enabled with
+	// WithCoverageCheck.
+	Unvisited []ast.Node
+}
+
+// Removed describes a subtree removed from the AST.
+type Removed struct {
+	// Node is the removed subtree.
+	Node ast.Node
+
+	// Path holds the former ancestors of Node, starting at the root of
+	// the walk and ending with its parent.
+	Path []ast.Node
+
+	// Pos is the position Node had.
+	Pos token.Pos
+}
+
+// WithRemoved records the nodes removed by the walk function in the report.
+// Nodes removed as a consequence, like the statement of a removed
+// expression, are not recorded.
+//
+// Without clone, the recorded node is the removed subtree itself. Walk still
+// walks the children of a removed node if the walk function asks for it, and
+// the walk function may change them, so such a subtree might differ from what
+// was removed. With clone a deep copy is recorded at the time of removal.
+// Either way, the comments attached to the removed subtree are kept in the
+// recorded node, although they are removed from the tree that was walked.
+func WithRemoved(clone bool) Option {
+	return func(w *Walker) {
+		w.retainRemoved = true
+		w.cloneRemoved = clone
+	}
+}
+
+// NilMeansUnchanged makes a nil node returned by the walk function leave the
+// node in place, so that only returning Remove removes it. This guards
+// against helpers that forget to return their input when they don't match.
+func NilMeansUnchanged() Option {
+	return func(w *Walker) {
+		w.nilUnchanged = true
+	}
+}
+
+// WithCoverageCheck checks that the walk function was shown every node of
+// the resulting tree and records the nodes it wasn't shown in the report,
+// which points at gaps in the traversal. Subtrees the walk function skipped
+// by returning false, or which it returned in place of the node it was
+// called with, are not checked.
+func WithCoverageCheck() Option {
+	return func(w *Walker) {
+		w.coverage = true
+	}
+}
+
+// checkCoverage records the subtrees of root the walk function wasn't shown.
+func (w *walker) checkCoverage(root ast.Node) {
+	if isNil(root) {
+		return
+	}
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch {
+		case n == nil || w.skipped[n]:
+			return false
+		case !w.shown[n]:
+			w.report.Unvisited = append(w.report.Unvisited, n)
+			return false
+		}
+		return true
+	})
+}
+
+// Remove can be returned by a WalkFunc to remove the node it was called
+// with. Unlike nil, it removes the node under NilMeansUnchanged as well.
+var Remove ast.Node = removeNode{}
+
+type removeNode struct{}
+
+func (removeNode) Pos() token.Pos { return token.NoPos }
+func (removeNode) End() token.Pos { return token.NoPos }
+
+// retain records the removal of node in the report.
+func (w *walker) retain(node ast.Node) {
+	r := Removed{
+		Node: node,
+		Path: append([]ast.Node(nil), w.stack...),
+		Pos:  node.Pos(),
+	}
+	if w.cloneRemoved {
+		r.Node = Clone(node)
+	} else {
+		if w.retained == nil {
+			w.retained = make(map[ast.Node]bool)
+		}
+		w.retained[node] = true
+	}
+	w.report.Removed = append(w.report.Removed, r)
+}
+
+// remove clears the comments of a node removed from a list, so they aren't
+// printed as stray comments. A retained node gets copies of its comment
+// groups in place of the cleared ones.
+func (w *walker) remove(node ast.Node) {
+	if !w.retained[node] {
+		nukeComments(node)
+		return
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			n.Doc, n.Comment = detachComments(n.Doc), detachComments(n.Comment)
+		case *ast.ImportSpec:
+			n.Doc, n.Comment = detachComments(n.Doc), detachComments(n.Comment)
+		case *ast.ValueSpec:
+			n.Doc, n.Comment = detachComments(n.Doc), detachComments(n.Comment)
+		case *ast.TypeSpec:
+			n.Doc, n.Comment = detachComments(n.Doc), detachComments(n.Comment)
+		case *ast.GenDecl:
+			n.Doc = detachComments(n.Doc)
+		case *ast.FuncDecl:
+			n.Doc = detachComments(n.Doc)
+		case *ast.CommentGroup:
+			return false
+		}
+		return true
+	})
+}
+
+// detachComments clears cg and returns a copy of it.
+func detachComments(cg *ast.CommentGroup) *ast.CommentGroup {
+	if cg == nil {
+		return nil
+	}
+	cp := &ast.CommentGroup{List: cg.List}
+	cg.List = nil
+	return cp
+}
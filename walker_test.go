@@ -0,0 +1,155 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestWalkerRemoved(t *testing.T) {
+	src := `package p
+
+func f() {
+	a := 1
+	// b is two.
+	var b = 2 // two
+	println(a, b)
+	println("kept")
+}
+`
+	for _, clone := range []bool{false, true} {
+		fset, file := parse(t, src)
+
+		var stmts []ast.Stmt
+		w := New(func(n ast.Node) (ast.Node, bool) {
+			switch n := n.(type) {
+			case *ast.AssignStmt, *ast.DeclStmt:
+				return nil, false
+			case *ast.ExprStmt:
+				if len(n.X.(*ast.CallExpr).Args) == 2 {
+					return nil, false
+				}
+			case *ast.BlockStmt:
+				stmts = append(stmts, n.List...)
+			}
+			return n, true
+		}, WithRemoved(clone))
+
+		_, report := w.Walk(file)
+		checkSource(t, fset, file, `package p
+
+func f() {
+
+	println("kept")
+}
+`)
+
+		if len(report.Removed) != 3 {
+			t.Fatalf("got %d removed nodes, want 3", len(report.Removed))
+		}
+		// the attached comments are printed with the declaration
+		want := []string{"a := 1", "// b is two.\nvar b = 2 // two\n", "println(a, b)"}
+		for i, r := range report.Removed {
+			if got := render(t, fset, r.Node); got != want[i] {
+				t.Errorf("removed node %d printed as %q, want %q", i, got, want[i])
+			}
+			if r.Pos != stmts[i].Pos() {
+				t.Errorf("removed node %d: got position %v, want %v", i, fset.Position(r.Pos), fset.Position(stmts[i].Pos()))
+			}
+			if clone == (r.Node == ast.Node(stmts[i])) {
+				t.Errorf("removed node %d: got clone %v, want %v", i, !clone, clone)
+			}
+			if len(r.Path) != 3 || r.Path[2] != ast.Node(findFunc(file, "f").Body) {
+				t.Errorf("removed node %d: wrong path %v", i, r.Path)
+			}
+		}
+
+		decl := report.Removed[1].Node.(*ast.DeclStmt).Decl.(*ast.GenDecl)
+		if doc := decl.Doc.Text(); doc != "b is two.\n" {
+			t.Errorf("got doc %q of removed declaration", doc)
+		}
+		if comment := decl.Specs[0].(*ast.ValueSpec).Comment.Text(); comment != "two\n" {
+			t.Errorf("got comment %q of removed declaration", comment)
+		}
+	}
+}
+
+func TestWalkerNilMeansUnchanged(t *testing.T) {
+	src := `package p
+
+func f() {
+	debug("x")
+	g(1, 2)
+}
+`
+	// sloppy returns nil for everything it doesn't handle
+	sloppy := func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.ExprStmt:
+			if call, ok := n.X.(*ast.CallExpr); ok && call.Fun.(*ast.Ident).Name == "debug" {
+				return Remove, false
+			}
+			return n, true
+		case *ast.BlockStmt:
+			return n, true
+		}
+		return nil, true
+	}
+
+	fset, file := parse(t, src)
+	Walk(findFunc(file, "f").Body, sloppy)
+	checkSource(t, fset, file, `package p
+
+func f() {
+
+}
+`)
+
+	fset, file = parse(t, src)
+	New(sloppy, NilMeansUnchanged()).Walk(findFunc(file, "f").Body)
+	checkSource(t, fset, file, `package p
+
+func f() {
+
+	g(1, 2)
+}
+`)
+}
+
+func TestWalkerCoverageCheck(t *testing.T) {
+	_, file := parse(t, `package p
+
+func f() {
+	g := func() { println("skipped") }
+	g()
+}
+
+func (t T) m() { println("method") }
+
+func G[T any](x T) {}
+`)
+
+	// the walk function grafts a node onto the already walked assignment
+	assign := findFunc(file, "f").Body.List[0].(*ast.AssignStmt)
+	grafted := ast.NewIdent("h")
+	w := New(func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return n, false
+		case *ast.CallExpr:
+			if id, ok := n.Fun.(*ast.Ident); ok && id.Name == "g" {
+				assign.Rhs[0] = grafted
+			}
+		}
+		return n, true
+	}, WithCoverageCheck())
+	_, report := w.Walk(file)
+
+	// the bodies of functions with and without receivers and the type
+	// parameters are walked, and the skipped function literal is left out
+	if len(report.Unvisited) != 1 {
+		t.Fatalf("got %d unvisited nodes, want 1: %v", len(report.Unvisited), report.Unvisited)
+	}
+	if report.Unvisited[0] != ast.Node(grafted) {
+		t.Errorf("got unvisited %T, want the grafted identifier", report.Unvisited[0])
+	}
+}
@@ -0,0 +1,187 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// ZeroCheckOption enables a transform of NormalizeZeroChecks.
+type ZeroCheckOption func(*zeroCheckConfig)
+
+type zeroCheckConfig struct {
+	info        *types.Info
+	nilRight    bool
+	parenZero   bool
+	stringEmpty bool
+	sliceNil    bool
+}
+
+// ZeroCheckTypes passes the type information needed by StringLenToEmpty and
+// LenToNil. info must hold Types.
+func ZeroCheckTypes(info *types.Info) ZeroCheckOption {
+	return func(c *zeroCheckConfig) {
+		c.info = info
+	}
+}
+
+// NilOnRight turns nil == x into x == nil, and likewise for !=. It preserves
+// semantics, as evaluating nil has no effect.
+func NilOnRight() ZeroCheckOption {
+	return func(c *zeroCheckConfig) {
+		c.nilRight = true
+	}
+}
+
+// ParenZeroLiterals turns comparisons with the zero value of a composite
+// type written as an empty literal, like T{} == x, into x == (T{}), the form
+// that is valid in the header of an if statement as well. It preserves
+// semantics, as evaluating the literal has no effect.
+func ParenZeroLiterals() ZeroCheckOption {
+	return func(c *zeroCheckConfig) {
+		c.parenZero = true
+	}
+}
+
+// StringLenToEmpty turns len(s) == 0 into s == "" and len(s) != 0 or
+// len(s) > 0 into s != "" for strings s. It preserves semantics and needs
+// ZeroCheckTypes.
+func StringLenToEmpty() ZeroCheckOption {
+	return func(c *zeroCheckConfig) {
+		c.stringEmpty = true
+	}
+}
+
+// LenToNil turns len(s) == 0 into s == nil and len(s) != 0 or len(s) > 0
+// into s != nil for slices and maps s. It does NOT preserve semantics: an
+// empty slice or map that isn't nil used to pass the check and no longer
+// does. Only use it where the values are known to be nil when empty. It
+// needs ZeroCheckTypes.
+func LenToNil() ZeroCheckOption {
+	return func(c *zeroCheckConfig) {
+		c.sliceNil = true
+	}
+}
+
+// NormalizeZeroChecks rewrites the comparisons with zero values below node
+// by the transforms enabled by opts, and returns the number of rewritten
+// comparisons. Without options, nothing is rewritten. The transforms that
+// need types skip operands without type information.
+func NormalizeZeroChecks(node ast.Node, opts ...ZeroCheckOption) int {
+	var c zeroCheckConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	n := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		if b, ok := node.(*ast.BinaryExpr); ok && c.normalize(b) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// normalize rewrites b in place and reports whether it did.
+func (c *zeroCheckConfig) normalize(b *ast.BinaryExpr) bool {
+	switch b.Op {
+	case token.EQL, token.NEQ:
+	case token.GTR, token.LSS:
+		return c.lenCheck(b)
+	default:
+		return false
+	}
+
+	switch {
+	case c.nilRight && isNilIdent(b.X) && !isNilIdent(b.Y):
+		b.X, b.Y = b.Y, b.X
+		return true
+	case c.parenZero && isZeroLit(b.X) && !isZeroLit(b.Y):
+		b.X, b.Y = b.Y, b.X
+		if _, ok := b.Y.(*ast.ParenExpr); !ok {
+			b.Y = &ast.ParenExpr{Lparen: b.Y.Pos(), X: b.Y, Rparen: b.Y.End()}
+		}
+		return true
+	case c.parenZero && isZeroLit(b.Y):
+		if _, ok := b.Y.(*ast.ParenExpr); ok {
+			return false
+		}
+		b.Y = &ast.ParenExpr{Lparen: b.Y.Pos(), X: b.Y, Rparen: b.Y.End()}
+		return true
+	}
+	return c.lenCheck(b)
+}
+
+// lenCheck rewrites the comparison b of a length with 0 as enabled and
+// reports whether it did.
+func (c *zeroCheckConfig) lenCheck(b *ast.BinaryExpr) bool {
+	if c.info == nil || (!c.stringEmpty && !c.sliceNil) {
+		return false
+	}
+
+	// len(s) op 0, or 0 op len(s) with op mirrored
+	call, zero, op := b.X, b.Y, b.Op
+	if isZeroInt(call) {
+		call, zero = zero, call
+		switch op {
+		case token.LSS:
+			op = token.GTR
+		case token.GTR:
+			op = token.LSS
+		}
+	}
+	if !isZeroInt(zero) {
+		return false
+	}
+	switch op {
+	case token.EQL:
+	case token.NEQ, token.GTR:
+		op = token.NEQ
+	default:
+		return false
+	}
+	lenCall, ok := call.(*ast.CallExpr)
+	if !ok || len(lenCall.Args) != 1 || lenCall.Ellipsis.IsValid() {
+		return false
+	}
+	if id, ok := lenCall.Fun.(*ast.Ident); !ok || id.Name != "len" || c.info.Uses[id] != types.Universe.Lookup("len") {
+		return false
+	}
+	s := lenCall.Args[0]
+	typ := c.info.TypeOf(s)
+	if typ == nil {
+		return false
+	}
+
+	var empty ast.Expr
+	switch u := typ.Underlying().(type) {
+	case *types.Basic:
+		if !c.stringEmpty || u.Info()&types.IsString == 0 {
+			return false
+		}
+		empty = &ast.BasicLit{ValuePos: zero.Pos(), Kind: token.STRING, Value: `""`}
+	case *types.Slice, *types.Map:
+		if !c.sliceNil {
+			return false
+		}
+		empty = &ast.Ident{NamePos: zero.Pos(), Name: "nil"}
+	default:
+		return false
+	}
+	b.X, b.Op, b.Y = s, op, empty
+	return true
+}
+
+// isZeroLit reports whether e is an empty composite literal with a type,
+// possibly in parentheses.
+func isZeroLit(e ast.Expr) bool {
+	lit, ok := ast.Unparen(e).(*ast.CompositeLit)
+	return ok && lit.Type != nil && len(lit.Elts) == 0
+}
+
+// isZeroInt reports whether e is the literal 0.
+func isZeroInt(e ast.Expr) bool {
+	lit, ok := e.(*ast.BasicLit)
+	return ok && lit.Kind == token.INT && lit.Value == "0"
+}
@@ -0,0 +1,107 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/types"
+	"testing"
+)
+
+func TestNormalizeZeroChecks(t *testing.T) {
+	src := `package p
+
+type T struct{ a int }
+
+func f(s string, b []byte, m map[string]int, a [2]int, err error, x T) {
+	_ = nil == err
+	_ = err != nil
+	_ = T{} == x
+	_ = x != (T{})
+	_ = x == T{a: 1}
+	_ = len(s) == 0
+	_ = 0 < len(s)
+	_ = len(b) != 0
+	_ = len(m) > 0
+	_ = len(a) == 0
+	_ = len(s) >= 0
+	_ = len(s) == 1
+}
+`
+	check := func(opts ...ZeroCheckOption) (string, int) {
+		fset, file := parse(t, src)
+		info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue), Uses: make(map[*ast.Ident]types.Object)}
+		if _, err := new(types.Config).Check("p", fset, []*ast.File{file}, info); err != nil {
+			t.Fatal(err)
+		}
+		n := NormalizeZeroChecks(file, append(opts, ZeroCheckTypes(info))...)
+		return render(t, fset, findFunc(file, "f").Body), n
+	}
+
+	tests := []struct {
+		opts []ZeroCheckOption
+		n    int
+		want string
+	}{{
+		nil, 0, "",
+	}, {
+		[]ZeroCheckOption{NilOnRight(), ParenZeroLiterals()}, 2, `{
+	_ = err == nil
+	_ = err != nil
+	_ = x == (T{})
+	_ = x != (T{})
+	_ = x == T{a: 1}
+	_ = len(s) == 0
+	_ = 0 < len(s)
+	_ = len(b) != 0
+	_ = len(m) > 0
+	_ = len(a) == 0
+	_ = len(s) >= 0
+	_ = len(s) == 1
+}`,
+	}, {
+		// arrays, other comparisons and other lengths are left alone
+		[]ZeroCheckOption{StringLenToEmpty()}, 2, `{
+	_ = nil == err
+	_ = err != nil
+	_ = T{} == x
+	_ = x != (T{})
+	_ = x == T{a: 1}
+	_ = s == ""
+	_ = s != ""
+	_ = len(b) != 0
+	_ = len(m) > 0
+	_ = len(a) == 0
+	_ = len(s) >= 0
+	_ = len(s) == 1
+}`,
+	}, {
+		[]ZeroCheckOption{LenToNil()}, 2, `{
+	_ = nil == err
+	_ = err != nil
+	_ = T{} == x
+	_ = x != (T{})
+	_ = x == T{a: 1}
+	_ = len(s) == 0
+	_ = 0 < len(s)
+	_ = b != nil
+	_ = m != nil
+	_ = len(a) == 0
+	_ = len(s) >= 0
+	_ = len(s) == 1
+}`,
+	}}
+	for i, tt := range tests {
+		got, n := check(tt.opts...)
+		if n != tt.n {
+			t.Errorf("%d: rewrote %d comparisons, want %d", i, n, tt.n)
+		}
+		if tt.want != "" && got != tt.want {
+			t.Errorf("%d: got:\n%s\nwant:\n%s", i, got, tt.want)
+		}
+	}
+
+	// the length transforms need types
+	_, file := parse(t, src)
+	if n := NormalizeZeroChecks(file, StringLenToEmpty(), LenToNil()); n != 0 {
+		t.Errorf("rewrote %d comparisons without types", n)
+	}
+}